@@ -0,0 +1,254 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+// Package audit records every mutation the bot makes (github API calls and git
+// pushes) to an append-only log file, one JSON entry per line.
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sniperkit/snk.fork.release-git-bot/clock"
+	"github.com/sniperkit/snk.fork.release-git-bot/ghclient"
+)
+
+// Entry is one mutation.
+type Entry struct {
+	Time time.Time `json:"time"`
+	// Actor is the github user making the change.
+	Actor string `json:"actor"`
+	// Method is the http method, or "GIT" for git operations.
+	Method string `json:"method"`
+	// Endpoint is the API path, or the remote url for git operations.
+	Endpoint string `json:"endpoint"`
+	// Payload is a summary of the request body, e.g. the title and branches
+	// of a pull request. Long values are replaced by their length.
+	Payload string `json:"payload,omitempty"`
+	// Status is the http status code, 0 if the request failed or for git
+	// operations.
+	Status int `json:"status,omitempty"`
+	// Result is the url of the created or changed object, if any.
+	Result string `json:"result,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Log is an append-only audit log. A nil Log records nothing.
+type Log struct {
+	// Redact, if not nil, scrubs the secrets from each line before it's
+	// written.
+	Redact func([]byte) []byte
+	// Clock is the time of the entries. If nil, it's clock.Real.
+	Clock clock.Clock
+
+	path string
+
+	mu sync.Mutex
+	// f is opened on the first entry, so the runs changing nothing don't
+	// create the file.
+	f       *os.File
+	actor   string
+	entries []*Entry
+}
+
+// Open returns the audit log at path. The file is opened for appending, and
+// created if it doesn't exist, on the first entry.
+func Open(path string) (*Log, error) {
+	if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+		return nil, fmt.Errorf("failed to open audit log: %v is a directory", path)
+	}
+	return &Log{path: path}, nil
+}
+
+// SetActor sets the actor of the following entries.
+func (l *Log) SetActor(actor string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	l.actor = actor
+	l.mu.Unlock()
+}
+
+// Record appends e to the log. Time and Actor are set if they are empty.
+func (l *Log) Record(e *Entry) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e.Time.IsZero() {
+		e.Time = clock.Or(l.Clock).Now().UTC()
+	}
+	if e.Actor == "" {
+		e.Actor = l.actor
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if l.Redact != nil {
+		b = l.Redact(b)
+	}
+	l.entries = append(l.entries, e)
+	if l.f == nil {
+		if l.f, err = os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644); err != nil {
+			return fmt.Errorf("failed to open audit log: %v", err)
+		}
+	}
+	if _, err := l.f.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit log: %v", err)
+	}
+	return nil
+}
+
+// Entries returns the entries recorded by this process.
+func (l *Log) Entries() []*Entry {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]*Entry(nil), l.entries...)
+}
+
+// Summary returns a markdown summary of the entries recorded by this process,
+// e.g. to be posted on the tracking issue.
+func (l *Log) Summary() string {
+	entries := l.Entries()
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "The release bot made %v changes:\n\n", len(entries))
+	b.WriteString("| time | actor | operation | result |\n|---|---|---|---|\n")
+	for _, e := range entries {
+		result := e.Result
+		if e.Error != "" {
+			result = "failed: " + e.Error
+		} else if result == "" && e.Status != 0 {
+			result = fmt.Sprint(e.Status)
+		}
+		fmt.Fprintf(&b, "| %v | %v | `%v %v` | %v |\n", e.Time.Format(time.RFC3339), e.Actor, e.Method, e.Endpoint, strings.Replace(result, "|", `\|`, -1))
+	}
+	return b.String()
+}
+
+// Close closes the log file.
+func (l *Log) Close() error {
+	if l == nil || l.f == nil {
+		return nil
+	}
+	return l.f.Close()
+}
+
+// Client returns a copy of hc with a transport that records every mutating
+// request (POST, PATCH, PUT and DELETE, except the GraphQL queries). If hc is
+// nil, a new client with the default transport is returned.
+func (l *Log) Client(hc *http.Client) *http.Client {
+	if l == nil {
+		return hc
+	}
+	var ret http.Client
+	if hc != nil {
+		ret = *hc
+	}
+	base := ret.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	ret.Transport = &transport{l: l, base: base}
+	return &ret
+}
+
+type transport struct {
+	l    *Log
+	base http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch req.Method {
+	case http.MethodPost, http.MethodPatch, http.MethodPut, http.MethodDelete:
+	default:
+		return t.base.RoundTrip(req)
+	}
+	if ghclient.IsGraphQLQuery(req) {
+		// A POST, but only a read.
+		return t.base.RoundTrip(req)
+	}
+	e := &Entry{Method: req.Method, Endpoint: req.URL.Path}
+	switch {
+	case req.Body != nil && req.GetBody != nil:
+		if body, err := req.GetBody(); err == nil {
+			b, _ := ioutil.ReadAll(body)
+			body.Close()
+			e.Payload = summarize(req.Header.Get("Content-Type"), b)
+		}
+	case req.ContentLength > 0:
+		// Not replayable, e.g. an uploaded file.
+		e.Payload = fmt.Sprintf("<%v bytes %v>", req.ContentLength, req.Header.Get("Content-Type"))
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		e.Error = err.Error()
+		t.l.Record(e)
+		return nil, err
+	}
+	e.Status = resp.StatusCode
+	if resp.StatusCode >= 300 {
+		e.Error = resp.Status
+	}
+	// Read the url of the result, and put the body back for the caller.
+	b, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(b))
+	if err == nil {
+		var result struct {
+			HTMLURL string `json:"html_url"`
+			URL     string `json:"url"`
+		}
+		if json.Unmarshal(b, &result) == nil {
+			e.Result = result.HTMLURL
+			if e.Result == "" {
+				e.Result = result.URL
+			}
+		}
+	}
+	t.l.Record(e)
+	return resp, nil
+}
+
+// maxValue is the max length of a payload value kept in the summary.
+const maxValue = 80
+
+// summarize returns the top level fields of a json body, with long values
+// replaced by their length. Other bodies are summarized by their size.
+func summarize(contentType string, b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	var fields map[string]interface{}
+	if !strings.HasPrefix(contentType, "application/json") || json.Unmarshal(b, &fields) != nil {
+		return fmt.Sprintf("<%v bytes %v>", len(b), contentType)
+	}
+	var keys []string
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var ss []string
+	for _, k := range keys {
+		v, _ := json.Marshal(fields[k])
+		if len(v) > maxValue {
+			v = []byte(fmt.Sprintf("<%v bytes>", len(v)))
+		}
+		ss = append(ss, fmt.Sprintf("%v=%s", k, v))
+	}
+	return strings.Join(ss, " ")
+}
@@ -0,0 +1,42 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package audit
+
+import (
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestClientSkipsGraphQLQueries(t *testing.T) {
+	l, err := Open(filepath.Join(t.TempDir(), "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	hc := l.Client(&http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Status: "200 OK", Body: http.NoBody}, nil
+	})})
+
+	for _, body := range []string{
+		`{"query": "query { viewer { login } }"}`,
+		`{"query": "mutation { addComment(input: {}) { clientMutationId } }"}`,
+	} {
+		resp, err := hc.Post("https://api.github.com/graphql", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Post(%v) failed: %v", body, err)
+		}
+		resp.Body.Close()
+	}
+
+	entries := l.Entries()
+	if len(entries) != 1 || !strings.Contains(entries[0].Payload, "mutation") {
+		t.Errorf("Entries() = %v entries, want only the mutation", len(entries))
+	}
+}
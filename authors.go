@@ -0,0 +1,62 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package main
+
+import (
+	"github.com/sniperkit/snk.fork.release-git-bot/cache"
+	"github.com/sniperkit/snk.fork.release-git-bot/ghclient"
+	"github.com/sniperkit/snk.fork.release-git-bot/notes"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// identity is the cached name and email of a user.
+type identity struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// resolveAuthors fills the names and emails of the entry authors, unless
+// disabled by -authors=false. Each user is fetched once, and cached in c.
+func resolveAuthors(upstream *ghclient.Client, c *cache.Cache, ns *notes.Notes) {
+	if !*authors {
+		return
+	}
+	// The entries of the sections are also in the changes, unless the notes
+	// were decoded from an older version.
+	entries := ns.Changes
+	for _, s := range ns.Sections {
+		entries = append(entries, s.Entries...)
+	}
+	resolved := make(map[string]*identity)
+	for _, e := range entries {
+		if e.User == nil || e.User.Login == "" {
+			continue
+		}
+		id, ok := resolved[e.User.Login]
+		if !ok {
+			id = lookupIdentity(upstream, c, e.User.Login)
+			resolved[e.User.Login] = id
+		}
+		e.User.Name, e.User.Email = id.Name, id.Email
+	}
+}
+
+func lookupIdentity(upstream *ghclient.Client, c *cache.Cache, login string) *identity {
+	key := "user/" + login
+	id := new(identity)
+	if c.Get(key, id) {
+		return id
+	}
+	name, email, err := upstream.GetUserIdentityContext(runCtx, login)
+	if err != nil {
+		log.Warningf("failed to resolve the name of %v: %v", login, err)
+		return id
+	}
+	id.Name, id.Email = name, email
+	if err := c.Put(key, id); err != nil {
+		log.Warningf("failed to cache the name of %v: %v", login, err)
+	}
+	return id
+}
@@ -0,0 +1,155 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/olekukonko/tablewriter"
+	"github.com/sniperkit/snk.fork.release-git-bot/clock"
+	"github.com/sniperkit/snk.fork.release-git-bot/config"
+	"github.com/sniperkit/snk.fork.release-git-bot/ghclient"
+	"github.com/sniperkit/snk.fork.release-git-bot/state"
+	"github.com/sniperkit/snk.fork.release-git-bot/version"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Defaults of the branch cut announcement.
+const (
+	defaultOptOutLabel    = "no-branch-cut-notice"
+	defaultNoticeBatch    = 20
+	defaultNoticeInterval = time.Minute
+)
+
+// announceBranchCut comments on the open PRs of the milestone of the release
+// that the release branch is cut, with how to backport them and the status of
+// the merge window. The PRs are commented in batches, pausing between them so
+// a large milestone doesn't trip the github secondary rate limits, and the
+// commented PRs are kept in the state, so they are not commented again on
+// resume.
+func announceBranchCut(bc *config.BranchCut, st *state.State, upstream *ghclient.Client, ver *version.Version, branch, mainline string) error {
+	optOut := bc.OptOutLabel
+	if optOut == "" {
+		optOut = defaultOptOutLabel
+	}
+	batch := bc.BatchSize
+	if batch <= 0 {
+		batch = defaultNoticeBatch
+	}
+	interval := defaultNoticeInterval
+	if bc.BatchInterval != "" {
+		d, err := time.ParseDuration(bc.BatchInterval)
+		if err != nil {
+			return fmt.Errorf("invalid branch_cut batch_interval %q: %v", bc.BatchInterval, err)
+		}
+		interval = d
+	}
+
+	prs, m, err := upstream.GetOpenPRsForMilestoneContext(runCtx, ver.Milestone(), milestoneAliases(ver)...)
+	if err != nil {
+		return fmt.Errorf("failed to get the open PRs of the milestone: %v", err)
+	}
+	sha, err := upstream.GetCommitSHAContext(runCtx, branch)
+	if err != nil {
+		return fmt.Errorf("failed to get the head of %v: %v", branch, err)
+	}
+	body := branchCutNotice(bc, ver, m, branch, mainline, sha, len(prs), optOut)
+
+	var commented, skipped int
+	for _, pr := range prs {
+		key := fmt.Sprintf("branch_cut_notice_%v", pr.GetNumber())
+		if st.Get(key) != "" || st.Get(retargetedKey(pr.GetNumber())) != "" {
+			continue
+		}
+		if hasLabel(pr, optOut) {
+			skipped++
+			continue
+		}
+		if commented > 0 && commented%batch == 0 {
+			fmt.Printf("Commented on %v PRs, pausing %v\n", commented, interval)
+			clock.Sleep(botClock, interval)
+		}
+		url, err := upstream.CreateIssueCommentContext(runCtx, pr.GetNumber(), body)
+		if err != nil {
+			return fmt.Errorf("failed to comment on #%v: %v", pr.GetNumber(), err)
+		}
+		st.Set(key, url)
+		commented++
+	}
+	fmt.Printf("Branch cut announced on %v open PRs of %q, %v opted out\n", commented, m.GetTitle(), skipped)
+	return nil
+}
+
+// retargetPRs retargets the open PRs to the mainline with the retarget label
+// to the release branch, comments why on each, and prints a report. The
+// retargeted PRs are kept in the state, so announceBranchCut skips them.
+func retargetPRs(bc *config.BranchCut, st *state.State, upstream *ghclient.Client, ver *version.Version, branch, mainline string) error {
+	label := versionReplacer(ver).Replace(bc.RetargetLabel)
+	prs, err := upstream.ListOpenPullRequestsWithLabelContext(runCtx, mainline, label)
+	if err != nil {
+		return fmt.Errorf("failed to list the open PRs to %v labeled %q: %v", mainline, label, err)
+	}
+	report := tablewriter.NewWriter(os.Stdout)
+	report.SetHeader([]string{"PR", "title", "retargeted", "why"})
+	var n int
+	for _, pr := range prs {
+		why := fmt.Sprintf("labeled %q", label)
+		if err := upstream.RetargetPullRequestContext(runCtx, pr.GetNumber(), branch); err != nil {
+			return fmt.Errorf("failed to retarget #%v: %v", pr.GetNumber(), err)
+		}
+		st.Set(retargetedKey(pr.GetNumber()), why)
+		body := fmt.Sprintf("The release branch `%v` was cut from `%v`. This PR is %v, so it's retargeted to `%v`, for %v.", branch, mainline, why, branch, ver.Tag())
+		if _, err := upstream.CreateIssueCommentContext(runCtx, pr.GetNumber(), body); err != nil {
+			log.Warningf("failed to comment on #%v: %v", pr.GetNumber(), err)
+		}
+		report.Append([]string{fmt.Sprintf("#%v", pr.GetNumber()), pr.GetTitle(), mainline + " -> " + branch, why})
+		n++
+	}
+	if n == 0 {
+		fmt.Printf("No open PR to %v is labeled %q, none retargeted\n", mainline, label)
+		return nil
+	}
+	report.Render()
+	return nil
+}
+
+// retargetedKey is the state key of the PR retargeted by retargetPRs.
+func retargetedKey(number int) string {
+	return fmt.Sprintf("retargeted_%v", number)
+}
+
+// branchCutNotice returns the comment announcing the branch cut to the open
+// PRs of the milestone.
+func branchCutNotice(bc *config.BranchCut, ver *version.Version, m *github.Milestone, branch, mainline, sha string, open int, optOut string) string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "The release branch `%v` was cut from `%v` at %v, for the %v milestone.\n\n", branch, mainline, sha, m.GetTitle())
+	fmt.Fprintf(&b, "This PR is still open, so it won't be in %v unless it's backported: ", ver.Tag())
+	if bc.BackportLabel != "" {
+		fmt.Fprintf(&b, "once it's merged on `%v`, add the `%v` label to have it cherry-picked to `%v`.", mainline, versionReplacer(ver).Replace(bc.BackportLabel), branch)
+	} else {
+		fmt.Fprintf(&b, "once it's merged on `%v`, ask a maintainer to cherry-pick it to `%v`.", mainline, branch)
+	}
+	fmt.Fprintf(&b, " Otherwise, it will be in the next release.\n\n")
+	fmt.Fprintf(&b, "Merge window: %v PRs of the milestone are still open", open)
+	if m.DueOn != nil {
+		fmt.Fprintf(&b, ", and it's due on %v", formatDate(m.GetDueOn()))
+	}
+	fmt.Fprintf(&b, ".\n\n_To stop these notices on a PR, add the `%v` label._\n", optOut)
+	return b.String()
+}
+
+// hasLabel returns whether the issue has the label.
+func hasLabel(i *github.Issue, label string) bool {
+	for _, l := range i.Labels {
+		if l.GetName() == label {
+			return true
+		}
+	}
+	return false
+}
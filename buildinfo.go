@@ -0,0 +1,97 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/sniperkit/snk.fork.release-git-bot/buildinfo"
+	"github.com/sniperkit/snk.fork.release-git-bot/config"
+	"github.com/sniperkit/snk.fork.release-git-bot/features"
+)
+
+// The version command lists the commands, so it's added in init to break the
+// initialization cycle.
+func init() {
+	commands["version"] = &command{
+		usage:    "print the version of the bot, its backends, commands and enabled features, as text or -format json for wrapper scripts",
+		run:      runVersion,
+		readOnly: true,
+	}
+}
+
+// runVersion prints the version of the bot, its backends and commands, and
+// the optional features enabled by the flags and config.
+func runVersion(cfg *config.Config, args []string) error {
+	fs := newFlagSet("version")
+	format := fs.String("format", "text", "output format, text or json")
+	fs.Parse(args)
+
+	info := buildinfo.New(commandNames(), enabledFeatures(cfg))
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(info)
+	}
+	fmt.Printf("release-git-bot %v", info.Version)
+	if info.Commit != "" {
+		fmt.Printf(" (%v)", info.Commit)
+	}
+	if info.Date != "" {
+		fmt.Printf(" built %v", info.Date)
+	}
+	fmt.Printf("\n%v %v\n", info.GoVersion, info.Platform)
+	fmt.Printf("backends: %v\n", strings.Join(info.Backends, ", "))
+	fmt.Printf("commands: %v\n", strings.Join(info.Commands, ", "))
+	var names []string
+	for name := range info.Features {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Println("features:")
+	for _, name := range names {
+		fmt.Printf("  %-16v %v\n", name, info.Features[name])
+	}
+	return nil
+}
+
+// commandNames returns the names of the commands, sorted.
+func commandNames() []string {
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// enabledFeatures returns the optional features of the bot, and whether the
+// flags and config of the run enable them.
+func enabledFeatures(cfg *config.Config) map[string]bool {
+	ret := map[string]bool{
+		"github_app":       *appID != 0,
+		"tracing":          tracer != nil,
+		"audit":            auditLog != nil,
+		"policy":           cfg.Policy != nil || cfg.OPA != nil,
+		"encrypted_state":  stateKey != nil,
+		"etag_cache":       *etagCache,
+		"read_only":        *readOnly,
+		"graphql":          cfg.API != nil && cfg.API.GraphQL,
+		"github_automerge": *mergeMethod != "" && *autoMerge,
+		"wait_checks":      *waitChecks != 0,
+		"channels":         len(cfg.Channels) > 0,
+		"images":           len(cfg.Images) > 0,
+		"packages":         len(cfg.Packages) > 0,
+		"webhooks":         len(cfg.Webhooks) > 0,
+	}
+	// The experimental features.
+	for name := range features.Known {
+		ret[name] = featureFlags.Enabled(name)
+	}
+	return ret
+}
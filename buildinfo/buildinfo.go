@@ -0,0 +1,84 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+// Package buildinfo reports the version of the bot binary and its
+// capabilities, so wrapper scripts can check they are compatible with it
+// before running a flow, e.g. with "release-git-bot version -format json".
+//
+// The version is set at build time:
+//
+//	go build -ldflags "-X github.com/sniperkit/snk.fork.release-git-bot/buildinfo.Version=1.2.0 -X github.com/sniperkit/snk.fork.release-git-bot/buildinfo.Commit=$(git rev-parse HEAD)"
+package buildinfo
+
+import (
+	"runtime"
+	"strings"
+
+	"github.com/blang/semver"
+)
+
+// Set with -ldflags -X at build time.
+var (
+	// Version is the version of the bot, without the "v" prefix. It's "dev"
+	// for local builds.
+	Version = "dev"
+	// Commit is the commit the bot is built from, empty if unknown.
+	Commit = ""
+	// Date is the build time, in RFC 3339, empty if unknown.
+	Date = ""
+)
+
+// Backends are the code hosts the bot can release on.
+var Backends = []string{"github"}
+
+// Info is the version and capabilities of the bot.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	Date      string `json:"date,omitempty"`
+	GoVersion string `json:"go_version"`
+	// Platform is "<GOOS>/<GOARCH>".
+	Platform string   `json:"platform"`
+	Backends []string `json:"backends"`
+	// Commands are the subcommands of the bot, sorted.
+	Commands []string `json:"commands"`
+	// Features are the optional features, and whether they are enabled by
+	// the flags and config of the run.
+	Features map[string]bool `json:"features"`
+}
+
+// New returns the Info of the binary, with the commands and the features.
+func New(commands []string, features map[string]bool) *Info {
+	return &Info{
+		Version:   Version,
+		Commit:    Commit,
+		Date:      Date,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+		Backends:  Backends,
+		Commands:  commands,
+		Features:  features,
+	}
+}
+
+// IsDev returns whether the binary is a local build, without a version.
+func IsDev() bool {
+	return Version == "dev"
+}
+
+// AtLeast returns whether the version of the bot is min or later, e.g.
+// AtLeast("1.2.0"). Dev builds are assumed to be the latest.
+func AtLeast(min string) (bool, error) {
+	if IsDev() {
+		return true, nil
+	}
+	want, err := semver.Parse(strings.TrimPrefix(min, "v"))
+	if err != nil {
+		return false, err
+	}
+	v, err := semver.Parse(strings.TrimPrefix(Version, "v"))
+	if err != nil {
+		return false, err
+	}
+	return v.GTE(want), nil
+}
@@ -0,0 +1,57 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/sniperkit/snk.fork.release-git-bot/gitwrapper"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// maxChecksOutput keeps the pull request body under the github limit (65536
+// characters).
+const maxChecksOutput = 60000
+
+// runBumpChecks exports the current branch of local to a temp dir and runs the
+// checks in it with sh, one by one. It returns the combined output of the
+// checks run, and an error for the first failed check.
+func runBumpChecks(local *gitwrapper.Repo, checks []string) (string, error) {
+	dir, err := ioutil.TempDir("", "release-git-bot-checks")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+	if err := local.Export(dir); err != nil {
+		return "", fmt.Errorf("failed to export the change: %v", err)
+	}
+
+	var out bytes.Buffer
+	for _, c := range checks {
+		log.Infof("executing %q", c)
+		fmt.Fprintf(&out, "$ %v\n", c)
+		cmd := exec.Command("sh", "-c", c)
+		cmd.Dir = dir
+		cmd.Stdout = &out
+		cmd.Stderr = &out
+		if err := cmd.Run(); err != nil {
+			return out.String(), fmt.Errorf("%q failed: %v", c, err)
+		}
+	}
+	return out.String(), nil
+}
+
+// bumpChecksBody returns the pull request body with the checks output.
+func bumpChecksBody(out string) string {
+	if len(out) > maxChecksOutput {
+		out = "...\n" + out[len(out)-maxChecksOutput:]
+	}
+	return fmt.Sprintf("The change passed the checks before the pull request was opened:\n\n<details><summary>output</summary>\n\n```\n%v\n```\n\n</details>\n", strings.TrimRight(out, "\n"))
+}
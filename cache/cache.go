@@ -0,0 +1,76 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+// Package cache stores github data that doesn't change (e.g. merged PRs) on
+// disk, so it doesn't need to be fetched again.
+//
+// A nil *Cache is valid and caches nothing.
+package cache
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sniperkit/snk.fork.release-git-bot/seal"
+)
+
+// Cache is a directory of json files, one per key.
+type Cache struct {
+	dir string
+	key *seal.Key
+}
+
+// New creates a cache in dir. If dir is "", the user cache dir is used. If key
+// is not nil, the files are encrypted with it.
+func New(dir string, key *seal.Key) (*Cache, error) {
+	if dir == "" {
+		userDir, err := os.UserCacheDir()
+		if err != nil {
+			return nil, err
+		}
+		dir = filepath.Join(userDir, "release-git-bot")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Cache{dir: dir, key: key}, nil
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.dir, strings.Replace(key, "/", "_", -1)+".json")
+}
+
+// Get reads the value for key into v. It returns false if the key is not
+// cached.
+func (c *Cache) Get(key string, v interface{}) bool {
+	if c == nil {
+		return false
+	}
+	b, err := ioutil.ReadFile(c.path(key))
+	if err != nil {
+		return false
+	}
+	// Entries that can't be decrypted (e.g. the key changed) are misses.
+	if b, err = c.key.Open(b); err != nil {
+		return false
+	}
+	return json.Unmarshal(b, v) == nil
+}
+
+// Put stores v for key.
+func (c *Cache) Put(key string, v interface{}) error {
+	if c == nil {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if b, err = c.key.Seal(b); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(c.path(key), b, 0600)
+}
@@ -0,0 +1,101 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/sniperkit/snk.fork.release-git-bot/changelog"
+	"github.com/sniperkit/snk.fork.release-git-bot/config"
+	"github.com/sniperkit/snk.fork.release-git-bot/notes"
+)
+
+// changelogSections maps the notes labels to the Keep a Changelog sections.
+// PRs with other labels are not added.
+var changelogSections = map[string]string{
+	"Feature":         "Added",
+	"API Change":      "Changed",
+	"Behavior Change": "Changed",
+	"Dependencies":    "Changed",
+	"Performance":     "Changed",
+	"Documentation":   "Changed",
+	"Bug":             "Fixed",
+}
+
+func runChangelog(cfg *config.Config, args []string) error {
+	fs := newFlagSet("changelog")
+	file := fs.String("file", "CHANGELOG.md", "the changelog to update, created if it doesn't exist")
+	audience := fs.String("audience", "user", `the entries to add: "user" for the entries of the release notes, "developer" for every PR, including the ones left out of the notes`)
+	roll := fs.Bool("roll", true, "move the Unreleased entries into a block for -version. If false, the entries are only added to Unreleased")
+	fs.Parse(args)
+	if *audience != "user" && *audience != "developer" {
+		return fmt.Errorf("unknown audience %q", *audience)
+	}
+
+	ver, err := versionScheme.Parse(*newVersion)
+	if err != nil {
+		return fmt.Errorf("invalid version string %q: %v", *newVersion, err)
+	}
+	b, err := ioutil.ReadFile(*file)
+	if os.IsNotExist(err) {
+		b, err = []byte("# Changelog\n"), nil
+	}
+	if err != nil {
+		return err
+	}
+	c, err := changelog.Parse(b)
+	if err != nil {
+		return fmt.Errorf("failed to parse %v: %v", *file, err)
+	}
+
+	upstream := newClient(upstreamUser, *repo)
+	ns, _ := releaseNote(upstream, ver)
+	if *audience == "developer" {
+		addChanges(c, ns)
+	} else {
+		addNotes(c, ns)
+	}
+	if *roll {
+		date := ns.Date
+		if date.IsZero() {
+			date = botClock.Now()
+		}
+		if err := c.Roll(ver.String(), ver.Tag(), date.In(releaseZone).Format("2006-01-02")); err != nil {
+			return err
+		}
+	}
+	if err := ioutil.WriteFile(*file, c.Bytes(), 0644); err != nil {
+		return err
+	}
+	fmt.Println("Changelog updated: ", *file)
+	return nil
+}
+
+// addNotes adds the entries of the notes to the Unreleased block of the
+// changelog, in the sections of their labels.
+func addNotes(c *changelog.Changelog, ns *notes.Notes) {
+	for _, s := range ns.Sections {
+		section, ok := changelogSections[s.LabelName]
+		if !ok {
+			continue
+		}
+		for _, e := range s.Entries {
+			c.Add(section, fmt.Sprintf("%v (#%v)", e.Title, e.IssueNumber))
+		}
+	}
+}
+
+// addChanges adds every PR of the notes to the Unreleased block of the
+// changelog. PRs with labels that have no section are added to "Changed".
+func addChanges(c *changelog.Changelog, ns *notes.Notes) {
+	for _, e := range ns.Changes {
+		section, ok := changelogSections[e.Label]
+		if !ok {
+			section = "Changed"
+		}
+		c.Add(section, fmt.Sprintf("%v (#%v)", e.Title, e.IssueNumber))
+	}
+}
@@ -0,0 +1,268 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+// Package changelog parses and writes changelogs in the Keep a Changelog
+// format (https://keepachangelog.com), so release entries can be inserted in
+// the right sections of an existing CHANGELOG.md:
+//
+//	# Changelog
+//
+//	## [Unreleased]
+//
+//	### Added
+//
+//	- credentials: support ALTS handshaker (#2110)
+//
+//	## [1.13.0] - 2018-06-19
+//	...
+//
+//	[Unreleased]: https://github.com/grpc/grpc-go/compare/v1.13.0...HEAD
+package changelog
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Unreleased is the version of the block of unreleased changes.
+const Unreleased = "Unreleased"
+
+// SectionOrder is the order of the sections in a release block.
+var SectionOrder = []string{"Added", "Changed", "Deprecated", "Removed", "Fixed", "Security"}
+
+// Changelog is a parsed changelog.
+type Changelog struct {
+	// Header is the text before the first release, e.g. the title and the
+	// format notice.
+	Header []string
+	// Releases are the release blocks, newest first, usually starting with
+	// Unreleased.
+	Releases []*Release
+	// Links are the link reference definitions at the end, e.g.
+	// "[1.13.0]: https://github.com/grpc/grpc-go/compare/v1.12.0...v1.13.0".
+	Links []string
+}
+
+// Release is the block of a release.
+type Release struct {
+	Version string
+	// Date is e.g. "2018-07-31", empty for Unreleased.
+	Date string
+	// Text is the text before the first section, if any.
+	Text     []string
+	Sections []*Section
+
+	// heading is the parsed heading line, written back unchanged.
+	heading string
+}
+
+// Section is a section of a release, e.g. "Added".
+type Section struct {
+	Name string
+	// Entries are the list items, without the "- " marker. Entries spanning
+	// several lines keep their continuation lines.
+	Entries []string
+}
+
+var (
+	headingRE = regexp.MustCompile(`^##\s+\[?([^\]\s]+)\]?(?:\s+-\s+(.+))?\s*$`)
+	linkRE    = regexp.MustCompile(`^\[[^\]]+\]:\s*\S`)
+	bulletRE  = regexp.MustCompile(`^[-*+]\s+`)
+)
+
+// Parse parses a changelog.
+func Parse(b []byte) (*Changelog, error) {
+	c := new(Changelog)
+	var (
+		r *Release
+		s *Section
+	)
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		switch {
+		case strings.HasPrefix(line, "## "):
+			m := headingRE.FindStringSubmatch(line)
+			if m == nil {
+				return nil, fmt.Errorf("line %v: invalid release heading %q", n, line)
+			}
+			r = &Release{Version: m[1], Date: m[2], heading: line}
+			s = nil
+			c.Releases = append(c.Releases, r)
+		case r == nil:
+			c.Header = append(c.Header, line)
+		case linkRE.MatchString(line):
+			c.Links = append(c.Links, line)
+		case strings.HasPrefix(line, "### "):
+			s = &Section{Name: strings.TrimSpace(strings.TrimPrefix(line, "### "))}
+			r.Sections = append(r.Sections, s)
+		case line == "":
+		case s == nil:
+			r.Text = append(r.Text, line)
+		case bulletRE.MatchString(line):
+			s.Entries = append(s.Entries, bulletRE.ReplaceAllString(line, ""))
+		case len(s.Entries) > 0:
+			// A continuation of the previous entry.
+			s.Entries[len(s.Entries)-1] += "\n" + line
+		default:
+			return nil, fmt.Errorf("line %v: %q in section %q is not a list item", n, line, s.Name)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Bytes returns the changelog in the Keep a Changelog format.
+func (c *Changelog) Bytes() []byte {
+	var buf bytes.Buffer
+	header := trimBlank(c.Header)
+	for _, l := range header {
+		buf.WriteString(l + "\n")
+	}
+	for _, r := range c.Releases {
+		if buf.Len() > 0 {
+			buf.WriteString("\n")
+		}
+		buf.WriteString(r.headingLine() + "\n")
+		if len(r.Text) > 0 {
+			buf.WriteString("\n" + strings.Join(r.Text, "\n") + "\n")
+		}
+		for _, s := range r.Sections {
+			if len(s.Entries) == 0 {
+				continue
+			}
+			fmt.Fprintf(&buf, "\n### %v\n\n", s.Name)
+			for _, e := range s.Entries {
+				buf.WriteString("- " + e + "\n")
+			}
+		}
+	}
+	if len(c.Links) > 0 {
+		buf.WriteString("\n" + strings.Join(c.Links, "\n") + "\n")
+	}
+	return buf.Bytes()
+}
+
+func (r *Release) headingLine() string {
+	if r.heading != "" {
+		return r.heading
+	}
+	if r.Date == "" {
+		return fmt.Sprintf("## [%v]", r.Version)
+	}
+	return fmt.Sprintf("## [%v] - %v", r.Version, r.Date)
+}
+
+// trimBlank removes the leading and trailing blank lines.
+func trimBlank(lines []string) []string {
+	for len(lines) > 0 && lines[0] == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// Release returns the block of the version, nil if there's none.
+func (c *Changelog) Release(version string) *Release {
+	for _, r := range c.Releases {
+		if strings.EqualFold(r.Version, version) {
+			return r
+		}
+	}
+	return nil
+}
+
+// unreleased returns the Unreleased block, and adds it first if there's none.
+func (c *Changelog) unreleased() *Release {
+	if r := c.Release(Unreleased); r != nil {
+		return r
+	}
+	r := &Release{Version: Unreleased}
+	c.Releases = append([]*Release{r}, c.Releases...)
+	return r
+}
+
+// Section returns the section with the name, and adds it in the order of
+// SectionOrder if it doesn't exist.
+func (r *Release) Section(name string) *Section {
+	for _, s := range r.Sections {
+		if s.Name == name {
+			return s
+		}
+	}
+	s := &Section{Name: name}
+	at := len(r.Sections)
+	for i, existing := range r.Sections {
+		if orderOf(existing.Name) > orderOf(name) {
+			at = i
+			break
+		}
+	}
+	r.Sections = append(r.Sections, nil)
+	copy(r.Sections[at+1:], r.Sections[at:])
+	r.Sections[at] = s
+	return s
+}
+
+// orderOf returns the index of the section name in SectionOrder, unknown
+// sections go last.
+func orderOf(name string) int {
+	for i, n := range SectionOrder {
+		if n == name {
+			return i
+		}
+	}
+	return len(SectionOrder)
+}
+
+// Add adds the entry to the section of the Unreleased block, unless the
+// section has it already.
+func (c *Changelog) Add(section, entry string) {
+	s := c.unreleased().Section(section)
+	for _, e := range s.Entries {
+		if e == entry {
+			return
+		}
+	}
+	s.Entries = append(s.Entries, entry)
+}
+
+var unreleasedLinkRE = regexp.MustCompile(`(?i)^\[unreleased\]:\s*(.*/compare/)(.+)\.\.\.HEAD$`)
+
+// Roll moves the Unreleased entries into a new block for the version and
+// date, released as tag, and leaves Unreleased empty. If the Unreleased link
+// compares the previous tag with HEAD, it's moved to the new tag, and a link
+// comparing the previous and the new tag is added for the version.
+func (c *Changelog) Roll(version, tag, date string) error {
+	if c.Release(version) != nil {
+		return fmt.Errorf("changelog already has a %v release", version)
+	}
+	u := c.unreleased()
+	r := &Release{Version: version, Date: date, Text: u.Text, Sections: u.Sections}
+	u.Text, u.Sections = nil, nil
+	for i, rr := range c.Releases {
+		if rr == u {
+			c.Releases = append(c.Releases[:i+1], append([]*Release{r}, c.Releases[i+1:]...)...)
+			break
+		}
+	}
+
+	for i, l := range c.Links {
+		m := unreleasedLinkRE.FindStringSubmatch(l)
+		if m == nil {
+			continue
+		}
+		base, prev := m[1], m[2]
+		c.Links[i] = fmt.Sprintf("[Unreleased]: %v%v...HEAD", base, tag)
+		c.Links = append(c.Links[:i+1], append([]string{fmt.Sprintf("[%v]: %v%v...%v", version, base, prev, tag)}, c.Links[i+1:]...)...)
+		break
+	}
+	return nil
+}
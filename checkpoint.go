@@ -0,0 +1,97 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime/debug"
+	"strings"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/sniperkit/snk.fork.release-git-bot/state"
+	survey "gopkg.in/AlecAivazis/survey.v1"
+	"gopkg.in/AlecAivazis/survey.v1/terminal"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// interrupted is set to 1 when SIGINT or SIGTERM is received, and
+// interruptCh is closed, to stop the waits.
+var (
+	interrupted int32
+	interruptCh = make(chan struct{})
+)
+
+// handleSignals makes SIGINT and SIGTERM stop the bot after the current step,
+// instead of killing it in the middle of a change. A second signal exits
+// immediately.
+func handleSignals() {
+	ch := make(chan os.Signal, 2)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ch
+		atomic.StoreInt32(&interrupted, 1)
+		close(interruptCh)
+		fmt.Println("\nInterrupted, stopping after the current step. Interrupt again to exit immediately.")
+		<-ch
+		os.Exit(1)
+	}()
+}
+
+// runStep runs the step f, unless it's already done according to the state.
+// The step is checkpointed after f returns.
+//
+// If the bot was interrupted, it exits before starting the step, with the
+// instructions to resume. If f panics, the panic is recovered, and the bot
+// exits with a crash bundle and the instructions to resume.
+func runStep(st *state.State, name string, f func()) {
+	if st.IsDone(name) {
+		fmt.Printf(" - %v: already done, skipping\n", name)
+		return
+	}
+	if atomic.LoadInt32(&interrupted) != 0 {
+		exitForResume(st, name)
+	}
+	span := tracer.Start(name)
+	currentStep, currentState = name, st
+	func() {
+		defer func() {
+			if v := recover(); v != nil {
+				span.End()
+				exitForCrash(st, name, &stepPanicError{Step: name, Value: v, Stack: debug.Stack()})
+			}
+		}()
+		f()
+	}()
+	currentStep = ""
+	span.End()
+	if err := st.MarkDone(name); err != nil {
+		log.Warningf("failed to checkpoint step %q: %v", name, err)
+	}
+}
+
+// confirm asks the yes/no question until the answer is yes. If the prompt is
+// interrupted, the bot exits with the instructions to resume at step.
+func confirm(st *state.State, step, message string) {
+	confirmed := false
+	for !confirmed {
+		if err := survey.AskOne(&survey.Confirm{Message: message}, &confirmed, nil); err == terminal.InterruptErr {
+			exitForResume(st, step)
+		}
+	}
+}
+
+// exitForResume saves the state and exits, printing how to resume from step.
+func exitForResume(st *state.State, step string) {
+	if err := st.Save(); err != nil {
+		log.Warningf("failed to save state: %v", err)
+	}
+	fmt.Printf("\nStopped before %q. Progress is saved in %v.\n", step, st.Path())
+	fmt.Printf("To resume, run the same command again:\n\n  %v\n\n", strings.Join(os.Args, " "))
+	flushTraces()
+	os.Exit(1)
+}
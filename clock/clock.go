@@ -0,0 +1,161 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+// Package clock is the time source of the bot: schedules, lease expiry, waits
+// and timestamps use a Clock, so tests and simulations can control time with
+// a Fake instead of waiting for it.
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock tells and waits for the time.
+type Clock interface {
+	Now() time.Time
+	// After sends the time on the returned channel after d.
+	After(d time.Duration) <-chan time.Time
+	// NewTicker returns a Ticker sending the time every d.
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker is a time.Ticker of a Clock.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Real is the system clock.
+var Real Clock = realClock{}
+
+// Or returns c, or Real if c is nil, for the optional Clock fields.
+func Or(c Clock) Clock {
+	if c == nil {
+		return Real
+	}
+	return c
+}
+
+// Sleep waits for d on the clock.
+func Sleep(c Clock, d time.Duration) {
+	<-c.After(d)
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) NewTicker(d time.Duration) Ticker       { return realTicker{time.NewTicker(d)} }
+
+type realTicker struct{ t *time.Ticker }
+
+func (t realTicker) C() <-chan time.Time { return t.t.C }
+func (t realTicker) Stop()               { t.t.Stop() }
+
+// Fake is a Clock that only moves when it's advanced. The timers and tickers
+// fire from Advance.
+type Fake struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	at     time.Time
+	period time.Duration // 0 for After.
+	c      chan time.Time
+}
+
+// NewFake returns a Fake clock at now.
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+// Now returns the time of the clock.
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// After sends the time once the clock is advanced by d.
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	return f.add(d, 0).c
+}
+
+// NewTicker returns a Ticker sending the time each time the clock is
+// advanced past a multiple of d. Like time.Ticker, ticks are dropped for
+// slow receivers.
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	return &fakeTicker{f: f, t: f.add(d, d)}
+}
+
+func (f *Fake) add(d, period time.Duration) *fakeTimer {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t := &fakeTimer{at: f.now.Add(d), period: period, c: make(chan time.Time, 1)}
+	if d <= 0 {
+		t.c <- f.now
+		return t
+	}
+	f.timers = append(f.timers, t)
+	return t
+}
+
+// Advance moves the clock forward by d, and fires the timers and tickers due
+// meanwhile, in order.
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	end := f.now.Add(d)
+	for {
+		sort.Slice(f.timers, func(i, j int) bool { return f.timers[i].at.Before(f.timers[j].at) })
+		if len(f.timers) == 0 || f.timers[0].at.After(end) {
+			break
+		}
+		t := f.timers[0]
+		f.now = t.at
+		select {
+		case t.c <- t.at:
+		default:
+		}
+		if t.period > 0 {
+			t.at = t.at.Add(t.period)
+		} else {
+			f.timers = f.timers[1:]
+		}
+	}
+	f.now = end
+}
+
+// Waiters returns the number of pending timers and tickers, e.g. to advance
+// the clock once the code under test is waiting.
+func (f *Fake) Waiters() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.timers)
+}
+
+func (f *Fake) remove(t *fakeTimer) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, tt := range f.timers {
+		if tt == t {
+			f.timers = append(f.timers[:i], f.timers[i+1:]...)
+			return
+		}
+	}
+}
+
+type fakeTicker struct {
+	f *Fake
+	t *fakeTimer
+}
+
+func (t *fakeTicker) C() <-chan time.Time { return t.t.c }
+func (t *fakeTicker) Stop()               { t.f.remove(t.t) }
@@ -0,0 +1,263 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sniperkit/snk.fork.release-git-bot/config"
+	"github.com/sniperkit/snk.fork.release-git-bot/ghclient"
+	"github.com/sniperkit/snk.fork.release-git-bot/state"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// command is a subcommand, run as:
+//
+//	release-git-bot [global flags] <command> [command flags]
+//
+// Without a command, the bot runs the release flow.
+type command struct {
+	usage string
+	run   func(cfg *config.Config, args []string) error
+	// readOnly commands never change anything, they run with -readonly.
+	readOnly bool
+}
+
+var commands = map[string]*command{
+	"changelog": {
+		usage: "add the notes of -version to a Keep a Changelog file, in the Added/Changed/Fixed sections, and roll Unreleased into the version block",
+		run:   runChangelog,
+	},
+	"diff": {
+		usage:    "show the PRs, reverts and new contributors in one release but not another, across release branches",
+		run:      runDiff,
+		readOnly: true,
+	},
+	"disclose": {
+		usage: "wait for the disclosure time of the embargoed release -version, then swap the -advisory into its draft notes and publish it",
+		run:   runDisclose,
+	},
+	"export": {
+		usage:    "dump all the issues and PRs of a milestone (-title, default to the milestone of -version) with their metadata, as newline-delimited JSON or CSV, for analytics. -prs adds the merge details and size of the PRs",
+		run:      runExport,
+		readOnly: true,
+	},
+	"hotfix": {
+		usage: "release one merged PR (-pr) or commit (-commit) as the next patch of the latest release (or -version): cherry-pick it onto the release branch with the version change, and draft the release with a one-line note",
+		run:   runHotfix,
+	},
+	"nightly": {
+		usage: "publish a snapshot of the mainline as a pre-release (vX.Y.Z-dev.YYYYMMDD, or a -moving tag), with the notes since the last stable release and the -assets, replacing the previous one of the day",
+		run:   runNightly,
+	},
+	"org": {
+		usage:    "show the latest release and open milestone progress of all repos in an org",
+		run:      runOrg,
+		readOnly: true,
+	},
+	"pages": {
+		usage: "rebuild the release notes archive in the config (e.g. on gh-pages) with all the published releases",
+		run:   runPages,
+	},
+	"permissions": {
+		usage:    "print the minimal github token permissions needed by the bot",
+		run:      runPermissions,
+		readOnly: true,
+	},
+	"pipeline": {
+		usage:    "print the release steps and their progress (from the state file of -version) as a mermaid or graphviz diagram",
+		run:      runPipeline,
+		readOnly: true,
+	},
+	"prune": {
+		usage: "delete the old draft pre-releases, the assets of superseded pre-releases, the old nightly releases and the merged bot branches, per the retention in the config",
+		run:   runPrune,
+	},
+	"promote": {
+		usage: "promote the published release of -version to the next of the channels in the config (or -to a channel), without rebuilding: move the channel tag, tag the images and notify the channel",
+		run:   runPromote,
+	},
+	"publish": {
+		usage: "publish the draft release of -version, once its assets are uploaded and match the -assets globs, e.g. from the CI job verifying them",
+		run:   runPublishDraft,
+	},
+	"query": {
+		usage:    "show the PRs, contributors and notes of a past release, from the commits between tags",
+		run:      runQuery,
+		readOnly: true,
+	},
+	"ready": {
+		usage: "mark the draft pull requests (numbers or urls) of the repo ready for review",
+		run:   runReady,
+	},
+	"retract": {
+		usage: "retract the botched release -version: open a PR adding the retract directive with the -reason to go.mod, add a retraction notice to its notes, and with -yank mark it as a pre-release",
+		run:   runRetract,
+	},
+	"self-update": {
+		usage:    "replace the bot binary with the one of its latest release for this platform, after verifying its checksum (and with -keyring, its signature). -check only prints whether an update is available",
+		run:      runSelfUpdate,
+		readOnly: true,
+	},
+	"serve": {
+		usage: "serve github webhooks, and run the configured commands for the events of many tenants",
+		run:   runServe,
+	},
+	"shadow": {
+		usage:    "compare what the bot would have done for a manual release (-version) with what was done: version, branches and notes",
+		run:      runShadow,
+		readOnly: true,
+	},
+	"update": {
+		usage: "update the branches of the pull requests (numbers or urls, default to the bot's PRs in the state file of -version) with their base branches",
+		run:   runUpdate,
+	},
+	"status": {
+		usage:    "show the review status of the pull requests (numbers or urls, default to the bot's PRs in the state file of -version) and the requirements of their base branches",
+		run:      runStatus,
+		readOnly: true,
+	},
+	"template": {
+		usage: "\"template check\" checks the notes template and renders it with a fixture release",
+		run:   runTemplate,
+	},
+	"webhooks": {
+		usage: "\"webhooks schema\" prints the JSON schema of the webhook payloads, \"webhooks send\" (re)sends the published release -version to the webhooks in the config",
+		run:   runWebhooks,
+	},
+	"verify": {
+		usage:    "verify the assets, tag and module of a published release",
+		run:      runVerify,
+		readOnly: true,
+	},
+}
+
+func runCommand(cfg *config.Config, args []string) {
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q, available commands:\n", args[0])
+		for _, name := range commandNames() {
+			fmt.Fprintf(os.Stderr, "  %-12v %v\n", name, commands[name].usage)
+		}
+		os.Exit(2)
+	}
+	if err := cmd.run(cfg, args[1:]); err != nil {
+		log.Fatalf("%v: %v", args[0], err)
+	}
+}
+
+// newFlagSet creates the flag set for a command.
+func newFlagSet(name string) *flag.FlagSet {
+	return flag.NewFlagSet(name, flag.ExitOnError)
+}
+
+func runPermissions(cfg *config.Config, args []string) error {
+	fineGrained, classic := ghclient.MinimalPermissions()
+	fmt.Println("Fine-grained personal access token permissions:")
+	for _, p := range fineGrained {
+		fmt.Println("  -", p)
+	}
+	fmt.Println("Classic personal access token scopes:")
+	for _, p := range classic {
+		fmt.Println("  -", p)
+	}
+	return nil
+}
+
+func runReady(cfg *config.Config, args []string) error {
+	fs := newFlagSet("ready")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		return fmt.Errorf("no pull request to mark ready")
+	}
+	upstream := newClient(upstreamUser, *repo)
+	for _, pr := range fs.Args() {
+		if err := markReady(upstream, pr); err != nil {
+			return err
+		}
+		fmt.Println("Ready for review: ", pr)
+	}
+	return nil
+}
+
+// botPRs are the state keys of the pull requests opened by the release flow.
+var botPRs = []string{"version_pr", "patch_dev_pr", "minor_dev_pr"}
+
+// argPRs returns the pull requests in args, or the bot's pull requests in the
+// state file of -version if there's none.
+func argPRs(args []string) ([]string, error) {
+	if len(args) > 0 {
+		return args, nil
+	}
+	ver, err := versionScheme.Parse(*newVersion)
+	if err != nil {
+		return nil, fmt.Errorf("no pull request given, and invalid version string %q: %v", *newVersion, err)
+	}
+	st, err := state.Load(stateFilePath(ver), upstreamUser+"/"+*repo, ver.String(), stateKey)
+	if err != nil {
+		return nil, err
+	}
+	var prs []string
+	for _, k := range botPRs {
+		if pr := st.Get(k); pr != "" {
+			prs = append(prs, pr)
+		}
+	}
+	return prs, nil
+}
+
+func runUpdate(cfg *config.Config, args []string) error {
+	fs := newFlagSet("update")
+	fs.Parse(args)
+	prs, err := argPRs(fs.Args())
+	if err != nil {
+		return err
+	}
+	upstream := newClient(upstreamUser, *repo)
+	var failed int
+	for _, pr := range prs {
+		if err := updatePR(upstream, pr); err != nil {
+			log.Errorf("failed to update %v: %v", pr, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%v of %v pull requests not updated", failed, len(prs))
+	}
+	return nil
+}
+
+func runStatus(cfg *config.Config, args []string) error {
+	fs := newFlagSet("status")
+	fs.Parse(args)
+	prs, err := argPRs(fs.Args())
+	if err != nil {
+		return err
+	}
+	upstream := newClient(upstreamUser, *repo)
+	for _, pr := range prs {
+		n, err := prNumber(pr)
+		if err != nil {
+			return err
+		}
+		s, err := upstream.GetPullRequestStatusContext(runCtx, n)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%v\n  %v\n  %v approvals\n", s.URL, s.Requirements, s.Approvals)
+		switch missing := s.Missing(); {
+		case s.Merged:
+			fmt.Println("  merged")
+		case len(missing) > 0:
+			fmt.Printf("  needs %v\n", strings.Join(missing, ", "))
+		default:
+			fmt.Println("  ready to merge")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,679 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+// Package config defines the config file of the bot.
+//
+// All fields are optional. The zero Config keeps the default behavior.
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Config is the content of the bot config file.
+type Config struct {
+	// Publishers are the package manager manifests to be updated after the
+	// release is published.
+	Publishers []*Publisher `yaml:"publishers"`
+	// Packages are the .deb and .rpm packages to be built and attached to the
+	// draft release.
+	Packages []*Package `yaml:"packages"`
+	// Checksums uploads a sha256sums.txt of the packages with them.
+	Checksums bool `yaml:"checksums"`
+	// Images are the container images to be tagged with the release version
+	// after the release is published.
+	Images []*Image `yaml:"images"`
+	// RepoMetadata is the repo metadata to be updated after the release is
+	// published.
+	RepoMetadata *RepoMetadata `yaml:"repo_metadata"`
+	// Webhooks are posted a signed JSON payload (see package notify) when the
+	// release is published, for internal systems to react to releases.
+	Webhooks []*Webhook `yaml:"webhooks"`
+	// Pages is the release notes archive to be updated after the release is
+	// published, e.g. on the gh-pages branch. If nil, there is no archive.
+	Pages *Pages `yaml:"pages"`
+	// ReleasedComment comments on the merged PRs of the release once it's
+	// published, e.g. "This PR is included in v1.20.0". If nil, they are not
+	// commented.
+	ReleasedComment *ReleasedComment `yaml:"released_comment"`
+	// Channels are the release channels a published release is promoted
+	// through with the promote command, from the least to the most stable,
+	// e.g. edge, beta and stable. If empty, there are no channels.
+	Channels []*Channel `yaml:"channels"`
+
+	// NotesTemplate is the path of the text/template file to render the
+	// release notes with. The template is executed with a *notes.Notes. If
+	// empty, notes.DefaultTemplate is used.
+	NotesTemplate string `yaml:"notes_template"`
+	// SectionTemplates are the paths of the text/template files to render
+	// sections of the notes with, keyed by section name, e.g. a table for
+	// "Dependencies". The templates are executed with a *notes.Section, by
+	// {{section .}} in the notes template. The other sections are rendered
+	// with notes.DefaultSectionTemplate.
+	SectionTemplates map[string]string `yaml:"section_templates"`
+	// Classification sorts the PRs into the sections of the notes with the
+	// project's own rules and categories. If nil, the PRs are sorted by their
+	// "Type: " labels.
+	Classification *Classification `yaml:"classification"`
+	// NotesRepos are other repos released together with this one, e.g. its
+	// plugins, in the format of owner/repo. Their merged PRs for the same
+	// milestone are added to the notes, each repo in its own subsection, for
+	// umbrella projects publishing one combined announcement.
+	NotesRepos []string `yaml:"notes_repos"`
+	// DeveloperNotes configures the developer changelog of every PR, attached
+	// to the draft release next to the user facing notes. If nil, there is no
+	// developer changelog.
+	DeveloperNotes *DeveloperNotes `yaml:"developer_notes"`
+	// NotesReview shares the notes in a secret gist (or a Google Doc) for
+	// review before the draft release is created. If nil, the notes are
+	// reviewed in the draft.
+	NotesReview *NotesReview `yaml:"notes_review"`
+
+	// Milestones configures the milestones the bot opens and closes in the
+	// release flow. If nil, milestones are left to humans.
+	Milestones *Milestones `yaml:"milestones"`
+	// BranchCut announces the cut of the release branch on the open PRs of
+	// the milestone. If nil, they are not commented.
+	BranchCut *BranchCut `yaml:"branch_cut"`
+
+	// Retention is what the prune command deletes to keep the releases page
+	// tidy. If nil, prune deletes nothing.
+	Retention *Retention `yaml:"retention"`
+
+	// VersionScheme is how versions are parsed, bumped and named. If nil,
+	// versions are semver.
+	VersionScheme *VersionScheme `yaml:"version_scheme"`
+
+	// Mainline is the branch release branches are cut from and the next dev
+	// version is bumped on. If nil, it's master.
+	Mainline *Mainline `yaml:"mainline"`
+	// MirrorBranches are created with the release branch, at the same commit,
+	// e.g. "release-{line}" for downstream tooling. "{line}", "{major}" and
+	// "{minor}" are replaced by the version numbers. If any fails, the branches
+	// already created are deleted.
+	MirrorBranches []string `yaml:"mirror_branches"`
+
+	// BumpChecks are shell commands run on the version bump change before its
+	// pull request is opened, e.g. "go build ./..." and "go test -short ./...".
+	// The pull request is not opened if any fails, and the output is added to
+	// the pull request body otherwise.
+	BumpChecks []string `yaml:"bump_checks"`
+
+	// DraftPRs are the kinds of pull requests opened as drafts, so a human can
+	// finish or review them before CI and the reviewers are pinged: "version"
+	// (the version change on the release branch), "patch_dev", "minor_dev" and
+	// "manifest". The version pull request is marked ready for review when
+	// it's confirmed, the others with the ready command.
+	DraftPRs []string `yaml:"draft_prs"`
+	// PullRequests triages the version pull requests ("version",
+	// "patch_dev" and "minor_dev") when they are opened. If nil, they have no
+	// reviewers, assignees or labels.
+	PullRequests *PullRequests `yaml:"pull_requests"`
+
+	// Redact are regexps of secrets to be scrubbed from the logs, the state
+	// file and everything posted to github, in addition to the token and the
+	// common secret formats. If a regexp has groups, the first group is kept
+	// before the replacement and the second after it, e.g. `(SECRET=)\S+`.
+	Redact []string `yaml:"redact"`
+
+	// Policy constrains the changes the bot is allowed to make. If nil,
+	// everything is allowed.
+	Policy *Policy `yaml:"policy"`
+	// OPA evaluates the release plan against OPA/Rego policies before the
+	// release starts, as an alternative (or in addition) to Policy.
+	OPA *OPA `yaml:"opa"`
+
+	// API pins the github API version and previews. If nil, the API version is
+	// ghclient.DefaultAPIVersion.
+	API *API `yaml:"api"`
+
+	// PRSearch filters the merged PRs of the notes with -prsfrom search, which
+	// selects the PRs merged since the previous release with the search API.
+	// If nil, all of them are selected.
+	PRSearch *PRSearch `yaml:"pr_search"`
+
+	// Time sets the timezone and the format of the dates of the notes, the
+	// release archive and the branch cut announcements, and the timezone of
+	// the times without offset (e.g. -embargo). If nil, it's UTC.
+	Time *Time `yaml:"time"`
+
+	// Features turns the experimental steps on, see package features for
+	// their names. If nil, they are all off, unless enabled with
+	// $RELEASE_BOT_FEATURES.
+	Features *Features `yaml:"features"`
+}
+
+// PRSearch filters the merged PRs found with the search API.
+type PRSearch struct {
+	// Base is the branch the PRs are merged into, e.g. master. Default to
+	// the mainline, or for a patch release, to the release branch.
+	Base string `yaml:"base"`
+	// Labels selects the PRs with any of the labels, ExcludeLabels leaves
+	// out the PRs with any of them.
+	Labels        []string `yaml:"labels"`
+	ExcludeLabels []string `yaml:"exclude_labels"`
+	// Authors selects the PRs of any of the users, ExcludeAuthors leaves out
+	// the PRs of any of them, e.g. dependabot[bot].
+	Authors        []string `yaml:"authors"`
+	ExcludeAuthors []string `yaml:"exclude_authors"`
+	// Query is added to the search query as is, e.g. "-is:draft".
+	Query string `yaml:"query"`
+	// Since is the start of the release window, e.g. 2018-07-01 or
+	// 2018-07-01T12:00:00Z. Default to the commit time of the previous
+	// release tag.
+	Since string `yaml:"since"`
+	// Until is the end of the release window (inclusive), in the format of
+	// Since. Default to the branch cut of the release branch, or for a patch
+	// release, to the head of the release branch.
+	Until string `yaml:"until"`
+}
+
+// Time sets the timezone and the format of the dates.
+type Time struct {
+	// Zone is the IANA timezone, e.g. America/Los_Angeles. Default to UTC.
+	Zone string `yaml:"zone"`
+	// DateFormat is the Go layout of the dates, e.g. "Jan 2, 2006". Default
+	// to 2006-01-02. The dates of the Keep a Changelog file are always
+	// 2006-01-02.
+	DateFormat string `yaml:"date_format"`
+}
+
+// Features turns the experimental features on or off, e.g.
+//
+//	features:
+//	  flags:
+//	    auto_publish: true
+//	  repos:
+//	    grpc/grpc-java:
+//	      auto_publish: false
+type Features struct {
+	// Flags are the features on or off for all repos, by name.
+	Flags map[string]bool `yaml:"flags"`
+	// Repos override the flags for the repos, keyed by "owner/repo".
+	Repos map[string]map[string]bool `yaml:"repos"`
+}
+
+// API configures the headers of the github API requests.
+type API struct {
+	// Version is the X-GitHub-Api-Version, e.g. "2022-11-28".
+	Version string `yaml:"version"`
+	// Previews are the API previews to opt in to, e.g. "mercy" for the
+	// application/vnd.github.mercy-preview+json media type.
+	Previews []string `yaml:"previews"`
+
+	// BaseURL is the API url of a GitHub Enterprise Server, e.g.
+	// "https://github.example.com/api/v3/". If empty, the bot uses
+	// github.com. The repos are cloned from the host of BaseURL.
+	BaseURL string `yaml:"base_url"`
+	// UploadURL is the uploads API url of the GitHub Enterprise Server,
+	// default to the "uploads" API next to BaseURL.
+	UploadURL string `yaml:"upload_url"`
+
+	// GraphQL makes the bot query the merged PRs with the GraphQL API, in a
+	// few paginated queries instead of one REST call per PR.
+	GraphQL bool `yaml:"graphql"`
+	// Concurrency is the max number of concurrent requests of the queries
+	// fetching many pages or PRs, e.g. the closed issues of a milestone,
+	// default to 8.
+	Concurrency int `yaml:"concurrency"`
+
+	// Breaker configures the circuit breaker pausing the API requests while
+	// github fails. If nil, the defaults of ghclient.Breaker are used.
+	Breaker *Breaker `yaml:"breaker"`
+	// Retry configures the retries of the API requests failing with a 5xx
+	// response or a network error. If nil, the defaults of ghclient.Retry are
+	// used.
+	Retry *Retry `yaml:"retry"`
+	// RateLimit configures the waits for the API rate limits. If nil, the
+	// defaults of ghclient.RateLimiter are used.
+	RateLimit *RateLimit `yaml:"rate_limit"`
+}
+
+// Breaker configures the circuit breaker of the API requests.
+type Breaker struct {
+	// Disabled disables the circuit breaker.
+	Disabled bool `yaml:"disabled"`
+	// Threshold is the number of consecutive 5xx responses or network errors
+	// opening the breaker, default to 5.
+	Threshold int `yaml:"threshold"`
+	// Cooldown is how long the requests are paused the first time, e.g.
+	// "10s" (the default). It doubles each time github is still failing, up
+	// to MaxCooldown, default to 5m.
+	Cooldown    string `yaml:"cooldown"`
+	MaxCooldown string `yaml:"max_cooldown"`
+}
+
+// Retry configures the retries of the API requests.
+type Retry struct {
+	// Disabled disables the retries.
+	Disabled bool `yaml:"disabled"`
+	// Attempts is the number of retries after the first failure, default to
+	// 3.
+	Attempts int `yaml:"attempts"`
+	// Base is the backoff before the first retry, e.g. "1s" (the default). It
+	// doubles with each retry, up to Max, default to 30s.
+	Base string `yaml:"base"`
+	Max  string `yaml:"max"`
+}
+
+// RateLimit configures the waits for the API rate limits.
+type RateLimit struct {
+	// Reserve is the number of requests left when the bot starts waiting for
+	// the rate limit reset, default to 50. It's at most a tenth of the limit
+	// of each resource, e.g. 3 of the 30 searches a minute.
+	Reserve int `yaml:"reserve"`
+	// MaxWait is the longest wait for a rate limit, e.g. "15m". The bot fails
+	// instead of waiting longer. Empty waits as long as needed.
+	MaxWait string `yaml:"max_wait"`
+}
+
+// Publisher configures the manifest update for one package manager.
+type Publisher struct {
+	// Kind is the package manager, one of "krew", "scoop" and "winget".
+	Kind string `yaml:"kind"`
+	// Repo is the manifest repo in the format of owner/repo, e.g.
+	// kubernetes-sigs/krew-index. The pull request will be sent from the
+	// user's fork of this repo.
+	Repo string `yaml:"repo"`
+	// Path is the manifest file path (or directory for winget) in the manifest
+	// repo. If empty, the default path for the package manager is used.
+	Path string `yaml:"path"`
+
+	// Name is the package name, e.g. the krew plugin name.
+	Name string `yaml:"name"`
+	// Identifier is the winget package identifier, e.g. "gRPC.grpcurl".
+	Identifier string `yaml:"identifier"`
+	// Publisher is the winget publisher name.
+	Publisher string `yaml:"publisher"`
+	// Bin is the binary name in the release archives.
+	Bin string `yaml:"bin"`
+
+	Description string `yaml:"description"`
+	Homepage    string `yaml:"homepage"`
+	License     string `yaml:"license"`
+}
+
+// Package configures one linux package. The fields follow the nfpm config
+// format, the version and changelog are filled by the bot.
+type Package struct {
+	Name string `yaml:"name"`
+	// Arch is the GOARCH of the binaries, e.g. amd64.
+	Arch string `yaml:"arch"`
+	// Formats are the package formats to build, "deb" and/or "rpm".
+	Formats []string `yaml:"formats"`
+
+	Maintainer  string `yaml:"maintainer"`
+	Description string `yaml:"description"`
+	Vendor      string `yaml:"vendor"`
+	Homepage    string `yaml:"homepage"`
+	License     string `yaml:"license"`
+
+	Depends  []string          `yaml:"depends"`
+	Contents []*PackageContent `yaml:"contents"`
+}
+
+// PackageContent is one file in a package.
+type PackageContent struct {
+	// Src is the local path of the file, e.g. the built binary.
+	Src string `yaml:"src"`
+	// Dst is the install path of the file, e.g. /usr/bin/grpcurl.
+	Dst string `yaml:"dst"`
+	// Type is the nfpm content type, e.g. "config". Empty for regular files.
+	Type string `yaml:"type,omitempty"`
+}
+
+// Image configures the release tags of one container image.
+type Image struct {
+	// Source is the built image to be released, e.g.
+	// ghcr.io/grpc/grpcurl:sha-1234567.
+	Source string `yaml:"source"`
+	// Repository is the image repository to push the release tags to, e.g.
+	// ghcr.io/grpc/grpcurl.
+	Repository string `yaml:"repository"`
+	// ExtraTags are pushed in addition to the release tag, e.g. "latest".
+	ExtraTags []string `yaml:"extra_tags"`
+	// Annotations are added to the generated OCI annotations.
+	Annotations map[string]string `yaml:"annotations"`
+}
+
+// RepoMetadata configures the repo metadata updates. Empty fields are not
+// changed.
+//
+// In Description and Homepage, "{version}", "{line}", "{major}" and "{minor}"
+// are replaced by the release version, e.g. "https://grpc.io/docs/v{line}".
+type RepoMetadata struct {
+	Description string `yaml:"description"`
+	Homepage    string `yaml:"homepage"`
+	// Topics replace all the repo topics.
+	Topics []string `yaml:"topics"`
+}
+
+// Classification configures the classification of the PRs. Its rules are
+// tried in order before the default ones (of the "Type: " labels), and the
+// first matching a PR classifies it.
+type Classification struct {
+	// Categories are added to the default ones (e.g. "Feature" and "Bug"), or
+	// replace them.
+	Categories []*Category `yaml:"categories"`
+	Rules      []*Rule     `yaml:"rules"`
+	// ConventionalCommits, if set, classifies the PRs matched by no rule
+	// by the Conventional Commits prefix of their titles, as squash-merged,
+	// e.g. "feat(api): ...", and the BREAKING CHANGE footer of their
+	// descriptions.
+	ConventionalCommits *ConventionalCommits `yaml:"conventional_commits"`
+}
+
+// Category is a category of PRs in the notes.
+type Category struct {
+	Name string `yaml:"name"`
+	// Section is the title of the section of the category in the notes. The
+	// PRs of a category without section are left out of the notes.
+	Section string `yaml:"section"`
+	// Weight orders the sections, higher first. The default ones range from
+	// 70 (Dependencies) to 0 (Testing).
+	Weight int `yaml:"weight"`
+}
+
+// Rule classifies the PRs matching all its conditions. A rule without
+// conditions matches all the PRs.
+type Rule struct {
+	// Labels are globs of label names, one of which must match.
+	Labels []string `yaml:"labels"`
+	// Title is a regexp the PR title must match.
+	Title string `yaml:"title"`
+	// Paths are globs of changed files, one of which must match. "**"
+	// matches any number of dirs, and globs without dir match the base name.
+	Paths []string `yaml:"paths"`
+	// Authors are the logins of the authors, one of which must match.
+	Authors []string `yaml:"authors"`
+
+	// Category is the category of the PR, a default or configured one.
+	Category string `yaml:"category"`
+	// Audience is who the change is for, e.g. "user" or "developer", for the
+	// notes templates.
+	Audience string `yaml:"audience"`
+	// Importance scores the PR, higher is more important. If 0, it's the
+	// weight of the category.
+	Importance int `yaml:"importance"`
+}
+
+// ConventionalCommits is the classification of the PRs by their Conventional
+// Commits titles.
+type ConventionalCommits struct {
+	// Types maps commit types to categories, added to (or replacing) the
+	// default ones: feat is a Feature, fix a Bug, perf Performance, docs
+	// Documentation, test Testing, and build, chore, ci, refactor and style
+	// Internal Cleanup. Commits with the "deps" scope are Dependencies.
+	Types map[string]string `yaml:"types"`
+	// Breaking is the category of the breaking changes, marked with a "!"
+	// after the type or a BREAKING CHANGE footer, default to "Behavior
+	// Change".
+	Breaking string `yaml:"breaking"`
+}
+
+// Webhook is an endpoint notified of the releases.
+type Webhook struct {
+	URL string `yaml:"url"`
+	// SecretEnv is the env var of the secret signing the payloads. If empty,
+	// the payloads are not signed.
+	SecretEnv string `yaml:"secret_env"`
+}
+
+// Pages configures the release notes archive: an index of the releases, and a
+// page with the notes of each, committed to a branch served by GitHub Pages.
+type Pages struct {
+	// Branch is the branch of the archive, "gh-pages" if empty. It's created
+	// if it doesn't exist.
+	Branch string `yaml:"branch"`
+	// Dir is the dir of the archive in the branch, "releases" if empty, e.g.
+	// "docs/releases" to publish it from the docs folder of master.
+	Dir string `yaml:"dir"`
+	// Prereleases adds the pre-releases to the archive.
+	Prereleases bool `yaml:"prereleases"`
+}
+
+// ReleasedComment configures the comment on the PRs of a published release.
+type ReleasedComment struct {
+	// Body is the comment, in markdown. "{version}", "{line}", "{major}" and
+	// "{minor}" are replaced by the version numbers, "{tag}" by the release
+	// tag and "{url}" by the release page. If empty, it's "This PR is
+	// included in [{tag}]({url})."
+	Body string `yaml:"body"`
+	// BatchSize is the number of PRs commented between pauses, 20 if 0.
+	BatchSize int `yaml:"batch_size"`
+	// BatchInterval is the pause between batches, "1m" if empty.
+	BatchInterval string `yaml:"batch_interval"`
+}
+
+// Channel is a release channel. A release is in the channel once it's
+// promoted to it, nothing is rebuilt: the tag of the channel is moved to the
+// release, and its images are tagged for the channel.
+type Channel struct {
+	Name string `yaml:"name"`
+	// Tag is the moving git tag of the latest release of the channel, the
+	// name if empty.
+	Tag string `yaml:"tag"`
+	// Prerelease marks the github releases of the channel as pre-releases,
+	// e.g. for edge and beta. They are unmarked once promoted to a channel
+	// without it.
+	Prerelease bool `yaml:"prerelease"`
+	// ImageTags are the tags of the channel pushed for the Images, from their
+	// release tag, e.g. "beta" or "{line}-beta".
+	ImageTags []string `yaml:"image_tags"`
+	// Webhooks are posted the release.promoted event of the promotions to
+	// the channel.
+	Webhooks []*Webhook `yaml:"webhooks"`
+	// SlackWebhookEnv is the env var of a Slack incoming webhook announcing
+	// the promotions to the channel. If empty, there is no announcement.
+	SlackWebhookEnv string `yaml:"slack_webhook_env"`
+	// AssetsURL is where the release assets of the channel are downloaded
+	// from, e.g. "https://dl.example.com/beta/{version}/", with the
+	// placeholders of the version. The promotions announce the assets at
+	// this location instead of the github release. Copying the assets there
+	// is up to the receivers of the webhooks.
+	AssetsURL string `yaml:"assets_url"`
+}
+
+// DeveloperNotes configures the developer changelog.
+type DeveloperNotes struct {
+	// Template is the path of the text/template file to render the changelog
+	// with. If empty, notes.DeveloperTemplate is used.
+	Template string `yaml:"template"`
+	// Asset is the name of the release asset, "CHANGELOG.md" if empty.
+	Asset string `yaml:"asset"`
+}
+
+// NotesReview configures the review of the notes in a secret gist, or a
+// Google Doc. The link is sent to the reviewers, and the edited notes are
+// used for the draft release.
+type NotesReview struct {
+	// Reviewers are the logins mentioned with the link.
+	Reviewers []string `yaml:"reviewers"`
+	// Issue is the upstream issue or PR the link is commented on. If 0, it's
+	// the -trackingissue, if any.
+	Issue int `yaml:"issue"`
+	// SlackWebhookEnv is the environment variable with the url of a Slack
+	// incoming webhook the link is posted to.
+	SlackWebhookEnv string `yaml:"slack_webhook_env"`
+	// GoogleDocs exports the notes to a Google Doc instead of a gist, for
+	// organizations reviewing release communications in Docs.
+	GoogleDocs *GoogleDocs `yaml:"google_docs"`
+}
+
+// GoogleDocs configures the export of the notes to Google Docs.
+type GoogleDocs struct {
+	// TokenEnv is the environment variable with the OAuth access token, with
+	// the https://www.googleapis.com/auth/drive.file scope.
+	TokenEnv string `yaml:"token_env"`
+	// Folder is the id of the Drive folder of the docs. If empty, they are
+	// in the Drive root of the token user.
+	Folder string `yaml:"folder"`
+	// Editors are the emails of the stakeholders the docs are shared with,
+	// who can edit them.
+	Editors []string `yaml:"editors"`
+}
+
+// BranchCut configures the comment on the open PRs of the milestone when the
+// release branch is cut.
+type BranchCut struct {
+	// BackportLabel is the label to add to a PR merged on the mainline to
+	// have it cherry-picked to the release branch, e.g. "backport
+	// {major}.{minor}". If empty, authors are told to ask a maintainer.
+	BackportLabel string `yaml:"backport_label"`
+	// OptOutLabel is the label of the PRs not to comment on,
+	// "no-branch-cut-notice" if empty.
+	OptOutLabel string `yaml:"opt_out_label"`
+	// BatchSize is the number of PRs commented between pauses, 20 if 0.
+	BatchSize int `yaml:"batch_size"`
+	// BatchInterval is the pause between batches, "1m" if empty.
+	BatchInterval string `yaml:"batch_interval"`
+	// RetargetLabel is the label of the open PRs to the mainline to retarget
+	// to the release branch when it's cut, e.g. "release {major}.{minor}".
+	// They are not told they missed the branch. If empty, no PR is
+	// retargeted.
+	RetargetLabel string `yaml:"retarget_label"`
+}
+
+// PullRequests configures the triage of the version pull requests.
+type PullRequests struct {
+	// Reviewers are the logins requested for review.
+	Reviewers []string `yaml:"reviewers"`
+	// TeamReviewers are the slugs of the teams requested for review, e.g.
+	// "release-team".
+	TeamReviewers []string `yaml:"team_reviewers"`
+	Assignees     []string `yaml:"assignees"`
+	// Labels are added to the pull requests, and can have the {version},
+	// {line}, {major} and {minor} placeholders of the version in the pull
+	// request.
+	Labels []string `yaml:"labels"`
+	// Milestone sets the milestone of the version in the pull request, e.g.
+	// "1.15 Release" for the change to 1.15.0-dev, if it exists.
+	Milestone bool `yaml:"milestone"`
+}
+
+// Milestones configures the milestone lifecycle in the release flow.
+type Milestones struct {
+	// OpenNext opens the milestone of the next release line (e.g. "1.15
+	// Release" for 1.14.0) once the release branch is created, so the PRs
+	// merged on the mainline meanwhile have a milestone.
+	OpenNext bool `yaml:"open_next"`
+	// Close closes the milestone of the release once it's published. Its open
+	// issues and PRs are moved to the milestone of the next release line
+	// first, with a comment.
+	Close bool `yaml:"close"`
+}
+
+// Retention configures the cleanup of old releases by the prune command. The
+// ages are durations, e.g. "720h" for 30 days. Empty ones disable their
+// cleanup.
+type Retention struct {
+	// Drafts is the age after which the draft pre-releases are deleted.
+	Drafts string `yaml:"drafts"`
+	// RCAssets deletes the assets of the pre-releases superseded by their
+	// final release, e.g. of v1.14.0-rc.1 once v1.14.0 is published.
+	RCAssets bool `yaml:"rc_assets"`
+	// Nightly is the age after which the nightly releases are deleted, with
+	// their tags.
+	Nightly string `yaml:"nightly"`
+	// NightlyTags is the glob of the nightly release tags, "*-dev.*" if
+	// empty.
+	NightlyTags string `yaml:"nightly_tags"`
+	// Branches are globs of the branches made by the bot (in the repo and
+	// in the fork of the token user) to delete once their PRs are all
+	// closed, e.g. "release_version_*".
+	Branches []string `yaml:"branches"`
+}
+
+// VersionScheme configures the versioning scheme of the project.
+//
+// In Branch and Milestone, "{line}" is replaced by the release line of the
+// version, e.g. "1.14" for 1.14.2 with semver, or "2024.06" for 2024.06.1
+// with calver.
+type VersionScheme struct {
+	// Kind is one of "semver" (default), "calver" (YYYY.0M.MICRO),
+	// "fourpart" (1.2.3.4) and "regex".
+	Kind string `yaml:"kind"`
+
+	// Pattern is the regexp of the versions for kind "regex". Every unnamed
+	// group is a numeric part of the version, and the optional group named
+	// "pre" is the pre-release, e.g. `^(\d+)\.(\d+)(?:-(?P<pre>.+))?$`.
+	Pattern string `yaml:"pattern"`
+	// Format is how versions are printed for kind "regex". "{0}", "{1}"...
+	// are replaced by the numeric parts, and "{pre}" by "-<pre-release>" (or
+	// "" if there's none). Default to the parts joined by "." followed by
+	// "{pre}".
+	Format string `yaml:"format"`
+
+	// LineParts is the number of leading parts that make the release line,
+	// i.e. versions sharing them are released from the same branch. Default
+	// to 2 for semver and calver, and one less than the number of parts
+	// otherwise.
+	LineParts int `yaml:"line_parts"`
+
+	// Branch is the release branch name, default to "v{line}.x".
+	Branch string `yaml:"branch"`
+	// Milestone is the milestone title of the release line, default to
+	// "{line} Release".
+	Milestone string `yaml:"milestone"`
+}
+
+// Mainline configures the mainline branch, e.g. develop for git-flow repos.
+type Mainline struct {
+	// Branch is the mainline branch, default to the default branch of the
+	// repo (see -defaultbranch).
+	Branch string `yaml:"branch"`
+	// Lines overrides the mainline for some release lines, keyed by the line,
+	// e.g. "1.14": "next".
+	Lines map[string]string `yaml:"lines"`
+}
+
+// Policy configures the operations the bot is allowed to make. The
+// operations are create_branch, create_tag, update_ref, delete_ref,
+// create_pr, retarget_pr, create_release, publish_release, upload_asset,
+// comment, edit_repo, edit_milestone, gist, push (to the user's fork) and
+// other.
+type Policy struct {
+	// Deny are the operations never allowed, e.g. delete_ref.
+	Deny []string `yaml:"deny"`
+	// Branches are the globs of the branches the bot may create, e.g.
+	// "v*.x". Empty allows all branches.
+	Branches []string `yaml:"branches"`
+	// RequireApproval are the operations to be approved interactively, e.g.
+	// publish_release.
+	RequireApproval []string `yaml:"require_approval"`
+}
+
+// OPA configures the OPA/Rego policies of the release plan. The input of the
+// policies is {"plan": <the plan>, "repo": <the github repo metadata>}, see
+// policy.Input.
+type OPA struct {
+	// URL is the OPA server, e.g. http://localhost:8181. If empty, the
+	// policies are evaluated with the opa CLI.
+	URL string `yaml:"url"`
+	// Policies are the rego files or dirs evaluated by the opa CLI.
+	Policies []string `yaml:"policies"`
+	// Query is the rule returning the deny messages, default to
+	// "data.release.deny". The release is blocked if it's not empty.
+	Query string `yaml:"query"`
+}
+
+// Load reads the config from the file at path.
+//
+// It returns an empty config if path is "".
+func Load(path string) (*Config, error) {
+	c := &Config{}
+	if path == "" {
+		return c, nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+	if err := yaml.UnmarshalStrict(b, c); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %q: %v", path, err)
+	}
+	return c, nil
+}
@@ -0,0 +1,103 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Service is the config of the bot service ("release-git-bot serve"), which
+// runs bot commands on github webhook events for many tenants.
+type Service struct {
+	// Listen is the address to listen on, default to ":8080".
+	Listen string `yaml:"listen"`
+	// Tenants are the teams served. Each repo belongs to one tenant.
+	Tenants []*Tenant `yaml:"tenants"`
+
+	// LeaderElection, if set, elects one replica to run the scheduled
+	// commands. Webhooks are served by all replicas.
+	LeaderElection *LeaderElection `yaml:"leader_election"`
+}
+
+// LeaderElection configures the leader election among the replicas.
+type LeaderElection struct {
+	// Kind is "lease" for a kubernetes Lease (in cluster, with the pod
+	// service account), or "file" for a lock file on a volume shared by the
+	// replicas.
+	Kind string `yaml:"kind"`
+	// Name is the Lease name, or the lock file path.
+	Name string `yaml:"name"`
+	// Namespace is the Lease namespace, default to the pod namespace.
+	Namespace string `yaml:"namespace"`
+	// Duration is how long the leader holds the lock without renewing it,
+	// default to 15s.
+	Duration string `yaml:"duration"`
+}
+
+// Schedule runs commands periodically for all the repos of a tenant, every
+// interval, or every day at a time.
+type Schedule struct {
+	// Every is the interval, e.g. "24h".
+	Every string `yaml:"every"`
+	// At is the time of day, e.g. "09:30", instead of Every. It's in
+	// Timezone, so it doesn't move with the daylight saving time.
+	At string `yaml:"at"`
+	// Timezone is the IANA timezone of At, e.g. Europe/Paris. Default to
+	// UTC.
+	Timezone string   `yaml:"timezone"`
+	Commands []string `yaml:"commands"`
+}
+
+// Tenant is a team with its own credentials, config and state.
+type Tenant struct {
+	// Name identifies the tenant in the logs.
+	Name string `yaml:"name"`
+	// Repos are the repos of the tenant, in the format of owner/repo.
+	Repos []string `yaml:"repos"`
+
+	// TokenEnv is the env var of the github token of the tenant. Tokens are
+	// never in the config file, and each tenant's commands only see its own
+	// token.
+	TokenEnv string `yaml:"token_env"`
+	// SecretEnv is the env var of the webhook secret of the tenant. The
+	// webhook signatures are verified with it.
+	SecretEnv string `yaml:"secret_env"`
+
+	// Config is the bot config file of the tenant.
+	Config string `yaml:"config"`
+	// StateDir is the dir the tenant's commands run in. State files, audit
+	// logs and caches are kept there.
+	StateDir string `yaml:"state_dir"`
+	// StateKeyEnv is the env var of the tenant's key to encrypt the state and
+	// cache files, see package seal. If empty, $RELEASE_BOT_STATE_KEY of the
+	// service is used, if any.
+	StateKeyEnv string `yaml:"state_key_env"`
+
+	// On maps the webhook events to the bot commands to run, e.g.
+	// "release.published": ["verify"]. The event is "<X-GitHub-Event>.<action>",
+	// or "<X-GitHub-Event>" for events without action. Each command is run
+	// with the -repo and (for release events) -version of the event.
+	On map[string][]string `yaml:"on"`
+	// Schedule are the commands run periodically, by the leader replica.
+	Schedule []*Schedule `yaml:"schedule"`
+}
+
+// LoadService reads the service config from the file at path.
+func LoadService(path string) (*Service, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service config file: %v", err)
+	}
+	c := &Service{}
+	if err := yaml.UnmarshalStrict(b, c); err != nil {
+		return nil, fmt.Errorf("failed to parse service config file %q: %v", path, err)
+	}
+	if c.Listen == "" {
+		c.Listen = ":8080"
+	}
+	return c, nil
+}
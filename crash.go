@@ -0,0 +1,113 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sniperkit/snk.fork.release-git-bot/crash"
+	"github.com/sniperkit/snk.fork.release-git-bot/state"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// recentLogs keeps the last log lines, and requestTrace the last github
+	// API requests, for the crash bundle.
+	recentLogs   = crash.NewLog(500)
+	requestTrace = crash.NewTrace(200)
+
+	// currentStep is the release step being run, and currentState the state
+	// of the release, so a fatal error in the step writes a crash bundle.
+	currentStep  string
+	currentState *state.State
+)
+
+// stepPanicError is a panic in a release step.
+type stepPanicError struct {
+	Step  string
+	Value interface{}
+	Stack []byte
+}
+
+func (e *stepPanicError) Error() string {
+	return fmt.Sprintf("panic in step %q: %v", e.Step, e.Value)
+}
+
+// resumeGuidance returns how to resume the release from step.
+func resumeGuidance(st *state.State, step string) string {
+	return fmt.Sprintf("Progress is saved in %v, %q is not done.\nFix the cause, then resume by running the same command again:\n\n  %v", st.Path(), step, strings.Join(os.Args, " "))
+}
+
+// exitForCrash saves the state, writes the crash bundle of the failed step and
+// exits, printing the error, the bundle path and how to resume.
+func exitForCrash(st *state.State, step string, err error) {
+	if serr := st.Save(); serr != nil {
+		log.Warningf("failed to save state: %v", serr)
+	}
+	fmt.Printf("\nStep %q failed: %v\n", step, err)
+	if path, berr := writeCrashBundle(st, step, err); berr != nil {
+		log.Warningf("failed to write crash bundle: %v", berr)
+	} else {
+		fmt.Printf("Crash bundle written to %v\n", path)
+	}
+	fmt.Printf("%v\n\n", resumeGuidance(st, step))
+	flushTraces()
+	os.Exit(1)
+}
+
+// writeCrashBundle writes the crash bundle of the failed step to -crashdir,
+// and returns its path.
+func writeCrashBundle(st *state.State, step string, err error) (string, error) {
+	now := botClock.Now().UTC()
+	b := &crash.Bundle{
+		Time:     now,
+		Step:     step,
+		Error:    err.Error(),
+		Args:     os.Args,
+		Logs:     recentLogs.Lines(),
+		Requests: requestTrace.Requests(),
+		Redact:   redactor.Bytes,
+	}
+	if perr, ok := err.(*stepPanicError); ok {
+		b.Stack = perr.Stack
+	}
+	if st != nil {
+		b.Resume = resumeGuidance(st, step)
+		var serr error
+		if b.State, serr = st.Snapshot(); serr != nil {
+			log.Warningf("failed to add state to crash bundle: %v", serr)
+		}
+	}
+	if err := os.MkdirAll(*crashDir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create %v: %v", *crashDir, err)
+	}
+	name := fmt.Sprintf("%v.crash-%v.tar.gz", *repo, now.Format("20060102T150405Z"))
+	if st != nil {
+		name = fmt.Sprintf("%v_v%v.crash-%v.tar.gz", *repo, st.Version, now.Format("20060102T150405Z"))
+	}
+	path := filepath.Join(*crashDir, name)
+	return path, b.Write(path)
+}
+
+// crashOnFatal writes the crash bundle when log.Fatal is called in a release
+// step. The error is the last log line.
+func crashOnFatal() {
+	if currentStep == "" {
+		return
+	}
+	msg := "fatal error"
+	if lines := recentLogs.Lines(); len(lines) > 0 {
+		msg = lines[len(lines)-1]
+	}
+	path, err := writeCrashBundle(currentState, currentStep, fmt.Errorf("%v", msg))
+	if err != nil {
+		log.Warningf("failed to write crash bundle: %v", err)
+		return
+	}
+	fmt.Printf("\nCrash bundle written to %v\n%v\n\n", path, resumeGuidance(currentState, currentStep))
+}
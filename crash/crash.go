@@ -0,0 +1,234 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+// Package crash collects what's needed to debug a failed unattended run: the
+// recent log lines, the recent github API requests, and the state of the
+// release, written together to a crash bundle.
+package crash
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Log is an io.Writer keeping the last lines written to it. A nil Log keeps
+// nothing.
+type Log struct {
+	max int
+
+	mu      sync.Mutex
+	lines   []string
+	partial string
+}
+
+// NewLog returns a Log keeping the last max lines.
+func NewLog(max int) *Log {
+	return &Log{max: max}
+}
+
+// Write implements io.Writer.
+func (l *Log) Write(p []byte) (int, error) {
+	if l == nil {
+		return len(p), nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s := l.partial + string(p)
+	lines := strings.Split(s, "\n")
+	l.partial = lines[len(lines)-1]
+	l.lines = append(l.lines, lines[:len(lines)-1]...)
+	if len(l.lines) > l.max {
+		l.lines = append([]string(nil), l.lines[len(l.lines)-l.max:]...)
+	}
+	return len(p), nil
+}
+
+// Lines returns the kept lines, oldest first.
+func (l *Log) Lines() []string {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ret := append([]string(nil), l.lines...)
+	if l.partial != "" {
+		ret = append(ret, l.partial)
+	}
+	return ret
+}
+
+// Request is one http request of a Trace.
+type Request struct {
+	Time   time.Time `json:"time"`
+	Method string    `json:"method"`
+	// Path is the path of the url, without the query, which may have
+	// secrets.
+	Path     string        `json:"path"`
+	Status   int           `json:"status,omitempty"`
+	Duration time.Duration `json:"duration"`
+	// RequestID is the X-GitHub-Request-Id of the response, to look the
+	// request up with github support.
+	RequestID string `json:"request_id,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Trace keeps the last http requests made by its clients. A nil Trace keeps
+// nothing.
+type Trace struct {
+	max int
+
+	mu       sync.Mutex
+	requests []*Request
+}
+
+// NewTrace returns a Trace keeping the last max requests.
+func NewTrace(max int) *Trace {
+	return &Trace{max: max}
+}
+
+// Requests returns the kept requests, oldest first.
+func (t *Trace) Requests() []*Request {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]*Request(nil), t.requests...)
+}
+
+func (t *Trace) add(r *Request) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.requests = append(t.requests, r)
+	if len(t.requests) > t.max {
+		t.requests = append([]*Request(nil), t.requests[len(t.requests)-t.max:]...)
+	}
+}
+
+// Client returns a copy of hc with a transport that records every request in
+// the trace. If hc is nil, a new client with the default transport is
+// returned.
+func (t *Trace) Client(hc *http.Client) *http.Client {
+	if t == nil {
+		return hc
+	}
+	var ret http.Client
+	if hc != nil {
+		ret = *hc
+	}
+	base := ret.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	ret.Transport = &transport{t: t, base: base}
+	return &ret
+}
+
+type transport struct {
+	t    *Trace
+	base http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := &Request{Time: time.Now().UTC(), Method: req.Method, Path: req.URL.Path}
+	resp, err := t.base.RoundTrip(req)
+	r.Duration = time.Since(r.Time)
+	if err != nil {
+		r.Error = err.Error()
+	} else {
+		r.Status = resp.StatusCode
+		r.RequestID = resp.Header.Get("X-GitHub-Request-Id")
+	}
+	t.t.add(r)
+	return resp, err
+}
+
+// Bundle is the crash report of a failed run.
+type Bundle struct {
+	Time time.Time `json:"time"`
+	// Step is the release step that failed, empty if the run failed
+	// outside the steps.
+	Step  string `json:"step,omitempty"`
+	Error string `json:"error"`
+	// Args is the command line of the run.
+	Args []string `json:"args"`
+	// Resume is the guidance printed to resume the run.
+	Resume string `json:"resume,omitempty"`
+
+	// Stack is the goroutine stack of a panic.
+	Stack []byte `json:"-"`
+	// State is the content of the release state file, encrypted if the
+	// state is.
+	State    []byte     `json:"-"`
+	Logs     []string   `json:"-"`
+	Requests []*Request `json:"-"`
+
+	// Redact, if not nil, scrubs the secrets from each file before it's
+	// written.
+	Redact func([]byte) []byte `json:"-"`
+}
+
+// Write writes the bundle to a new .tar.gz file at path, with the files:
+//
+//   - report.json, the step, error, command line and resume guidance;
+//   - stack.txt, the stack of the panic, if any;
+//   - state.json, the release state, if any, encrypted if the state is;
+//   - log.txt, the recent log lines;
+//   - requests.json, the recent github API requests.
+func (b *Bundle) Write(path string) error {
+	report, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	requests, err := json.MarshalIndent(b.Requests, "", "  ")
+	if err != nil {
+		return err
+	}
+	files := []struct {
+		name    string
+		content []byte
+	}{
+		{"report.json", report},
+		{"stack.txt", b.Stack},
+		{"state.json", b.State},
+		{"log.txt", []byte(strings.Join(b.Logs, "\n"))},
+		{"requests.json", requests},
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create crash bundle: %v", err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for _, file := range files {
+		if len(file.content) == 0 {
+			continue
+		}
+		content := file.content
+		if b.Redact != nil {
+			content = b.Redact(content)
+		}
+		if err := tw.WriteHeader(&tar.Header{Name: file.name, Mode: 0600, Size: int64(len(content)), ModTime: b.Time}); err != nil {
+			return fmt.Errorf("failed to write crash bundle: %v", err)
+		}
+		if _, err := tw.Write(content); err != nil {
+			return fmt.Errorf("failed to write crash bundle: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to write crash bundle: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to write crash bundle: %v", err)
+	}
+	return f.Close()
+}
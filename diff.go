@@ -0,0 +1,156 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/sniperkit/snk.fork.release-git-bot/cache"
+	"github.com/sniperkit/snk.fork.release-git-bot/config"
+	"github.com/sniperkit/snk.fork.release-git-bot/ghclient"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// releaseDiff is the difference between two releases, possibly on different
+// release branches.
+type releaseDiff struct {
+	A string `json:"a"`
+	B string `json:"b"`
+	// NewPRs are merged into B but not A. PRs cherry-picked into both lines
+	// (with the same title) are excluded.
+	NewPRs []*github.Issue `json:"new_prs"`
+	// MissingPRs are merged into A but not B, e.g. fixes only made on the
+	// older release branch.
+	MissingPRs []*github.Issue `json:"missing_prs"`
+	// Reverts are the titles of the revert commits in B but not A.
+	Reverts []string `json:"reverts"`
+	// NewContributors have commits in B, but no commit reachable from A.
+	NewContributors []string `json:"new_contributors"`
+}
+
+func runDiff(cfg *config.Config, args []string) error {
+	fs := newFlagSet("diff")
+	a := fs.String("a", "", "the older release tag, e.g. v1.29.3")
+	b := fs.String("b", "", "the newer release tag, e.g. v1.30.1")
+	format := fs.String("format", "markdown", "output format, markdown or json")
+	cacheDir := fs.String("cachedir", "", "the cache dir for fetched PRs, default to the user cache dir")
+	fs.Parse(args)
+	if *a == "" || *b == "" {
+		return fmt.Errorf("both -a and -b must be set")
+	}
+
+	c, err := cache.New(*cacheDir, stateKey)
+	if err != nil {
+		log.Warningf("failed to create cache, PRs won't be cached: %v", err)
+	}
+	upstream := newClient(upstreamUser, *repo)
+	d, err := diffReleases(upstream, c, *a, *b)
+	if err != nil {
+		return err
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(d)
+	}
+	fmt.Printf("# Changes in %v since %v\n\n", d.B, d.A)
+	printPRs := func(title string, prs []*github.Issue) {
+		fmt.Printf("## %v (%v)\n\n", title, len(prs))
+		for _, pr := range prs {
+			fmt.Printf(" * %v (#%v) @%v\n", pr.GetTitle(), pr.GetNumber(), pr.GetUser().GetLogin())
+		}
+		fmt.Println()
+	}
+	printPRs(fmt.Sprintf("PRs in %v but not %v", d.B, d.A), d.NewPRs)
+	printPRs(fmt.Sprintf("PRs in %v but not %v", d.A, d.B), d.MissingPRs)
+	fmt.Printf("## Reverted (%v)\n\n", len(d.Reverts))
+	for _, r := range d.Reverts {
+		fmt.Printf(" * %v\n", r)
+	}
+	fmt.Printf("\n## New contributors (%v)\n\n", len(d.NewContributors))
+	for _, login := range d.NewContributors {
+		fmt.Printf(" * @%v\n", login)
+	}
+	return nil
+}
+
+// diffReleases compares the two tags in both directions, so it works for tags
+// on different release branches.
+func diffReleases(upstream *ghclient.Client, c *cache.Cache, a, b string) (*releaseDiff, error) {
+	onlyB, err := upstream.GetCommitsBetweenContext(runCtx, a, b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commits between %v and %v: %v", a, b, err)
+	}
+	onlyA, err := upstream.GetCommitsBetweenContext(runCtx, b, a)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commits between %v and %v: %v", b, a, err)
+	}
+	prsB, contributorsB, err := prsForCommits(upstream, c, onlyB)
+	if err != nil {
+		return nil, err
+	}
+	prsA, _, err := prsForCommits(upstream, c, onlyA)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &releaseDiff{A: a, B: b}
+	titlesA := make(map[string]bool)
+	for _, pr := range prsA {
+		titlesA[normalizeTitle(pr.GetTitle())] = true
+	}
+	titlesB := make(map[string]bool)
+	for _, pr := range prsB {
+		titlesB[normalizeTitle(pr.GetTitle())] = true
+		if !titlesA[normalizeTitle(pr.GetTitle())] {
+			d.NewPRs = append(d.NewPRs, pr)
+		}
+	}
+	for _, pr := range prsA {
+		if !titlesB[normalizeTitle(pr.GetTitle())] {
+			d.MissingPRs = append(d.MissingPRs, pr)
+		}
+	}
+
+	for _, cmt := range onlyB {
+		title := strings.SplitN(cmt.GetCommit().GetMessage(), "\n", 2)[0]
+		if strings.HasPrefix(title, "Revert ") {
+			d.Reverts = append(d.Reverts, title)
+		}
+	}
+
+	for login := range contributorsB {
+		contributed, err := upstream.HasCommitsByContext(runCtx, a, login)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check commits by %v: %v", login, err)
+		}
+		if !contributed {
+			d.NewContributors = append(d.NewContributors, login)
+		}
+	}
+	sort.Strings(d.NewContributors)
+	return d, nil
+}
+
+// prRefRegexp matches PR references in titles, e.g. "(#123)" and
+// "[backport v1.29.x]".
+var prRefRegexp = regexp.MustCompile(`\(#\d+\)|\[[^\]]*\]`)
+
+// normalizeTitle removes PR references and cherry-pick markers from a PR
+// title, so a PR and its backport have the same title.
+func normalizeTitle(title string) string {
+	title = prRefRegexp.ReplaceAllString(title, "")
+	title = strings.TrimPrefix(strings.TrimSpace(title), "Cherry-pick")
+	title = strings.TrimPrefix(strings.TrimSpace(title), "cherry-pick")
+	title = strings.TrimPrefix(strings.TrimSpace(title), ":")
+	return strings.ToLower(strings.TrimSpace(title))
+}
@@ -0,0 +1,115 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/sniperkit/snk.fork.release-git-bot/config"
+	"github.com/sniperkit/snk.fork.release-git-bot/ghclient"
+	"github.com/sniperkit/snk.fork.release-git-bot/version"
+)
+
+// runPublishDraft publishes the draft release of -version once its assets are
+// all uploaded, e.g. from the CI job that built and verified them.
+func runPublishDraft(cfg *config.Config, args []string) error {
+	fs := newFlagSet("publish")
+	assets := fs.String("assets", "", "the asset names (globs) the draft must have to be published, format: glob1,glob2")
+	fs.Parse(args)
+	if *embargo != "" {
+		return fmt.Errorf("embargoed releases are published at the disclosure time, use disclose")
+	}
+	ver, err := versionScheme.Parse(*newVersion)
+	if err != nil {
+		return fmt.Errorf("invalid version string %q: %v", *newVersion, err)
+	}
+	release, err := publishDraft(newClient(upstreamUser, *repo), ver, *assets)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Release %v published\n", release.GetHTMLURL())
+	return nil
+}
+
+// publishDraft publishes the draft release of ver once its assets are all
+// uploaded, with one matching each of the comma separated globs, and with
+// -waitchecks, once the checks on its target are green.
+func publishDraft(upstream *ghclient.Client, ver *version.Version, assets string) (*github.RepositoryRelease, error) {
+	draft, err := upstream.FindDraftReleaseByTagContext(runCtx, ver.Tag())
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDraftAssets(draft, assets); err != nil {
+		return nil, fmt.Errorf("not publishing %v: %v", ver.Tag(), err)
+	}
+	if *waitChecks != 0 {
+		if _, err := upstream.WaitForChecksContext(runCtx, draft.GetTargetCommitish(), *waitChecks); err != nil {
+			return nil, fmt.Errorf("not publishing %v: %v", ver.Tag(), err)
+		}
+	}
+	release, err := upstream.PublishReleaseContext(runCtx, draft.GetID())
+	if err != nil {
+		return nil, fmt.Errorf("failed to publish %v: %v", ver.Tag(), err)
+	}
+	return release, nil
+}
+
+// createOrUpdateDraft creates the draft release of the tag, at the branch. If
+// a draft of the tag already exists, e.g. from a previous run or created by
+// hand, it's reused: its title, target and notes are replaced, and its assets
+// are kept. It's an error if the tag is already released.
+func createOrUpdateDraft(upstream *ghclient.Client, tag, branch, title, body string) (*github.RepositoryRelease, error) {
+	releases, err := upstream.ListReleasesContext(runCtx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list releases: %v", err)
+	}
+	for _, r := range releases {
+		if r.GetTagName() != tag {
+			continue
+		}
+		if !r.GetDraft() {
+			return nil, fmt.Errorf("%v is already released: %v", tag, r.GetHTMLURL())
+		}
+		fmt.Printf("Updating the existing draft release %v\n", r.GetHTMLURL())
+		return upstream.EditReleaseContext(runCtx, r.GetID(), &github.RepositoryRelease{
+			TargetCommitish: github.String(branch),
+			Name:            github.String(title),
+			Body:            github.String(body),
+		})
+	}
+	return upstream.CreateDraftReleaseContext(runCtx, tag, branch, title, body)
+}
+
+// checkDraftAssets checks that the assets of the draft are all uploaded, and
+// that there's one matching each of the comma separated globs.
+func checkDraftAssets(draft *github.RepositoryRelease, globs string) error {
+	for _, a := range draft.Assets {
+		if a.GetState() != "uploaded" {
+			return fmt.Errorf("asset %v is %v, not uploaded", a.GetName(), a.GetState())
+		}
+	}
+	if globs == "" {
+		return nil
+	}
+	for _, g := range strings.Split(globs, ",") {
+		g = strings.TrimSpace(g)
+		if _, err := path.Match(g, ""); err != nil {
+			return fmt.Errorf("invalid assets glob %q: %v", g, err)
+		}
+		found := false
+		for _, a := range draft.Assets {
+			if ok, _ := path.Match(g, a.GetName()); ok {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("no asset matches %q", g)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/sniperkit/snk.fork.release-git-bot/clock"
+	"github.com/sniperkit/snk.fork.release-git-bot/config"
+	"github.com/sniperkit/snk.fork.release-git-bot/ghclient"
+	"github.com/sniperkit/snk.fork.release-git-bot/state"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	embargo  = flag.String("embargo", "", "security release mode: the coordinated disclosure time, in RFC 3339 (e.g. 2018-08-01T16:00:00Z), or without offset in the timezone of the config (e.g. 2018-08-01T09:00). The security PRs are left out of the draft notes, and the release is published with the -advisory text only at that time")
+	advisory = flag.String("advisory", "", "the markdown file of the security advisory, swapped into the notes of an -embargo release when it's disclosed. It's read at the disclosure time, so it can be edited until then")
+)
+
+// advisoryPlaceholder marks where the advisory goes in the draft notes of an
+// embargoed release.
+const advisoryPlaceholder = "<!-- security advisory -->"
+
+// securityLabel is the label of the security PRs left out of the draft notes.
+const securityLabel = "Type: Security"
+
+// embargoPollInterval is how often the disclosure time is checked.
+const embargoPollInterval = time.Minute
+
+// embargoTime returns the parsed -embargo, and false if it's not set.
+func embargoTime() (time.Time, bool) {
+	if *embargo == "" {
+		return time.Time{}, false
+	}
+	t, err := parseTime(*embargo)
+	if err != nil {
+		log.Fatalf("invalid -embargo %q: %v", *embargo, err)
+	}
+	return t, true
+}
+
+// embargoFilter returns the Embargoed notes filter, nil if -embargo is not set.
+func embargoFilter() func(pr *github.Issue) bool {
+	if _, ok := embargoTime(); !ok {
+		return nil
+	}
+	return func(pr *github.Issue) bool {
+		for _, l := range pr.Labels {
+			if l.GetName() == securityLabel {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// embargoNotes adds the security section to the draft notes, with the
+// placeholder the advisory replaces at the disclosure time t.
+func embargoNotes(markdown string, t time.Time) string {
+	return fmt.Sprintf("# Security\n\n%v\nDetails will be published on %v.\n%v\n\n%v",
+		advisoryPlaceholder, t.In(releaseZone).Format(time.RFC1123), advisoryPlaceholder, markdown)
+}
+
+// disclose waits until the disclosure time in the state, swaps the advisory
+// into the notes of the draft release, and publishes it. If the bot is
+// interrupted while waiting, it exits with the instructions to resume at step.
+func disclose(upstream *ghclient.Client, st *state.State, step string) {
+	t, err := time.Parse(time.RFC3339, st.Get("embargo"))
+	if err != nil {
+		log.Fatalf("invalid embargo in %v: %v", st.Path(), err)
+	}
+	id, err := strconv.ParseInt(st.Get("draft_release_id"), 10, 64)
+	if err != nil {
+		log.Fatalf("no draft release in %v", st.Path())
+	}
+	for now := botClock.Now(); now.Before(t); now = botClock.Now() {
+		if atomic.LoadInt32(&interrupted) != 0 {
+			exitForResume(st, step)
+		}
+		fmt.Printf("Embargoed until %v, %v left\n", t.In(releaseZone).Format(time.RFC1123), t.Sub(now).Round(time.Second))
+		wait := t.Sub(now)
+		if wait > embargoPollInterval {
+			wait = embargoPollInterval
+		}
+		clock.Sleep(botClock, wait)
+	}
+
+	if *advisory == "" {
+		log.Fatal("the embargo is over, but there's no -advisory to disclose")
+	}
+	text, err := ioutil.ReadFile(*advisory)
+	if err != nil {
+		log.Fatalf("failed to read advisory: %v", err)
+	}
+	release, err := upstream.GetReleaseContext(runCtx, id)
+	if err != nil {
+		log.Fatalf("failed to get draft release: %v", err)
+	}
+	parts := strings.Split(release.GetBody(), advisoryPlaceholder)
+	if len(parts) != 3 {
+		log.Fatalf("the placeholders of the advisory are missing in the notes of %v", release.GetHTMLURL())
+	}
+	body := parts[0] + strings.TrimSpace(string(text)) + parts[2]
+	release, err = upstream.UpdateReleaseContext(runCtx, id, body, true)
+	if err != nil {
+		log.Fatalf("failed to publish release: %v", err)
+	}
+	fmt.Println("Advisory disclosed, release published: ", release.GetHTMLURL())
+}
+
+func runDisclose(cfg *config.Config, args []string) error {
+	fs := newFlagSet("disclose")
+	fs.Parse(args)
+	ver, err := versionScheme.Parse(*newVersion)
+	if err != nil {
+		return fmt.Errorf("invalid version string %q: %v", *newVersion, err)
+	}
+	st, err := state.Load(stateFilePath(ver), upstreamUser+"/"+*repo, ver.String(), stateKey)
+	if err != nil {
+		return err
+	}
+	if st.Get("embargo") == "" {
+		return fmt.Errorf("%v is not an embargoed release", ver.String())
+	}
+	handleSignals()
+	upstream := newClient(upstreamUser, *repo)
+	runStep(st, "wait for release published", func() {
+		disclose(upstream, st, "wait for release published")
+	})
+	return nil
+}
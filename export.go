@@ -0,0 +1,245 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/sniperkit/snk.fork.release-git-bot/config"
+	"github.com/sniperkit/snk.fork.release-git-bot/ghclient"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// exportRecord is one issue or PR of an exported milestone. The PR fields are
+// only set with -prs.
+type exportRecord struct {
+	Type      string     `json:"type"`
+	Number    int        `json:"number"`
+	Title     string     `json:"title"`
+	State     string     `json:"state"`
+	Author    string     `json:"author"`
+	Labels    []string   `json:"labels"`
+	Assignees []string   `json:"assignees"`
+	Milestone string     `json:"milestone"`
+	Comments  int        `json:"comments"`
+	CreatedAt *time.Time `json:"created_at"`
+	UpdatedAt *time.Time `json:"updated_at"`
+	ClosedAt  *time.Time `json:"closed_at"`
+	ClosedBy  string     `json:"closed_by,omitempty"`
+	URL       string     `json:"url"`
+	Body      string     `json:"body"`
+
+	Merged       *bool      `json:"merged,omitempty"`
+	MergedAt     *time.Time `json:"merged_at,omitempty"`
+	MergedBy     string     `json:"merged_by,omitempty"`
+	MergeCommit  string     `json:"merge_commit,omitempty"`
+	Base         string     `json:"base,omitempty"`
+	Head         string     `json:"head,omitempty"`
+	Commits      *int       `json:"commits,omitempty"`
+	Additions    *int       `json:"additions,omitempty"`
+	Deletions    *int       `json:"deletions,omitempty"`
+	ChangedFiles *int       `json:"changed_files,omitempty"`
+}
+
+// exportColumns are the CSV columns, in the order of exportRecord.row.
+var exportColumns = []string{
+	"type", "number", "title", "state", "author", "labels", "assignees", "milestone", "comments",
+	"created_at", "updated_at", "closed_at", "closed_by", "url", "body",
+	"merged", "merged_at", "merged_by", "merge_commit", "base", "head", "commits", "additions", "deletions", "changed_files",
+}
+
+func newExportRecord(i *github.Issue) *exportRecord {
+	r := &exportRecord{
+		Type:      "issue",
+		Number:    i.GetNumber(),
+		Title:     i.GetTitle(),
+		State:     i.GetState(),
+		Author:    i.GetUser().GetLogin(),
+		Labels:    []string{},
+		Assignees: []string{},
+		Milestone: i.GetMilestone().GetTitle(),
+		Comments:  i.GetComments(),
+		CreatedAt: i.CreatedAt,
+		UpdatedAt: i.UpdatedAt,
+		ClosedAt:  i.ClosedAt,
+		ClosedBy:  i.GetClosedBy().GetLogin(),
+		URL:       i.GetHTMLURL(),
+		Body:      i.GetBody(),
+	}
+	if i.PullRequestLinks != nil {
+		r.Type = "pr"
+	}
+	for _, l := range i.Labels {
+		r.Labels = append(r.Labels, l.GetName())
+	}
+	for _, a := range i.Assignees {
+		r.Assignees = append(r.Assignees, a.GetLogin())
+	}
+	return r
+}
+
+// addPR sets the merge details and size of the PR.
+func (r *exportRecord) addPR(pr *github.PullRequest) {
+	r.Merged = pr.Merged
+	r.MergedAt = pr.MergedAt
+	r.MergedBy = pr.GetMergedBy().GetLogin()
+	r.MergeCommit = pr.GetMergeCommitSHA()
+	r.Base = pr.GetBase().GetRef()
+	r.Head = pr.GetHead().GetLabel()
+	r.Commits = pr.Commits
+	r.Additions = pr.Additions
+	r.Deletions = pr.Deletions
+	r.ChangedFiles = pr.ChangedFiles
+}
+
+// row returns the CSV row of the record. Lists are joined with ";", times are
+// RFC 3339 in UTC, and unset fields are empty.
+func (r *exportRecord) row() []string {
+	t := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339)
+	}
+	n := func(n *int) string {
+		if n == nil {
+			return ""
+		}
+		return strconv.Itoa(*n)
+	}
+	merged := ""
+	if r.Merged != nil {
+		merged = strconv.FormatBool(*r.Merged)
+	}
+	return []string{
+		r.Type, strconv.Itoa(r.Number), r.Title, r.State, r.Author,
+		strings.Join(r.Labels, ";"), strings.Join(r.Assignees, ";"), r.Milestone, strconv.Itoa(r.Comments),
+		t(r.CreatedAt), t(r.UpdatedAt), t(r.ClosedAt), r.ClosedBy, r.URL, r.Body,
+		merged, t(r.MergedAt), r.MergedBy, r.MergeCommit, r.Base, r.Head,
+		n(r.Commits), n(r.Additions), n(r.Deletions), n(r.ChangedFiles),
+	}
+}
+
+// exportWriter writes the records of an export, one at a time.
+type exportWriter interface {
+	Write(r *exportRecord) error
+	// Flush writes the buffered records, after each page.
+	Flush() error
+}
+
+type ndjsonWriter struct {
+	enc *json.Encoder
+}
+
+func (w *ndjsonWriter) Write(r *exportRecord) error { return w.enc.Encode(r) }
+func (w *ndjsonWriter) Flush() error                { return nil }
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func (w *csvWriter) Write(r *exportRecord) error { return w.w.Write(r.row()) }
+
+func (w *csvWriter) Flush() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+func newExportWriter(format string, out io.Writer) (exportWriter, error) {
+	switch format {
+	case "ndjson":
+		enc := json.NewEncoder(out)
+		enc.SetEscapeHTML(false)
+		return &ndjsonWriter{enc: enc}, nil
+	case "csv":
+		w := csv.NewWriter(out)
+		if err := w.Write(exportColumns); err != nil {
+			return nil, err
+		}
+		return &csvWriter{w: w}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q, ndjson or csv", format)
+}
+
+// runExport dumps all the issues and PRs of a milestone, one record per line,
+// for analytics. The records are written page by page as they're listed, so
+// the export of a huge milestone is streamed.
+func runExport(cfg *config.Config, args []string) error {
+	fs := newFlagSet("export")
+	title := fs.String("title", "", "the milestone title, default to the milestone of -version (and the -milestone candidates)")
+	format := fs.String("format", "ndjson", "output format, ndjson (newline-delimited JSON) or csv")
+	output := fs.String("o", "", "the output file, default to stdout")
+	prs := fs.Bool("prs", false, "add the merge details and size of the PRs, one more API request per PR")
+	fs.Parse(args)
+
+	candidates := []string{*title}
+	if *title == "" {
+		ver, err := versionScheme.Parse(*newVersion)
+		if err != nil {
+			return fmt.Errorf("-title is not set, and invalid version string %q: %v", *newVersion, err)
+		}
+		candidates = append([]string{ver.Milestone()}, milestoneAliases(ver)...)
+	}
+	upstream := newClient(upstreamUser, *repo)
+	m, err := upstream.FindMilestoneContext(runCtx, candidates...)
+	if err != nil {
+		return fmt.Errorf("failed to find the milestone: %v", err)
+	}
+
+	out := io.Writer(os.Stdout)
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("failed to create %v: %v", *output, err)
+		}
+		defer f.Close()
+		out = f
+	}
+	w, err := newExportWriter(*format, out)
+	if err != nil {
+		return err
+	}
+	count := 0
+	err = upstream.ListMilestoneIssuesContext(runCtx, m.GetNumber(), func(page []*github.Issue) error {
+		for _, i := range page {
+			r := newExportRecord(i)
+			if *prs && r.Type == "pr" {
+				if err := addExportPR(upstream, r); err != nil {
+					return err
+				}
+			}
+			if err := w.Write(r); err != nil {
+				return fmt.Errorf("failed to write #%v: %v", r.Number, err)
+			}
+			count++
+		}
+		return w.Flush()
+	})
+	if err != nil {
+		return fmt.Errorf("failed to export milestone %q: %v", m.GetTitle(), err)
+	}
+	log.Infof("exported %v issues and PRs of milestone %q", count, m.GetTitle())
+	if f, ok := out.(*os.File); ok && f != os.Stdout {
+		return f.Close()
+	}
+	return nil
+}
+
+func addExportPR(c *ghclient.Client, r *exportRecord) error {
+	pr, err := c.GetPullRequestContext(runCtx, r.Number)
+	if err != nil {
+		return fmt.Errorf("failed to get PR #%v: %v", r.Number, err)
+	}
+	r.addPR(pr)
+	return nil
+}
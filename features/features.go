@@ -0,0 +1,127 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+// Package features turns the experimental steps of the release flow on or off,
+// so they can be adopted one repo at a time before they become the default.
+//
+// A feature is off unless it's turned on, in order of precedence, by:
+//
+//   - $RELEASE_BOT_FEATURES, a comma separated list of names, prefixed with
+//     "-" to turn them off, e.g. "auto_publish,-auto_merge";
+//   - the repos overrides of the config, for the released repo;
+//   - the flags of the config.
+package features
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sniperkit/snk.fork.release-git-bot/config"
+)
+
+// Env is the env var overriding the features of the config.
+const Env = "RELEASE_BOT_FEATURES"
+
+// The experimental features.
+const (
+	// AutoMerge merges the version pull requests once they are ready, like
+	// -merge with the merge method, without the flag.
+	AutoMerge = "auto_merge"
+	// AutoPublish publishes the draft release once its assets are uploaded
+	// (and with -waitchecks, its checks are green), instead of waiting for a
+	// human to publish it.
+	AutoPublish = "auto_publish"
+)
+
+// Known are the experimental features, with their descriptions.
+var Known = map[string]string{
+	AutoMerge:   "merge the version pull requests once they are ready, without -merge",
+	AutoPublish: "publish the draft release once its assets are uploaded, instead of waiting for a human",
+}
+
+// Set is the features of a release. A nil Set has every feature off.
+type Set struct {
+	on map[string]bool
+}
+
+// New returns the features of the repo ("owner/repo") with the config c, and
+// the value of Env. It's an error if a feature is unknown.
+func New(c *config.Features, repo, env string) (*Set, error) {
+	s := &Set{on: make(map[string]bool)}
+	if c != nil {
+		if err := s.apply(c.Flags); err != nil {
+			return nil, fmt.Errorf("invalid features: %v", err)
+		}
+		if err := s.apply(c.Repos[repo]); err != nil {
+			return nil, fmt.Errorf("invalid features of %v: %v", repo, err)
+		}
+	}
+	env = strings.TrimSpace(env)
+	if env == "" {
+		return s, nil
+	}
+	flags := make(map[string]bool)
+	for _, name := range strings.Split(env, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			// e.g. a trailing comma.
+			continue
+		}
+		flags[strings.TrimPrefix(name, "-")] = !strings.HasPrefix(name, "-")
+	}
+	if err := s.apply(flags); err != nil {
+		return nil, fmt.Errorf("invalid $%v: %v", Env, err)
+	}
+	return s, nil
+}
+
+func (s *Set) apply(flags map[string]bool) error {
+	for name, on := range flags {
+		if _, ok := Known[name]; !ok {
+			return fmt.Errorf("unknown feature %q", name)
+		}
+		s.on[name] = on
+	}
+	return nil
+}
+
+// Enabled returns whether the feature is on.
+func (s *Set) Enabled(name string) bool {
+	if s == nil {
+		return false
+	}
+	return s.on[name]
+}
+
+// Active returns the names of the features on, sorted.
+func (s *Set) Active() []string {
+	if s == nil {
+		return nil
+	}
+	var ret []string
+	for name, on := range s.on {
+		if on {
+			ret = append(ret, name)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Banner returns the warning listing the features on, to be printed before
+// the release starts, or "" if there's none.
+func (s *Set) Banner() string {
+	active := s.Active()
+	if len(active) == 0 {
+		return ""
+	}
+	line := strings.Repeat("!", 78)
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v\n!! EXPERIMENTAL features are on, they may change or be removed:\n", line)
+	for _, name := range active {
+		fmt.Fprintf(&b, "!!   %v: %v\n", name, Known[name])
+	}
+	fmt.Fprintf(&b, "%v\n", line)
+	return b.String()
+}
@@ -0,0 +1,167 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+// Package gdocs exports text to Google Docs and reads it back, with the Docs
+// and Drive REST APIs, so the release notes can be reviewed where the
+// stakeholders review documents.
+//
+// The requests are authorized with an OAuth access token with the
+// https://www.googleapis.com/auth/drive.file scope, e.g. from
+// "gcloud auth print-access-token" or a service account.
+package gdocs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// The API urls.
+const (
+	DocsURL  = "https://docs.googleapis.com/v1/documents"
+	DriveURL = "https://www.googleapis.com/drive/v3/files"
+)
+
+// Client calls the Docs and Drive APIs.
+type Client struct {
+	// HTTP is the http client of the requests. If nil, it's
+	// http.DefaultClient.
+	HTTP *http.Client
+	// Token is the OAuth access token.
+	Token string
+}
+
+// Doc is a Google Doc.
+type Doc struct {
+	ID    string
+	Title string
+}
+
+// URL returns the url to open the doc in the browser.
+func (d *Doc) URL() string {
+	return fmt.Sprintf("https://docs.google.com/document/d/%v/edit", d.ID)
+}
+
+// Create creates a doc with the title and the plain text, in the Drive root
+// of the token user, or in the Drive folder if it's not empty.
+func (c *Client) Create(ctx context.Context, title, text, folder string) (*Doc, error) {
+	var created struct {
+		DocumentID string `json:"documentId"`
+		Title      string `json:"title"`
+	}
+	if err := c.do(ctx, http.MethodPost, DocsURL, map[string]string{"title": title}, &created); err != nil {
+		return nil, fmt.Errorf("failed to create doc: %v", err)
+	}
+	d := &Doc{ID: created.DocumentID, Title: created.Title}
+	if text != "" {
+		req := map[string]interface{}{
+			"requests": []interface{}{
+				map[string]interface{}{
+					"insertText": map[string]interface{}{
+						"location": map[string]int{"index": 1},
+						"text":     text,
+					},
+				},
+			},
+		}
+		if err := c.do(ctx, http.MethodPost, DocsURL+"/"+d.ID+":batchUpdate", req, nil); err != nil {
+			return d, fmt.Errorf("failed to write doc %v: %v", d.ID, err)
+		}
+	}
+	if folder != "" {
+		u := fmt.Sprintf("%v/%v?addParents=%v&removeParents=root", DriveURL, d.ID, url.QueryEscape(folder))
+		if err := c.do(ctx, http.MethodPatch, u, map[string]string{}, nil); err != nil {
+			return d, fmt.Errorf("failed to move doc %v to folder %v: %v", d.ID, folder, err)
+		}
+	}
+	return d, nil
+}
+
+// Share gives the user with the email the role on the doc: "reader",
+// "commenter" or "writer". Google notifies the user by email.
+func (c *Client) Share(ctx context.Context, id, email, role string) error {
+	req := map[string]string{"type": "user", "role": role, "emailAddress": email}
+	if err := c.do(ctx, http.MethodPost, DriveURL+"/"+id+"/permissions", req, nil); err != nil {
+		return fmt.Errorf("failed to share doc %v with %v: %v", id, email, err)
+	}
+	return nil
+}
+
+// Text returns the plain text of the doc, with the trailing newline Docs
+// always adds trimmed to one.
+func (c *Client) Text(ctx context.Context, id string) (string, error) {
+	var doc struct {
+		Body struct {
+			Content []struct {
+				Paragraph *struct {
+					Elements []struct {
+						TextRun *struct {
+							Content string `json:"content"`
+						} `json:"textRun"`
+					} `json:"elements"`
+				} `json:"paragraph"`
+			} `json:"content"`
+		} `json:"body"`
+	}
+	if err := c.do(ctx, http.MethodGet, DocsURL+"/"+id, nil, &doc); err != nil {
+		return "", fmt.Errorf("failed to read doc %v: %v", id, err)
+	}
+	var b bytes.Buffer
+	for _, s := range doc.Body.Content {
+		if s.Paragraph == nil {
+			// Tables and section breaks are not notes text.
+			continue
+		}
+		for _, e := range s.Paragraph.Elements {
+			if e.TextRun != nil {
+				b.WriteString(e.TextRun.Content)
+			}
+		}
+	}
+	return strings.TrimRight(b.String(), "\n") + "\n", nil
+}
+
+// do sends the request with the JSON body (if not nil), and decodes the JSON
+// response into out (if not nil).
+func (c *Client) do(ctx context.Context, method, u string, body, out interface{}) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, u, r)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	hc := c.HTTP
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%v %v: %v: %s", method, req.URL.Path, resp.Status, bytes.TrimSpace(msg))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
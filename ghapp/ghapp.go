@@ -0,0 +1,210 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+// Package ghapp authenticates as a GitHub App installation instead of with a
+// personal access token: requests are signed with an installation token,
+// created from a JWT signed with the app private key, cached, and renewed
+// before it expires.
+//
+//	t, err := ghapp.NewFromKeyFile(appID, installationID, "app.private-key.pem")
+//	if err != nil {
+//		...
+//	}
+//	c := ghclient.New(t.Client(), "grpc", "grpc-go")
+package ghapp
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sniperkit/snk.fork.release-git-bot/clock"
+)
+
+// DefaultBaseURL is the github.com API url.
+const DefaultBaseURL = "https://api.github.com/"
+
+const (
+	// jwtLifetime is the lifetime of the app JWT, github allows up to 10
+	// minutes.
+	jwtLifetime = 9 * time.Minute
+	// clockSkew is how far back the JWT is issued, in case the local clock is
+	// ahead of github's.
+	clockSkew = time.Minute
+	// refreshMargin is how long before its expiry the installation token is
+	// renewed, so a request never goes out with an expired token.
+	refreshMargin = 5 * time.Minute
+)
+
+// Transport is an http.RoundTripper authenticating the requests as the app
+// installation. It's safe for concurrent use.
+type Transport struct {
+	// BaseURL is the API url the tokens are created with, DefaultBaseURL if
+	// empty. Set it for GitHub Enterprise Server, e.g.
+	// "https://github.example.com/api/v3/".
+	BaseURL string
+	// Base is the transport of the requests, http.DefaultTransport if nil.
+	Base http.RoundTripper
+	// Clock is the time the tokens are checked for expiry with. If nil, it's
+	// clock.Real.
+	Clock clock.Clock
+
+	appID          int64
+	installationID int64
+	key            *rsa.PrivateKey
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// New creates a Transport for the installation of the app, signing the JWTs
+// with key.
+func New(appID, installationID int64, key *rsa.PrivateKey) *Transport {
+	return &Transport{appID: appID, installationID: installationID, key: key}
+}
+
+// NewFromKeyFile creates a Transport with the PEM encoded private key in the
+// file, as downloaded from the app settings.
+func NewFromKeyFile(appID, installationID int64, path string) (*Transport, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read app private key: %v", err)
+	}
+	key, err := ParseKey(b)
+	if err != nil {
+		return nil, err
+	}
+	return New(appID, installationID, key), nil
+}
+
+// ParseKey parses a PEM encoded RSA private key, in PKCS#1 or PKCS#8.
+func ParseKey(b []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("app private key is not PEM encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse app private key: %v", err)
+	}
+	key, ok := k.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("app private key is not an RSA key")
+	}
+	return key, nil
+}
+
+// Client returns an http client with the transport.
+func (t *Transport) Client() *http.Client {
+	return &http.Client{Transport: t}
+}
+
+// RoundTrip sends the request with the installation token.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.Token()
+	if err != nil {
+		return nil, err
+	}
+	// The request must not be modified, see http.RoundTripper.
+	req = req.WithContext(req.Context())
+	header := make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		header[k] = v
+	}
+	req.Header = header
+	req.Header.Set("Authorization", "token "+token)
+	return t.base().RoundTrip(req)
+}
+
+// Token returns the installation token, renewed if it expires soon. It's also
+// the password to push with git, as user "x-access-token".
+func (t *Transport) Token() (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := clock.Or(t.Clock).Now()
+	if t.token != "" && now.Add(refreshMargin).Before(t.expires) {
+		return t.token, nil
+	}
+	jwt, err := t.jwt(now)
+	if err != nil {
+		return "", err
+	}
+	url := fmt.Sprintf("%vapp/installations/%v/access_tokens", t.baseURL(), t.installationID)
+	req, err := http.NewRequest(http.MethodPost, url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	resp, err := t.base().RoundTrip(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to create installation token: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return "", fmt.Errorf("failed to create installation token: %v: %s", resp.Status, b)
+	}
+	var out struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("failed to parse installation token: %v", err)
+	}
+	t.token, t.expires = out.Token, out.ExpiresAt
+	return t.token, nil
+}
+
+// jwt returns the app JWT, signed with RS256.
+func (t *Transport) jwt(now time.Time) (string, error) {
+	enc := base64.RawURLEncoding
+	header := enc.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, err := json.Marshal(map[string]interface{}{
+		"iat": now.Add(-clockSkew).Unix(),
+		"exp": now.Add(jwtLifetime).Unix(),
+		"iss": t.appID,
+	})
+	if err != nil {
+		return "", err
+	}
+	signed := header + "." + enc.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, t.key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign app JWT: %v", err)
+	}
+	return signed + "." + enc.EncodeToString(sig), nil
+}
+
+func (t *Transport) baseURL() string {
+	if t.BaseURL == "" {
+		return DefaultBaseURL
+	}
+	if !strings.HasSuffix(t.BaseURL, "/") {
+		return t.BaseURL + "/"
+	}
+	return t.BaseURL
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base == nil {
+		return http.DefaultTransport
+	}
+	return t.Base
+}
@@ -0,0 +1,109 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package ghclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/google/go-github/github"
+	log "github.com/sirupsen/logrus"
+)
+
+// ChecksumsAsset is the name of the checksums asset uploaded by
+// UploadChecksumsContext, in the format of sha256sum.
+const ChecksumsAsset = "sha256sums.txt"
+
+// UploadedAsset is a file uploaded to a release.
+type UploadedAsset struct {
+	// Name is the asset name, the base name of the file.
+	Name string
+	// URL is the download url of the asset.
+	URL string
+	// SHA256 is the hex SHA-256 checksum of the file.
+	SHA256 string
+}
+
+// UploadReleaseAssetsContext uploads the files at paths to the release, in
+// order, and returns the uploaded assets with their checksums. The files are
+// streamed from disk, not read in memory. It stops at the first failure, and
+// returns the assets uploaded so far with the error.
+func (c *Client) UploadReleaseAssetsContext(ctx context.Context, releaseID int64, paths ...string) ([]*UploadedAsset, error) {
+	names := make(map[string]string)
+	for _, p := range paths {
+		name := filepath.Base(p)
+		if other, ok := names[name]; ok {
+			return nil, fmt.Errorf("%v and %v have the same asset name %v", other, p, name)
+		}
+		names[name] = p
+	}
+	var ret []*UploadedAsset
+	for _, p := range paths {
+		a, err := c.uploadAsset(ctx, releaseID, p)
+		if err != nil {
+			return ret, fmt.Errorf("failed to upload %v: %v", p, err)
+		}
+		ret = append(ret, a)
+	}
+	return ret, nil
+}
+
+// uploadAsset hashes the file, then uploads it.
+func (c *Client) uploadAsset(ctx context.Context, releaseID int64, path string) (*UploadedAsset, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	name := filepath.Base(path)
+	asset, _, err := c.c.Repositories.UploadReleaseAsset(ctx, c.owner, c.repo, releaseID,
+		&github.UploadOptions{Name: name}, f)
+	if err != nil {
+		return nil, diagnose(err)
+	}
+	log.Infof("asset uploaded: %s", asset.GetBrowserDownloadURL())
+	return &UploadedAsset{Name: name, URL: asset.GetBrowserDownloadURL(), SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// Checksums returns the content of the checksums file of the assets, a line
+// "<hex>  <name>" per asset sorted by name, as printed by sha256sum.
+func Checksums(assets []*UploadedAsset) []byte {
+	sorted := append([]*UploadedAsset(nil), assets...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	var b bytes.Buffer
+	for _, a := range sorted {
+		fmt.Fprintf(&b, "%v  %v\n", a.SHA256, a.Name)
+	}
+	return b.Bytes()
+}
+
+// UploadChecksumsContext uploads the checksums of the assets to the release,
+// as ChecksumsAsset, and returns its download url.
+func (c *Client) UploadChecksumsContext(ctx context.Context, releaseID int64, assets []*UploadedAsset) (string, error) {
+	dir, err := ioutil.TempDir("", "release-git-bot-checksums")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+	p := filepath.Join(dir, ChecksumsAsset)
+	if err := ioutil.WriteFile(p, Checksums(assets), 0644); err != nil {
+		return "", err
+	}
+	return c.UploadReleaseAssetContext(ctx, releaseID, p)
+}
@@ -0,0 +1,107 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package ghclient
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sniperkit/snk.fork.release-git-bot/clock"
+)
+
+// EnableAutoMergeContext enables the auto-merge of the pull request with the
+// method ("merge", "squash" or "rebase"): github merges it once it meets the
+// requirements of its base branch, even if the bot is gone. The repo must
+// allow auto-merge.
+func (c *Client) EnableAutoMergeContext(ctx context.Context, number int, method string) error {
+	var pr struct {
+		Repository struct {
+			PullRequest struct {
+				ID string `json:"id"`
+			} `json:"pullRequest"`
+		} `json:"repository"`
+	}
+	if err := c.graphQL(ctx, `query($owner: String!, $repo: String!, $number: Int!) {
+	repository(owner: $owner, name: $repo) { pullRequest(number: $number) { id } }
+}`, map[string]interface{}{"owner": c.owner, "repo": c.repo, "number": number}, &pr); err != nil {
+		return fmt.Errorf("failed to get PR #%v: %v", number, err)
+	}
+	if err := c.graphQL(ctx, `mutation($id: ID!, $method: PullRequestMergeMethod!) {
+	enablePullRequestAutoMerge(input: {pullRequestId: $id, mergeMethod: $method}) { clientMutationId }
+}`, map[string]interface{}{"id": pr.Repository.PullRequest.ID, "method": strings.ToUpper(method)}, nil); err != nil {
+		return fmt.Errorf("failed to enable auto-merge of PR #%v: %v", number, err)
+	}
+	log.Infof("auto-merge of PR #%v enabled", number)
+	return nil
+}
+
+// MergeWait configures WaitAndMergeContext.
+type MergeWait struct {
+	// Interval is the time between the polls, a minute if 0.
+	Interval time.Duration
+	// Clock is the time of the polls. If nil, it's clock.Real.
+	Clock clock.Clock
+	// Waiting, if set, is called with what the pull request still needs
+	// before each wait.
+	Waiting func(missing []string)
+}
+
+// WaitAndMergeContext polls the checks and the reviews of the pull request,
+// and merges it with the method once the checks are green and it meets the
+// requirements of its base branch. It returns a *ChecksFailedError as soon as
+// a check fails, and doesn't merge.
+func (c *Client) WaitAndMergeContext(ctx context.Context, number int, method string, w *MergeWait) error {
+	if w == nil {
+		w = &MergeWait{}
+	}
+	interval := w.Interval
+	if interval == 0 {
+		interval = time.Minute
+	}
+	for {
+		missing, err := c.mergeOnce(ctx, number, method)
+		if err != nil || len(missing) == 0 {
+			return err
+		}
+		if w.Waiting != nil {
+			w.Waiting(missing)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-clock.Or(w.Clock).After(interval):
+		}
+	}
+}
+
+// mergeOnce merges the pull request if it's ready, or returns what it still
+// needs.
+func (c *Client) mergeOnce(ctx context.Context, number int, method string) ([]string, error) {
+	s, err := c.GetChecksStatusContext(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case s.Merged:
+		log.Infof("PR #%v already merged", number)
+		return nil, nil
+	case len(s.Failed) > 0:
+		return nil, &ChecksFailedError{Status: s}
+	}
+	switch {
+	case s.Checks == 0:
+		// Like WaitForChecksContext, CI may not have reported yet.
+		return []string{"checks (none reported yet)"}, nil
+	case len(s.Pending) > 0:
+		return []string{"checks " + strings.Join(s.Pending, ", ")}, nil
+	}
+	err = c.MergePullRequestContext(ctx, number, method)
+	if nerr, ok := err.(*NotMergeableError); ok {
+		return nerr.Status.Missing(), nil
+	}
+	return nil, err
+}
@@ -0,0 +1,56 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package ghclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+// newTestClient returns a client of the repo o/r on the API served by h.
+func newTestClient(t *testing.T, h http.Handler) *Client {
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	c := New(nil, "o", "r")
+	u, err := url.Parse(srv.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.c.BaseURL = u
+	return c
+}
+
+func TestMergeOnceNoChecksYet(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/o/r/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"number": 1, "head": {"sha": "abc"}, "base": {"ref": "main"}}`)
+	})
+	mux.HandleFunc("/repos/o/r/branches/main", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"name": "main", "protected": false}`)
+	})
+	mux.HandleFunc("/repos/o/r/commits/abc/status", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"state": "pending", "statuses": []}`)
+	})
+	mux.HandleFunc("/repos/o/r/commits/abc/check-runs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"total_count": 0, "check_runs": []}`)
+	})
+	mux.HandleFunc("/repos/o/r/pulls/1/merge", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("PR merged before any check was reported")
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	c := newTestClient(t, mux)
+
+	missing, err := c.mergeOnce(context.Background(), 1, "merge")
+	if err != nil {
+		t.Fatalf("mergeOnce() failed: %v", err)
+	}
+	if want := []string{"checks (none reported yet)"}; !reflect.DeepEqual(missing, want) {
+		t.Errorf("mergeOnce() = %q, want %q", missing, want)
+	}
+}
@@ -0,0 +1,133 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package ghclient
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"github.com/google/go-github/github"
+	log "github.com/sirupsen/logrus"
+	"github.com/sniperkit/snk.fork.release-git-bot/refs"
+)
+
+// DeleteBranchContext deletes the branch.
+func (c *Client) DeleteBranchContext(ctx context.Context, branch string) error {
+	log.Infof("deleting %v/%v %v", c.owner, c.repo, refs.BranchRef(branch).Full())
+	_, err := c.c.Git.DeleteRef(ctx, c.owner, c.repo, refs.BranchRef(branch).Short())
+	return diagnose(err)
+}
+
+// DefaultBranchContext returns the default branch of the repo, e.g. "main",
+// as set by SetDefaultBranch, or from the repo settings. The branch from the
+// settings is cached.
+func (c *Client) DefaultBranchContext(ctx context.Context) (string, error) {
+	c.defaultBranchMu.Lock()
+	defer c.defaultBranchMu.Unlock()
+	if c.defaultBranch != "" {
+		return c.defaultBranch, nil
+	}
+	r, _, err := c.c.Repositories.Get(ctx, c.owner, c.repo)
+	if err != nil {
+		return "", diagnose(err)
+	}
+	if r.GetDefaultBranch() == "" {
+		return "", fmt.Errorf("%v/%v has no default branch, is it empty?", c.owner, c.repo)
+	}
+	c.defaultBranch = r.GetDefaultBranch()
+	return c.defaultBranch, nil
+}
+
+// SetDefaultBranch overrides the default branch of the repo, e.g. when the
+// token can't read the repo settings, or to release from another branch.
+func (c *Client) SetDefaultBranch(branch string) {
+	c.defaultBranchMu.Lock()
+	c.defaultBranch = branch
+	c.defaultBranchMu.Unlock()
+}
+
+// StaleBranch is a branch whose pull requests are all closed.
+type StaleBranch struct {
+	Name string
+	// PRs are the numbers of the pull requests of the branch, newest first.
+	PRs []int
+	// Merged is whether the newest pull request was merged.
+	Merged bool
+}
+
+// StaleBranchesContext returns the branches of head (the repo of c, or a fork
+// of it) matching the glob whose pull requests to the repo of c are all
+// closed, merged or not. Protected branches, branches without pull requests,
+// and branches with commits pushed after their newest pull request are not
+// stale.
+func (c *Client) StaleBranchesContext(ctx context.Context, head *Client, glob string) ([]*StaleBranch, error) {
+	if _, err := path.Match(glob, ""); err != nil {
+		return nil, fmt.Errorf("invalid branch glob %q: %v", glob, err)
+	}
+	var branches []*github.Branch
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		page, resp, err := head.c.Repositories.ListBranches(ctx, head.owner, head.repo, opt)
+		if err != nil {
+			return nil, diagnose(err)
+		}
+		branches = append(branches, page...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	var ret []*StaleBranch
+	for _, b := range branches {
+		if ok, _ := path.Match(glob, b.GetName()); !ok || b.GetProtected() {
+			continue
+		}
+		prs, _, err := c.c.PullRequests.List(ctx, c.owner, c.repo, &github.PullRequestListOptions{
+			State:       "all",
+			Head:        head.owner + ":" + b.GetName(),
+			Sort:        "created",
+			Direction:   "desc",
+			ListOptions: github.ListOptions{PerPage: 100},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the PRs of %v: %v", b.GetName(), diagnose(err))
+		}
+		if len(prs) == 0 || prs[0].GetHead().GetSHA() != b.GetCommit().GetSHA() {
+			continue
+		}
+		sb := &StaleBranch{Name: b.GetName(), Merged: prs[0].MergedAt != nil}
+		for _, pr := range prs {
+			if pr.GetState() == "open" {
+				sb = nil
+				break
+			}
+			sb.PRs = append(sb.PRs, pr.GetNumber())
+		}
+		if sb != nil {
+			ret = append(ret, sb)
+		}
+	}
+	return ret, nil
+}
+
+// PruneReleaseBranchesContext deletes the stale branches of head matching the
+// glob (see StaleBranchesContext), e.g. the release-prep branches once their
+// pull requests are merged. It returns the deleted branches, and stops at the
+// first failure.
+func (c *Client) PruneReleaseBranchesContext(ctx context.Context, head *Client, glob string) ([]*StaleBranch, error) {
+	stale, err := c.StaleBranchesContext(ctx, head, glob)
+	if err != nil {
+		return nil, err
+	}
+	var deleted []*StaleBranch
+	for _, b := range stale {
+		if err := head.DeleteBranchContext(ctx, b.Name); err != nil {
+			return deleted, fmt.Errorf("failed to delete %v: %v", b.Name, err)
+		}
+		deleted = append(deleted, b)
+	}
+	return deleted, nil
+}
@@ -0,0 +1,198 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package ghclient
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sniperkit/snk.fork.release-git-bot/clock"
+)
+
+// Defaults of the Breaker.
+const (
+	DefaultBreakerThreshold   = 5
+	DefaultBreakerCooldown    = 10 * time.Second
+	DefaultBreakerMaxCooldown = 5 * time.Minute
+)
+
+// probeWait is how often the requests waiting for the probe of a half open
+// breaker check its result.
+const probeWait = time.Second
+
+// Backoff returns the jittered exponential backoff before the retry attempt
+// (from 0): a random duration between half and all of base*2^attempt, capped
+// to max. The jitter keeps the clients that failed together from retrying
+// together.
+func Backoff(attempt int, base, max time.Duration) time.Duration {
+	d := base
+	for i := 0; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
+
+// Breaker is a circuit breaker for the github API: after Threshold
+// consecutive 5xx responses or network errors, github is assumed to be down,
+// and all the requests wait for a jittered cooldown instead of failing. A
+// single probe request is then sent. If it succeeds the traffic resumes,
+// otherwise the breaker opens again, with a longer cooldown.
+//
+// Waiting requests fail only if their context is done. A nil *Breaker does
+// nothing.
+type Breaker struct {
+	// Threshold is the number of consecutive failures opening the breaker,
+	// DefaultBreakerThreshold if 0.
+	Threshold int
+	// Cooldown is the backoff base of the first opening,
+	// DefaultBreakerCooldown if 0. It doubles with each failed probe, up to
+	// MaxCooldown (DefaultBreakerMaxCooldown if 0).
+	Cooldown    time.Duration
+	MaxCooldown time.Duration
+	// Clock is the time of the cooldowns. If nil, it's clock.Real.
+	Clock clock.Clock
+
+	// OnOpen, if not nil, is called when the breaker opens for d, with the
+	// last failure.
+	OnOpen func(d time.Duration, err error)
+	// OnClose, if not nil, is called when the traffic resumes.
+	OnClose func()
+
+	mu        sync.Mutex
+	failures  int
+	opens     int
+	openUntil time.Time
+	probing   bool
+}
+
+// Client returns a copy of hc with a transport going through the breaker. If
+// hc is nil, a new client with the default transport is returned.
+func (b *Breaker) Client(hc *http.Client) *http.Client {
+	if b == nil {
+		return hc
+	}
+	var ret http.Client
+	if hc != nil {
+		ret = *hc
+	}
+	base := ret.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	ret.Transport = &breakerTransport{b: b, base: base}
+	return &ret
+}
+
+type breakerTransport struct {
+	b    *Breaker
+	base http.RoundTripper
+}
+
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	probe, err := t.b.wait(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.base.RoundTrip(req)
+	switch {
+	case err != nil && req.Context().Err() != nil:
+		// Canceled, not a github failure, nor a recovery.
+		t.b.canceled(probe)
+	case err != nil:
+		t.b.record(probe, err)
+	case resp.StatusCode >= 500:
+		t.b.record(probe, fmt.Errorf("%v %v: %v", req.Method, req.URL.Path, resp.Status))
+	default:
+		t.b.record(probe, nil)
+	}
+	return resp, err
+}
+
+// wait blocks while the breaker is open. It returns whether the request is the
+// probe of the half open breaker.
+func (b *Breaker) wait(ctx context.Context) (probe bool, err error) {
+	clk := clock.Or(b.Clock)
+	for {
+		b.mu.Lock()
+		now := clk.Now()
+		if b.openUntil.IsZero() {
+			b.mu.Unlock()
+			return false, nil
+		}
+		if !now.Before(b.openUntil) && !b.probing {
+			b.probing = true
+			b.mu.Unlock()
+			return true, nil
+		}
+		d := b.openUntil.Sub(now)
+		if d <= 0 {
+			d = probeWait
+		}
+		b.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-clk.After(d):
+		}
+	}
+}
+
+// canceled records a request canceled before its result. The breaker stays as
+// it is, only another request can probe it.
+func (b *Breaker) canceled(probe bool) {
+	if !probe {
+		return
+	}
+	b.mu.Lock()
+	b.probing = false
+	b.mu.Unlock()
+}
+
+// record records the result of a request, err is nil if it succeeded.
+func (b *Breaker) record(probe bool, err error) {
+	b.mu.Lock()
+	if probe {
+		b.probing = false
+	}
+	if err == nil {
+		closed := !b.openUntil.IsZero()
+		b.failures, b.opens, b.openUntil = 0, 0, time.Time{}
+		b.mu.Unlock()
+		if closed && b.OnClose != nil {
+			b.OnClose()
+		}
+		return
+	}
+	b.failures++
+	threshold := b.Threshold
+	if threshold == 0 {
+		threshold = DefaultBreakerThreshold
+	}
+	if !probe && b.failures < threshold {
+		b.mu.Unlock()
+		return
+	}
+	cooldown, max := b.Cooldown, b.MaxCooldown
+	if cooldown == 0 {
+		cooldown = DefaultBreakerCooldown
+	}
+	if max == 0 {
+		max = DefaultBreakerMaxCooldown
+	}
+	d := Backoff(b.opens, cooldown, max)
+	b.opens++
+	b.openUntil = clock.Or(b.Clock).Now().Add(d)
+	b.mu.Unlock()
+	if b.OnOpen != nil {
+		b.OnOpen(d, err)
+	}
+}
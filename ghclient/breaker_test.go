@@ -0,0 +1,64 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package ghclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sniperkit/snk.fork.release-git-bot/clock"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestBreakerCanceledProbe(t *testing.T) {
+	clk := clock.NewFake(time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC))
+	closed := false
+	b := &Breaker{
+		Threshold: 1,
+		Cooldown:  10 * time.Second,
+		Clock:     clk,
+		OnClose:   func() { closed = true },
+	}
+	var base http.RoundTripper
+	tr := &breakerTransport{b: b, base: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return base.RoundTrip(req)
+	})}
+
+	// A 5xx opens the breaker.
+	base = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusBadGateway, Status: "502 Bad Gateway", Body: http.NoBody}, nil
+	})
+	req, _ := http.NewRequest("GET", "https://api.github.com/repos/o/r", nil)
+	if _, err := tr.RoundTrip(req); err != nil {
+		t.Fatalf("RoundTrip() failed: %v", err)
+	}
+	if b.openUntil.IsZero() {
+		t.Fatalf("breaker not open after a 5xx")
+	}
+	openUntil := b.openUntil
+
+	// The probe is canceled while in flight.
+	clk.Advance(10 * time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	base = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		cancel()
+		return nil, errors.New("request canceled")
+	})
+	if _, err := tr.RoundTrip(req.WithContext(ctx)); err == nil {
+		t.Fatalf("canceled RoundTrip() succeeded")
+	}
+
+	if closed || !b.openUntil.Equal(openUntil) || b.failures != 1 {
+		t.Errorf("breaker closed by a canceled probe: closed %v, openUntil %v (was %v), failures %v", closed, b.openUntil, openUntil, b.failures)
+	}
+	if b.probing {
+		t.Errorf("breaker still probing after the probe was canceled")
+	}
+}
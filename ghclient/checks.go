@@ -0,0 +1,209 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package ghclient
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	log "github.com/sirupsen/logrus"
+	"github.com/sniperkit/snk.fork.release-git-bot/clock"
+)
+
+// ChecksStatus is the status of the checks on a commit, e.g. the head of a
+// pull request.
+type ChecksStatus struct {
+	// Number is the pull request, 0 for a commit.
+	Number int
+	SHA    string
+	// Merged is set if the pull request is already merged, its checks don't
+	// matter anymore.
+	Merged bool
+	// Required is set if the checks are the required checks of the base
+	// branch, as opposed to all the checks reported on the head.
+	Required bool
+	// Checks is the number of checks.
+	Checks int
+	// Pending and Failed are the names of the checks not finished, or
+	// finished without success. A required check not reported yet is
+	// pending.
+	Pending []string
+	Failed  []string
+}
+
+// Green returns whether all the checks passed.
+func (s *ChecksStatus) Green() bool {
+	return len(s.Pending) == 0 && len(s.Failed) == 0
+}
+
+// GetChecksStatusContext returns the status of the checks on the head of the
+// pull request, from both the commit statuses and the check runs. Only the
+// required checks of the base branch count, or all of them if none is required
+// or the requirements can't be read.
+func (c *Client) GetChecksStatusContext(ctx context.Context, number int) (*ChecksStatus, error) {
+	pr, _, err := c.c.PullRequests.Get(ctx, c.owner, c.repo, number)
+	if err != nil {
+		return nil, diagnose(err)
+	}
+	reqs, err := c.GetMergeRequirementsContext(ctx, pr.GetBase().GetRef())
+	if err != nil {
+		return nil, err
+	}
+	s, err := c.commitChecks(ctx, pr.GetHead().GetSHA(), reqs.RequiredChecks)
+	if err != nil {
+		return nil, err
+	}
+	s.Number, s.Merged = number, pr.GetMerged()
+	return s, nil
+}
+
+// GetCommitChecksContext returns the status of all the checks on the commit
+// at ref (a branch, tag or SHA), from both the commit statuses and the check
+// runs.
+func (c *Client) GetCommitChecksContext(ctx context.Context, ref string) (*ChecksStatus, error) {
+	sha, err := c.GetCommitSHAContext(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	return c.commitChecks(ctx, sha, nil)
+}
+
+// commitChecks returns the status of the required checks on the commit sha,
+// or of all its checks if required is empty.
+func (c *Client) commitChecks(ctx context.Context, sha string, required []string) (*ChecksStatus, error) {
+	s := &ChecksStatus{SHA: sha}
+
+	// The state of each check, "success", "pending" or "failure".
+	states := make(map[string]string)
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		combined, resp, err := c.c.Repositories.GetCombinedStatus(ctx, c.owner, c.repo, sha, opt)
+		if err != nil {
+			return nil, diagnose(err)
+		}
+		for _, st := range combined.Statuses {
+			switch st.GetState() {
+			case "success", "pending":
+				states[st.GetContext()] = st.GetState()
+			default:
+				states[st.GetContext()] = "failure"
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	// go-github doesn't have the checks API, so the requests are built here.
+	for page := 1; page != 0; {
+		req, err := c.c.NewRequest("GET", fmt.Sprintf("repos/%v/%v/commits/%v/check-runs?per_page=100&page=%v", c.owner, c.repo, sha, page), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/vnd.github.antiope-preview+json")
+		var runs struct {
+			CheckRuns []struct {
+				Name       string `json:"name"`
+				Status     string `json:"status"`
+				Conclusion string `json:"conclusion"`
+			} `json:"check_runs"`
+		}
+		resp, err := c.c.Do(ctx, req, &runs)
+		if err != nil {
+			return nil, diagnose(err)
+		}
+		for _, r := range runs.CheckRuns {
+			switch {
+			case r.Status != "completed":
+				states[r.Name] = "pending"
+			case r.Conclusion == "success" || r.Conclusion == "neutral" || r.Conclusion == "skipped":
+				states[r.Name] = "success"
+			default:
+				states[r.Name] = "failure"
+			}
+		}
+		page = resp.NextPage
+	}
+
+	names := required
+	if len(names) > 0 {
+		s.Required = true
+	} else {
+		for name := range states {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	s.Checks = len(names)
+	for _, name := range names {
+		switch states[name] {
+		case "success":
+		case "failure":
+			s.Failed = append(s.Failed, name)
+		default:
+			s.Pending = append(s.Pending, name)
+		}
+	}
+	return s, nil
+}
+
+// checksPollInterval is how often WaitForChecksContext polls the checks.
+const checksPollInterval = 30 * time.Second
+
+// WaitForChecksContext polls the checks on the commit at ref until they all
+// pass, and returns their status. It returns a *ChecksFailedError as soon as
+// one fails, and an error after timeout (if not 0) if some are still pending.
+//
+// A commit without any check is pending too, its CI may not have started yet.
+func (c *Client) WaitForChecksContext(ctx context.Context, ref string, timeout time.Duration) (*ChecksStatus, error) {
+	clk := clock.Or(c.clock)
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = clk.Now().Add(timeout)
+	}
+	for {
+		s, err := c.GetCommitChecksContext(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case len(s.Failed) > 0:
+			return s, &ChecksFailedError{Status: s}
+		case s.Checks > 0 && len(s.Pending) == 0:
+			log.Infof("%v checks passed on %v/%v %v", s.Checks, c.owner, c.repo, shortSHA(s.SHA))
+			return s, nil
+		}
+		wait := checksPollInterval
+		if !deadline.IsZero() {
+			left := deadline.Sub(clk.Now())
+			if left <= 0 {
+				return s, fmt.Errorf("timed out waiting for the checks on %v, pending: %v", s.SHA, strings.Join(s.Pending, ", "))
+			}
+			if left < wait {
+				wait = left
+			}
+		}
+		log.Infof("waiting for the checks on %v/%v %v: %v pending", c.owner, c.repo, shortSHA(s.SHA), strings.Join(s.Pending, ", "))
+		select {
+		case <-ctx.Done():
+			return s, ctx.Err()
+		case <-clk.After(wait):
+		}
+	}
+}
+
+// ChecksFailedError is returned by WaitAndMergeContext and
+// WaitForChecksContext if checks failed on the commit.
+type ChecksFailedError struct {
+	Status *ChecksStatus
+}
+
+func (e *ChecksFailedError) Error() string {
+	return fmt.Sprintf("checks failed on %v: %v", e.Status.SHA, strings.Join(e.Status.Failed, ", "))
+}
@@ -0,0 +1,102 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package ghclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/google/go-github/github"
+	log "github.com/sirupsen/logrus"
+	"github.com/sniperkit/snk.fork.release-git-bot/refs"
+)
+
+// CherryPickContext applies the changes of the commit sha on top of branch,
+// without a local clone, and returns the new commit of branch. The new commit
+// keeps the message and the author of sha. For merge commits, the changes
+// are the ones from the first parent.
+//
+// The github API has no cherry-pick, so the changes are merged on a temporary
+// branch: a commit with the tree of branch and the parent of sha is created,
+// and sha is merged into it, which applies only the changes of sha. The tree
+// of the merge is then committed on branch.
+//
+// It fails if the changes conflict, or if branch moved meanwhile.
+func (c *Client) CherryPickContext(ctx context.Context, sha, branch string) (*github.Commit, error) {
+	cmt, _, err := c.c.Git.GetCommit(ctx, c.owner, c.repo, sha)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit %v: %v", sha, diagnose(err))
+	}
+	if len(cmt.Parents) == 0 {
+		return nil, fmt.Errorf("commit %v has no parent to cherry-pick from", sha)
+	}
+	target := refs.BranchRef(branch)
+	head, err := c.refSHA(ctx, target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get branch %v: %v", branch, err)
+	}
+	headCmt, _, err := c.c.Git.GetCommit(ctx, c.owner, c.repo, head)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit %v: %v", head, diagnose(err))
+	}
+
+	sibling, _, err := c.c.Git.CreateCommit(ctx, c.owner, c.repo, &github.Commit{
+		Message: github.String(fmt.Sprintf("Cherry-pick %v onto %v", shortSHA(sha), branch)),
+		Tree:    headCmt.Tree,
+		Parents: []github.Commit{{SHA: cmt.Parents[0].SHA}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cherry-pick base: %v", diagnose(err))
+	}
+	tmp := refs.BranchRef(fmt.Sprintf("release-git-bot-cherry-pick-%v", shortSHA(sha)))
+	log.Infof("creating %v/%v %v at %v", c.owner, c.repo, tmp.Full(), sibling.GetSHA())
+	if err := c.createRef(ctx, tmp, sibling.GetSHA()); err != nil {
+		return nil, fmt.Errorf("failed to create %v: %v", tmp.Name(), err)
+	}
+	defer func() {
+		// Not canceled with ctx, so the temporary branch is not left behind.
+		if _, err := c.c.Git.DeleteRef(context.Background(), c.owner, c.repo, tmp.Short()); err != nil {
+			log.Warningf("failed to delete %v: %v", tmp.Name(), diagnose(err))
+		}
+	}()
+
+	merge, resp, err := c.c.Repositories.Merge(ctx, c.owner, c.repo, &github.RepositoryMergeRequest{
+		Base:          github.String(tmp.Name()),
+		Head:          github.String(sha),
+		CommitMessage: github.String(fmt.Sprintf("Merge %v", sha)),
+	})
+	if resp != nil && resp.StatusCode == http.StatusConflict {
+		return nil, fmt.Errorf("commit %v conflicts with %v, cherry-pick it manually", shortSHA(sha), branch)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge %v: %v", sha, diagnose(err))
+	}
+
+	picked, _, err := c.c.Git.CreateCommit(ctx, c.owner, c.repo, &github.Commit{
+		Message: cmt.Message,
+		Author:  cmt.Author,
+		Tree:    merge.GetCommit().Tree,
+		Parents: []github.Commit{{SHA: github.String(head)}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cherry-picked commit: %v", diagnose(err))
+	}
+	log.Infof("updating %v/%v %v from %v to %v", c.owner, c.repo, target.Full(), head, picked.GetSHA())
+	// Not forced, so changes pushed to branch meanwhile are not lost.
+	if _, _, err := c.c.Git.UpdateRef(ctx, c.owner, c.repo, &github.Reference{
+		Ref:    github.String(target.Full()),
+		Object: &github.GitObject{SHA: picked.SHA},
+	}, false); err != nil {
+		return nil, fmt.Errorf("failed to update %v: %v", branch, diagnose(err))
+	}
+	return picked, nil
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
@@ -7,9 +7,17 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/google/go-github/github"
 	log "github.com/sirupsen/logrus"
+	"github.com/sniperkit/snk.fork.release-git-bot/clock"
+	"github.com/sniperkit/snk.fork.release-git-bot/refs"
 )
 
 // Client is a github client used to get info from github.
@@ -18,6 +26,22 @@ type Client struct {
 	repo  string
 
 	c *github.Client
+
+	// useGraphQL is set by UseGraphQL.
+	useGraphQL bool
+	// workers is set by SetConcurrency.
+	workers int
+	// mergeCommits are the merge commits of the PRs from the GraphQL
+	// queries, by number.
+	mergeCommits sync.Map
+	// defaultBranch is set by SetDefaultBranch, or cached by
+	// DefaultBranchContext.
+	defaultBranch   string
+	defaultBranchMu sync.Mutex
+	// retry is set by SetRetry.
+	retry *Retry
+	// clock is set by SetClock.
+	clock clock.Clock
 }
 
 // New creates a new client.
@@ -26,7 +50,77 @@ func New(tc *http.Client, owner, repo string) *Client {
 		owner: owner,
 		repo:  repo,
 		c:     github.NewClient(tc),
+		retry: &Retry{},
+	}
+}
+
+// NewEnterprise creates a new client for a GitHub Enterprise Server, e.g. with
+// baseURL "https://github.example.com/api/v3/". If uploadURL is empty, it's
+// the "uploads" API next to baseURL, e.g.
+// "https://github.example.com/api/uploads/".
+func NewEnterprise(tc *http.Client, baseURL, uploadURL, owner, repo string) (*Client, error) {
+	if uploadURL == "" {
+		uploadURL = strings.TrimSuffix(strings.TrimSuffix(baseURL, "/"), "/v3") + "/uploads/"
+	}
+	base, err := parseAPIURL(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base url %q: %v", baseURL, err)
+	}
+	upload, err := parseAPIURL(uploadURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upload url %q: %v", uploadURL, err)
+	}
+	c := New(tc, owner, repo)
+	c.c.BaseURL, c.c.UploadURL = base, upload
+	return c, nil
+}
+
+// parseAPIURL parses the API url, with the trailing slash the github client
+// requires.
+func parseAPIURL(s string) (*url.URL, error) {
+	if !strings.HasSuffix(s, "/") {
+		s += "/"
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("not an absolute url")
+	}
+	return u, nil
+}
+
+// DefaultConcurrency is the default max number of concurrent requests of a
+// query.
+const DefaultConcurrency = 8
+
+// SetConcurrency sets the max number of concurrent requests of the queries
+// fetching many pages or PRs, e.g. the pages of the closed issues of a
+// milestone, and the merge events of its PRs. If n is 0, it's
+// DefaultConcurrency.
+func (c *Client) SetConcurrency(n int) {
+	c.workers = n
+}
+
+// SetRetry sets the retries of the creations of refs and releases, which are
+// not retried by the Retry transport (see Retry). If r is nil, they are not
+// retried. By default, they are retried with the defaults of Retry.
+func (c *Client) SetRetry(r *Retry) {
+	c.retry = r
+}
+
+// SetClock sets the clock of the polls, e.g. of WaitForChecksContext. If clk
+// is nil, it's clock.Real.
+func (c *Client) SetClock(clk clock.Clock) {
+	c.clock = clk
+}
+
+func (c *Client) concurrency() int {
+	if c.workers <= 0 {
+		return DefaultConcurrency
 	}
+	return c.workers
 }
 
 // Owner returns the github user name this client was build with.
@@ -39,87 +133,213 @@ func (c *Client) Repo() string {
 	return c.repo
 }
 
-// GetMergedPRsForMilestone returns a list of github issues that are merged PRs
-// for this milestone.
-func (c *Client) GetMergedPRsForMilestone(milestone string) []*github.Issue {
-	return c.getMergedPRsForMilestone(milestone)
+// GetMergedPRsForMilestoneContext returns a list of github issues that are
+// merged PRs for this milestone.
+//
+// The milestone is found by FindMilestone with milestone and aliases as the
+// candidates. It fails if no milestone matches, or if any of the API calls
+// fails, so an empty list always means the milestone has no merged PRs.
+func (c *Client) GetMergedPRsForMilestoneContext(ctx context.Context, milestone string, aliases ...string) ([]*github.Issue, error) {
+	return c.getMergedPRsForMilestone(ctx, append([]string{milestone}, aliases...))
 }
 
-// GetMergedPRsForLabels returns a list of github issues that are merged PRs
-// with the given label.
+// GetMergedPRsForMilestone is GetMergedPRsForMilestoneContext with
+// context.Background. Errors are logged, and nil is returned.
+//
+// Deprecated: use GetMergedPRsForMilestoneContext.
+func (c *Client) GetMergedPRsForMilestone(milestone string, aliases ...string) []*github.Issue {
+	prs, err := c.GetMergedPRsForMilestoneContext(context.Background(), milestone, aliases...)
+	if err != nil {
+		log.Warning("failed to get merged PRs for milestone: ", err)
+		return nil
+	}
+	return prs
+}
+
+// FindMilestoneContext returns the first milestone matching the candidates.
+//
+// A candidate can be an exact title, a glob pattern (e.g. "1.30*"), or a
+// regular expression in slashes (e.g. "/^v?1\.30/"). If no milestone matches
+// exactly, titles are compared ignoring case, the "v" prefix and the
+// "Release" word, so "v1.30" matches "1.30 Release".
+//
+// If none matches, the error lists all the available milestones.
+func (c *Client) FindMilestoneContext(ctx context.Context, candidates ...string) (*github.Milestone, error) {
+	return c.findMilestone(ctx, candidates)
+}
+
+// FindMilestone is FindMilestoneContext with context.Background.
+//
+// Deprecated: use FindMilestoneContext.
+func (c *Client) FindMilestone(candidates ...string) (*github.Milestone, error) {
+	return c.FindMilestoneContext(context.Background(), candidates...)
+}
+
+// GetMergedPRsForLabelsContext returns a list of github issues that are merged
+// PRs with all the given labels, sorted by number. The labels are queried
+// concurrently. It fails if any of the API calls fails.
+func (c *Client) GetMergedPRsForLabelsContext(ctx context.Context, labels []string) ([]*github.Issue, error) {
+	return c.getMergedPRsForLabels(ctx, labels)
+}
+
+// GetMergedPRsForLabels is GetMergedPRsForLabelsContext with
+// context.Background. Errors are logged, and nil is returned.
+//
+// Deprecated: use GetMergedPRsForLabelsContext.
 func (c *Client) GetMergedPRsForLabels(labels []string) []*github.Issue {
-	return c.getMergedPRsForLabels(labels)
+	prs, err := c.GetMergedPRsForLabelsContext(context.Background(), labels)
+	if err != nil {
+		log.Warning("failed to get merged PRs for labels: ", err)
+		return nil
+	}
+	return prs
+}
+
+// GetOrgMembersContext returns a set of names of members in the org.
+func (c *Client) GetOrgMembersContext(ctx context.Context, org string) (map[string]struct{}, error) {
+	return c.getOrgMembers(ctx, org)
 }
 
-// GetOrgMembers returns a set of names of members in the org.
+// GetOrgMembers is GetOrgMembersContext with context.Background. Errors are
+// logged, and nil is returned.
+//
+// Deprecated: use GetOrgMembersContext.
 func (c *Client) GetOrgMembers(org string) map[string]struct{} {
-	return c.getOrgMembers(org)
+	members, err := c.GetOrgMembersContext(context.Background(), org)
+	if err != nil {
+		log.Warning(err)
+		return nil
+	}
+	return members
 }
 
-// CommitIDForMergedPR returns the commit id for pr.
+// CommitIDForMergedPRContext returns the commit id for pr.
 //
 // It returns "" if pr is not a merged PR.
+func (c *Client) CommitIDForMergedPRContext(ctx context.Context, pr *github.Issue) string {
+	return c.commitIDForMergedPR(ctx, pr)
+}
+
+// CommitIDForMergedPR is CommitIDForMergedPRContext with context.Background.
+//
+// Deprecated: use CommitIDForMergedPRContext.
 func (c *Client) CommitIDForMergedPR(pr *github.Issue) string {
-	return c.commitIDForMergedPR(pr)
+	return c.CommitIDForMergedPRContext(context.Background(), pr)
 }
 
-// NewBranchFromHead create a new branch with the current commit from head.
+// NewBranchFromHeadContext create a new branch with the current commit from
+// head of the default branch (see DefaultBranchContext).
 //
 // It does nothing if the branch already exists.
+func (c *Client) NewBranchFromHeadContext(ctx context.Context, branchName string) error {
+	base, err := c.DefaultBranchContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get the default branch: %v", err)
+	}
+	return c.NewBranchFromContext(ctx, branchName, base)
+}
+
+// NewBranchFromHead is NewBranchFromHeadContext with context.Background.
+//
+// Deprecated: use NewBranchFromHeadContext.
 func (c *Client) NewBranchFromHead(branchName string) error {
-	log.Infof("creating branch: %v/%v/%v", c.owner, c.repo, branchName)
-	ctx := context.Background()
+	return c.NewBranchFromHeadContext(context.Background(), branchName)
+}
 
-	refName := "heads/" + branchName
-	// Check if ref already exists.
-	if ref, _, err := c.c.Git.GetRef(ctx, c.owner, c.repo, refName); err == nil {
-		log.Infof("ref already exists: %v", ref)
-		return nil
-	}
+// NewBranchFromContext create a new branch with the current commit of branch
+// base, e.g. develop for git-flow repos.
+//
+// It does nothing if the branch already exists.
+func (c *Client) NewBranchFromContext(ctx context.Context, branchName, base string) error {
+	return c.NewBranchesFromContext(ctx, []string{branchName}, base)
+}
 
-	// Get head SHA.
-	ref, _, err := c.c.Git.GetRef(ctx, c.owner, c.repo, "heads/master")
-	if err != nil {
-		return fmt.Errorf("failed to get master hash: %v", err)
-	}
-	log.Infof("hash for HEAD: %v", ref.GetObject().GetSHA())
+// NewBranchFrom is NewBranchFromContext with context.Background.
+//
+// Deprecated: use NewBranchFromContext.
+func (c *Client) NewBranchFrom(branchName, base string) error {
+	return c.NewBranchFromContext(context.Background(), branchName, base)
+}
 
-	// Create new ref.
-	newRef, _, err := c.c.Git.CreateRef(ctx, c.owner, c.repo, &github.Reference{
-		Ref:    &refName,
-		Object: ref.GetObject(),
-	})
-	if err != nil {
-		return fmt.Errorf("failed to create ref: %v", err)
+// NewBranchesFromContext creates the branches with the current commit of branch
+// base in one RefTx, so either all of them are created, or none.
+//
+// Branches that already exist are left alone.
+func (c *Client) NewBranchesFromContext(ctx context.Context, branchNames []string, base string) error {
+	log.Infof("creating branches: %v/%v/%v from %v", c.owner, c.repo, branchNames, base)
+	tx := c.NewRefTx()
+	for _, b := range branchNames {
+		tx.Create(refs.BranchRef(b), refs.BranchRef(base))
 	}
+	return tx.CommitContext(ctx)
+}
 
-	log.Infof("new ref created: %v", newRef.String())
-	return nil
+// NewBranchesFrom is NewBranchesFromContext with context.Background.
+//
+// Deprecated: use NewBranchesFromContext.
+func (c *Client) NewBranchesFrom(branchNames []string, base string) error {
+	return c.NewBranchesFromContext(context.Background(), branchNames, base)
 }
 
-// NewPullRequest creates a pull request to the owner/repo pointed by this
-// Client.
+// NewPullRequestContext creates a pull request to the owner/repo pointed by
+// this Client.
 //
-// headUser:headBranch specifies where the pull request is from.
+// headUser:headBranch specifies where the pull request is from, in the fork of
+// headUser with the same repo name. Use NewPullRequestFrom for forks with
+// other names.
+func (c *Client) NewPullRequestContext(ctx context.Context, headUser, headBranch, base, title, body string) (string, error) {
+	return c.NewPullRequestFromContext(ctx, &Head{Owner: headUser, Repo: c.repo, Branch: headBranch}, base, title, body)
+}
+
+// NewPullRequest is NewPullRequestContext with context.Background.
+//
+// Deprecated: use NewPullRequestContext.
 func (c *Client) NewPullRequest(headUser, headBranch, base, title, body string) (string, error) {
-	newPR := &github.NewPullRequest{
-		Title:               github.String(title),
-		Head:                github.String(headUser + ":" + headBranch),
-		Base:                github.String(base),
-		Body:                github.String(body),
-		MaintainerCanModify: github.Bool(true),
-	}
+	return c.NewPullRequestContext(context.Background(), headUser, headBranch, base, title, body)
+}
 
-	pr, _, err := c.c.PullRequests.Create(context.Background(), c.owner, c.repo, newPR)
+// NewPullRequestFromContext creates a pull request from head to the base branch
+// of the owner/repo pointed by this Client, and returns its url.
+//
+// It fails with a clear error if the head branch doesn't exist, or has no
+// changes from base. Use CreatePullRequest to handle these cases.
+func (c *Client) NewPullRequestFromContext(ctx context.Context, head *Head, base, title, body string) (string, error) {
+	r, err := c.CreatePullRequestContext(ctx, head, base, title, body, false)
 	if err != nil {
 		return "", err
 	}
-	log.Infof("PR created: %s", pr.GetHTMLURL())
-	return pr.GetHTMLURL(), nil
+	if r.NoChanges {
+		return "", fmt.Errorf("head %v has no changes from %v, there's nothing to merge", head, base)
+	}
+	return r.URL, nil
+}
+
+// NewPullRequestFrom is NewPullRequestFromContext with context.Background.
+//
+// Deprecated: use NewPullRequestFromContext.
+func (c *Client) NewPullRequestFrom(head *Head, base, title, body string) (string, error) {
+	return c.NewPullRequestFromContext(context.Background(), head, base, title, body)
+}
+
+// NewDraftReleaseContext creates a draft release.
+func (c *Client) NewDraftReleaseContext(ctx context.Context, tagName, targetBranch, title, body string) (string, error) {
+	release, err := c.CreateDraftReleaseContext(ctx, tagName, targetBranch, title, body)
+	if err != nil {
+		return "", diagnose(err)
+	}
+	return release.GetHTMLURL(), nil
 }
 
-// NewDraftRelease creates a draft release.
+// NewDraftRelease is NewDraftReleaseContext with context.Background.
+//
+// Deprecated: use NewDraftReleaseContext.
 func (c *Client) NewDraftRelease(tagName, targetBranch, title, body string) (string, error) {
+	return c.NewDraftReleaseContext(context.Background(), tagName, targetBranch, title, body)
+}
+
+// CreateDraftReleaseContext creates a draft release, and returns the created
+// release.
+func (c *Client) CreateDraftReleaseContext(ctx context.Context, tagName, targetBranch, title, body string) (*github.RepositoryRelease, error) {
 	newRelease := &github.RepositoryRelease{
 		TagName:         github.String(tagName),
 		TargetCommitish: github.String(targetBranch),
@@ -127,18 +347,405 @@ func (c *Client) NewDraftRelease(tagName, targetBranch, title, body string) (str
 		Body:            github.String(body),
 		Draft:           github.Bool(true),
 	}
-	release, _, err := c.c.Repositories.CreateRelease(context.Background(), c.owner, c.repo, newRelease)
+	return c.createRelease(ctx, newRelease)
+}
+
+// CreateDraftRelease is CreateDraftReleaseContext with context.Background.
+//
+// Deprecated: use CreateDraftReleaseContext.
+func (c *Client) CreateDraftRelease(tagName, targetBranch, title, body string) (*github.RepositoryRelease, error) {
+	return c.CreateDraftReleaseContext(context.Background(), tagName, targetBranch, title, body)
+}
+
+// UploadReleaseAssetContext uploads the file at path to the release, and
+// returns the download url of the asset.
+//
+// The asset name is the base name of path.
+func (c *Client) UploadReleaseAssetContext(ctx context.Context, releaseID int64, path string) (string, error) {
+	f, err := os.Open(path)
 	if err != nil {
-		return "", err
+		return "", diagnose(err)
 	}
-	return release.GetHTMLURL(), nil
+	defer f.Close()
+	asset, _, err := c.c.Repositories.UploadReleaseAsset(ctx, c.owner, c.repo, releaseID,
+		&github.UploadOptions{Name: filepath.Base(path)}, f)
+	if err != nil {
+		return "", diagnose(err)
+	}
+	log.Infof("asset uploaded: %s", asset.GetBrowserDownloadURL())
+	return asset.GetBrowserDownloadURL(), nil
 }
 
-// GetPrimaryEmail returns the primary email of the token owner.
-func (c *Client) GetPrimaryEmail() (string, error) {
-	emails, _, err := c.c.Users.ListEmails(context.Background(), nil)
+// UploadReleaseAsset is UploadReleaseAssetContext with context.Background.
+//
+// Deprecated: use UploadReleaseAssetContext.
+func (c *Client) UploadReleaseAsset(releaseID int64, path string) (string, error) {
+	return c.UploadReleaseAssetContext(context.Background(), releaseID, path)
+}
+
+// GetReleaseContext returns the release with the given id. Unlike
+// GetReleaseByTagContext, it finds draft releases.
+func (c *Client) GetReleaseContext(ctx context.Context, releaseID int64) (*github.RepositoryRelease, error) {
+	release, _, err := c.c.Repositories.GetRelease(ctx, c.owner, c.repo, releaseID)
 	if err != nil {
-		return "", err
+		return nil, diagnose(err)
+	}
+	return release, nil
+}
+
+// UpdateReleaseContext replaces the body of the release, and publishes it if
+// publish is true.
+func (c *Client) UpdateReleaseContext(ctx context.Context, releaseID int64, body string, publish bool) (*github.RepositoryRelease, error) {
+	edit := &github.RepositoryRelease{Body: github.String(body)}
+	if publish {
+		edit.Draft = github.Bool(false)
+	}
+	release, _, err := c.c.Repositories.EditRelease(ctx, c.owner, c.repo, releaseID, edit)
+	if err != nil {
+		return nil, diagnose(err)
+	}
+	return release, nil
+}
+
+// GetReleaseByTagContext returns the release with the given tag name.
+func (c *Client) GetReleaseByTagContext(ctx context.Context, tagName string) (*github.RepositoryRelease, error) {
+	release, _, err := c.c.Repositories.GetReleaseByTag(ctx, c.owner, c.repo, tagName)
+	if err != nil {
+		return nil, diagnose(err)
+	}
+	return release, nil
+}
+
+// GetReleaseByTag is GetReleaseByTagContext with context.Background.
+//
+// Deprecated: use GetReleaseByTagContext.
+func (c *Client) GetReleaseByTag(tagName string) (*github.RepositoryRelease, error) {
+	return c.GetReleaseByTagContext(context.Background(), tagName)
+}
+
+// GetCommitSHAContext returns the SHA of the commit the ref (branch, tag or
+// SHA) points to.
+func (c *Client) GetCommitSHAContext(ctx context.Context, ref string) (string, error) {
+	sha, _, err := c.c.Repositories.GetCommitSHA1(ctx, c.owner, c.repo, ref, "")
+	if err != nil {
+		return "", diagnose(err)
+	}
+	return sha, nil
+}
+
+// GetCommitSHA is GetCommitSHAContext with context.Background.
+//
+// Deprecated: use GetCommitSHAContext.
+func (c *Client) GetCommitSHA(ref string) (string, error) {
+	return c.GetCommitSHAContext(context.Background(), ref)
+}
+
+// GetCommitTimeContext returns the committer time of the commit of ref.
+func (c *Client) GetCommitTimeContext(ctx context.Context, ref string) (time.Time, error) {
+	commit, _, err := c.c.Repositories.GetCommit(ctx, c.owner, c.repo, ref)
+	if err != nil {
+		return time.Time{}, diagnose(err)
+	}
+	return commit.GetCommit().GetCommitter().GetDate(), nil
+}
+
+// GetCommitTime is GetCommitTimeContext with context.Background.
+//
+// Deprecated: use GetCommitTimeContext.
+func (c *Client) GetCommitTime(ref string) (time.Time, error) {
+	return c.GetCommitTimeContext(context.Background(), ref)
+}
+
+// IsAncestorContext returns whether the commit ancestor is reachable from ref.
+func (c *Client) IsAncestorContext(ctx context.Context, ancestor, ref string) (bool, error) {
+	cmp, _, err := c.c.Repositories.CompareCommits(ctx, c.owner, c.repo, ancestor, ref)
+	if err != nil {
+		return false, diagnose(err)
+	}
+	// "ahead" means ref has commits after ancestor, and none before it.
+	return cmp.GetStatus() == "ahead" || cmp.GetStatus() == "identical", nil
+}
+
+// IsAncestor is IsAncestorContext with context.Background.
+//
+// Deprecated: use IsAncestorContext.
+func (c *Client) IsAncestor(ancestor, ref string) (bool, error) {
+	return c.IsAncestorContext(context.Background(), ancestor, ref)
+}
+
+// GetCommitsBetweenContext returns the commits reachable from head but not from
+// base, with their signature verification info.
+func (c *Client) GetCommitsBetweenContext(ctx context.Context, base, head string) ([]github.RepositoryCommit, error) {
+	var commits []github.RepositoryCommit
+	// The compare API returns at most 250 commits without pagination, go-github
+	// doesn't support the pagination params, so the request is built here.
+	for page := 1; ; page++ {
+		u := fmt.Sprintf("repos/%v/%v/compare/%v...%v?per_page=100&page=%v", c.owner, c.repo, base, head, page)
+		req, err := c.c.NewRequest("GET", u, nil)
+		if err != nil {
+			return nil, err
+		}
+		cmp := new(github.CommitsComparison)
+		if _, err := c.c.Do(ctx, req, cmp); err != nil {
+			return nil, diagnose(err)
+		}
+		commits = append(commits, cmp.Commits...)
+		if len(cmp.Commits) == 0 || len(commits) >= cmp.GetTotalCommits() {
+			break
+		}
+	}
+	return commits, nil
+}
+
+// GetCommitsBetween is GetCommitsBetweenContext with context.Background.
+//
+// Deprecated: use GetCommitsBetweenContext.
+func (c *Client) GetCommitsBetween(base, head string) ([]github.RepositoryCommit, error) {
+	return c.GetCommitsBetweenContext(context.Background(), base, head)
+}
+
+// HasCommitsByContext returns whether the user authored any commit reachable
+// from ref.
+func (c *Client) HasCommitsByContext(ctx context.Context, ref, login string) (bool, error) {
+	commits, _, err := c.c.Repositories.ListCommits(ctx, c.owner, c.repo, &github.CommitsListOptions{
+		SHA:         ref,
+		Author:      login,
+		ListOptions: github.ListOptions{PerPage: 1},
+	})
+	if err != nil {
+		return false, diagnose(err)
+	}
+	return len(commits) > 0, nil
+}
+
+// HasCommitsBy is HasCommitsByContext with context.Background.
+//
+// Deprecated: use HasCommitsByContext.
+func (c *Client) HasCommitsBy(ref, login string) (bool, error) {
+	return c.HasCommitsByContext(context.Background(), ref, login)
+}
+
+// GetIssueContext returns the issue or PR with the given number.
+func (c *Client) GetIssueContext(ctx context.Context, number int) (*github.Issue, error) {
+	issue, _, err := c.c.Issues.Get(ctx, c.owner, c.repo, number)
+	if err != nil {
+		return nil, diagnose(err)
+	}
+	return issue, nil
+}
+
+// GetIssue is GetIssueContext with context.Background.
+//
+// Deprecated: use GetIssueContext.
+func (c *Client) GetIssue(number int) (*github.Issue, error) {
+	return c.GetIssueContext(context.Background(), number)
+}
+
+// GetIssuesByNumbersContext returns the issues or PRs with the given numbers,
+// in the same order. They are fetched concurrently, a few at a time. It fails
+// if any of them can't be fetched.
+func (c *Client) GetIssuesByNumbersContext(ctx context.Context, nums []int) ([]*github.Issue, error) {
+	return c.getIssuesByNumbers(ctx, nums)
+}
+
+// ListPRFilesContext returns the paths of the files changed by the PR.
+func (c *Client) ListPRFilesContext(ctx context.Context, number int) ([]string, error) {
+	opt := &github.ListOptions{PerPage: 100}
+	var paths []string
+	for {
+		files, resp, err := c.c.PullRequests.ListFiles(ctx, c.owner, c.repo, number, opt)
+		if err != nil {
+			return nil, diagnose(err)
+		}
+		for _, f := range files {
+			paths = append(paths, f.GetFilename())
+		}
+		if resp.NextPage == 0 {
+			return paths, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// ListPRFiles is ListPRFilesContext with context.Background.
+//
+// Deprecated: use ListPRFilesContext.
+func (c *Client) ListPRFiles(number int) ([]string, error) {
+	return c.ListPRFilesContext(context.Background(), number)
+}
+
+// GetFileContentContext returns the content of the file at path, at the given
+// ref.
+func (c *Client) GetFileContentContext(ctx context.Context, path, ref string) ([]byte, error) {
+	file, _, _, err := c.c.Repositories.GetContents(ctx, c.owner, c.repo, path,
+		&github.RepositoryContentGetOptions{Ref: ref})
+	if err != nil {
+		return nil, diagnose(err)
+	}
+	if file == nil {
+		return nil, fmt.Errorf("%v is a directory", path)
+	}
+	content, err := file.GetContent()
+	if err != nil {
+		return nil, diagnose(err)
+	}
+	return []byte(content), nil
+}
+
+// GetFileContent is GetFileContentContext with context.Background.
+//
+// Deprecated: use GetFileContentContext.
+func (c *Client) GetFileContent(path, ref string) ([]byte, error) {
+	return c.GetFileContentContext(context.Background(), path, ref)
+}
+
+// GetLatestReleaseContext returns the latest published full release, drafts and
+// prereleases are ignored.
+func (c *Client) GetLatestReleaseContext(ctx context.Context) (*github.RepositoryRelease, error) {
+	release, _, err := c.c.Repositories.GetLatestRelease(ctx, c.owner, c.repo)
+	if err != nil {
+		return nil, diagnose(err)
+	}
+	return release, nil
+}
+
+// GetLatestRelease is GetLatestReleaseContext with context.Background.
+//
+// Deprecated: use GetLatestReleaseContext.
+func (c *Client) GetLatestRelease() (*github.RepositoryRelease, error) {
+	return c.GetLatestReleaseContext(context.Background())
+}
+
+// ListTagsContext returns the names of all the tags in the repo, in the order
+// returned by github (which is not version order).
+func (c *Client) ListTagsContext(ctx context.Context) ([]string, error) {
+	return c.listTags(ctx)
+}
+
+// ListTags is ListTagsContext with context.Background.
+//
+// Deprecated: use ListTagsContext.
+func (c *Client) ListTags() ([]string, error) {
+	return c.ListTagsContext(context.Background())
+}
+
+// GetOpenMilestonesContext returns the open milestones, with their issue
+// counts.
+func (c *Client) GetOpenMilestonesContext(ctx context.Context) ([]*github.Milestone, error) {
+	milestones, _, err := c.c.Issues.ListMilestones(ctx, c.owner, c.repo,
+		&github.MilestoneListOptions{
+			State:       "open",
+			ListOptions: github.ListOptions{PerPage: 100},
+		},
+	)
+	if err != nil {
+		return nil, diagnose(err)
+	}
+	return milestones, nil
+}
+
+// GetOpenMilestones is GetOpenMilestonesContext with context.Background.
+//
+// Deprecated: use GetOpenMilestonesContext.
+func (c *Client) GetOpenMilestones() ([]*github.Milestone, error) {
+	return c.GetOpenMilestonesContext(context.Background())
+}
+
+// ListOrgReposContext returns the non-archived repos in the org (the owner of
+// this client).
+//
+// If team is not empty, only the repos of the team (by slug) are returned. If
+// topic is not empty, only the repos with the topic are returned.
+func (c *Client) ListOrgReposContext(ctx context.Context, team, topic string) ([]*github.Repository, error) {
+	return c.listOrgRepos(ctx, team, topic)
+}
+
+// ListOrgRepos is ListOrgReposContext with context.Background.
+//
+// Deprecated: use ListOrgReposContext.
+func (c *Client) ListOrgRepos(team, topic string) ([]*github.Repository, error) {
+	return c.ListOrgReposContext(context.Background(), team, topic)
+}
+
+// GetRepoContext returns the repo metadata.
+func (c *Client) GetRepoContext(ctx context.Context) (*github.Repository, error) {
+	r, _, err := c.c.Repositories.Get(ctx, c.owner, c.repo)
+	if err != nil {
+		return nil, diagnose(err)
+	}
+	return r, nil
+}
+
+// GetRepo is GetRepoContext with context.Background.
+//
+// Deprecated: use GetRepoContext.
+func (c *Client) GetRepo() (*github.Repository, error) {
+	return c.GetRepoContext(context.Background())
+}
+
+// EditRepoContext updates the repo description and homepage. Empty values are
+// not changed.
+func (c *Client) EditRepoContext(ctx context.Context, description, homepage string) error {
+	r := &github.Repository{}
+	if description != "" {
+		r.Description = github.String(description)
+	}
+	if homepage != "" {
+		r.Homepage = github.String(homepage)
+	}
+	if _, _, err := c.c.Repositories.Edit(ctx, c.owner, c.repo, r); err != nil {
+		return diagnose(err)
+	}
+	return nil
+}
+
+// EditRepo is EditRepoContext with context.Background.
+//
+// Deprecated: use EditRepoContext.
+func (c *Client) EditRepo(description, homepage string) error {
+	return c.EditRepoContext(context.Background(), description, homepage)
+}
+
+// ReplaceTopicsContext replaces all the repo topics.
+func (c *Client) ReplaceTopicsContext(ctx context.Context, topics []string) error {
+	if _, _, err := c.c.Repositories.ReplaceAllTopics(ctx, c.owner, c.repo, topics); err != nil {
+		return diagnose(err)
+	}
+	return nil
+}
+
+// ReplaceTopics is ReplaceTopicsContext with context.Background.
+//
+// Deprecated: use ReplaceTopicsContext.
+func (c *Client) ReplaceTopics(topics []string) error {
+	return c.ReplaceTopicsContext(context.Background(), topics)
+}
+
+// CreateIssueCommentContext comments on the issue or pull request.
+//
+// return value is the comment URL.
+func (c *Client) CreateIssueCommentContext(ctx context.Context, number int, body string) (string, error) {
+	comment, _, err := c.c.Issues.CreateComment(ctx, c.owner, c.repo, number, &github.IssueComment{
+		Body: &body,
+	})
+	if err != nil {
+		return "", diagnose(err)
+	}
+	return comment.GetHTMLURL(), nil
+}
+
+// CreateIssueComment is CreateIssueCommentContext with context.Background.
+//
+// Deprecated: use CreateIssueCommentContext.
+func (c *Client) CreateIssueComment(number int, body string) (string, error) {
+	return c.CreateIssueCommentContext(context.Background(), number, body)
+}
+
+// GetPrimaryEmailContext returns the primary email of the token owner.
+func (c *Client) GetPrimaryEmailContext(ctx context.Context) (string, error) {
+	emails, _, err := c.c.Users.ListEmails(ctx, nil)
+	if err != nil {
+		return "", diagnose(err)
 	}
 	if len(emails) <= 0 {
 		return "", fmt.Errorf("no email address found")
@@ -153,12 +760,58 @@ func (c *Client) GetPrimaryEmail() (string, error) {
 	return e.GetEmail(), nil
 }
 
-// GetLogin returns the username of the token owner.
-func (c *Client) GetLogin() (string, error) {
+// GetPrimaryEmail is GetPrimaryEmailContext with context.Background.
+//
+// Deprecated: use GetPrimaryEmailContext.
+func (c *Client) GetPrimaryEmail() (string, error) {
+	return c.GetPrimaryEmailContext(context.Background())
+}
+
+// GetUserIdentityContext returns the display name of the user, and the public
+// email: the profile email, or if it's not public, the author email of the
+// user's latest commit in the repo. Both can be "".
+func (c *Client) GetUserIdentityContext(ctx context.Context, login string) (name, email string, err error) {
+	user, _, err := c.c.Users.Get(ctx, login)
+	if err != nil {
+		return "", "", diagnose(err)
+	}
+	name, email = user.GetName(), user.GetEmail()
+	if email != "" {
+		return name, email, nil
+	}
+	commits, _, err := c.c.Repositories.ListCommits(ctx, c.owner, c.repo, &github.CommitsListOptions{
+		Author:      login,
+		ListOptions: github.ListOptions{PerPage: 1},
+	})
+	if err != nil {
+		return "", "", diagnose(err)
+	}
+	if len(commits) > 0 {
+		email = commits[0].GetCommit().GetAuthor().GetEmail()
+	}
+	return name, email, nil
+}
+
+// GetUserIdentity is GetUserIdentityContext with context.Background.
+//
+// Deprecated: use GetUserIdentityContext.
+func (c *Client) GetUserIdentity(login string) (name, email string, err error) {
+	return c.GetUserIdentityContext(context.Background(), login)
+}
+
+// GetLoginContext returns the username of the token owner.
+func (c *Client) GetLoginContext(ctx context.Context) (string, error) {
 	// Passing the empty string will fetch the authenticated user.
-	user, _, err := c.c.Users.Get(context.Background(), "")
+	user, _, err := c.c.Users.Get(ctx, "")
 	if err != nil {
-		return "", err
+		return "", diagnose(err)
 	}
 	return user.GetLogin(), nil
 }
+
+// GetLogin is GetLoginContext with context.Background.
+//
+// Deprecated: use GetLoginContext.
+func (c *Client) GetLogin() (string, error) {
+	return c.GetLoginContext(context.Background())
+}
@@ -0,0 +1,85 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package ghclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/google/go-github/github"
+	log "github.com/sirupsen/logrus"
+	"github.com/sniperkit/snk.fork.release-git-bot/refs"
+)
+
+// CommitFilesContext writes the files (path to content) in one commit on
+// branch, without a local clone, and returns the commit. If branch doesn't
+// exist, it's created with a root commit of only the files, e.g. for a new
+// gh-pages branch.
+//
+// It fails if branch moved meanwhile.
+func (c *Client) CommitFilesContext(ctx context.Context, branch, message string, files map[string][]byte) (*github.Commit, error) {
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files to commit")
+	}
+	target := refs.BranchRef(branch)
+	var (
+		head, baseTree string
+		parents        []github.Commit
+	)
+	ref, resp, err := c.c.Git.GetRef(ctx, c.owner, c.repo, target.Short())
+	switch {
+	case resp != nil && resp.StatusCode == http.StatusNotFound:
+		// A new branch.
+	case err != nil:
+		return nil, fmt.Errorf("failed to get branch %v: %v", branch, diagnose(err))
+	default:
+		head = ref.GetObject().GetSHA()
+		headCmt, _, err := c.c.Git.GetCommit(ctx, c.owner, c.repo, head)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get commit %v: %v", head, diagnose(err))
+		}
+		baseTree = headCmt.GetTree().GetSHA()
+		parents = []github.Commit{{SHA: github.String(head)}}
+	}
+
+	var entries []github.TreeEntry
+	for p, content := range files {
+		entries = append(entries, github.TreeEntry{
+			Path:    github.String(p),
+			Mode:    github.String("100644"),
+			Type:    github.String("blob"),
+			Content: github.String(string(content)),
+		})
+	}
+	tree, _, err := c.c.Git.CreateTree(ctx, c.owner, c.repo, baseTree, entries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tree: %v", diagnose(err))
+	}
+	cmt, _, err := c.c.Git.CreateCommit(ctx, c.owner, c.repo, &github.Commit{
+		Message: github.String(message),
+		Tree:    tree,
+		Parents: parents,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create commit: %v", diagnose(err))
+	}
+
+	if head == "" {
+		log.Infof("creating %v/%v %v at %v", c.owner, c.repo, target.Full(), cmt.GetSHA())
+		if err := c.createRef(ctx, target, cmt.GetSHA()); err != nil {
+			return nil, fmt.Errorf("failed to create %v: %v", branch, err)
+		}
+		return cmt, nil
+	}
+	log.Infof("updating %v/%v %v from %v to %v", c.owner, c.repo, target.Full(), head, cmt.GetSHA())
+	// Not forced, so changes pushed to branch meanwhile are not lost.
+	if _, _, err := c.c.Git.UpdateRef(ctx, c.owner, c.repo, &github.Reference{
+		Ref:    github.String(target.Full()),
+		Object: &github.GitObject{SHA: cmt.SHA},
+	}, false); err != nil {
+		return nil, fmt.Errorf("failed to update %v: %v", branch, diagnose(err))
+	}
+	return cmt, nil
+}
@@ -0,0 +1,54 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package ghclient
+
+import "context"
+
+// compareMaxFiles is the most files the compare API returns.
+const compareMaxFiles = 300
+
+// Comparison is the difference between two commits.
+type Comparison struct {
+	Base, Head string
+	// Status is "ahead", "behind", "diverged" or "identical", from the point
+	// of view of head.
+	Status string
+	// Commits is the number of commits reachable from head but not from
+	// base.
+	Commits      int
+	FilesChanged int
+	Additions    int
+	Deletions    int
+	// Truncated is whether more files changed than the compare API returns,
+	// so FilesChanged, Additions and Deletions are lower bounds.
+	Truncated bool
+	// HTMLURL is the compare page on github.
+	HTMLURL string
+	// MergeBase is the SHA of the best common ancestor of base and head.
+	MergeBase string
+}
+
+// CompareCommitsContext compares the commits base and head (branches, tags or
+// SHAs), and returns the number of commits and the diff statistics.
+func (c *Client) CompareCommitsContext(ctx context.Context, base, head string) (*Comparison, error) {
+	cmp, _, err := c.c.Repositories.CompareCommits(ctx, c.owner, c.repo, base, head)
+	if err != nil {
+		return nil, diagnose(err)
+	}
+	ret := &Comparison{
+		Base:         base,
+		Head:         head,
+		Status:       cmp.GetStatus(),
+		Commits:      cmp.GetTotalCommits(),
+		FilesChanged: len(cmp.Files),
+		Truncated:    len(cmp.Files) >= compareMaxFiles,
+		HTMLURL:      cmp.GetHTMLURL(),
+		MergeBase:    cmp.GetMergeBaseCommit().GetSHA(),
+	}
+	for _, f := range cmp.Files {
+		ret.Additions += f.GetAdditions()
+		ret.Deletions += f.GetDeletions()
+	}
+	return ret, nil
+}
@@ -0,0 +1,155 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package ghclient
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// Permission is the token permission needed by an API endpoint.
+type Permission struct {
+	// FineGrained is the fine-grained personal access token (and github app)
+	// permission, e.g. "Contents: write".
+	FineGrained string
+	// Classic is the classic personal access token scope, e.g. "repo".
+	Classic string
+}
+
+func (p Permission) String() string {
+	return fmt.Sprintf("fine-grained token: %q, classic token: %q", p.FineGrained, p.Classic)
+}
+
+type endpointPermission struct {
+	method string
+	// path is the api path, with "*" matching one path segment, and a trailing
+	// "**" matching the rest of the path.
+	path string
+	perm Permission
+}
+
+// endpointPermissions lists the permissions of the endpoints used by the
+// client. The first match wins.
+var endpointPermissions = []endpointPermission{
+	{"GET", "/user/emails", Permission{"Email addresses: read", "user:email"}},
+	{"GET", "/user", Permission{"(none)", "read:user"}},
+	{"GET", "/orgs/*/members", Permission{"Members: read", "read:org"}},
+	{"GET", "/repos/*/*/milestones/**", Permission{"Issues: read", "repo"}},
+	{"*", "/repos/*/*/milestones/**", Permission{"Issues: write", "repo"}},
+	{"GET", "/repos/*/*/issues/**", Permission{"Issues: read", "repo"}},
+	{"*", "/repos/*/*/issues/**", Permission{"Issues: write", "repo"}},
+	{"GET", "/repos/*/*/pulls/**", Permission{"Pull requests: read", "repo"}},
+	{"*", "/repos/*/*/pulls/**", Permission{"Pull requests: write", "repo"}},
+	{"GET", "/repos/*/*/**", Permission{"Contents: read", "repo"}},
+	{"*", "/repos/*/*/**", Permission{"Contents: write", "repo"}},
+}
+
+// permissionFor returns the permission needed for the request.
+func permissionFor(method, path string) (Permission, bool) {
+	// Uploads go to uploads.github.com with the same path after the prefix.
+	path = strings.TrimPrefix(path, "/api/v3")
+	path = strings.TrimPrefix(path, "/api/uploads")
+	for _, ep := range endpointPermissions {
+		if (ep.method == "*" || ep.method == method) && matchPath(ep.path, path) {
+			return ep.perm, true
+		}
+	}
+	return Permission{}, false
+}
+
+func matchPath(pattern, path string) bool {
+	ps := strings.Split(strings.Trim(pattern, "/"), "/")
+	segs := strings.Split(strings.Trim(path, "/"), "/")
+	for i, p := range ps {
+		if p == "**" {
+			return true
+		}
+		if i >= len(segs) || (p != "*" && p != segs[i]) {
+			return false
+		}
+	}
+	return len(ps) == len(segs)
+}
+
+// PermissionError is returned when an API call fails with 403 or 404, which
+// is likely caused by missing token permission.
+type PermissionError struct {
+	Err *github.ErrorResponse
+	// Method and Path are the failed API request.
+	Method string
+	Path   string
+	// Permission is the permission likely missing. If the response has the
+	// X-Accepted-GitHub-Permissions or X-Accepted-OAuth-Scopes header, it's
+	// from the header.
+	Permission Permission
+}
+
+func (e *PermissionError) Error() string {
+	return fmt.Sprintf("%v (the token may be missing permission for %v %v: %v; note that github returns 404 for resources the token can't see)",
+		e.Err, e.Method, e.Path, e.Permission)
+}
+
+// diagnose returns a PermissionError if err is a 403 or 404 error response,
+// and err otherwise.
+func diagnose(err error) error {
+	errResp, ok := err.(*github.ErrorResponse)
+	if !ok || errResp.Response == nil || errResp.Response.Request == nil {
+		return err
+	}
+	resp := errResp.Response
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusNotFound {
+		return err
+	}
+	req := resp.Request
+	perm, ok := permissionFor(req.Method, req.URL.Path)
+	if !ok {
+		return err
+	}
+	// Github tells which permission is accepted for fine-grained tokens and
+	// which scopes for classic tokens.
+	if h := resp.Header.Get("X-Accepted-GitHub-Permissions"); h != "" {
+		perm.FineGrained = h
+	}
+	if h := resp.Header.Get("X-Accepted-OAuth-Scopes"); h != "" {
+		perm.Classic = h
+	}
+	return &PermissionError{
+		Err:        errResp,
+		Method:     req.Method,
+		Path:       req.URL.Path,
+		Permission: perm,
+	}
+}
+
+// MinimalPermissions returns the minimal token permissions needed by all the
+// endpoints used by the client, for fine-grained and classic tokens.
+func MinimalPermissions() (fineGrained, classic []string) {
+	fineSet := make(map[string]bool)
+	classicSet := make(map[string]bool)
+	for _, ep := range endpointPermissions {
+		if ep.perm.FineGrained != "(none)" {
+			fineSet[ep.perm.FineGrained] = true
+		}
+		classicSet[ep.perm.Classic] = true
+	}
+	// Write implies read.
+	for p := range fineSet {
+		if strings.HasSuffix(p, ": read") && fineSet[strings.TrimSuffix(p, "read")+"write"] {
+			delete(fineSet, p)
+		}
+	}
+	for p := range fineSet {
+		fineGrained = append(fineGrained, p)
+	}
+	for p := range classicSet {
+		classic = append(classic, p)
+	}
+	sort.Strings(fineGrained)
+	sort.Strings(classic)
+	return fineGrained, classic
+}
@@ -0,0 +1,187 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package ghclient
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"sync"
+)
+
+// ETagStore stores the responses of an ETagCache. A *cache.Cache is one, to
+// keep them across runs.
+type ETagStore interface {
+	// Get reads the value for key into v. It returns false if the key is not
+	// stored.
+	Get(key string, v interface{}) bool
+	Put(key string, v interface{}) error
+}
+
+// ETagCache caches the github API responses with an ETag or a Last-Modified
+// header, and revalidates them with conditional requests. Unchanged responses
+// are a 304, which github doesn't count in the rate limit, so the repeated
+// queries of a release (e.g. the milestone and label queries of a dry run
+// rerun) cost almost nothing.
+//
+// Only the 200 responses of GET requests are cached. A nil *ETagCache caches
+// nothing.
+type ETagCache struct {
+	// Store is where the responses are stored. If nil, they are kept in
+	// memory.
+	Store ETagStore
+	// Scope separates the responses fetched with different credentials, e.g.
+	// the token, which are private. It's hashed into the keys.
+	Scope string
+	// OnHit, if not nil, is called when a cached response is reused.
+	OnHit func(req *http.Request)
+
+	mu  sync.Mutex
+	mem map[string]*cachedResponse
+}
+
+// cachedResponse is a response of an ETagCache.
+type cachedResponse struct {
+	ETag         string      `json:"etag,omitempty"`
+	LastModified string      `json:"last_modified,omitempty"`
+	Header       http.Header `json:"header"`
+	Body         []byte      `json:"body"`
+}
+
+// Client returns a copy of hc with a transport going through the cache. If hc
+// is nil, a new client with the default transport is returned.
+func (e *ETagCache) Client(hc *http.Client) *http.Client {
+	if e == nil {
+		return hc
+	}
+	var ret http.Client
+	if hc != nil {
+		ret = *hc
+	}
+	base := ret.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	ret.Transport = &etagTransport{e: e, base: base}
+	return &ret
+}
+
+type etagTransport struct {
+	e    *ETagCache
+	base http.RoundTripper
+}
+
+func (t *etagTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || req.Header.Get("Range") != "" {
+		return t.base.RoundTrip(req)
+	}
+	key := t.e.key(req)
+	cached := t.e.get(key)
+	if cached != nil {
+		// The request must not be modified, see http.RoundTripper.
+		req = req.WithContext(req.Context())
+		header := make(http.Header, len(req.Header)+2)
+		for k, v := range req.Header {
+			header[k] = v
+		}
+		req.Header = header
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		resp.Body.Close()
+		if t.e.OnHit != nil {
+			t.e.OnHit(req)
+		}
+		return cached.response(req, resp.Header), nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+	etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		return resp, nil
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	t.e.put(key, &cachedResponse{ETag: etag, LastModified: lastModified, Header: resp.Header, Body: body})
+	return resp, nil
+}
+
+// key returns the cache key of the request: its url and media type, in the
+// scope.
+func (e *ETagCache) key(req *http.Request) string {
+	h := sha256.New()
+	for _, s := range []string{e.Scope, req.URL.String(), req.Header.Get("Accept"), req.Header.Get("X-GitHub-Api-Version")} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	return "etag/" + hex.EncodeToString(h.Sum(nil))
+}
+
+func (e *ETagCache) get(key string) *cachedResponse {
+	if e.Store != nil {
+		r := new(cachedResponse)
+		if !e.Store.Get(key, r) {
+			return nil
+		}
+		return r
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.mem[key]
+}
+
+func (e *ETagCache) put(key string, r *cachedResponse) {
+	if e.Store != nil {
+		// A response not cached is only fetched again.
+		e.Store.Put(key, r)
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.mem == nil {
+		e.mem = make(map[string]*cachedResponse)
+	}
+	e.mem[key] = r
+}
+
+// response returns the cached response to req, with the fresh headers of the
+// 304 (e.g. the rate limit).
+func (r *cachedResponse) response(req *http.Request, fresh http.Header) *http.Response {
+	header := make(http.Header, len(r.Header))
+	for k, v := range r.Header {
+		header[k] = v
+	}
+	for k, v := range fresh {
+		if k != "Content-Length" {
+			header[k] = v
+		}
+	}
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(r.Body)),
+		ContentLength: int64(len(r.Body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,54 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package ghclient
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/github"
+	log "github.com/sirupsen/logrus"
+)
+
+// SaveGistContext creates a secret gist of the token user with the files (by
+// name), or replaces the files of the gist if id is not empty, and returns
+// the gist. Secret gists are not listed, but anyone with the link can read
+// them.
+func (c *Client) SaveGistContext(ctx context.Context, id, description string, files map[string]string) (*github.Gist, error) {
+	g := &github.Gist{
+		Description: github.String(description),
+		Files:       make(map[github.GistFilename]github.GistFile),
+	}
+	for name, content := range files {
+		g.Files[github.GistFilename(name)] = github.GistFile{Content: github.String(content)}
+	}
+	if id != "" {
+		ret, _, err := c.c.Gists.Edit(ctx, id, g)
+		if err != nil {
+			return nil, diagnose(err)
+		}
+		return ret, nil
+	}
+	g.Public = github.Bool(false)
+	ret, _, err := c.c.Gists.Create(ctx, g)
+	if err != nil {
+		return nil, diagnose(err)
+	}
+	log.Infof("gist created: %v", ret.GetHTMLURL())
+	return ret, nil
+}
+
+// GetGistFileContext returns the content of the file of the gist, at its
+// latest revision.
+func (c *Client) GetGistFileContext(ctx context.Context, id, name string) (string, error) {
+	g, _, err := c.c.Gists.Get(ctx, id)
+	if err != nil {
+		return "", diagnose(err)
+	}
+	f, ok := g.Files[github.GistFilename(name)]
+	if !ok {
+		return "", fmt.Errorf("gist %v has no file %v", id, name)
+	}
+	return f.GetContent(), nil
+}
@@ -5,134 +5,346 @@ package ghclient
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"path"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/google/go-github/github"
 	log "github.com/sirupsen/logrus"
 )
 
-func (c *Client) getMilestoneNumberForTitle(ctx context.Context, milestoneTitle string) (int, error) {
-	log.Info("milestone title: ", milestoneTitle)
-	milestones, _, err := c.c.Issues.ListMilestones(context.Background(), c.owner, c.repo,
-		&github.MilestoneListOptions{
-			State:       "all",
-			ListOptions: github.ListOptions{PerPage: 100},
-		},
-	)
+func (c *Client) listMilestones(ctx context.Context) ([]*github.Milestone, error) {
+	opt := &github.MilestoneListOptions{
+		State:       "all",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	var ret []*github.Milestone
+	for {
+		milestones, resp, err := c.c.Issues.ListMilestones(ctx, c.owner, c.repo, opt)
+		if err != nil {
+			return nil, diagnose(err)
+		}
+		ret = append(ret, milestones...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	log.Info("count milestones", len(ret))
+	return ret, nil
+}
+
+func (c *Client) listTags(ctx context.Context) ([]string, error) {
+	opt := &github.ListOptions{PerPage: 100}
+	var ret []string
+	for {
+		tags, resp, err := c.c.Repositories.ListTags(ctx, c.owner, c.repo, opt)
+		if err != nil {
+			return nil, diagnose(err)
+		}
+		for _, t := range tags {
+			ret = append(ret, t.GetName())
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	log.Info("count tags", len(ret))
+	return ret, nil
+}
+
+// normalizeMilestoneTitle makes "v1.30", "1.30 Release" and "Release 1.30"
+// the same.
+func normalizeMilestoneTitle(title string) string {
+	title = strings.ToLower(strings.TrimSpace(title))
+	title = strings.TrimSpace(strings.TrimSuffix(title, "release"))
+	title = strings.TrimSpace(strings.TrimPrefix(title, "release"))
+	return strings.TrimPrefix(title, "v")
+}
+
+// milestoneMatches returns whether title matches the candidate. A candidate
+// can be an exact title, a glob pattern (e.g. "1.30*"), or a regular
+// expression in slashes (e.g. "/^v?1\.30/").
+func milestoneMatches(candidate, title string) bool {
+	if len(candidate) > 2 && strings.HasPrefix(candidate, "/") && strings.HasSuffix(candidate, "/") {
+		re, err := regexp.Compile(candidate[1 : len(candidate)-1])
+		if err != nil {
+			log.Warningf("invalid milestone regexp %q: %v", candidate, err)
+			return false
+		}
+		return re.MatchString(title)
+	}
+	if strings.ContainsAny(candidate, "*?[") {
+		ok, _ := path.Match(strings.ToLower(candidate), strings.ToLower(title))
+		return ok
+	}
+	return candidate == title
+}
+
+func (c *Client) findMilestone(ctx context.Context, candidates []string) (*github.Milestone, error) {
+	log.Info("milestone candidates: ", candidates)
+	milestones, err := c.listMilestones(ctx)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	log.Info("count milestones", len(milestones))
-	for _, m := range milestones {
-		if m.GetTitle() == milestoneTitle {
-			return m.GetNumber(), nil
+	// Exact titles and patterns are tried before normalized titles, and
+	// candidates in order.
+	for _, cand := range candidates {
+		for _, m := range milestones {
+			if milestoneMatches(cand, m.GetTitle()) {
+				return m, nil
+			}
 		}
 	}
-	return 0, fmt.Errorf("no milestone with title %q was found", milestoneTitle)
+	for _, cand := range candidates {
+		for _, m := range milestones {
+			if normalizeMilestoneTitle(cand) == normalizeMilestoneTitle(m.GetTitle()) {
+				return m, nil
+			}
+		}
+	}
+	var titles []string
+	for _, m := range milestones {
+		titles = append(titles, fmt.Sprintf("%q", m.GetTitle()))
+	}
+	return nil, fmt.Errorf("no milestone matches %q, available milestones: %v", candidates, strings.Join(titles, ", "))
 }
 
+// errNotMerged is returned by getMergeEventForPR for closed PRs that were not
+// merged.
+var errNotMerged = errors.New("merge event not found")
+
 func (c *Client) getMergeEventForPR(ctx context.Context, issue *github.Issue) (*github.IssueEvent, error) {
 	events, _, err := c.c.Issues.ListIssueEvents(ctx, c.owner, c.repo, issue.GetNumber(), &github.ListOptions{PerPage: 1000})
 	if err != nil {
-		return nil, err
+		return nil, diagnose(err)
 	}
 	for _, e := range events {
 		if e.GetEvent() == "merged" {
 			return e, nil
 		}
 	}
-	return nil, fmt.Errorf("merge event not found")
+	return nil, errNotMerged
 }
 
-func (c *Client) getMergedPRs(issues []*github.Issue) (prs []*github.Issue) {
-	ctx := context.Background()
-
-	prChan := make(chan *github.Issue)
-
+// getMergedPRs returns the issues that are merged PRs, in the same order. The
+// merge events are listed concurrently. It fails if the events of any PR can't
+// be listed, so a PR is never silently left out.
+func (c *Client) getMergedPRs(ctx context.Context, issues []*github.Issue) ([]*github.Issue, error) {
+	merged := make([]bool, len(issues))
+	errs := make([]error, len(issues))
+	sem := make(chan struct{}, c.concurrency())
 	var wg sync.WaitGroup
-	for _, ii := range issues {
+	for i, ii := range issues {
 		if ii.PullRequestLinks == nil {
 			log.Infof("%v not a pull request", issueToString(ii))
 			continue
 		}
 		wg.Add(1)
-		go func(ii *github.Issue) {
+		go func(i int, ii *github.Issue) {
 			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
 			// ii is a PR.
 			_, err := c.getMergeEventForPR(ctx, ii)
-			if err != nil {
-				log.Infof("failed to get merge event, issue: %v, error: %v", issueToString(ii), err)
-				return
+			switch {
+			case err == errNotMerged:
+				log.Infof("%v not merged", issueToString(ii))
+			case err != nil:
+				errs[i] = fmt.Errorf("failed to get merge event of %v: %v", issueToString(ii), err)
+			default:
+				merged[i] = true
 			}
-			prChan <- ii
-		}(ii)
+		}(i, ii)
 	}
-	go func() {
-		wg.Wait()
-		close(prChan)
-	}()
+	wg.Wait()
 
-	for ii := range prChan {
-		log.Info(issueToString(ii))
-		log.Info(" - ", labelsToString(ii.Labels))
-		prs = append(prs, ii)
+	var prs []*github.Issue
+	for i, ii := range issues {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		if merged[i] {
+			log.Info(issueToString(ii))
+			log.Info(" - ", labelsToString(ii.Labels))
+			prs = append(prs, ii)
+		}
 	}
-	return
+	return prs, nil
 }
 
-func (c *Client) getMergedPRsForMilestone(milestoneTitle string) []*github.Issue {
-	num, err := c.getMilestoneNumberForTitle(context.Background(), milestoneTitle)
+// listClosedIssues lists all the closed issues matching opt, in the order of
+// the listing. The first page tells the number of pages, the others are then
+// fetched concurrently.
+func (c *Client) listClosedIssues(ctx context.Context, opt github.IssueListByRepoOptions) ([]*github.Issue, error) {
+	opt.State = "closed"
+	opt.ListOptions = github.ListOptions{PerPage: 100}
+	first, resp, err := c.c.Issues.ListByRepo(ctx, c.owner, c.repo, &opt)
 	if err != nil {
-		log.Info("failed to get milestone number: ", err)
+		return nil, diagnose(err)
+	}
+	if resp.LastPage <= 1 {
+		return first, nil
+	}
+	pages := make([][]*github.Issue, resp.LastPage+1)
+	pages[1] = first
+	errs := make([]error, resp.LastPage+1)
+	sem := make(chan struct{}, c.concurrency())
+	var wg sync.WaitGroup
+	for p := 2; p <= resp.LastPage; p++ {
+		wg.Add(1)
+		go func(p int, opt github.IssueListByRepoOptions) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			opt.Page = p
+			pages[p], _, errs[p] = c.c.Issues.ListByRepo(ctx, c.owner, c.repo, &opt)
+		}(p, opt)
+	}
+	wg.Wait()
+	var issues []*github.Issue
+	for p, page := range pages {
+		if errs[p] != nil {
+			return nil, fmt.Errorf("failed to get page %v: %v", p, diagnose(errs[p]))
+		}
+		issues = append(issues, page...)
+	}
+	return issues, nil
+}
+
+func (c *Client) getMergedPRsForMilestone(ctx context.Context, candidates []string) ([]*github.Issue, error) {
+	m, err := c.findMilestone(ctx, candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.useGraphQL {
+		return c.graphQLMergedPRsForMilestone(ctx, m)
 	}
 
 	// Get closed issues with milestone number.
-	milestoneNumberStr := strconv.Itoa(num)
-	log.Info("milestone number: ", milestoneNumberStr)
-	issues, _, err := c.c.Issues.ListByRepo(context.Background(), c.owner, c.repo,
-		&github.IssueListByRepoOptions{
-			State:       "closed",
-			Milestone:   milestoneNumberStr,
-			ListOptions: github.ListOptions{PerPage: 1000},
-		},
-	)
+	milestoneNumberStr := strconv.Itoa(m.GetNumber())
+	log.Infof("milestone %q number: %v", m.GetTitle(), milestoneNumberStr)
+	issues, err := c.listClosedIssues(ctx, github.IssueListByRepoOptions{Milestone: milestoneNumberStr})
 	if err != nil {
-		log.Info("failed to get closed issues for milestone: ", err)
-		return nil
+		return nil, fmt.Errorf("failed to get closed issues for milestone %q: %v", m.GetTitle(), err)
 	}
 	log.Info("count issues", len(issues))
-	return c.getMergedPRs(issues)
+	return c.getMergedPRs(ctx, issues)
 }
 
-func (c *Client) getMergedPRsForLabels(labels []string) []*github.Issue {
-	// Get closed issues with labels.
+func (c *Client) getMergedPRsForLabels(ctx context.Context, labels []string) ([]*github.Issue, error) {
+	if c.useGraphQL {
+		log.Info("labels: ", labels)
+		return c.graphQLMergedPRsForLabels(ctx, labels)
+	}
+	// Get closed issues with each label, concurrently, and keep the ones
+	// with all the labels. The results are kept per label so the merge below
+	// is deterministic.
 	log.Info("labels: ", labels)
-	issues, _, err := c.c.Issues.ListByRepo(context.Background(), c.owner, c.repo,
-		&github.IssueListByRepoOptions{
-			State:       "closed",
-			Labels:      labels,
-			ListOptions: github.ListOptions{PerPage: 1000},
-		},
-	)
+	results := make([][]*github.Issue, len(labels))
+	errs := make([]error, len(labels))
+	sem := make(chan struct{}, c.concurrency())
+	var wg sync.WaitGroup
+	for i, l := range labels {
+		wg.Add(1)
+		go func(i int, l string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			issues, err := c.listClosedIssues(ctx, github.IssueListByRepoOptions{Labels: []string{l}})
+			if err != nil {
+				errs[i] = fmt.Errorf("failed to get closed issues for label %q: %v", l, err)
+				return
+			}
+			results[i] = issues
+		}(i, l)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	issues := withAllLabels(results)
+	log.Info("count issues", len(issues))
+	prs, err := c.getMergedPRs(ctx, issues)
 	if err != nil {
-		log.Info("failed to get closed issues for milestone: ", err)
+		return nil, err
+	}
+	sort.Slice(prs, func(i, j int) bool { return prs[i].GetNumber() < prs[j].GetNumber() })
+	return prs, nil
+}
+
+// withAllLabels returns the issues listed for each of the labels, i.e. the
+// issues with all the labels, like the labels filter of the issues API.
+func withAllLabels(results [][]*github.Issue) []*github.Issue {
+	if len(results) == 0 {
 		return nil
 	}
-	log.Info("count issues", len(issues))
-	return c.getMergedPRs(issues)
+	count := make(map[int]int)
+	for _, r := range results {
+		seen := make(map[int]bool)
+		for _, ii := range r {
+			if !seen[ii.GetNumber()] {
+				seen[ii.GetNumber()] = true
+				count[ii.GetNumber()]++
+			}
+		}
+	}
+	var ret []*github.Issue
+	for _, ii := range results[0] {
+		if count[ii.GetNumber()] == len(results) {
+			ret = append(ret, ii)
+			count[ii.GetNumber()] = 0
+		}
+	}
+	return ret
 }
 
-func (c *Client) getOrgMembers(org string) map[string]struct{} {
+func (c *Client) getIssuesByNumbers(ctx context.Context, nums []int) ([]*github.Issue, error) {
+	issues := make([]*github.Issue, len(nums))
+	errs := make([]error, len(nums))
+	sem := make(chan struct{}, c.concurrency())
+	var wg sync.WaitGroup
+	for i, n := range nums {
+		wg.Add(1)
+		go func(i, n int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			issue, _, err := c.c.Issues.Get(ctx, c.owner, c.repo, n)
+			if err != nil {
+				errs[i] = fmt.Errorf("failed to get issue %v: %v", n, diagnose(err))
+				return
+			}
+			issues[i] = issue
+		}(i, n)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return issues, nil
+}
+
+func (c *Client) getOrgMembers(ctx context.Context, org string) (map[string]struct{}, error) {
 	opt := &github.ListMembersOptions{}
 	var count int
 	ret := make(map[string]struct{})
 	for {
-		members, resp, err := c.c.Organizations.ListMembers(context.Background(), org, opt)
+		members, resp, err := c.c.Organizations.ListMembers(ctx, org, opt)
 		if err != nil {
-			log.Info("failed to get org members: ", err)
-			return nil
+			return nil, fmt.Errorf("failed to get members of org %v: %v", org, diagnose(err))
 		}
 		for _, m := range members {
 			ret[m.GetLogin()] = struct{}{}
@@ -144,11 +356,13 @@ func (c *Client) getOrgMembers(org string) map[string]struct{} {
 		opt.Page = resp.NextPage
 	}
 	log.Infof("%v members in org %v\n", count, org)
-	return ret
+	return ret, nil
 }
 
-func (c *Client) commitIDForMergedPR(pr *github.Issue) string {
-	ctx := context.Background()
+func (c *Client) commitIDForMergedPR(ctx context.Context, pr *github.Issue) string {
+	if sha, ok := c.mergeCommits.Load(pr.GetNumber()); ok {
+		return sha.(string)
+	}
 	mergeEvent, err := c.getMergeEventForPR(ctx, pr)
 	if err != nil {
 		log.Info("failed to get merge event: ", err)
@@ -161,3 +375,80 @@ func (c *Client) commitIDForMergedPR(pr *github.Issue) string {
 	// }
 	return mergeEvent.GetCommitID()
 }
+
+func (c *Client) teamID(ctx context.Context, slug string) (int64, error) {
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		teams, resp, err := c.c.Organizations.ListTeams(ctx, c.owner, opt)
+		if err != nil {
+			return 0, diagnose(err)
+		}
+		for _, t := range teams {
+			if t.GetSlug() == slug {
+				return t.GetID(), nil
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	return 0, fmt.Errorf("no team %q in org %v", slug, c.owner)
+}
+
+func (c *Client) listOrgRepos(ctx context.Context, team, topic string) ([]*github.Repository, error) {
+	var all []*github.Repository
+	if team != "" {
+		id, err := c.teamID(ctx, team)
+		if err != nil {
+			return nil, err
+		}
+		opt := &github.ListOptions{PerPage: 100}
+		for {
+			repos, resp, err := c.c.Organizations.ListTeamRepos(ctx, id, opt)
+			if err != nil {
+				return nil, diagnose(err)
+			}
+			all = append(all, repos...)
+			if resp.NextPage == 0 {
+				break
+			}
+			opt.Page = resp.NextPage
+		}
+	} else {
+		opt := &github.RepositoryListByOrgOptions{ListOptions: github.ListOptions{PerPage: 100}}
+		for {
+			repos, resp, err := c.c.Repositories.ListByOrg(ctx, c.owner, opt)
+			if err != nil {
+				return nil, diagnose(err)
+			}
+			all = append(all, repos...)
+			if resp.NextPage == 0 {
+				break
+			}
+			opt.Page = resp.NextPage
+		}
+	}
+
+	var ret []*github.Repository
+	for _, r := range all {
+		if r.GetArchived() {
+			continue
+		}
+		if topic != "" && !hasTopic(r, topic) {
+			continue
+		}
+		ret = append(ret, r)
+	}
+	log.Infof("%v repos in org %v (team %q, topic %q)", len(ret), c.owner, team, topic)
+	return ret, nil
+}
+
+func hasTopic(r *github.Repository, topic string) bool {
+	for _, t := range r.Topics {
+		if t == topic {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,327 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package ghclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	log "github.com/sirupsen/logrus"
+)
+
+// UseGraphQL makes the merged PR queries (GetMergedPRsForMilestoneContext and
+// GetMergedPRsForLabelsContext) use the GraphQL API: the merged PRs, with
+// their authors, labels and merge commits, come in one paginated query,
+// instead of one REST call per PR for its merge event.
+func (c *Client) UseGraphQL(on bool) {
+	c.useGraphQL = on
+}
+
+// graphQLURL returns the GraphQL endpoint. It's next to the REST API on
+// github.com, and at /api/graphql on GitHub Enterprise Server.
+func (c *Client) graphQLURL() string {
+	if p := c.c.BaseURL.Path; strings.HasSuffix(p, "/api/v3/") {
+		u := *c.c.BaseURL
+		u.Path = strings.TrimSuffix(p, "v3/") + "graphql"
+		return u.String()
+	}
+	return "graphql"
+}
+
+// graphQL runs the GraphQL query or mutation, and decodes its data into out.
+func (c *Client) graphQL(ctx context.Context, query string, vars map[string]interface{}, out interface{}) error {
+	req, err := c.c.NewRequest("POST", c.graphQLURL(), map[string]interface{}{
+		"query":     query,
+		"variables": vars,
+	})
+	if err != nil {
+		return err
+	}
+	var resp struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if _, err := c.c.Do(ctx, req, &resp); err != nil {
+		return diagnose(err)
+	}
+	if len(resp.Errors) > 0 {
+		return fmt.Errorf("graphql: %v", resp.Errors[0].Message)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(resp.Data, out)
+}
+
+// IsGraphQLQuery returns whether req is a GraphQL query, which only reads
+// like a GET, as opposed to a mutation. Documents with several operations are
+// not queries, whichever operationName selects.
+func IsGraphQLQuery(req *http.Request) bool {
+	if req.Method != http.MethodPost || !strings.HasSuffix(req.URL.Path, "/graphql") || req.GetBody == nil {
+		return false
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return false
+	}
+	defer body.Close()
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return false
+	}
+	var q struct {
+		Query string `json:"query"`
+	}
+	if json.Unmarshal(b, &q) != nil {
+		return false
+	}
+	ops := graphQLOperations(q.Query)
+	// A document with several operations runs the one named by
+	// operationName, so only a single query is let through.
+	return len(ops) == 1 && ops[0] == "query"
+}
+
+// graphQLOperations returns the kinds of the operations of the GraphQL
+// document, "query", "mutation" or "subscription", in order. The anonymous
+// "{...}" operations are queries, and fragments are left out.
+func graphQLOperations(doc string) []string {
+	var ops []string
+	// named is whether a definition keyword was read, and its selection set
+	// not yet.
+	depth, named := 0, false
+	for i := 0; i < len(doc); i++ {
+		switch c := doc[i]; {
+		case c == '#':
+			// A comment, to the end of the line.
+			for i < len(doc) && doc[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(doc[i:], `"""`):
+			end := strings.Index(doc[i+3:], `"""`)
+			if end < 0 {
+				return nil
+			}
+			i += end + 5
+		case c == '"':
+			for i++; i < len(doc) && doc[i] != '"'; i++ {
+				if doc[i] == '\\' {
+					i++
+				}
+			}
+		case c == '{' || c == '(' || c == '[':
+			if c == '{' && depth == 0 {
+				if !named {
+					ops = append(ops, "query")
+				}
+				named = false
+			}
+			depth++
+		case c == '}' || c == ')' || c == ']':
+			depth--
+		case depth == 0 && isNameStart(c):
+			j := i
+			for j < len(doc) && (isNameStart(doc[j]) || doc[j] >= '0' && doc[j] <= '9') {
+				j++
+			}
+			switch word := doc[i:j]; word {
+			case "query", "mutation", "subscription":
+				ops = append(ops, word)
+				named = true
+			case "fragment":
+				named = true
+			}
+			i = j - 1
+		}
+	}
+	return ops
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// graphQLPR is a merged PR in the GraphQL queries.
+type graphQLPR struct {
+	Number   int       `json:"number"`
+	Title    string    `json:"title"`
+	Body     string    `json:"body"`
+	URL      string    `json:"url"`
+	MergedAt time.Time `json:"mergedAt"`
+	Author   *struct {
+		Login string `json:"login"`
+	} `json:"author"`
+	Labels struct {
+		Nodes []struct {
+			Name string `json:"name"`
+		} `json:"nodes"`
+	} `json:"labels"`
+	MergeCommit *struct {
+		OID string `json:"oid"`
+	} `json:"mergeCommit"`
+}
+
+// issue returns the PR as the github issue the REST API returns.
+func (pr *graphQLPR) issue(owner, repo string) (*github.Issue, error) {
+	// Converted through the REST json, the fields of github.Issue differ
+	// across go-github versions.
+	rest := map[string]interface{}{
+		"number":    pr.Number,
+		"title":     pr.Title,
+		"body":      pr.Body,
+		"html_url":  pr.URL,
+		"state":     "closed",
+		"closed_at": pr.MergedAt,
+		"pull_request": map[string]string{
+			"url":      fmt.Sprintf("https://api.github.com/repos/%v/%v/pulls/%v", owner, repo, pr.Number),
+			"html_url": pr.URL,
+		},
+	}
+	if pr.Author != nil {
+		// Deleted users are null.
+		rest["user"] = map[string]string{"login": pr.Author.Login}
+	}
+	var labels []map[string]string
+	for _, l := range pr.Labels.Nodes {
+		labels = append(labels, map[string]string{"name": l.Name})
+	}
+	rest["labels"] = labels
+	b, err := json.Marshal(rest)
+	if err != nil {
+		return nil, err
+	}
+	ret := new(github.Issue)
+	if err := json.NewDecoder(bytes.NewReader(b)).Decode(ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// graphQLPRFields are the fields of graphQLPR.
+const graphQLPRFields = `pageInfo { hasNextPage endCursor }
+nodes {
+	number title body url mergedAt
+	author { login }
+	labels(first: 100) { nodes { name } }
+	mergeCommit { oid }
+}`
+
+// graphQLMergedPRs runs the paginated query of merged PRs, whose connection is
+// at path in the data, e.g. "repository.milestone.pullRequests".
+func (c *Client) graphQLMergedPRs(ctx context.Context, query, path string, vars map[string]interface{}) ([]*github.Issue, error) {
+	var prs []*github.Issue
+	for {
+		page, more, err := c.graphQLPRPage(ctx, query, path, vars)
+		if err != nil {
+			return nil, err
+		}
+		prs = append(prs, page...)
+		if !more {
+			return prs, nil
+		}
+	}
+}
+
+// graphQLPRPage runs the query for one page of merged PRs, and sets the cursor
+// of the next one in vars. It returns whether there are more pages.
+func (c *Client) graphQLPRPage(ctx context.Context, query, path string, vars map[string]interface{}) ([]*github.Issue, bool, error) {
+	vars["owner"], vars["repo"] = c.owner, c.repo
+	var data map[string]interface{}
+	if err := c.graphQL(ctx, query, vars, &data); err != nil {
+		return nil, false, err
+	}
+	// Walk down to the connection. A missing node (e.g. a label not in the
+	// repo) has no PRs.
+	var node interface{} = data
+	for _, k := range strings.Split(path, ".") {
+		m, ok := node.(map[string]interface{})
+		if !ok || m[k] == nil {
+			return nil, false, nil
+		}
+		node = m[k]
+	}
+	b, err := json.Marshal(node)
+	if err != nil {
+		return nil, false, err
+	}
+	var conn struct {
+		PageInfo struct {
+			HasNextPage bool   `json:"hasNextPage"`
+			EndCursor   string `json:"endCursor"`
+		} `json:"pageInfo"`
+		Nodes []*graphQLPR `json:"nodes"`
+	}
+	if err := json.Unmarshal(b, &conn); err != nil {
+		return nil, false, err
+	}
+	var prs []*github.Issue
+	for _, n := range conn.Nodes {
+		pr, err := n.issue(c.owner, c.repo)
+		if err != nil {
+			return nil, false, err
+		}
+		if n.MergeCommit != nil {
+			c.mergeCommits.Store(n.Number, n.MergeCommit.OID)
+		}
+		log.Info(issueToString(pr))
+		log.Info(" - ", labelsToString(pr.Labels))
+		prs = append(prs, pr)
+	}
+	vars["cursor"] = conn.PageInfo.EndCursor
+	return prs, conn.PageInfo.HasNextPage, nil
+}
+
+const milestonePRsQuery = `query($owner: String!, $repo: String!, $milestone: Int!, $cursor: String) {
+	repository(owner: $owner, name: $repo) {
+		milestone(number: $milestone) {
+			pullRequests(first: 100, after: $cursor, states: MERGED) { ` + graphQLPRFields + ` }
+		}
+	}
+}`
+
+const labelPRsQuery = `query($owner: String!, $repo: String!, $label: String!, $cursor: String) {
+	repository(owner: $owner, name: $repo) {
+		label(name: $label) {
+			pullRequests(first: 100, after: $cursor, states: MERGED) { ` + graphQLPRFields + ` }
+		}
+	}
+}`
+
+// graphQLMergedPRsForMilestone returns the merged PRs of the milestone.
+func (c *Client) graphQLMergedPRsForMilestone(ctx context.Context, m *github.Milestone) ([]*github.Issue, error) {
+	prs, err := c.graphQLMergedPRs(ctx, milestonePRsQuery, "repository.milestone.pullRequests", map[string]interface{}{
+		"milestone": m.GetNumber(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get merged PRs for milestone %q: %v", m.GetTitle(), err)
+	}
+	return prs, nil
+}
+
+// graphQLMergedPRsForLabels returns the merged PRs with all the labels,
+// sorted by number.
+func (c *Client) graphQLMergedPRsForLabels(ctx context.Context, labels []string) ([]*github.Issue, error) {
+	results := make([][]*github.Issue, len(labels))
+	for i, l := range labels {
+		lprs, err := c.graphQLMergedPRs(ctx, labelPRsQuery, "repository.label.pullRequests", map[string]interface{}{
+			"label": l,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get merged PRs for label %q: %v", l, err)
+		}
+		results[i] = lprs
+	}
+	prs := withAllLabels(results)
+	sort.Slice(prs, func(i, j int) bool { return prs[i].GetNumber() < prs[j].GetNumber() })
+	return prs, nil
+}
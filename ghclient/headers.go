@@ -0,0 +1,99 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package ghclient
+
+import (
+	"net/http"
+	"strings"
+)
+
+// DefaultAPIVersion is the github REST API version requests are pinned to if
+// it's not configured.
+const DefaultAPIVersion = "2022-11-28"
+
+// Headers sets the API version and the preview media types on every github API
+// request, so the API behavior doesn't change with go-github upgrades or github
+// API version bumps. A nil *Headers sets nothing.
+type Headers struct {
+	// Version is the X-GitHub-Api-Version, e.g. "2022-11-28".
+	Version string
+	// Previews are the API previews to opt in to, e.g. "mercy" for
+	// application/vnd.github.mercy-preview+json. They are added to the media
+	// types go-github requests.
+	Previews []string
+}
+
+// Client returns a copy of hc with a transport that sets the headers. If hc is
+// nil, a new client with the default transport is returned.
+func (h *Headers) Client(hc *http.Client) *http.Client {
+	if h == nil {
+		return hc
+	}
+	var ret http.Client
+	if hc != nil {
+		ret = *hc
+	}
+	base := ret.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	ret.Transport = &headersTransport{h: h, base: base}
+	return &ret
+}
+
+type headersTransport struct {
+	h    *Headers
+	base http.RoundTripper
+}
+
+func (t *headersTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// The request must not be modified, see http.RoundTripper.
+	req = req.WithContext(req.Context())
+	header := make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		header[k] = v
+	}
+	req.Header = header
+	if t.h.Version != "" {
+		req.Header.Set("X-GitHub-Api-Version", t.h.Version)
+	}
+	if accept := previewAccept(req.Header.Get("Accept"), t.h.Previews); accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// previewAccept returns the Accept header with the previews added, or "" if
+// it's unchanged. Downloads (e.g. application/octet-stream for release assets)
+// are left alone.
+func previewAccept(accept string, previews []string) string {
+	if len(previews) == 0 {
+		return ""
+	}
+	var types []string
+	seen := make(map[string]bool)
+	for _, t := range strings.Split(accept, ",") {
+		if t = strings.TrimSpace(t); t == "" {
+			continue
+		}
+		if !strings.HasPrefix(t, "application/vnd.github") {
+			return ""
+		}
+		types = append(types, t)
+		seen[t] = true
+	}
+	changed := false
+	for _, p := range previews {
+		t := "application/vnd.github." + p + "-preview+json"
+		if !seen[t] {
+			types = append(types, t)
+			seen[t] = true
+			changed = true
+		}
+	}
+	if !changed {
+		return ""
+	}
+	return strings.Join(types, ", ")
+}
@@ -0,0 +1,191 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package ghclient
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// PRQuery selects the merged PRs of a PRIterator: the PRs of a milestone, or
+// the PRs with all the labels.
+type PRQuery struct {
+	// Milestone and Aliases are the milestone candidates, see
+	// FindMilestoneContext.
+	Milestone string
+	Aliases   []string
+	// Labels are used if Milestone is empty.
+	Labels []string
+}
+
+// PRIterator iterates over merged PRs one page at a time, so the PRs of huge
+// milestones are never all in memory, and the first ones can be used while the
+// next pages load:
+//
+//	it := c.MergedPRs(ctx, ghclient.PRQuery{Milestone: "1.14 Release"})
+//	for it.Next() {
+//		pr := it.PR()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+//
+// The PRs come in the order of the listing, not sorted by number. An iterator
+// is not safe for concurrent use.
+type PRIterator struct {
+	ctx context.Context
+	c   *Client
+	q   PRQuery
+
+	started bool
+	// pages returns the next page of merged PRs of the current query, and
+	// whether there are more.
+	pages  func() ([]*github.Issue, bool, error)
+	more   bool
+	labels []string
+	// also are the other labels the PRs of the first label must have.
+	also []string
+
+	page []*github.Issue
+	pr   *github.Issue
+	err  error
+}
+
+// MergedPRs returns an iterator over the merged PRs selected by q.
+func (c *Client) MergedPRs(ctx context.Context, q PRQuery) *PRIterator {
+	return &PRIterator{ctx: ctx, c: c, q: q}
+}
+
+// Next advances to the next PR, fetching the next page if needed. It returns
+// false at the end, or if a page failed (see Err).
+func (it *PRIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if !it.started {
+		it.started = true
+		if it.err = it.start(); it.err != nil {
+			return false
+		}
+	}
+	for len(it.page) == 0 {
+		if !it.more && !it.nextLabel() {
+			it.pr = nil
+			return false
+		}
+		var page []*github.Issue
+		page, it.more, it.err = it.pages()
+		if it.err != nil {
+			return false
+		}
+		for _, pr := range page {
+			if hasLabels(pr, it.also) {
+				it.page = append(it.page, pr)
+			}
+		}
+	}
+	it.pr, it.page = it.page[0], it.page[1:]
+	return true
+}
+
+// PR returns the current PR.
+func (it *PRIterator) PR() *github.Issue {
+	return it.pr
+}
+
+// Err returns the error that stopped the iteration, nil at the end.
+func (it *PRIterator) Err() error {
+	return it.err
+}
+
+// start prepares the pages of the query.
+func (it *PRIterator) start() error {
+	if it.q.Milestone == "" {
+		// The PRs of the first label are listed, and filtered by the others.
+		if len(it.q.Labels) > 0 {
+			it.labels, it.also = it.q.Labels[:1], it.q.Labels[1:]
+		}
+		return nil
+	}
+	m, err := it.c.findMilestone(it.ctx, append([]string{it.q.Milestone}, it.q.Aliases...))
+	if err != nil {
+		return err
+	}
+	if it.c.useGraphQL {
+		it.pages = it.graphQLPages(milestonePRsQuery, "repository.milestone.pullRequests", map[string]interface{}{
+			"milestone": m.GetNumber(),
+		})
+	} else {
+		it.pages = it.restPages(&github.IssueListByRepoOptions{Milestone: strconv.Itoa(m.GetNumber())})
+	}
+	it.more = true
+	return nil
+}
+
+// nextLabel starts the pages of the next label. It returns false if there's
+// none left.
+func (it *PRIterator) nextLabel() bool {
+	if len(it.labels) == 0 {
+		return false
+	}
+	l := it.labels[0]
+	it.labels = it.labels[1:]
+	if it.c.useGraphQL {
+		it.pages = it.graphQLPages(labelPRsQuery, "repository.label.pullRequests", map[string]interface{}{
+			"label": l,
+		})
+	} else {
+		it.pages = it.restPages(&github.IssueListByRepoOptions{Labels: []string{l}})
+	}
+	it.more = true
+	return true
+}
+
+// hasLabels returns whether the PR has all the labels.
+func hasLabels(pr *github.Issue, labels []string) bool {
+	for _, l := range labels {
+		found := false
+		for _, pl := range pr.Labels {
+			if strings.EqualFold(pl.GetName(), l) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (it *PRIterator) graphQLPages(query, path string, vars map[string]interface{}) func() ([]*github.Issue, bool, error) {
+	return func() ([]*github.Issue, bool, error) {
+		return it.c.graphQLPRPage(it.ctx, query, path, vars)
+	}
+}
+
+// restPages lists the closed issues with opt, one page at a time, and keeps
+// the merged PRs.
+func (it *PRIterator) restPages(opt *github.IssueListByRepoOptions) func() ([]*github.Issue, bool, error) {
+	opt.State = "closed"
+	opt.ListOptions = github.ListOptions{PerPage: 100}
+	return func() ([]*github.Issue, bool, error) {
+		c := it.c
+		issues, resp, err := c.c.Issues.ListByRepo(it.ctx, c.owner, c.repo, opt)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to list closed issues: %v", diagnose(err))
+		}
+		prs, err := c.getMergedPRs(it.ctx, issues)
+		if err != nil {
+			return nil, false, err
+		}
+		opt.Page = resp.NextPage
+		return prs, resp.NextPage != 0, nil
+	}
+}
@@ -0,0 +1,164 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package ghclient
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/google/go-github/github"
+	log "github.com/sirupsen/logrus"
+)
+
+// CreateMilestoneContext creates an open milestone, and returns it.
+func (c *Client) CreateMilestoneContext(ctx context.Context, title, description string) (*github.Milestone, error) {
+	log.Infof("creating milestone %q in %v/%v", title, c.owner, c.repo)
+	m, _, err := c.c.Issues.CreateMilestone(ctx, c.owner, c.repo, &github.Milestone{
+		Title:       github.String(title),
+		Description: github.String(description),
+	})
+	if err != nil {
+		return nil, diagnose(err)
+	}
+	return m, nil
+}
+
+// CloseMilestoneContext closes the milestone with the given number. It's an
+// error if the milestone still has open issues or PRs, see
+// MoveToMilestoneContext.
+func (c *Client) CloseMilestoneContext(ctx context.Context, number int) error {
+	m, _, err := c.c.Issues.GetMilestone(ctx, c.owner, c.repo, number)
+	if err != nil {
+		return diagnose(err)
+	}
+	if n := m.GetOpenIssues(); n > 0 {
+		return fmt.Errorf("milestone %q still has %v open issues and PRs", m.GetTitle(), n)
+	}
+	log.Infof("closing milestone %v of %v/%v", number, c.owner, c.repo)
+	_, _, err = c.c.Issues.EditMilestone(ctx, c.owner, c.repo, number, &github.Milestone{
+		State: github.String("closed"),
+	})
+	return diagnose(err)
+}
+
+// MoveToMilestoneContext sets the milestone of the issue or PR.
+func (c *Client) MoveToMilestoneContext(ctx context.Context, issue, milestone int) error {
+	log.Infof("moving #%v of %v/%v to milestone %v", issue, c.owner, c.repo, milestone)
+	_, _, err := c.c.Issues.Edit(ctx, c.owner, c.repo, issue, &github.IssueRequest{
+		Milestone: github.Int(milestone),
+	})
+	return diagnose(err)
+}
+
+// RenameMilestoneContext changes the title of the milestone with the given
+// number, e.g. when a release is renumbered.
+func (c *Client) RenameMilestoneContext(ctx context.Context, number int, title string) error {
+	log.Infof("renaming milestone %v of %v/%v to %q", number, c.owner, c.repo, title)
+	_, _, err := c.c.Issues.EditMilestone(ctx, c.owner, c.repo, number, &github.Milestone{
+		Title: github.String(title),
+	})
+	return diagnose(err)
+}
+
+// EnsureMilestoneContext returns the open milestone with the exact title,
+// reopening it if it's closed, or creating it if there's none.
+func (c *Client) EnsureMilestoneContext(ctx context.Context, title string) (*github.Milestone, error) {
+	milestones, err := c.listMilestones(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range milestones {
+		if m.GetTitle() != title {
+			continue
+		}
+		if m.GetState() == "open" {
+			return m, nil
+		}
+		log.Infof("reopening milestone %q of %v/%v", title, c.owner, c.repo)
+		m, _, err := c.c.Issues.EditMilestone(ctx, c.owner, c.repo, m.GetNumber(), &github.Milestone{
+			State: github.String("open"),
+		})
+		if err != nil {
+			return nil, diagnose(err)
+		}
+		return m, nil
+	}
+	return c.CreateMilestoneContext(ctx, title, "")
+}
+
+// GetOpenPRsForMilestoneContext returns the open PRs of the milestone, found
+// by FindMilestone with milestone and aliases as the candidates, sorted by
+// number.
+func (c *Client) GetOpenPRsForMilestoneContext(ctx context.Context, milestone string, aliases ...string) ([]*github.Issue, *github.Milestone, error) {
+	m, err := c.findMilestone(ctx, append([]string{milestone}, aliases...))
+	if err != nil {
+		return nil, nil, err
+	}
+	issues, err := c.GetOpenIssuesForMilestoneContext(ctx, m.GetNumber())
+	if err != nil {
+		return nil, nil, err
+	}
+	var prs []*github.Issue
+	for _, i := range issues {
+		if i.PullRequestLinks != nil {
+			prs = append(prs, i)
+		}
+	}
+	return prs, m, nil
+}
+
+// GetOpenIssuesForMilestoneContext returns the open issues and PRs of the
+// milestone with the given number, sorted by number.
+func (c *Client) GetOpenIssuesForMilestoneContext(ctx context.Context, number int) ([]*github.Issue, error) {
+	opt := &github.IssueListByRepoOptions{
+		Milestone:   strconv.Itoa(number),
+		State:       "open",
+		Sort:        "created",
+		Direction:   "asc",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	var issues []*github.Issue
+	for {
+		page, resp, err := c.c.Issues.ListByRepo(ctx, c.owner, c.repo, opt)
+		if err != nil {
+			return nil, diagnose(err)
+		}
+		issues = append(issues, page...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	sort.Slice(issues, func(i, j int) bool { return issues[i].GetNumber() < issues[j].GetNumber() })
+	return issues, nil
+}
+
+// ListMilestoneIssuesContext lists all the issues and PRs of the milestone
+// with the given number, open and closed, oldest first, one page at a time: fn
+// is called with each page as it's fetched, so the issues of huge milestones
+// are never all in memory. The listing stops at the first error of fn.
+func (c *Client) ListMilestoneIssuesContext(ctx context.Context, number int, fn func([]*github.Issue) error) error {
+	opt := &github.IssueListByRepoOptions{
+		Milestone:   strconv.Itoa(number),
+		State:       "all",
+		Sort:        "created",
+		Direction:   "asc",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		page, resp, err := c.c.Issues.ListByRepo(ctx, c.owner, c.repo, opt)
+		if err != nil {
+			return diagnose(err)
+		}
+		if err := fn(page); err != nil {
+			return err
+		}
+		if resp.NextPage == 0 {
+			return nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
@@ -0,0 +1,274 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package ghclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/github"
+	log "github.com/sirupsen/logrus"
+)
+
+// MergeRequirements are the branch protection requirements to merge into a
+// branch.
+type MergeRequirements struct {
+	Branch    string
+	Protected bool
+	// Unknown is set if the branch is protected, but the token can't read the
+	// protection (it needs admin access to the repo).
+	Unknown           bool
+	RequiredApprovals int
+	CodeOwnerReviews  bool
+	RequiredChecks    []string
+}
+
+func (r *MergeRequirements) String() string {
+	switch {
+	case !r.Protected:
+		return fmt.Sprintf("%v is not protected", r.Branch)
+	case r.Unknown:
+		return fmt.Sprintf("%v is protected, requirements unknown", r.Branch)
+	}
+	var reqs []string
+	if r.RequiredApprovals > 0 {
+		reqs = append(reqs, fmt.Sprintf("%v approvals", r.RequiredApprovals))
+	}
+	if r.CodeOwnerReviews {
+		reqs = append(reqs, "code owner review")
+	}
+	if len(r.RequiredChecks) > 0 {
+		reqs = append(reqs, "checks "+strings.Join(r.RequiredChecks, ", "))
+	}
+	if len(reqs) == 0 {
+		return fmt.Sprintf("%v is protected, no review required", r.Branch)
+	}
+	return fmt.Sprintf("%v requires %v", r.Branch, strings.Join(reqs, ", "))
+}
+
+// GetMergeRequirementsContext returns the branch protection requirements of the
+// branch.
+func (c *Client) GetMergeRequirementsContext(ctx context.Context, branch string) (*MergeRequirements, error) {
+	ret := &MergeRequirements{Branch: branch}
+	b, _, err := c.c.Repositories.GetBranch(ctx, c.owner, c.repo, branch)
+	if err != nil {
+		return nil, diagnose(err)
+	}
+	if !b.GetProtected() {
+		return ret, nil
+	}
+	ret.Protected = true
+
+	// go-github doesn't have all the fields of the protection, so the request
+	// is built here.
+	req, err := c.c.NewRequest("GET", fmt.Sprintf("repos/%v/%v/branches/%v/protection", c.owner, c.repo, branch), nil)
+	if err != nil {
+		return nil, err
+	}
+	var p struct {
+		RequiredPullRequestReviews *struct {
+			RequiredApprovingReviewCount int  `json:"required_approving_review_count"`
+			RequireCodeOwnerReviews      bool `json:"require_code_owner_reviews"`
+		} `json:"required_pull_request_reviews"`
+		RequiredStatusChecks *struct {
+			Contexts []string `json:"contexts"`
+		} `json:"required_status_checks"`
+	}
+	if resp, err := c.c.Do(ctx, req, &p); err != nil {
+		if resp != nil && (resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusNotFound) {
+			log.Infof("can't read the protection of %v: %v", branch, err)
+			ret.Unknown = true
+			return ret, nil
+		}
+		return nil, diagnose(err)
+	}
+	if r := p.RequiredPullRequestReviews; r != nil {
+		ret.RequiredApprovals = r.RequiredApprovingReviewCount
+		ret.CodeOwnerReviews = r.RequireCodeOwnerReviews
+	}
+	if r := p.RequiredStatusChecks; r != nil {
+		ret.RequiredChecks = r.Contexts
+	}
+	return ret, nil
+}
+
+// GetMergeRequirements is GetMergeRequirementsContext with context.Background.
+//
+// Deprecated: use GetMergeRequirementsContext.
+func (c *Client) GetMergeRequirements(branch string) (*MergeRequirements, error) {
+	return c.GetMergeRequirementsContext(context.Background(), branch)
+}
+
+// PullRequestStatus is the review status of a pull request, against the
+// requirements of its base branch.
+type PullRequestStatus struct {
+	Number       int
+	URL          string
+	Merged       bool
+	Requirements *MergeRequirements
+	// Approvals is the number of reviewers whose latest review approves.
+	Approvals int
+	// ChangesRequested are the reviewers whose latest review requests changes.
+	ChangesRequested []string
+	// CodeOwnerReviewPending is set if the base branch requires a code owner
+	// review, and github still requires a review once the approvals are
+	// enough.
+	CodeOwnerReviewPending bool
+	// Checks is the status of the required checks on the head, nil if none
+	// is required.
+	Checks *ChecksStatus
+}
+
+// Missing returns what the pull request still needs before it can be merged,
+// empty if nothing is known to be missing.
+func (s *PullRequestStatus) Missing() []string {
+	var ret []string
+	if n := s.Requirements.RequiredApprovals - s.Approvals; n > 0 {
+		ret = append(ret, fmt.Sprintf("%v more approvals (%v of %v)", n, s.Approvals, s.Requirements.RequiredApprovals))
+	}
+	if s.CodeOwnerReviewPending {
+		ret = append(ret, "code owner review")
+	}
+	if len(s.ChangesRequested) > 0 {
+		ret = append(ret, "changes requested by "+strings.Join(s.ChangesRequested, ", "))
+	}
+	if s.Checks != nil {
+		if len(s.Checks.Pending) > 0 {
+			ret = append(ret, "checks "+strings.Join(s.Checks.Pending, ", "))
+		}
+		if len(s.Checks.Failed) > 0 {
+			ret = append(ret, "failed checks "+strings.Join(s.Checks.Failed, ", ")+" to pass")
+		}
+	}
+	return ret
+}
+
+// GetPullRequestStatusContext returns the review status of the pull request.
+func (c *Client) GetPullRequestStatusContext(ctx context.Context, number int) (*PullRequestStatus, error) {
+	pr, _, err := c.c.PullRequests.Get(ctx, c.owner, c.repo, number)
+	if err != nil {
+		return nil, diagnose(err)
+	}
+	s := &PullRequestStatus{Number: number, URL: pr.GetHTMLURL(), Merged: pr.GetMerged()}
+	if s.Requirements, err = c.GetMergeRequirementsContext(ctx, pr.GetBase().GetRef()); err != nil {
+		return nil, err
+	}
+
+	latest := make(map[string]string)
+	var reviewers []string
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		reviews, resp, err := c.c.PullRequests.ListReviews(ctx, c.owner, c.repo, number, opt)
+		if err != nil {
+			return nil, diagnose(err)
+		}
+		// Reviews are listed oldest first. Comments don't change the verdict.
+		for _, r := range reviews {
+			login := r.GetUser().GetLogin()
+			switch r.GetState() {
+			case "APPROVED", "CHANGES_REQUESTED", "DISMISSED":
+				if _, ok := latest[login]; !ok {
+					reviewers = append(reviewers, login)
+				}
+				latest[login] = r.GetState()
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	for _, login := range reviewers {
+		switch latest[login] {
+		case "APPROVED":
+			s.Approvals++
+		case "CHANGES_REQUESTED":
+			s.ChangesRequested = append(s.ChangesRequested, login)
+		}
+	}
+
+	if len(s.Requirements.RequiredChecks) > 0 {
+		if s.Checks, err = c.commitChecks(ctx, pr.GetHead().GetSHA(), s.Requirements.RequiredChecks); err != nil {
+			return nil, err
+		}
+		s.Checks.Number, s.Checks.Merged = number, s.Merged
+	}
+	// The reviews API doesn't tell which reviewers are code owners, github's
+	// review decision does.
+	if s.Requirements.CodeOwnerReviews && s.Approvals >= s.Requirements.RequiredApprovals {
+		decision, err := c.reviewDecision(ctx, number)
+		if err != nil {
+			return nil, err
+		}
+		s.CodeOwnerReviewPending = decision == "REVIEW_REQUIRED"
+	}
+	return s, nil
+}
+
+// reviewDecision returns github's review decision on the pull request,
+// "APPROVED", "CHANGES_REQUESTED" or "REVIEW_REQUIRED".
+func (c *Client) reviewDecision(ctx context.Context, number int) (string, error) {
+	var pr struct {
+		Repository struct {
+			PullRequest struct {
+				ReviewDecision string `json:"reviewDecision"`
+			} `json:"pullRequest"`
+		} `json:"repository"`
+	}
+	if err := c.graphQL(ctx, `query($owner: String!, $repo: String!, $number: Int!) {
+	repository(owner: $owner, name: $repo) { pullRequest(number: $number) { reviewDecision } }
+}`, map[string]interface{}{"owner": c.owner, "repo": c.repo, "number": number}, &pr); err != nil {
+		return "", fmt.Errorf("failed to get the review decision of PR #%v: %v", number, err)
+	}
+	return pr.Repository.PullRequest.ReviewDecision, nil
+}
+
+// GetPullRequestStatus is GetPullRequestStatusContext with context.Background.
+//
+// Deprecated: use GetPullRequestStatusContext.
+func (c *Client) GetPullRequestStatus(number int) (*PullRequestStatus, error) {
+	return c.GetPullRequestStatusContext(context.Background(), number)
+}
+
+// NotMergeableError is returned by MergePullRequest if the pull request doesn't
+// meet the requirements of its base branch yet.
+type NotMergeableError struct {
+	Status *PullRequestStatus
+}
+
+func (e *NotMergeableError) Error() string {
+	return fmt.Sprintf("PR #%v can't be merged yet, %v: needs %v", e.Status.Number, e.Status.Requirements, strings.Join(e.Status.Missing(), ", "))
+}
+
+// MergePullRequestContext merges the pull request with the method ("merge",
+// "squash" or "rebase"). It checks the review requirements of the base branch
+// first, and returns a *NotMergeableError instead of trying a merge that would
+// fail.
+func (c *Client) MergePullRequestContext(ctx context.Context, number int, method string) error {
+	s, err := c.GetPullRequestStatusContext(ctx, number)
+	if err != nil {
+		return err
+	}
+	if s.Merged {
+		return nil
+	}
+	if len(s.Missing()) > 0 {
+		return &NotMergeableError{Status: s}
+	}
+	if _, _, err := c.c.PullRequests.Merge(ctx, c.owner, c.repo, number, "",
+		&github.PullRequestOptions{MergeMethod: method}); err != nil {
+		return diagnose(err)
+	}
+	log.Infof("PR #%v merged", number)
+	return nil
+}
+
+// MergePullRequest is MergePullRequestContext with context.Background.
+//
+// Deprecated: use MergePullRequestContext.
+func (c *Client) MergePullRequest(number int, method string) error {
+	return c.MergePullRequestContext(context.Background(), number, method)
+}
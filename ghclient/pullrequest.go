@@ -0,0 +1,376 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package ghclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/go-github/github"
+	log "github.com/sirupsen/logrus"
+	"github.com/sniperkit/snk.fork.release-git-bot/refs"
+)
+
+// Head is where a pull request is from: a branch of the repo itself, or of a
+// fork in the same network.
+type Head struct {
+	Owner  string
+	Repo   string
+	Branch string
+}
+
+func (h *Head) String() string {
+	return fmt.Sprintf("%v/%v:%v", h.Owner, h.Repo, h.Branch)
+}
+
+// PullRequestResult is the outcome of CreatePullRequest.
+type PullRequestResult struct {
+	// NoChanges is set if head has no changes from base. No pull request is
+	// created then, e.g. the version was already bumped.
+	NoChanges bool
+
+	URL    string
+	Number int
+	Draft  bool
+	// Mergeable is nil if github hasn't computed it yet.
+	Mergeable *bool
+	// MergeableState is github's mergeable_state, e.g. "clean", "dirty" (there
+	// are conflicts), "blocked" or "unknown".
+	MergeableState string
+}
+
+// Conflicts returns whether the pull request can't be merged because of
+// conflicts with base.
+func (r *PullRequestResult) Conflicts() bool {
+	return r.MergeableState == "dirty" || (r.Mergeable != nil && !*r.Mergeable)
+}
+
+// mergeablePolls is how many times the mergeability of a new pull request is
+// polled, github computes it in the background.
+const mergeablePolls = 5
+
+// CreatePullRequestContext creates a pull request from head to the base branch
+// of the owner/repo pointed by this Client, and reports its mergeability. Draft
+// pull requests don't ping the reviewers until they are marked ready for
+// review.
+//
+// The head branch must exist. If it has no changes from base, no pull request
+// is created and the result has NoChanges set, instead of github's "No commits
+// between" error.
+func (c *Client) CreatePullRequestContext(ctx context.Context, head *Head, base, title, body string, draft bool) (*PullRequestResult, error) {
+	if _, _, err := c.c.Git.GetRef(ctx, head.Owner, head.Repo, refs.BranchRef(head.Branch).Short()); err != nil {
+		return nil, fmt.Errorf("head %v doesn't exist, was it pushed? %v", head, diagnose(err))
+	}
+
+	sameRepo := head.Owner == c.owner && head.Repo == c.repo
+	// The compare API takes owner:repo:branch for the other repos of the
+	// network, the pulls API owner:branch and the repo name separately.
+	compareHead, prHead, headRepo := head.Branch, head.Branch, ""
+	if !sameRepo {
+		compareHead = head.Owner + ":" + head.Repo + ":" + head.Branch
+		prHead = head.Owner + ":" + head.Branch
+		headRepo = head.Repo
+	}
+	cmp, _, err := c.c.Repositories.CompareCommits(ctx, c.owner, c.repo, base, compareHead)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare head %v with %v: %v", head, base, diagnose(err))
+	}
+	// Commits that change nothing (e.g. a version bump to the current
+	// version) are no changes either.
+	if cmp.GetAheadBy() == 0 || len(cmp.Files) == 0 {
+		log.Infof("%v has no changes from %v, PR not created", head, base)
+		return &PullRequestResult{NoChanges: true}, nil
+	}
+
+	// go-github doesn't support head_repo, which is needed for the forks
+	// owned by the same org, so the request is built here.
+	newPR := &struct {
+		Title               string `json:"title"`
+		Head                string `json:"head"`
+		HeadRepo            string `json:"head_repo,omitempty"`
+		Base                string `json:"base"`
+		Body                string `json:"body"`
+		MaintainerCanModify bool   `json:"maintainer_can_modify"`
+		Draft               bool   `json:"draft,omitempty"`
+	}{
+		Title:               title,
+		Head:                prHead,
+		HeadRepo:            headRepo,
+		Base:                base,
+		Body:                body,
+		MaintainerCanModify: !sameRepo,
+		Draft:               draft,
+	}
+	req, err := c.c.NewRequest("POST", fmt.Sprintf("repos/%v/%v/pulls", c.owner, c.repo), newPR)
+	if err != nil {
+		return nil, err
+	}
+	pr := new(github.PullRequest)
+	if _, err := c.c.Do(ctx, req, pr); err != nil {
+		return nil, diagnose(err)
+	}
+	log.Infof("PR created: %s", pr.GetHTMLURL())
+
+	for i := 1; pr.Mergeable == nil && i <= mergeablePolls; i++ {
+		time.Sleep(time.Duration(i) * time.Second)
+		p, _, err := c.c.PullRequests.Get(ctx, c.owner, c.repo, pr.GetNumber())
+		if err != nil {
+			log.Warningf("failed to get the mergeability of PR %v: %v", pr.GetHTMLURL(), diagnose(err))
+			break
+		}
+		pr = p
+	}
+	return &PullRequestResult{
+		URL:            pr.GetHTMLURL(),
+		Number:         pr.GetNumber(),
+		Draft:          draft,
+		Mergeable:      pr.Mergeable,
+		MergeableState: pr.GetMergeableState(),
+	}, nil
+}
+
+// CreatePullRequest is CreatePullRequestContext with context.Background.
+//
+// Deprecated: use CreatePullRequestContext.
+func (c *Client) CreatePullRequest(head *Head, base, title, body string, draft bool) (*PullRequestResult, error) {
+	return c.CreatePullRequestContext(context.Background(), head, base, title, body, draft)
+}
+
+// PullRequestOptions are the options of CreatePullRequestWithOptionsContext.
+type PullRequestOptions struct {
+	// Draft pull requests don't ping the reviewers until they are marked
+	// ready for review.
+	Draft bool
+	// Reviewers are the logins, and TeamReviewers the team slugs, requested
+	// for review.
+	Reviewers     []string
+	TeamReviewers []string
+	Assignees     []string
+	Labels        []string
+	// Milestones are the candidate titles of the milestone, as in
+	// FindMilestoneContext. The first one found is set.
+	Milestones []string
+}
+
+// CreatePullRequestWithOptionsContext is CreatePullRequestContext, which also
+// requests the reviewers, and sets the assignees, labels and milestone of the
+// pull request, so it lands triaged.
+//
+// If the pull request is created but can't be triaged, e.g. a reviewer isn't
+// a collaborator, the result is returned with the error.
+func (c *Client) CreatePullRequestWithOptionsContext(ctx context.Context, head *Head, base, title, body string, opt *PullRequestOptions) (*PullRequestResult, error) {
+	if opt == nil {
+		opt = &PullRequestOptions{}
+	}
+	pr, err := c.CreatePullRequestContext(ctx, head, base, title, body, opt.Draft)
+	if err != nil || pr.NoChanges {
+		return pr, err
+	}
+	if err := c.triagePullRequest(ctx, pr.Number, opt); err != nil {
+		return pr, fmt.Errorf("PR %v created, but not triaged: %v", pr.URL, err)
+	}
+	return pr, nil
+}
+
+// triagePullRequest requests the reviewers, and sets the assignees, labels and
+// milestone of the pull request.
+func (c *Client) triagePullRequest(ctx context.Context, number int, opt *PullRequestOptions) error {
+	edit := &github.IssueRequest{}
+	edited := false
+	if len(opt.Assignees) > 0 {
+		edit.Assignees, edited = &opt.Assignees, true
+	}
+	if len(opt.Labels) > 0 {
+		edit.Labels, edited = &opt.Labels, true
+	}
+	if len(opt.Milestones) > 0 {
+		// The milestone is set if it exists, the rest of the triage is
+		// done anyway.
+		if m, err := c.findMilestone(ctx, opt.Milestones); err != nil {
+			log.Warningf("PR #%v: not setting the milestone: %v", number, err)
+		} else {
+			edit.Milestone, edited = m.Number, true
+		}
+	}
+	if edited {
+		if _, _, err := c.c.Issues.Edit(ctx, c.owner, c.repo, number, edit); err != nil {
+			return fmt.Errorf("failed to set the assignees, labels and milestone: %v", diagnose(err))
+		}
+	}
+	if len(opt.Reviewers) > 0 || len(opt.TeamReviewers) > 0 {
+		_, _, err := c.c.PullRequests.RequestReviewers(ctx, c.owner, c.repo, number, github.ReviewersRequest{
+			Reviewers:     opt.Reviewers,
+			TeamReviewers: opt.TeamReviewers,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to request the reviewers: %v", diagnose(err))
+		}
+	}
+	log.Infof("PR #%v triaged", number)
+	return nil
+}
+
+// MarkReadyForReviewContext marks the draft pull request as ready for review.
+// The REST API can't, so it's done with the GraphQL API.
+func (c *Client) MarkReadyForReviewContext(ctx context.Context, number int) error {
+	req, err := c.c.NewRequest("GET", fmt.Sprintf("repos/%v/%v/pulls/%v", c.owner, c.repo, number), nil)
+	if err != nil {
+		return err
+	}
+	var pr struct {
+		NodeID string `json:"node_id"`
+		Draft  bool   `json:"draft"`
+	}
+	if _, err := c.c.Do(ctx, req, &pr); err != nil {
+		return diagnose(err)
+	}
+	if !pr.Draft {
+		return nil
+	}
+
+	err = c.graphQL(ctx, `mutation($id: ID!) { markPullRequestReadyForReview(input: {pullRequestId: $id}) { clientMutationId } }`,
+		map[string]interface{}{"id": pr.NodeID}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to mark PR #%v ready for review: %v", number, err)
+	}
+	log.Infof("PR #%v marked ready for review", number)
+	return nil
+}
+
+// MarkReadyForReview is MarkReadyForReviewContext with context.Background.
+//
+// Deprecated: use MarkReadyForReviewContext.
+func (c *Client) MarkReadyForReview(number int) error {
+	return c.MarkReadyForReviewContext(context.Background(), number)
+}
+
+// UpdatePullRequestBranchContext merges the base branch into the head branch of
+// the pull request if the base has moved since, so the pull request stays
+// mergeable through a long release window. It returns whether the branch was
+// updated, false if it's already up to date.
+func (c *Client) UpdatePullRequestBranchContext(ctx context.Context, number int) (bool, error) {
+	pr, _, err := c.c.PullRequests.Get(ctx, c.owner, c.repo, number)
+	if err != nil {
+		return false, diagnose(err)
+	}
+	if pr.GetState() != "open" {
+		return false, fmt.Errorf("PR #%v is %v", number, pr.GetState())
+	}
+	// The head commit is in the repo as refs/pull/<number>/head, also for
+	// pull requests from forks.
+	cmp, _, err := c.c.Repositories.CompareCommits(ctx, c.owner, c.repo, pr.GetHead().GetSHA(), pr.GetBase().GetRef())
+	if err != nil {
+		return false, fmt.Errorf("failed to compare PR #%v with %v: %v", number, pr.GetBase().GetRef(), diagnose(err))
+	}
+	if cmp.GetAheadBy() == 0 {
+		return false, nil
+	}
+
+	// go-github doesn't support the update-branch API, so the request is
+	// built here. The expected head makes it fail if someone pushed since.
+	req, err := c.c.NewRequest("PUT", fmt.Sprintf("repos/%v/%v/pulls/%v/update-branch", c.owner, c.repo, number), map[string]string{
+		"expected_head_sha": pr.GetHead().GetSHA(),
+	})
+	if err != nil {
+		return false, err
+	}
+	// The merge is done in the background, github responds 202 Accepted.
+	if resp, err := c.c.Do(ctx, req, nil); err != nil && (resp == nil || resp.StatusCode != http.StatusAccepted) {
+		if resp != nil && resp.StatusCode == http.StatusUnprocessableEntity {
+			return false, fmt.Errorf("failed to update PR #%v, it may conflict with %v or have new commits: %v", number, pr.GetBase().GetRef(), err)
+		}
+		return false, diagnose(err)
+	}
+	log.Infof("PR #%v updated with %v commits of %v", number, cmp.GetAheadBy(), pr.GetBase().GetRef())
+	return true, nil
+}
+
+// UpdatePullRequestBranch is UpdatePullRequestBranchContext with context.Background.
+//
+// Deprecated: use UpdatePullRequestBranchContext.
+func (c *Client) UpdatePullRequestBranch(number int) (bool, error) {
+	return c.UpdatePullRequestBranchContext(context.Background(), number)
+}
+
+// GetPullRequestContext returns the pull request with the given number, with
+// its merge details and size.
+func (c *Client) GetPullRequestContext(ctx context.Context, number int) (*github.PullRequest, error) {
+	pr, _, err := c.c.PullRequests.Get(ctx, c.owner, c.repo, number)
+	if err != nil {
+		return nil, diagnose(err)
+	}
+	return pr, nil
+}
+
+// ListOpenPullRequestsContext returns the open pull requests to the base
+// branch, oldest first.
+func (c *Client) ListOpenPullRequestsContext(ctx context.Context, base string) ([]*github.PullRequest, error) {
+	opt := &github.PullRequestListOptions{
+		State:       "open",
+		Base:        base,
+		Sort:        "created",
+		Direction:   "asc",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	var ret []*github.PullRequest
+	for {
+		page, resp, err := c.c.PullRequests.List(ctx, c.owner, c.repo, opt)
+		if err != nil {
+			return nil, diagnose(err)
+		}
+		ret = append(ret, page...)
+		if resp.NextPage == 0 {
+			return ret, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// ListOpenPullRequestsWithLabelContext returns the open pull requests to the
+// base branch with the label, oldest first. The labels are on the issue side
+// of the pull requests, so the open issues with the label are listed, and the
+// pull requests among them are fetched to check their base.
+func (c *Client) ListOpenPullRequestsWithLabelContext(ctx context.Context, base, label string) ([]*github.PullRequest, error) {
+	opt := &github.IssueListByRepoOptions{
+		State:       "open",
+		Labels:      []string{label},
+		Sort:        "created",
+		Direction:   "asc",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	var ret []*github.PullRequest
+	for {
+		issues, resp, err := c.c.Issues.ListByRepo(ctx, c.owner, c.repo, opt)
+		if err != nil {
+			return nil, diagnose(err)
+		}
+		for _, i := range issues {
+			if i.PullRequestLinks == nil {
+				continue
+			}
+			pr, _, err := c.c.PullRequests.Get(ctx, c.owner, c.repo, i.GetNumber())
+			if err != nil {
+				return nil, fmt.Errorf("failed to get PR #%v: %v", i.GetNumber(), diagnose(err))
+			}
+			if pr.GetBase().GetRef() == base {
+				ret = append(ret, pr)
+			}
+		}
+		if resp.NextPage == 0 {
+			return ret, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// RetargetPullRequestContext changes the base branch of the pull request.
+func (c *Client) RetargetPullRequestContext(ctx context.Context, number int, base string) error {
+	log.Infof("retargeting PR #%v of %v/%v to %v", number, c.owner, c.repo, base)
+	_, _, err := c.c.PullRequests.Edit(ctx, c.owner, c.repo, number, &github.PullRequest{
+		Base: &github.PullRequestBranch{Ref: github.String(base)},
+	})
+	return diagnose(err)
+}
@@ -0,0 +1,252 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package ghclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sniperkit/snk.fork.release-git-bot/clock"
+)
+
+// DefaultRateLimitReserve is the number of requests left when the
+// RateLimiter starts waiting for the reset, if it's not configured.
+const DefaultRateLimitReserve = 50
+
+// maxReserveFraction caps the reserve of a resource to a fraction of its
+// limit, so the small limits, e.g. 30 searches a minute, aren't all reserved.
+const maxReserveFraction = 10
+
+// maxRateLimitRetries is how many times a rate limited request is retried.
+const maxRateLimitRetries = 3
+
+// defaultSecondaryWait is the wait after a secondary rate limit without
+// Retry-After, as recommended by github.
+const defaultSecondaryWait = time.Minute
+
+// Rate is the rate limit of an API resource, from the X-RateLimit headers of
+// the last response.
+type Rate struct {
+	// Resource is e.g. "core", "search" or "graphql".
+	Resource  string
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
+// RateLimitWait is a wait for the rate limit, passed to RateLimiter.OnWait.
+type RateLimitWait struct {
+	// Secondary is true for a secondary (abuse) rate limit, false if the
+	// requests of the resource are running out.
+	Secondary bool
+	Rate      Rate
+	Until     time.Time
+}
+
+// RateLimiter keeps the requests within the github rate limits: when the
+// requests left for a resource drop to Reserve, the next ones wait for the
+// reset, and rate limited requests (403 or 429, primary or secondary) are
+// retried after Retry-After or the reset.
+//
+// A nil *RateLimiter does nothing.
+type RateLimiter struct {
+	// Reserve is the number of requests left when requests start waiting,
+	// DefaultRateLimitReserve if 0, and at most a tenth of the limit of the
+	// resource. Keeping a few lets the bot finish a step without hitting the
+	// limit.
+	Reserve int
+	// Clock is the time of the waits. If nil, it's clock.Real.
+	Clock clock.Clock
+	// OnWait, if not nil, is called before each wait. If it returns an
+	// error, the request fails with it instead of waiting, e.g. to abort if
+	// the wait is too long.
+	OnWait func(w *RateLimitWait) error
+
+	mu    sync.Mutex
+	rates map[string]*Rate
+}
+
+// Rates returns the last known rate limits, by resource.
+func (l *RateLimiter) Rates() map[string]Rate {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ret := make(map[string]Rate, len(l.rates))
+	for k, r := range l.rates {
+		ret[k] = *r
+	}
+	return ret
+}
+
+// Client returns a copy of hc with a transport going through the limiter. If
+// hc is nil, a new client with the default transport is returned.
+func (l *RateLimiter) Client(hc *http.Client) *http.Client {
+	if l == nil {
+		return hc
+	}
+	var ret http.Client
+	if hc != nil {
+		ret = *hc
+	}
+	base := ret.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	ret.Transport = &rateLimitTransport{l: l, base: base}
+	return &ret
+}
+
+type rateLimitTransport struct {
+	l    *RateLimiter
+	base http.RoundTripper
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	l := t.l
+	resource := resourceOf(req.URL.Path)
+	for attempt := 0; ; attempt++ {
+		if w := l.reserveWait(resource); w != nil {
+			if err := l.wait(req.Context(), w); err != nil {
+				return nil, err
+			}
+		}
+		if attempt > 0 && req.Body != nil {
+			// The body was consumed by the previous attempt.
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.WithContext(req.Context())
+			req.Body = body
+		}
+		resp, err := t.base.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		rate := l.update(resp.Header)
+		w := l.limitedWait(resp, rate)
+		if w == nil || attempt == maxRateLimitRetries || (req.Body != nil && req.GetBody == nil) {
+			return resp, nil
+		}
+		resp.Body.Close()
+		if err := l.wait(req.Context(), w); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// resourceOf returns the rate limit resource of the API path.
+func resourceOf(path string) string {
+	switch {
+	case strings.Contains(path, "/search/"):
+		return "search"
+	case strings.HasSuffix(path, "/graphql"):
+		return "graphql"
+	}
+	return "core"
+}
+
+// update records the rate limit of the response headers, and returns it. It
+// returns nil if the response has no rate limit headers.
+func (l *RateLimiter) update(h http.Header) *Rate {
+	limit, err1 := strconv.Atoi(h.Get("X-RateLimit-Limit"))
+	remaining, err2 := strconv.Atoi(h.Get("X-RateLimit-Remaining"))
+	reset, err3 := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return nil
+	}
+	r := &Rate{Resource: h.Get("X-RateLimit-Resource"), Limit: limit, Remaining: remaining, Reset: time.Unix(reset, 0)}
+	if r.Resource == "" {
+		r.Resource = "core"
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rates == nil {
+		l.rates = make(map[string]*Rate)
+	}
+	l.rates[r.Resource] = r
+	return r
+}
+
+// reserveWait returns the wait before a request of the resource, nil if
+// there are requests left.
+func (l *RateLimiter) reserveWait(resource string) *RateLimitWait {
+	reserve := l.Reserve
+	if reserve == 0 {
+		reserve = DefaultRateLimitReserve
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r, ok := l.rates[resource]
+	if ok && r.Limit/maxReserveFraction < reserve {
+		reserve = r.Limit / maxReserveFraction
+	}
+	if !ok || r.Remaining > reserve || !clock.Or(l.Clock).Now().Before(r.Reset) {
+		return nil
+	}
+	return &RateLimitWait{Rate: *r, Until: r.Reset}
+}
+
+// limitedWait returns the wait before retrying the rate limited response, nil
+// if it's not rate limited.
+func (l *RateLimiter) limitedWait(resp *http.Response, rate *Rate) *RateLimitWait {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return nil
+	}
+	now := clock.Or(l.Clock).Now()
+	w := &RateLimitWait{}
+	if rate != nil {
+		w.Rate = *rate
+	}
+	if s := resp.Header.Get("Retry-After"); s != "" {
+		// Retry-After is a number of seconds, or an HTTP date.
+		if secs, err := strconv.Atoi(s); err == nil {
+			w.Until = now.Add(time.Duration(secs) * time.Second)
+		} else if t, err := http.ParseTime(s); err == nil {
+			w.Until = t
+		} else {
+			return nil
+		}
+		w.Secondary = rate == nil || rate.Remaining > 0
+		return w
+	}
+	if rate != nil && rate.Remaining == 0 {
+		w.Until = rate.Reset
+		return w
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		w.Secondary = true
+		w.Until = now.Add(defaultSecondaryWait)
+		return w
+	}
+	// A 403 for another reason, e.g. a missing permission.
+	return nil
+}
+
+// wait waits until w.Until, unless OnWait or ctx stops it.
+func (l *RateLimiter) wait(ctx context.Context, w *RateLimitWait) error {
+	if l.OnWait != nil {
+		if err := l.OnWait(w); err != nil {
+			return err
+		}
+	}
+	clk := clock.Or(l.Clock)
+	d := w.Until.Sub(clk.Now())
+	if d <= 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("canceled while waiting for the rate limit: %v", ctx.Err())
+	case <-clk.After(d):
+		return nil
+	}
+}
@@ -0,0 +1,45 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package ghclient
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrReadOnly is the error of the requests rejected by a ReadOnly client.
+var ErrReadOnly = errors.New("read-only mode")
+
+// ReadOnly returns a copy of hc whose transport rejects all the requests but
+// GET, HEAD and GraphQL queries with ErrReadOnly, before they are sent. Unlike
+// a dry run, it doesn't depend on the bot skipping the changes: nothing can be
+// changed on github with the client, whatever the code path. If hc is nil, a
+// new client with the default transport is returned.
+func ReadOnly(hc *http.Client) *http.Client {
+	var ret http.Client
+	if hc != nil {
+		ret = *hc
+	}
+	base := ret.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	ret.Transport = readOnlyTransport{base: base}
+	return &ret
+}
+
+type readOnlyTransport struct {
+	base http.RoundTripper
+}
+
+func (t readOnlyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead && !IsGraphQLQuery(req) {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, fmt.Errorf("%v %v rejected: %v", req.Method, req.URL.Path, ErrReadOnly)
+	}
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,168 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package ghclient
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/github"
+	log "github.com/sirupsen/logrus"
+	"github.com/sniperkit/snk.fork.release-git-bot/refs"
+)
+
+// RefTx creates and updates several refs (e.g. a release branch and its
+// mirrors) as one change. If any fails, the refs already changed by the
+// transaction are rolled back, so no half cut state is left.
+type RefTx struct {
+	c   *Client
+	ops []*refOp
+}
+
+type refOp struct {
+	ref    refs.Ref
+	from   refs.Ref
+	update bool
+
+	// Set by Commit.
+	sha    string
+	oldSHA string // "" if ref was created.
+	done   bool
+}
+
+// NewRefTx starts a ref transaction on the repo.
+func (c *Client) NewRefTx() *RefTx {
+	return &RefTx{c: c}
+}
+
+// Create adds the creation of ref at the current commit of from. If ref
+// already exists, it's left alone.
+func (tx *RefTx) Create(ref, from refs.Ref) {
+	tx.ops = append(tx.ops, &refOp{ref: ref, from: from})
+}
+
+// Update adds moving ref to the current commit of from. It's rolled back to
+// the old commit if the transaction fails.
+func (tx *RefTx) Update(ref, from refs.Ref) {
+	tx.ops = append(tx.ops, &refOp{ref: ref, from: from, update: true})
+}
+
+// CommitContext makes the changes in the order they were added. All the source
+// refs are resolved first, so nothing is changed if any of them is missing.
+//
+// If a change fails, the previous ones are undone in reverse order, and the
+// error contains the refs that failed to roll back (if any). The rollback is
+// not canceled with ctx.
+func (tx *RefTx) CommitContext(ctx context.Context) error {
+	c := tx.c
+	for _, op := range tx.ops {
+		sha, err := c.refSHA(ctx, op.from)
+		if err != nil {
+			return fmt.Errorf("failed to get %v hash: %v", op.from.Name(), err)
+		}
+		op.sha = sha
+	}
+
+	for _, op := range tx.ops {
+		if err := tx.apply(ctx, op); err != nil {
+			err = fmt.Errorf("failed to %v: %v", op, err)
+			// ctx may be the reason of the failure.
+			if rerr := tx.rollback(context.Background()); rerr != nil {
+				return fmt.Errorf("%v; rollback failed: %v", err, rerr)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Commit is CommitContext with context.Background.
+//
+// Deprecated: use CommitContext.
+func (tx *RefTx) Commit() error {
+	return tx.CommitContext(context.Background())
+}
+
+func (op *refOp) String() string {
+	if op.update {
+		return fmt.Sprintf("update %v to %v", op.ref.Full(), op.from.Name())
+	}
+	return fmt.Sprintf("create %v from %v", op.ref.Full(), op.from.Name())
+}
+
+func (tx *RefTx) apply(ctx context.Context, op *refOp) error {
+	c := tx.c
+	cur, curErr := c.refSHA(ctx, op.ref)
+	if !op.update {
+		if curErr == nil {
+			log.Infof("ref already exists: %v at %v", op.ref.Full(), cur)
+			return nil
+		}
+		log.Infof("creating %v/%v %v at %v", c.owner, c.repo, op.ref.Full(), op.sha)
+		if err := c.createRef(ctx, op.ref, op.sha); err != nil {
+			return err
+		}
+		op.done = true
+		return nil
+	}
+
+	if curErr != nil {
+		return curErr
+	}
+	log.Infof("updating %v/%v %v from %v to %v", c.owner, c.repo, op.ref.Full(), cur, op.sha)
+	if err := c.setRef(ctx, op.ref, op.sha); err != nil {
+		return err
+	}
+	op.oldSHA, op.done = cur, true
+	return nil
+}
+
+// rollback undoes the applied operations in reverse order.
+func (tx *RefTx) rollback(ctx context.Context) error {
+	c := tx.c
+	var failed []string
+	for i := len(tx.ops) - 1; i >= 0; i-- {
+		op := tx.ops[i]
+		if !op.done {
+			continue
+		}
+		var err error
+		if op.oldSHA == "" {
+			log.Warningf("rolling back: deleting %v/%v %v", c.owner, c.repo, op.ref.Full())
+			_, err = c.c.Git.DeleteRef(ctx, c.owner, c.repo, op.ref.Short())
+			err = diagnose(err)
+		} else {
+			log.Warningf("rolling back: resetting %v/%v %v to %v", c.owner, c.repo, op.ref.Full(), op.oldSHA)
+			err = c.setRef(ctx, op.ref, op.oldSHA)
+		}
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%v (%v)", op.ref.Full(), err))
+			continue
+		}
+		op.done = false
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%v", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// refSHA returns the commit ref points to.
+func (c *Client) refSHA(ctx context.Context, ref refs.Ref) (string, error) {
+	r, _, err := c.c.Git.GetRef(ctx, c.owner, c.repo, ref.Short())
+	if err != nil {
+		return "", diagnose(err)
+	}
+	return r.GetObject().GetSHA(), nil
+}
+
+// setRef force moves ref to sha.
+func (c *Client) setRef(ctx context.Context, ref refs.Ref, sha string) error {
+	_, _, err := c.c.Git.UpdateRef(ctx, c.owner, c.repo, &github.Reference{
+		Ref:    github.String(ref.Full()),
+		Object: &github.GitObject{SHA: github.String(sha)},
+	}, true)
+	return diagnose(err)
+}
@@ -0,0 +1,163 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package ghclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/google/go-github/github"
+	log "github.com/sirupsen/logrus"
+	"github.com/sniperkit/snk.fork.release-git-bot/refs"
+)
+
+// ListReleasesContext returns all the releases of the repo, drafts included,
+// newest first.
+func (c *Client) ListReleasesContext(ctx context.Context) ([]*github.RepositoryRelease, error) {
+	opt := &github.ListOptions{PerPage: 100}
+	var releases []*github.RepositoryRelease
+	for {
+		page, resp, err := c.c.Repositories.ListReleases(ctx, c.owner, c.repo, opt)
+		if err != nil {
+			return nil, diagnose(err)
+		}
+		releases = append(releases, page...)
+		if resp.NextPage == 0 {
+			return releases, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// DeleteReleaseContext deletes the release. Its tag is kept, see
+// DeleteTagContext.
+func (c *Client) DeleteReleaseContext(ctx context.Context, releaseID int64) error {
+	log.Infof("deleting release %v/%v %v", c.owner, c.repo, releaseID)
+	_, err := c.c.Repositories.DeleteRelease(ctx, c.owner, c.repo, releaseID)
+	return diagnose(err)
+}
+
+// DeleteReleaseAssetContext deletes the release asset.
+func (c *Client) DeleteReleaseAssetContext(ctx context.Context, assetID int64) error {
+	log.Infof("deleting release asset %v/%v %v", c.owner, c.repo, assetID)
+	_, err := c.c.Repositories.DeleteReleaseAsset(ctx, c.owner, c.repo, assetID)
+	return diagnose(err)
+}
+
+// DeleteTagContext deletes the tag.
+func (c *Client) DeleteTagContext(ctx context.Context, tag string) error {
+	log.Infof("deleting %v/%v %v", c.owner, c.repo, refs.TagRef(tag).Full())
+	_, err := c.c.Git.DeleteRef(ctx, c.owner, c.repo, refs.TagRef(tag).Short())
+	return diagnose(err)
+}
+
+// CreatePrereleaseContext creates a published pre-release, e.g. a nightly
+// snapshot, and returns it. The tag is created at targetCommitish if it
+// doesn't exist.
+func (c *Client) CreatePrereleaseContext(ctx context.Context, tagName, targetCommitish, title, body string) (*github.RepositoryRelease, error) {
+	return c.createRelease(ctx, &github.RepositoryRelease{
+		TagName:         github.String(tagName),
+		TargetCommitish: github.String(targetCommitish),
+		Name:            github.String(title),
+		Body:            github.String(body),
+		Draft:           github.Bool(false),
+		Prerelease:      github.Bool(true),
+	})
+}
+
+// EditReleaseContext edits the release with the non-nil fields of edit, and
+// returns the edited release.
+func (c *Client) EditReleaseContext(ctx context.Context, releaseID int64, edit *github.RepositoryRelease) (*github.RepositoryRelease, error) {
+	release, _, err := c.c.Repositories.EditRelease(ctx, c.owner, c.repo, releaseID, edit)
+	if err != nil {
+		return nil, diagnose(err)
+	}
+	return release, nil
+}
+
+// SetTagContext points the lightweight tag at sha, creating it or force moving
+// it, e.g. for a moving "nightly" tag.
+func (c *Client) SetTagContext(ctx context.Context, tag, sha string) error {
+	ref := refs.TagRef(tag)
+	cur, err := c.refSHA(ctx, ref)
+	if err != nil {
+		return c.createRef(ctx, ref, sha)
+	}
+	if cur == sha {
+		return nil
+	}
+	log.Infof("moving %v/%v %v from %v to %v", c.owner, c.repo, ref.Full(), shortSHA(cur), shortSHA(sha))
+	return c.setRef(ctx, ref, sha)
+}
+
+// CreateTagContext tags the commit sha with the Git Data API: an annotated tag
+// object with the message if annotated is true, or a lightweight tag. The
+// tagger of annotated tags is the token user. If the tag already points at
+// sha, it's left alone, so reruns succeed; if it points elsewhere, it's an
+// error, tags are never moved.
+func (c *Client) CreateTagContext(ctx context.Context, tagName, sha, message string, annotated bool) error {
+	ref := refs.TagRef(tagName)
+	if cur, err := c.refSHA(ctx, ref); err == nil {
+		target, err := c.tagTarget(ctx, cur)
+		if err != nil {
+			return err
+		}
+		if target != sha {
+			return fmt.Errorf("tag %v already exists at %v, not %v", tagName, shortSHA(target), shortSHA(sha))
+		}
+		return nil
+	}
+	target := sha
+	if annotated {
+		t, _, err := c.c.Git.CreateTag(ctx, c.owner, c.repo, &github.Tag{
+			Tag:     github.String(tagName),
+			Message: github.String(message),
+			Object:  &github.GitObject{SHA: github.String(sha), Type: github.String("commit")},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create tag object %v: %v", tagName, diagnose(err))
+		}
+		target = t.GetSHA()
+	}
+	log.Infof("tagging %v/%v %v at %v", c.owner, c.repo, ref.Full(), shortSHA(sha))
+	return c.createRef(ctx, ref, target)
+}
+
+// tagTarget returns the commit of the tag ref target sha, which is either the
+// commit or an annotated tag object.
+func (c *Client) tagTarget(ctx context.Context, sha string) (string, error) {
+	t, resp, err := c.c.Git.GetTag(ctx, c.owner, c.repo, sha)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			// A lightweight tag.
+			return sha, nil
+		}
+		return "", diagnose(err)
+	}
+	return t.GetObject().GetSHA(), nil
+}
+
+// FindDraftReleaseByTagContext returns the draft release of the tag. Unlike
+// GetReleaseByTagContext, which only finds published releases, it lists the
+// releases, as drafts have no tag yet.
+func (c *Client) FindDraftReleaseByTagContext(ctx context.Context, tag string) (*github.RepositoryRelease, error) {
+	releases, err := c.ListReleasesContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range releases {
+		if r.GetDraft() && r.GetTagName() == tag {
+			return r, nil
+		}
+	}
+	return nil, fmt.Errorf("no draft release for tag %v in %v/%v", tag, c.owner, c.repo)
+}
+
+// PublishReleaseContext publishes the draft release, which creates its tag if
+// it doesn't exist, and returns the published release.
+func (c *Client) PublishReleaseContext(ctx context.Context, releaseID int64) (*github.RepositoryRelease, error) {
+	log.Infof("publishing release %v/%v %v", c.owner, c.repo, releaseID)
+	return c.EditReleaseContext(ctx, releaseID, &github.RepositoryRelease{Draft: github.Bool(false)})
+}
@@ -0,0 +1,255 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package ghclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/google/go-github/github"
+	log "github.com/sirupsen/logrus"
+	"github.com/sniperkit/snk.fork.release-git-bot/clock"
+	"github.com/sniperkit/snk.fork.release-git-bot/refs"
+)
+
+// Defaults of the Retry.
+const (
+	DefaultRetryAttempts = 3
+	DefaultRetryBase     = time.Second
+	DefaultRetryMax      = 30 * time.Second
+)
+
+// Retry retries the github API requests failing with a 5xx response or a
+// network error, after a jittered exponential backoff (see Backoff).
+//
+// Only the idempotent requests (GET, HEAD, PUT, PATCH, DELETE and GraphQL
+// queries) are retried by the transport: a failed POST may still have created
+// something. The PUTs merging a pull request or updating its branch are not
+// retried either, a failed attempt may have merged. The Client methods
+// creating refs and releases retry on their own with the Retry of the Client
+// (see Client.SetRetry), after checking that the failed attempt didn't create
+// it, so retries never create duplicates.
+//
+// A nil *Retry does nothing.
+type Retry struct {
+	// Attempts is the number of retries after the first failure,
+	// DefaultRetryAttempts if 0.
+	Attempts int
+	// Base is the backoff before the first retry, DefaultRetryBase if 0. It
+	// doubles with each retry, up to Max (DefaultRetryMax if 0).
+	Base time.Duration
+	Max  time.Duration
+	// Clock is the time of the backoffs. If nil, it's clock.Real.
+	Clock clock.Clock
+	// OnRetry, if not nil, is called before waiting d for the retry attempt
+	// (from 1), with the failure.
+	OnRetry func(attempt int, d time.Duration, err error)
+}
+
+// Client returns a copy of hc with a transport retrying the requests. If hc is
+// nil, a new client with the default transport is returned.
+func (r *Retry) Client(hc *http.Client) *http.Client {
+	if r == nil {
+		return hc
+	}
+	var ret http.Client
+	if hc != nil {
+		ret = *hc
+	}
+	base := ret.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	ret.Transport = &retryTransport{r: r, base: base}
+	return &ret
+}
+
+type retryTransport struct {
+	r    *Retry
+	base http.RoundTripper
+}
+
+// idempotentMethods are the methods retried by the transport.
+var idempotentMethods = map[string]bool{
+	http.MethodGet:    true,
+	http.MethodHead:   true,
+	http.MethodPut:    true,
+	http.MethodPatch:  true,
+	http.MethodDelete: true,
+}
+
+// mergePathRE matches the paths of the PUTs merging a pull request or
+// updating its branch with its base, which are not idempotent.
+var mergePathRE = regexp.MustCompile(`/pulls/\d+/(merge|update-branch)$`)
+
+// retried returns whether the transport retries the request.
+func retried(req *http.Request) bool {
+	if req.Body != nil && req.GetBody == nil {
+		return false
+	}
+	if req.Method == http.MethodPut && mergePathRE.MatchString(req.URL.Path) {
+		return false
+	}
+	return idempotentMethods[req.Method] || IsGraphQLQuery(req)
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !retried(req) {
+		return t.base.RoundTrip(req)
+	}
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.Body != nil {
+			// The body was consumed by the previous attempt.
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.WithContext(req.Context())
+			req.Body = body
+		}
+		resp, err := t.base.RoundTrip(req)
+		var failure error
+		switch {
+		case err != nil && req.Context().Err() != nil:
+			return nil, err
+		case err != nil:
+			failure = err
+		case resp.StatusCode >= 500:
+			failure = fmt.Errorf("%v %v: %v", req.Method, req.URL.Path, resp.Status)
+		}
+		if failure == nil || attempt == t.r.attempts() {
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		if err := t.r.wait(req.Context(), attempt, failure); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (r *Retry) attempts() int {
+	if r.Attempts == 0 {
+		return DefaultRetryAttempts
+	}
+	return r.Attempts
+}
+
+// wait waits for the backoff after the failed attempt (from 0).
+func (r *Retry) wait(ctx context.Context, attempt int, failure error) error {
+	base, max := r.Base, r.Max
+	if base == 0 {
+		base = DefaultRetryBase
+	}
+	if max == 0 {
+		max = DefaultRetryMax
+	}
+	d := Backoff(attempt, base, max)
+	if r.OnRetry != nil {
+		r.OnRetry(attempt+1, d, failure)
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-clock.Or(r.Clock).After(d):
+		return nil
+	}
+}
+
+// transient returns whether err is a 5xx response or a network error, after
+// which the request may or may not have been applied.
+func transient(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	if e, ok := err.(*github.ErrorResponse); ok {
+		return e.Response != nil && e.Response.StatusCode >= 500
+	}
+	if _, ok := err.(*github.RateLimitError); ok {
+		return false
+	}
+	if _, ok := err.(*github.AbuseRateLimitError); ok {
+		return false
+	}
+	return true
+}
+
+// createOnce runs create, a POST creating something on github. If it fails
+// transiently, created checks whether github created it anyway before create
+// is retried after the backoff, so the retries never create duplicates. A nil
+// *Retry runs create once.
+func (r *Retry) createOnce(ctx context.Context, what string, create func() error, created func() (bool, error)) error {
+	err := create()
+	if r == nil {
+		return err
+	}
+	for attempt := 0; attempt < r.attempts() && transient(ctx, err); attempt++ {
+		ok, cerr := created()
+		if cerr != nil {
+			// Unknown, a retry might create a duplicate.
+			return err
+		}
+		if ok {
+			log.Infof("%v was created by the failed attempt", what)
+			return nil
+		}
+		log.Warningf("failed to create %v: %v", what, err)
+		if werr := r.wait(ctx, attempt, err); werr != nil {
+			return err
+		}
+		err = create()
+	}
+	return err
+}
+
+// createRef creates ref at sha, guarded by createOnce.
+func (c *Client) createRef(ctx context.Context, ref refs.Ref, sha string) error {
+	err := c.retry.createOnce(ctx, ref.Full(), func() error {
+		_, _, err := c.c.Git.CreateRef(ctx, c.owner, c.repo, &github.Reference{
+			Ref:    github.String(ref.Full()),
+			Object: &github.GitObject{SHA: github.String(sha)},
+		})
+		return err
+	}, func() (bool, error) {
+		cur, err := c.refSHA(ctx, ref)
+		if err != nil {
+			// A duplicate ref can't be created, retry anyway.
+			return false, nil
+		}
+		return cur == sha, nil
+	})
+	return diagnose(err)
+}
+
+// createRelease creates the release, guarded by createOnce: a failed attempt
+// created it if there's a release with the same tag, name and draft status.
+func (c *Client) createRelease(ctx context.Context, r *github.RepositoryRelease) (*github.RepositoryRelease, error) {
+	var release *github.RepositoryRelease
+	err := c.retry.createOnce(ctx, "release "+r.GetTagName(), func() error {
+		var err error
+		release, _, err = c.c.Repositories.CreateRelease(ctx, c.owner, c.repo, r)
+		return err
+	}, func() (bool, error) {
+		// The new releases (and the drafts) are first.
+		releases, _, err := c.c.Repositories.ListReleases(ctx, c.owner, c.repo, &github.ListOptions{PerPage: 100})
+		if err != nil {
+			return false, err
+		}
+		for _, rr := range releases {
+			if rr.GetTagName() == r.GetTagName() && rr.GetName() == r.GetName() && rr.GetDraft() == r.GetDraft() {
+				release = rr
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, diagnose(err)
+	}
+	return release, nil
+}
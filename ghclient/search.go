@@ -0,0 +1,129 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package ghclient
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	log "github.com/sirupsen/logrus"
+)
+
+// searchMaxResults is the most results the search API returns for a query.
+const searchMaxResults = 1000
+
+// PRSearch filters the merged PRs of SearchMergedPRsContext. The zero value
+// selects all the merged PRs of the repo.
+type PRSearch struct {
+	// MergedAfter (inclusive) and MergedBefore (exclusive) bound the merge
+	// time, zero for no bound.
+	MergedAfter  time.Time
+	MergedBefore time.Time
+	// Base is the branch the PRs are merged into, any if empty.
+	Base string
+	// Labels selects the PRs with any of the labels, and ExcludeLabels
+	// leaves out the PRs with any of them.
+	Labels        []string
+	ExcludeLabels []string
+	// Authors selects the PRs of any of the users, and ExcludeAuthors leaves
+	// out the PRs of any of them, e.g. bots.
+	Authors        []string
+	ExcludeAuthors []string
+	// Query is added to the search query as is, e.g. "-is:draft" or
+	// "in:title fix".
+	Query string
+}
+
+// query returns the search query of the merged PRs of the repo with the
+// filters, for the author (any if empty).
+func (q *PRSearch) query(owner, repo, author string) string {
+	terms := []string{fmt.Sprintf("repo:%v/%v", owner, repo), "is:pr", "is:merged"}
+	const layout = "2006-01-02T15:04:05Z"
+	after, before := q.MergedAfter.UTC().Format(layout), q.MergedBefore.UTC().Format(layout)
+	switch {
+	case !q.MergedAfter.IsZero() && !q.MergedBefore.IsZero():
+		// The range is inclusive, and search has a second precision.
+		terms = append(terms, fmt.Sprintf("merged:%v..%v", after, q.MergedBefore.Add(-time.Second).UTC().Format(layout)))
+	case !q.MergedAfter.IsZero():
+		terms = append(terms, "merged:>="+after)
+	case !q.MergedBefore.IsZero():
+		terms = append(terms, "merged:<"+before)
+	}
+	if q.Base != "" {
+		terms = append(terms, "base:"+q.Base)
+	}
+	if len(q.Labels) > 0 {
+		// Comma separated labels are ORed.
+		terms = append(terms, "label:"+quoteAll(q.Labels))
+	}
+	for _, l := range q.ExcludeLabels {
+		terms = append(terms, "-label:"+quoteAll([]string{l}))
+	}
+	if author != "" {
+		terms = append(terms, "author:"+author)
+	}
+	for _, a := range q.ExcludeAuthors {
+		terms = append(terms, "-author:"+a)
+	}
+	if q.Query != "" {
+		terms = append(terms, q.Query)
+	}
+	return strings.Join(terms, " ")
+}
+
+func quoteAll(values []string) string {
+	var quoted []string
+	for _, v := range values {
+		quoted = append(quoted, fmt.Sprintf("%q", v))
+	}
+	return strings.Join(quoted, ",")
+}
+
+// SearchMergedPRsContext returns the merged PRs matching the filters with the
+// search API, sorted by number. Unlike the milestone and label listings, it
+// can select the PRs by merge time, e.g. for projects releasing on a schedule.
+//
+// The search API returns at most 1000 results per query, it's an error if
+// more PRs match, narrow the filters.
+func (c *Client) SearchMergedPRsContext(ctx context.Context, q PRSearch) ([]*github.Issue, error) {
+	authors := q.Authors
+	if len(authors) == 0 {
+		authors = []string{""}
+	}
+	seen := make(map[int]bool)
+	var prs []*github.Issue
+	// Several author qualifiers are ANDed, so each author is searched.
+	for _, author := range authors {
+		query := q.query(c.owner, c.repo, author)
+		log.Infof("searching %v", query)
+		opt := &github.SearchOptions{Sort: "created", Order: "asc", ListOptions: github.ListOptions{PerPage: 100}}
+		for {
+			result, resp, err := c.c.Search.Issues(ctx, query, opt)
+			if err != nil {
+				return nil, fmt.Errorf("failed to search %q: %v", query, diagnose(err))
+			}
+			if result.GetTotal() > searchMaxResults {
+				return nil, fmt.Errorf("%v PRs match %q, more than the %v the search API returns, narrow the search", result.GetTotal(), query, searchMaxResults)
+			}
+			for i := range result.Issues {
+				pr := &result.Issues[i]
+				if !seen[pr.GetNumber()] {
+					seen[pr.GetNumber()] = true
+					prs = append(prs, pr)
+				}
+			}
+			if resp.NextPage == 0 {
+				break
+			}
+			opt.Page = resp.NextPage
+		}
+	}
+	log.Infof("found %v merged PRs in %v/%v", len(prs), c.owner, c.repo)
+	sort.Slice(prs, func(i, j int) bool { return prs[i].GetNumber() < prs[j].GetNumber() })
+	return prs, nil
+}
@@ -0,0 +1,152 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package ghclient
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/go-github/github"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// squashPRRegexp matches the PR number github appends to squash merged
+	// commit titles, e.g. "Fix the bug (#123)".
+	squashPRRegexp = regexp.MustCompile(`\(#(\d+)\)$`)
+	// mergePRRegexp matches the title of merge commits.
+	mergePRRegexp = regexp.MustCompile(`^Merge pull request #(\d+) `)
+)
+
+// PRNumberForCommit returns the number of the PR the commit was merged in,
+// from its message, or 0 if it's unknown.
+func PRNumberForCommit(message string) int {
+	title := strings.TrimSpace(strings.SplitN(message, "\n", 2)[0])
+	for _, re := range []*regexp.Regexp{squashPRRegexp, mergePRRegexp} {
+		if m := re.FindStringSubmatch(title); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			return n
+		}
+	}
+	return 0
+}
+
+// GetMergedPRsBetweenTagsContext returns the PRs merged between the two tags
+// (or any refs, e.g. the release branch before its tag exists), sorted by
+// number, for projects that don't use milestones.
+//
+// The commits between the tags are listed with the compare API, and resolved
+// to their PRs by their messages (the "(#123)" of squash merges and the
+// "Merge pull request #123" of merge commits). The other commits (e.g. rebase
+// merges) are resolved with the PRs associated with them.
+func (c *Client) GetMergedPRsBetweenTagsContext(ctx context.Context, fromTag, toTag string) ([]*github.Issue, error) {
+	commits, err := c.GetCommitsBetweenContext(ctx, fromTag, toTag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commits between %v and %v: %v", fromTag, toTag, err)
+	}
+	nums, err := c.PRNumbersForCommitsContext(ctx, commits)
+	if err != nil {
+		return nil, err
+	}
+
+	issues, err := c.getIssuesByNumbers(ctx, nums)
+	if err != nil {
+		return nil, err
+	}
+	var prs []*github.Issue
+	for _, ii := range issues {
+		if ii.PullRequestLinks == nil {
+			continue // The number is an issue, not a PR.
+		}
+		log.Info(issueToString(ii))
+		prs = append(prs, ii)
+	}
+	sort.Slice(prs, func(i, j int) bool { return prs[i].GetNumber() < prs[j].GetNumber() })
+	return prs, nil
+}
+
+// PRNumbersForCommitsContext returns the numbers of the PRs the commits were
+// merged in, in the order of the commits, from their messages or else from
+// the PRs associated with them. Some numbers may be issues, e.g. from a
+// "(#123)" in a message.
+func (c *Client) PRNumbersForCommitsContext(ctx context.Context, commits []github.RepositoryCommit) ([]int, error) {
+	seen := make(map[int]bool)
+	var (
+		nums       []int
+		unresolved []string
+	)
+	add := func(n int) {
+		if n != 0 && !seen[n] {
+			seen[n] = true
+			nums = append(nums, n)
+		}
+	}
+	for _, cmt := range commits {
+		if n := PRNumberForCommit(cmt.GetCommit().GetMessage()); n != 0 {
+			add(n)
+			continue
+		}
+		if len(cmt.Parents) > 1 {
+			continue // A merge commit without a PR, e.g. a branch merged back.
+		}
+		unresolved = append(unresolved, cmt.GetSHA())
+	}
+	associated, err := c.prsForCommits(ctx, unresolved)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range associated {
+		add(n)
+	}
+	return nums, nil
+}
+
+// prsForCommits returns the numbers of the merged PRs associated with the
+// commits, concurrently.
+func (c *Client) prsForCommits(ctx context.Context, shas []string) ([]int, error) {
+	nums := make([][]int, len(shas))
+	errs := make([]error, len(shas))
+	sem := make(chan struct{}, c.concurrency())
+	var wg sync.WaitGroup
+	for i, sha := range shas {
+		wg.Add(1)
+		go func(i int, sha string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			req, err := c.c.NewRequest("GET", fmt.Sprintf("repos/%v/%v/commits/%v/pulls", c.owner, c.repo, sha), nil)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			// The endpoint was a preview in older API versions.
+			req.Header.Set("Accept", "application/vnd.github.groot-preview+json")
+			var prs []*github.PullRequest
+			if _, err := c.c.Do(ctx, req, &prs); err != nil {
+				errs[i] = fmt.Errorf("failed to get the PRs of commit %v: %v", shortSHA(sha), diagnose(err))
+				return
+			}
+			for _, pr := range prs {
+				// Also the PRs of forks containing the commit.
+				if pr.MergedAt != nil && strings.EqualFold(pr.GetBase().GetRepo().GetFullName(), c.owner+"/"+c.repo) {
+					nums[i] = append(nums[i], pr.GetNumber())
+				}
+			}
+		}(i, sha)
+	}
+	wg.Wait()
+	var ret []int
+	for i := range shas {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		ret = append(ret, nums[i]...)
+	}
+	return ret, nil
+}
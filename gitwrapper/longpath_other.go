@@ -0,0 +1,15 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+//go:build !windows
+// +build !windows
+
+package gitwrapper
+
+// longPath returns p, paths are not limited to MAX_PATH outside windows.
+func longPath(p string) string {
+	return p
+}
+
+// symlinksSupported is whether symlinks are exported as symlinks.
+const symlinksSupported = true
@@ -0,0 +1,31 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package gitwrapper
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// longPath returns p in the extended-length form ("\\?\C:\..."), so exported
+// files deeper than MAX_PATH (260 characters) can be created.
+func longPath(p string) string {
+	if strings.HasPrefix(p, `\\?\`) {
+		return p
+	}
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return p
+	}
+	if strings.HasPrefix(abs, `\\`) {
+		// UNC path, \\server\share\... is \\?\UNC\server\share\...
+		return `\\?\UNC\` + abs[2:]
+	}
+	return `\\?\` + abs
+}
+
+// symlinksSupported is false, creating symlinks needs the developer mode or
+// admin rights on windows. Like git with core.symlinks=false, links are
+// exported as files containing the target.
+const symlinksSupported = false
@@ -0,0 +1,71 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package gitwrapper
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// worktreePath converts a local path (e.g. "packaging\krew.yaml" on windows)
+// to the slash separated path used in the worktree.
+func worktreePath(p string) string {
+	return path.Clean(filepath.ToSlash(p))
+}
+
+// matchLineEndings converts the LF line endings of content to CRLF if old uses
+// CRLF, so rewriting a file checked in with windows line endings doesn't
+// change every line. content is returned unchanged otherwise.
+func matchLineEndings(old, content []byte) []byte {
+	if !bytes.Contains(old, []byte("\r\n")) {
+		return content
+	}
+	content = bytes.Replace(content, []byte("\r\n"), []byte("\n"), -1)
+	return bytes.Replace(content, []byte("\n"), []byte("\r\n"), -1)
+}
+
+// credentialFill gets the credentials for the remote url from the git
+// credential helpers ("git credential fill"), e.g. Git Credential Manager on
+// windows or osxkeychain on macOS.
+func credentialFill(remote string) (username, password string, err error) {
+	u, err := url.Parse(remote)
+	if err != nil {
+		return "", "", err
+	}
+	log.Infof("executing %q", "git credential fill")
+	cmd := exec.Command("git", "credential", "fill")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("protocol=%v\nhost=%v\npath=%v\n\n", u.Scheme, u.Host, strings.TrimPrefix(u.Path, "/")))
+	// Never prompt, the bot may not run in a terminal.
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	out, err := cmd.Output()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get credentials from git credential helper: %v", err)
+	}
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		kv := strings.SplitN(s.Text(), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "username":
+			username = kv[1]
+		case "password":
+			password = kv[1]
+		}
+	}
+	if password == "" {
+		return "", "", fmt.Errorf("git credential helper has no password for %v", u.Host)
+	}
+	return username, password, nil
+}
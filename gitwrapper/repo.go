@@ -7,15 +7,22 @@
 package gitwrapper
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"path"
+	"path/filepath"
+	"sort"
 	"time"
 
 	"gopkg.in/src-d/go-git.v4/plumbing"
 	"gopkg.in/src-d/go-git.v4/plumbing/object"
 	"gopkg.in/src-d/go-git.v4/plumbing/transport/http"
 
+	"github.com/sniperkit/snk.fork.release-git-bot/refs"
+
 	log "github.com/sirupsen/logrus"
 	billy "gopkg.in/src-d/go-billy.v4"
 	"gopkg.in/src-d/go-billy.v4/memfs"
@@ -29,11 +36,23 @@ type Repo struct {
 	worktree *git.Worktree
 
 	fs billy.Filesystem
+
+	// base is the cloned branch, all changes are based on it.
+	base string
+	// url is the cloned remote.
+	url string
 }
 
-// cloneRepo creates a new Repo by cloning from github.
-func cloneRepo(url string) (*Repo, error) {
-	log.Infof("executing %q", "git clone "+url)
+// cloneRepo creates a new Repo by cloning branch from github, or its default
+// branch if branch is empty.
+func cloneRepo(url, branch string) (*Repo, error) {
+	ref := plumbing.HEAD
+	if branch != "" {
+		log.Infof("executing %q", "git clone -b "+branch+" "+url)
+		ref = plumbing.ReferenceName(refs.BranchRef(branch).Full())
+	} else {
+		log.Infof("executing %q", "git clone "+url)
+	}
 
 	fs := memfs.New()
 	gitdir, err := fs.Chroot(".git")
@@ -46,13 +65,20 @@ func cloneRepo(url string) (*Repo, error) {
 	}
 	r, err := git.Clone(s, fs, &git.CloneOptions{
 		URL: url,
-		// Only fetch master branch.
-		ReferenceName: plumbing.Master,
+		// Only fetch the base branch.
+		ReferenceName: ref,
 		SingleBranch:  true,
 	})
 	if err != nil {
 		return nil, err
 	}
+	if branch == "" {
+		head, err := r.Head()
+		if err != nil {
+			return nil, fmt.Errorf("failed to call Head(): %v", err)
+		}
+		branch = head.Name().Short()
+	}
 
 	worktree, err := r.Worktree()
 	if err != nil {
@@ -63,6 +89,8 @@ func cloneRepo(url string) (*Repo, error) {
 		r:        r,
 		worktree: worktree,
 		fs:       fs,
+		base:     branch,
+		url:      url,
 	}, nil
 }
 
@@ -76,7 +104,7 @@ func (r *Repo) checkoutBranch(name string) error {
 	}
 	log.Infof("HEAD at: %v", head)
 
-	newRefName := plumbing.ReferenceName("refs/heads/" + name)
+	newRefName := plumbing.ReferenceName(refs.BranchRef(name).Full())
 	if _, err := r.r.Reference(newRefName, false); err != nil {
 		if err != plumbing.ErrReferenceNotFound {
 			return fmt.Errorf("failed to find ref: %v", err)
@@ -113,22 +141,82 @@ func (r *Repo) checkoutBranch(name string) error {
 
 func (r *Repo) updateFile(filepath, commitMsg, userName, userEmail string, write func(io.Writer) error) error {
 	log.Infof("executing %q", "edit "+filepath)
+	old, err := r.readFile(filepath)
+	if err != nil {
+		return fmt.Errorf("failed to open file %q: %v", filepath, err)
+	}
+	var content bytes.Buffer
+	if err := write(&content); err != nil {
+		return fmt.Errorf("failed to write to file: %v", err)
+	}
 	fileT, err := r.fs.OpenFile(filepath, os.O_WRONLY|os.O_TRUNC, 0644)
 	if err != nil {
 		return fmt.Errorf("failed to open file %q: %v", filepath, err)
 	}
-	err = write(fileT)
+	_, err = fileT.Write(matchLineEndings(old, content.Bytes()))
+	fileT.Close()
 	if err != nil {
-		fileT.Close()
 		return fmt.Errorf("failed to write to file: %v", err)
 	}
-	fileT.Close()
 
+	r.worktree.Add(filepath)
+	return r.commit(commitMsg, userName, userEmail)
+}
+
+// readFile returns the content of the worktree file, or nil if it doesn't
+// exist.
+func (r *Repo) readFile(p string) ([]byte, error) {
+	f, err := r.fs.Open(p)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
+
+// writeFiles creates or overwrites the files, and commits them.
+func (r *Repo) writeFiles(files map[string][]byte, commitMsg, userName, userEmail string) error {
+	var paths []string
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	for _, p := range paths {
+		log.Infof("executing %q", "edit "+p)
+		if dir := path.Dir(p); dir != "." {
+			if err := r.fs.MkdirAll(dir, 0755); err != nil {
+				return fmt.Errorf("failed to create dir %q: %v", dir, err)
+			}
+		}
+		old, err := r.readFile(p)
+		if err != nil {
+			return fmt.Errorf("failed to open file %q: %v", p, err)
+		}
+		f, err := r.fs.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open file %q: %v", p, err)
+		}
+		_, err = f.Write(matchLineEndings(old, files[p]))
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to write to file %q: %v", p, err)
+		}
+		if _, err := r.worktree.Add(p); err != nil {
+			return fmt.Errorf("failed to add file %q: %v", p, err)
+		}
+	}
+	return r.commit(commitMsg, userName, userEmail)
+}
+
+func (r *Repo) commit(commitMsg, userName, userEmail string) error {
 	status, err := r.worktree.Status()
 	if err != nil {
 		return fmt.Errorf("failed to get status from worktree: %v", err)
 	}
-	r.worktree.Add(filepath)
 	log.Infof("current worktree status (git status):\n%v", status)
 
 	log.Infof("executing %q", "git commit -m '"+commitMsg+"'")
@@ -146,6 +234,12 @@ func (r *Repo) updateFile(filepath, commitMsg, userName, userEmail string, write
 }
 
 func (r *Repo) push(username, password string) error {
+	if password == "" {
+		var err error
+		if username, password, err = credentialFill(r.url); err != nil {
+			return err
+		}
+	}
 	if err := r.r.Push(&git.PushOptions{
 		Auth: &http.BasicAuth{
 			Username: username,
@@ -191,3 +285,63 @@ func (r *Repo) printRepoInfo() {
 		return nil
 	})
 }
+
+// exportDir copies the worktree dir src (recursively) to the local dir dst.
+// .git is skipped.
+func (r *Repo) exportDir(src, dst string) error {
+	infos, err := r.fs.ReadDir(src)
+	if err != nil {
+		return fmt.Errorf("failed to read dir %q: %v", src, err)
+	}
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+	for _, info := range infos {
+		srcPath := path.Join(src, info.Name())
+		dstPath := filepath.Join(dst, info.Name())
+		switch {
+		case info.Name() == ".git":
+			continue
+		case info.IsDir():
+			if err := r.exportDir(srcPath, dstPath); err != nil {
+				return err
+			}
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := r.fs.Readlink(srcPath)
+			if err != nil {
+				return fmt.Errorf("failed to read link %q: %v", srcPath, err)
+			}
+			if !symlinksSupported {
+				if err := ioutil.WriteFile(dstPath, []byte(target), 0644); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := os.Symlink(target, dstPath); err != nil {
+				return err
+			}
+		default:
+			if err := r.exportFile(srcPath, dstPath, info.Mode()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *Repo) exportFile(src, dst string, mode os.FileMode) error {
+	in, err := r.fs.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open %q: %v", src, err)
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to copy %q: %v", src, err)
+	}
+	return out.Close()
+}
@@ -6,6 +6,8 @@ package gitwrapper
 import (
 	"fmt"
 	"io"
+
+	log "github.com/sirupsen/logrus"
 )
 
 // AuthConfig configures auth.
@@ -22,12 +24,22 @@ type GithubCloneConfig struct {
 	Owner string
 	// Repo is the repo name.
 	Repo string
+	// Branch is the branch to clone, default to the default branch of the
+	// repo. All changes are based on this branch.
+	Branch string
+	// Host is the github host, default to github.com. Set it to clone from a
+	// GitHub Enterprise Server.
+	Host string
 }
 
 // GithubClone creates a new Repo by cloning from github.
 func GithubClone(c *GithubCloneConfig) (*Repo, error) {
-	url := fmt.Sprintf("https://github.com/%v/%v", c.Owner, c.Repo)
-	return cloneRepo(url)
+	host := c.Host
+	if host == "" {
+		host = "github.com"
+	}
+	url := fmt.Sprintf("https://%v/%v/%v", host, c.Owner, c.Repo)
+	return cloneRepo(url, c.Branch)
 }
 
 // VersionChangeConfig contains the settings to make a version change.
@@ -53,8 +65,8 @@ type VersionChangeConfig struct {
 
 // MakeVersionChange makes the version change in repo.
 func (r *Repo) MakeVersionChange(c *VersionChangeConfig) error {
-	// git checkout master, all changes should be based on master.
-	if err := r.checkoutBranch("master"); err != nil {
+	// git checkout <base>, all changes should be based on the cloned branch.
+	if err := r.checkoutBranch(r.base); err != nil {
 		return err
 	}
 	// git checkout -b release_version_1.14.0
@@ -72,7 +84,7 @@ func (r *Repo) MakeVersionChange(c *VersionChangeConfig) error {
 		commitMsg += "\n\n[skip ci] Skipping Travis. Version number change only"
 	}
 	if err := r.updateFile(
-		c.VersionFile,
+		worktreePath(c.VersionFile),
 		commitMsg,
 		c.UserName,
 		c.UserEmail,
@@ -90,11 +102,62 @@ func (r *Repo) MakeVersionChange(c *VersionChangeConfig) error {
 	return nil
 }
 
+// FileChangeConfig contains the settings to change a set of files.
+type FileChangeConfig struct {
+	// Files maps the file paths to their new content. Files that don't exist
+	// will be created.
+	Files map[string][]byte
+	// BranchName is the branch where the change will be made.
+	BranchName string
+	// CommitMessage is the message for the commit.
+	CommitMessage string
+
+	// The user name for the commit.
+	UserName string
+	// The email address for the commit.
+	UserEmail string
+}
+
+// MakeFileChange writes the files in one commit on a new branch based on
+// the cloned branch.
+func (r *Repo) MakeFileChange(c *FileChangeConfig) error {
+	if len(c.Files) == 0 {
+		return fmt.Errorf("config.Files is empty")
+	}
+	// git checkout <base>, all changes should be based on the cloned branch.
+	if err := r.checkoutBranch(r.base); err != nil {
+		return err
+	}
+	if err := r.checkoutBranch(c.BranchName); err != nil {
+		return err
+	}
+	files := make(map[string][]byte, len(c.Files))
+	for p, content := range c.Files {
+		files[worktreePath(p)] = content
+	}
+	if err := r.writeFiles(files, c.CommitMessage, c.UserName, c.UserEmail); err != nil {
+		return err
+	}
+	// git diff HEAD~
+	return r.printDiffInHeadCommit()
+}
+
+// Export writes the worktree of the current branch to the local dir, e.g. to
+// build and test a change before it's pushed. The .git dir is not exported.
+//
+// On windows, paths longer than MAX_PATH are supported, and symlinks are
+// written as files containing the link target.
+func (r *Repo) Export(dir string) error {
+	log.Infof("exporting worktree to %v", dir)
+	return r.exportDir(r.fs.Root(), longPath(dir))
+}
+
 // PublicConfig configures public.
 type PublicConfig struct {
 	// The remote to be pushed to.
 	RemoteName string
-	// The config for auth.
+	// The config for auth. If it's nil or the password is empty, the
+	// credentials are from the git credential helpers.
 	Auth *AuthConfig
 }
 
@@ -103,8 +166,12 @@ func (r *Repo) Publish(c *PublicConfig) error {
 	// This could push to upstream directly, but to be safe, we send pull
 	// request instead.
 
+	auth := c.Auth
+	if auth == nil {
+		auth = &AuthConfig{}
+	}
 	// git push -u
-	if err := r.push(c.Auth.Username, c.Auth.Password); err != nil {
+	if err := r.push(auth.Username, auth.Password); err != nil {
 		return err
 	}
 	return nil
@@ -0,0 +1,154 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sniperkit/snk.fork.release-git-bot/config"
+	"github.com/sniperkit/snk.fork.release-git-bot/ghclient"
+	"github.com/sniperkit/snk.fork.release-git-bot/gitwrapper"
+	"github.com/sniperkit/snk.fork.release-git-bot/state"
+	"github.com/sniperkit/snk.fork.release-git-bot/version"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// runHotfix releases a single fix as the next patch of the latest release:
+// the fix is cherry-picked onto the release branch with the version change,
+// and the release is drafted with a one-line note. Milestones are not used.
+func runHotfix(cfg *config.Config, args []string) error {
+	fs := newFlagSet("hotfix")
+	prFlag := fs.Int("pr", 0, "the merged pull request with the fix")
+	commit := fs.String("commit", "", "the commit with the fix, if it has no pull request")
+	fs.Parse(args)
+	if (*prFlag == 0) == (*commit == "") {
+		return fmt.Errorf("exactly one of -pr and -commit must be set")
+	}
+
+	upstream := newClient(upstreamUser, *repo)
+	ver, err := hotfixVersion(upstream)
+	if err != nil {
+		return err
+	}
+	branch := ver.Branch()
+
+	var sha, note string
+	if *prFlag != 0 {
+		pr, err := upstream.GetIssueContext(runCtx, *prFlag)
+		if err != nil {
+			return fmt.Errorf("failed to get PR #%v: %v", *prFlag, err)
+		}
+		sha = upstream.CommitIDForMergedPRContext(runCtx, pr)
+		if sha == "" {
+			return fmt.Errorf("PR #%v is not merged", *prFlag)
+		}
+		note = fmt.Sprintf("%v (#%v)", pr.GetTitle(), pr.GetNumber())
+	} else {
+		sha, err = upstream.GetCommitSHAContext(runCtx, *commit)
+		if err != nil {
+			return fmt.Errorf("failed to get commit %v: %v", *commit, err)
+		}
+	}
+
+	login, err := upstream.GetLoginContext(runCtx)
+	if err != nil {
+		return fmt.Errorf("failed to get login from github: %v", err)
+	}
+	emailAddress := *email
+	if emailAddress == "" {
+		if emailAddress, err = upstream.GetPrimaryEmailContext(runCtx); err != nil {
+			return fmt.Errorf("failed to get primary email address from github: %v", err)
+		}
+	}
+	auditLog.SetActor(login)
+
+	st, err := state.Load(stateFilePath(ver), upstreamUser+"/"+*repo, ver.String(), stateKey)
+	if err != nil {
+		return fmt.Errorf("failed to load state: %v", err)
+	}
+	st.Redact = redactor.Bytes
+	st.Clock = botClock
+	handleSignals()
+	fmt.Printf("Hotfix %v: %v on %v\n\n", ver.String(), sha, branch)
+
+	hotfixBranch := fmt.Sprintf("hotfix_%v", ver.Tag())
+	runStep(st, "hotfix: cherry-pick", func() {
+		fmt.Printf(" - Cherry-pick %v onto %v/%v/%v\n\n", sha, upstreamUser, *repo, hotfixBranch)
+		if err := upstream.NewBranchFromContext(runCtx, hotfixBranch, branch); err != nil {
+			log.Fatalf("failed to create hotfix branch: %v", err)
+		}
+		picked, err := upstream.CherryPickContext(runCtx, sha, hotfixBranch)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if note == "" {
+			note = fmt.Sprintf("%v (%v)", strings.SplitN(picked.GetMessage(), "\n", 2)[0], sha)
+		}
+		st.Set("hotfix_note", note)
+	})
+
+	runStep(st, "hotfix: change version", func() {
+		fmt.Printf(" - Change version to %v, and send the fix to %v\n\n", ver.String(), branch)
+		local, err := gitwrapper.GithubClone(&gitwrapper.GithubCloneConfig{
+			Host:   githubHost(),
+			Owner:  upstreamUser,
+			Repo:   *repo,
+			Branch: hotfixBranch,
+		})
+		if err != nil {
+			log.Fatalf("failed to github clone: %v", err)
+		}
+		// Not skipping CI, the pull request has the fix too. Never a draft,
+		// the hotfix is merged as soon as it's ready.
+		opt := prOptions(cfg, "version", ver)
+		opt.Draft = false
+		st.Set("version_pr", makePR(upstream, local, ver.String(), branch, false, opt, cfg.BumpChecks, login, login, emailAddress))
+	})
+
+	runStep(st, "wait for version PR merged", func() {
+		if st.Get("version_pr") == "" {
+			log.Fatalf("no change to send to %v, is the fix already released?", branch)
+		}
+		if method := versionPRMergeMethod(); method != "" {
+			mergeWhenReady(upstream, st, "wait for version PR merged", st.Get("version_pr"), method)
+			return
+		}
+		fmt.Printf("PR %v created, merge before continuing, then delete %v...\n", st.Get("version_pr"), hotfixBranch)
+		confirm(st, "wait for version PR merged", "Merged?")
+	})
+
+	runStep(st, "hotfix: create draft release", func() {
+		fmt.Printf(" - Create draft release %v\n\n", ver.Tag())
+		body := fmt.Sprintf("# Bug Fixes\n\n * %v\n", st.Get("hotfix_note"))
+		release, err := createOrUpdateDraft(upstream, ver.Tag(), branch, fmt.Sprintf("Release %v", ver.String()), body)
+		if err != nil {
+			log.Fatal("failed to create release: ", err)
+		}
+		st.Set("draft_release", release.GetHTMLURL())
+	})
+	fmt.Printf("Draft release %v created, publish it to finish the hotfix\n", st.Get("draft_release"))
+	return nil
+}
+
+// hotfixVersion returns -version, or the patch after the latest release tag.
+func hotfixVersion(c *ghclient.Client) (*version.Version, error) {
+	if *newVersion != "" {
+		ver, err := versionScheme.Parse(*newVersion)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version string %q: %v", *newVersion, err)
+		}
+		return ver, nil
+	}
+	tags, err := c.ListTagsContext(runCtx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags: %v", err)
+	}
+	latest := version.Latest(version.ParseTags(versionScheme, tags), func(v *version.Version) bool { return !v.IsPrerelease() })
+	if latest == nil {
+		return nil, fmt.Errorf("no release tag to hotfix")
+	}
+	return latest.NextPatch(), nil
+}
@@ -7,12 +7,25 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
+	"time"
 
-	"github.com/blang/semver"
+	"github.com/sniperkit/snk.fork.release-git-bot/audit"
+	"github.com/sniperkit/snk.fork.release-git-bot/clock"
+	"github.com/sniperkit/snk.fork.release-git-bot/config"
+	"github.com/sniperkit/snk.fork.release-git-bot/features"
+	"github.com/sniperkit/snk.fork.release-git-bot/ghapp"
 	"github.com/sniperkit/snk.fork.release-git-bot/ghclient"
 	"github.com/sniperkit/snk.fork.release-git-bot/gitwrapper"
+	"github.com/sniperkit/snk.fork.release-git-bot/notes"
+	"github.com/sniperkit/snk.fork.release-git-bot/policy"
+	"github.com/sniperkit/snk.fork.release-git-bot/redact"
+	"github.com/sniperkit/snk.fork.release-git-bot/seal"
+	"github.com/sniperkit/snk.fork.release-git-bot/state"
+	"github.com/sniperkit/snk.fork.release-git-bot/tracing"
+	"github.com/sniperkit/snk.fork.release-git-bot/version"
 	"github.com/olekukonko/tablewriter"
 	"golang.org/x/oauth2"
 	survey "gopkg.in/AlecAivazis/survey.v1"
@@ -26,11 +39,17 @@ func init() {
 }
 
 var (
-	token      = flag.String("token", "", "github token")
-	newVersion = flag.String("version", "", "the new version number, in the format of Major.Minor.Patch, e.g. 1.14.0")
+	token      = flag.String("token", "", "github token, default to $GITHUB_TOKEN")
+	newVersion = flag.String("version", "", "the new version number, in the format of Major.Minor.Patch (e.g. 1.14.0), or of the version_scheme in the config")
 	user       = flag.String("user", "", "the github user. Changes will be made to this user's fork. If not specified, will be github username for the given token")
 	repo       = flag.String("repo", "grpc-go", "the repo this release is for, e.g. grpc-go")
 
+	appID        = flag.Int64("appid", 0, "the id of a GitHub App to authenticate as one of its installations (-installation, with the private key -appkey) instead of with -token")
+	installation = flag.Int64("installation", 0, "the GitHub App installation id, see -appid")
+	appKey       = flag.String("appkey", "", "the PEM private key file of the GitHub App, see -appid")
+
+	fork = flag.String("fork", "", "the fork to push the version changes to and send the pull requests from, as owner/repo, e.g. an org-owned fork or a renamed one. Default to <user>/<repo>")
+
 	email = flag.String("email", "", "the email address for the commit author. If not specified, will be github primary email for the given token")
 
 	// For specials thanks note.
@@ -38,55 +57,282 @@ var (
 	urwelcome = flag.String("urwelcome", "", "list of users to exclude from thank you note, format: user1,user2")
 	verymuch  = flag.String("verymuch", "", "list of users to include in thank you note even if they are grpc org members, format: user1,user2")
 
+	milestoneFlag = flag.String("milestone", "", `alternative milestone titles, tried after "{line} Release", format: title1,title2. "{line}", "{major}" and "{minor}" are replaced by the version numbers, globs (e.g. "v{major}.{minor}*") and regexps in slashes are supported`)
+	prsFrom       = flag.String("prsfrom", "milestone", "where the merged PRs of the notes come from: milestone, the PRs of the release milestone, tags, the PRs merged between the previous release tag and the release branch, for projects that don't use milestones, or search, the PRs merged since the previous release tag found with the search API and filtered by the pr_search of the config, for projects releasing by time window")
+
 	nokidding = flag.Bool("nokidding", false, "if no kidding, do real release. Eitherwise, do test in menghanl's fork")
+	owner     = flag.String("owner", "", "the owner of the upstream repo, overrides -nokidding")
+
+	configFile = flag.String("config", "", "the bot config file, see package config for the format")
+
+	otlpEndpoint = flag.String("otlp", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), "the OTLP/HTTP endpoint to export traces of the steps and github API calls to, e.g. http://localhost:4318. Tracing is disabled if empty")
+
+	stateFile = flag.String("state", "", "the file to save the release progress in, so an interrupted release can be resumed. Default to <repo>_v<version>.state.json")
+
+	auditFile     = flag.String("audit", "release-git-bot_audit.jsonl", "the append-only log file of all the changes made by the bot (github API calls and git pushes). Disabled if empty")
+	trackingIssue = flag.Int("trackingissue", 0, "the upstream issue tracking the release. If set, a summary of the changes made by the bot and a diagram of the release progress are commented on it when the run finishes")
+
+	notesEdits = flag.String("notesedits", "", "a yaml file to edit the notes entries in before the draft release is created. Edits are kept across runs, keyed by PR number")
+	ignoreList = flag.String("ignorelist", "", "the file of the PRs removed from the notes (with ignore in -notesedits), so they are not added back when the notes are regenerated. Default to <repo>_ignore.yaml")
+
+	collapse   = flag.Bool("collapse", false, "collapse the documentation and test-only PRs (by label, or by changed files) into summary lines with expandable details in the notes")
+	topChanges = flag.Int("topchanges", 0, "the number of the most important changes (see the classification rules) listed first in the notes, 0 for none")
+
+	authors = flag.Bool("authors", true, "resolve the PR authors to their names and public emails for the notes templates and package changelogs. The results are cached")
+
+	deterministic = flag.Bool("deterministic", false, "if true, the same inputs generate byte-identical notes: the notes are dated by the release commit instead of now, so they can be committed and diffed in review")
+
+	mergeMethod = flag.String("merge", "", "if set, the version PR is merged with this method (merge, squash or rebase) once its checks are green and it has the approvals required by the branch protection, instead of waiting for a human to merge it")
+	autoMerge   = flag.Bool("automerge", false, "with -merge, also enable github's auto-merge on the version PR, so it's merged even if the bot stops (the repo must allow auto-merge)")
+
+	timeout = flag.Duration("timeout", 0, "if set, the github API calls are canceled after this duration, e.g. 2h. It includes the time waiting for confirmations")
+
+	etagCache = flag.Bool("etagcache", false, "if true, the github API responses are cached in the user cache dir, and revalidated with conditional requests. The unchanged ones don't count in the rate limit, which makes reruns (e.g. dry runs) cheap")
+
+	defaultBranchFlag = flag.String("defaultbranch", "", "if set, the default branch of -repo, instead of the one in its settings, e.g. when the token can't read them. It's the mainline unless the config sets one")
+
+	readOnly = flag.Bool("readonly", false, "if true, the bot can't change anything: all the github API requests but GET, HEAD and GraphQL queries are rejected by the http client, and git pushes fail. Implied by the read-only commands (e.g. status), so they are safe to run with production credentials")
+
+	waitChecks = flag.Duration("waitchecks", 0, "if set, the bot waits up to this duration (e.g. 1h) for the checks on the head of the release branch to pass before tagging it and creating the draft release, and the publish command for the checks on the target of the draft. A failed check stops the release")
+	checkGoMod = flag.Bool("checkgomod", true, "if true, the release stops before the release branch is tagged and drafted if its go.mod has replace directives to local paths, requires pseudo-versions of modules of the repo, or requires retracted versions (looked up on the go module proxy)")
+	tagKind    = flag.String("tagkind", "", "if set (lightweight or annotated), the release tag is created at the head of the release branch when the draft release is created, instead of by github when it's published, so the release is pinned to the commit reviewed in the draft")
+
+	crashDir = flag.String("crashdir", ".", "the directory the crash bundle (the recent logs and github API requests, and the release state, redacted) is written to when a release step fails or panics")
+
+	requireSigned = flag.Bool("requiresigned", false, "if true, all commits since the previous release must be signed and verified by github before the release is drafted")
 )
 
 var (
 	upstreamUser = "menghanl" // TODO: change this back to "grpc" by default.
+
+	// transportClient is the authenticated http client for github, nil if no
+	// token is specified.
+	transportClient *http.Client
+
+	// appTransport authenticates as the GitHub App installation, nil if
+	// -appid is not set.
+	appTransport *ghapp.Transport
+
+	// tracer is nil if tracing is disabled.
+	tracer *tracing.Tracer
+
+	// versionScheme is the version_scheme in the config, default to semver.
+	versionScheme version.Scheme
+
+	// classifier sorts the PRs into the sections of the notes, with the
+	// classification in the config.
+	classifier = notes.DefaultClassifier()
+
+	// redactor scrubs the token and the configured secrets from the outputs.
+	redactor *redact.Redactor
+
+	// auditLog is nil if -audit is empty.
+	auditLog *audit.Log
+
+	// policyEngine is nil if there's no policy in the config.
+	policyEngine *policy.Engine
+
+	// stateKey encrypts the state and cache files, nil if no key is set.
+	stateKey *seal.Key
+
+	// runCtx is the context of the github API calls, canceled after -timeout.
+	runCtx = context.Background()
+
+	// apiConfig is the api in the config, nil if it's not set.
+	apiConfig *config.API
+	// apiRetryPolicy is the retry of the api config, nil if it's disabled.
+	apiRetryPolicy *ghclient.Retry
+
+	// prSearch is the pr_search in the config, nil if it's not set.
+	prSearch *config.PRSearch
+	// mainlineConfig is the mainline in the config, nil if it's not set.
+	mainlineConfig *config.Mainline
+
+	// featureFlags are the experimental features on for the release.
+	featureFlags *features.Set
+
+	// botClock is the time of the waits, schedules and timestamps, replaced
+	// by a clock.Fake in simulations.
+	botClock = clock.Real
 )
 
 func main() {
 	flag.Parse()
+	// Not the flag default, which flag prints on -h and on errors.
+	if *token == "" {
+		*token = os.Getenv("GITHUB_TOKEN")
+	}
+
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(runCtx, *timeout)
+		defer cancel()
+	}
 
 	if *nokidding {
 		upstreamUser = "grpc"
 	}
+	if *owner != "" {
+		upstreamUser = *owner
+	}
 
-	ver, err := semver.Make(*newVersion)
+	cfg, err := config.Load(*configFile)
 	if err != nil {
-		log.Fatalf("invalid version string %q: %v", *newVersion, err)
+		log.Fatalf("failed to load config: %v", err)
 	}
-	log.Info("version is valid: ", ver.String())
+	versionScheme, err = version.New(cfg.VersionScheme)
+	if err != nil {
+		log.Fatalf("invalid version scheme: %v", err)
+	}
+	classifier, err = notes.NewClassifier(cfg.Classification)
+	if err != nil {
+		log.Fatalf("invalid classification: %v", err)
+	}
+	stateKey, err = seal.FromEnv()
+	if err != nil {
+		log.Fatalf("failed to load state key: %v", err)
+	}
+	if err := loadTimeConfig(cfg.Time); err != nil {
+		log.Fatal(err)
+	}
+	featureFlags, err = features.New(cfg.Features, upstreamUser+"/"+*repo, os.Getenv(features.Env))
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Fprint(os.Stderr, featureFlags.Banner())
+	redactor, err = redact.New([]string{*token, os.Getenv(passphraseEnv), os.Getenv(seal.KeyEnv)}, cfg.Redact)
+	if err != nil {
+		log.Fatalf("invalid redact config: %v", err)
+	}
+	log.SetOutput(redactor.Writer(io.MultiWriter(os.Stderr, recentLogs)))
 
-	var transportClient *http.Client
-	if *token != "" {
+	if *appID != 0 {
+		appTransport, err = ghapp.NewFromKeyFile(*appID, *installation, *appKey)
+		if err != nil {
+			log.Fatalf("failed to load GitHub App: %v", err)
+		}
+		appTransport.Clock = botClock
+		if cfg.API != nil {
+			appTransport.BaseURL = cfg.API.BaseURL
+		}
+		transportClient = appTransport.Client()
+	} else if *token != "" {
 		ctx := context.Background()
 		ts := oauth2.StaticTokenSource(
 			&oauth2.Token{AccessToken: *token},
 		)
 		transportClient = oauth2.NewClient(ctx, ts)
 	}
-	upstreamGithub := ghclient.New(transportClient, upstreamUser, *repo)
+	apiConfig = cfg.API
+	prSearch = cfg.PRSearch
+	mainlineConfig = cfg.Mainline
+	if *etagCache {
+		// Inside the headers, so the responses are keyed by the final media
+		// type.
+		transportClient = newETagCache().Client(transportClient)
+	}
+	transportClient = apiHeaders(cfg.API).Client(transportClient)
+	breaker, err := apiBreaker(cfg.API)
+	if err != nil {
+		log.Fatalf("invalid api config: %v", err)
+	}
+	transportClient = breaker.Client(transportClient)
+	// Inside the retries and the rate limiter, so each attempt is traced.
+	transportClient = requestTrace.Client(transportClient)
+	// Outside the breaker, so the retries go through it, and stop while it's
+	// open.
+	retry, err := apiRetry(cfg.API)
+	if err != nil {
+		log.Fatalf("invalid api config: %v", err)
+	}
+	transportClient = retry.Client(transportClient)
+	apiRetryPolicy = retry
+	limiter, err := apiRateLimiter(cfg.API)
+	if err != nil {
+		log.Fatalf("invalid api config: %v", err)
+	}
+	transportClient = limiter.Client(transportClient)
+
+	if *otlpEndpoint != "" {
+		service := os.Getenv("OTEL_SERVICE_NAME")
+		if service == "" {
+			service = "release-git-bot"
+		}
+		tracer = tracing.New(*otlpEndpoint, service)
+		transportClient = tracer.Client(transportClient)
+		// Fatal exits without running defers.
+		log.RegisterExitHandler(flushTraces)
+		defer flushTraces()
+	}
+
+	policyEngine, err = policy.New(cfg.Policy)
+	if err != nil {
+		log.Fatalf("invalid policy: %v", err)
+	}
+	if policyEngine != nil {
+		policyEngine.Approve = approveOperation
+		transportClient = policyEngine.Client(transportClient)
+	}
+
+	if *auditFile != "" {
+		auditLog, err = audit.Open(*auditFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		auditLog.Redact = redactor.Bytes
+		auditLog.Clock = botClock
+		defer auditLog.Close()
+		transportClient = auditLog.Client(transportClient)
+	}
+
+	// Redact the bodies before they are posted (and audited).
+	transportClient = redactor.Client(transportClient)
+
+	if flag.NArg() > 0 {
+		if cmd, ok := commands[flag.Arg(0)]; ok && cmd.readOnly {
+			*readOnly = true
+		}
+	}
+	if *readOnly {
+		// Outermost, so the rejected requests are not even audited or traced.
+		transportClient = ghclient.ReadOnly(transportClient)
+	}
+
+	if flag.NArg() > 0 {
+		runCommand(cfg, flag.Args())
+		return
+	}
+
+	ver, err := versionScheme.Parse(*newVersion)
+	if err != nil {
+		log.Fatalf("invalid version string %q: %v", *newVersion, err)
+	}
+	log.Info("version is valid: ", ver.String())
+
+	upstreamGithub := newClient(upstreamUser, *repo)
 	emailAddress := *email
 	if emailAddress == "" {
-		emailAddress, err = upstreamGithub.GetPrimaryEmail()
+		emailAddress, err = upstreamGithub.GetPrimaryEmailContext(runCtx)
 		if err != nil {
 			log.Fatalf("Email was not specified, and failed to get primary email address from github: %v. Does your token have permission to read email?", err)
 		}
 	}
 	userLogin := *user
 	if userLogin == "" {
-		userLogin, err = upstreamGithub.GetLogin()
+		userLogin, err = upstreamGithub.GetLoginContext(runCtx)
 		if err != nil {
 			log.Fatalf("User was not specified, and failed to get login from github: %v. Does your token have permission to read user?", err)
 		}
 	}
+	auditLog.SetActor(userLogin)
 
 	inputTable := tablewriter.NewWriter(os.Stdout)
 	inputTable.SetHeader([]string{"input"})
 	inputTable.Append([]string{"user", userLogin})
 	inputTable.Append([]string{"email", emailAddress})
 	inputTable.Append([]string{"repo", *repo})
+	forkOwner, forkRepo := forkOf(userLogin)
+	inputTable.Append([]string{"fork", forkOwner + "/" + forkRepo})
 	inputTable.Append([]string{"version", *newVersion})
 	inputTable.Append([]string{"upstreamRepo", upstreamUser + "/" + *repo})
 	inputTable.Render()
@@ -98,88 +344,295 @@ func main() {
 		return
 	}
 
-	fmt.Printf(" - Cloning %v/%v into memory\n\n", userLogin, *repo)
+	st, err := state.Load(stateFilePath(ver), upstreamUser+"/"+*repo, ver.String(), stateKey)
+	if err != nil {
+		log.Fatalf("failed to load state: %v", err)
+	}
+	st.Redact = redactor.Bytes
+	st.Clock = botClock
+	if *trackingIssue != 0 {
+		// Also comment if the run fails.
+		log.RegisterExitHandler(func() { commentAuditSummary(upstreamGithub, cfg, st) })
+		defer commentAuditSummary(upstreamGithub, cfg, st)
+	}
+	log.RegisterExitHandler(crashOnFatal)
+	if len(st.Done) > 0 {
+		fmt.Printf("Resuming from %v, %v steps already done\n\n", st.Path(), len(st.Done))
+	}
+	handleSignals()
+
+	releaseSpan := tracer.Start("release " + ver.String())
+	releaseSpan.SetAttribute("repo", upstreamUser+"/"+*repo)
+	defer releaseSpan.End()
+
+	mainline := mainlineBranch(cfg.Mainline, ver)
+	checkPlan(cfg.OPA, upstreamGithub, releasePlan(cfg, ver, mainline, userLogin))
+
+	fmt.Printf(" - Cloning %v/%v (%v) into memory\n\n", forkOwner, forkRepo, mainline)
 	forkLocalGit, err := gitwrapper.GithubClone(&gitwrapper.GithubCloneConfig{
-		Owner: userLogin,
-		Repo:  *repo,
+		Host:   githubHost(),
+		Owner:  forkOwner,
+		Repo:   forkRepo,
+		Branch: mainline,
 	})
 	if err != nil {
 		log.Fatalf("failed to github clone: %v", err)
 	}
 
-	fmt.Println()
 	/* Step 1: create an upstream release branch if it doesn't exist */
-	upstreamReleaseBranchName := fmt.Sprintf("v%v.%v.x", ver.Major, ver.Minor)
-	fmt.Printf(" - Step 1: create an upstream release branch %v/%v/%v\n\n", upstreamUser, *repo, upstreamReleaseBranchName)
-	upstreamGithub.NewBranchFromHead(upstreamReleaseBranchName)
+	upstreamReleaseBranchName := ver.Branch()
+	runStep(st, "step 1: create release branch", func() {
+		fmt.Println()
+		fmt.Printf(" - Step 1: create an upstream release branch %v/%v/%v from %v\n\n", upstreamUser, *repo, upstreamReleaseBranchName, mainline)
+		branches := []string{upstreamReleaseBranchName}
+		for _, m := range cfg.MirrorBranches {
+			branches = append(branches, versionReplacer(ver).Replace(m))
+		}
+		if err := upstreamGithub.NewBranchesFromContext(runCtx, branches, mainline); err != nil {
+			log.Fatalf("failed to create release branch: %v", err)
+		}
+	})
+
+	if cfg.BranchCut != nil && cfg.BranchCut.RetargetLabel != "" {
+		runStep(st, "retarget PRs to release branch", func() {
+			fmt.Println()
+			fmt.Printf(" - Retarget the open PRs labeled for the release to %v\n\n", upstreamReleaseBranchName)
+			if err := retargetPRs(cfg.BranchCut, st, upstreamGithub, ver, upstreamReleaseBranchName, mainline); err != nil {
+				log.Fatal(err)
+			}
+		})
+	}
+
+	if cfg.BranchCut != nil {
+		runStep(st, "announce branch cut", func() {
+			fmt.Println()
+			fmt.Printf(" - Announce the branch cut on the open PRs of the milestone\n\n")
+			if err := announceBranchCut(cfg.BranchCut, st, upstreamGithub, ver, upstreamReleaseBranchName, mainline); err != nil {
+				log.Fatal(err)
+			}
+		})
+	}
+
+	if cfg.Milestones != nil && cfg.Milestones.OpenNext {
+		runStep(st, "open next milestone", func() {
+			title := ver.NextLine().Milestone()
+			fmt.Println()
+			fmt.Printf(" - Open milestone %q\n\n", title)
+			m, err := upstreamGithub.EnsureMilestoneContext(runCtx, title)
+			if err != nil {
+				log.Fatalf("failed to open milestone %q: %v", title, err)
+			}
+			fmt.Println("Milestone: ", m.GetHTMLURL())
+		})
+	}
 
-	fmt.Println()
 	/* Step 2: on release branch, change version file to 1.release.0 */
-	fmt.Printf(" - Step 2: on release branch, change version to %v\n\n", *newVersion)
-	prURL1 := makePR(upstreamGithub, forkLocalGit, *newVersion, upstreamReleaseBranchName, userLogin, userLogin, emailAddress)
-	// prURL1 := "https://github.com/menghanl/grpc-go/pull/17"
-	fmt.Printf("PR %v created, merge before continuing...\n", prURL1)
+	runStep(st, "step 2: change version on release branch", func() {
+		fmt.Println()
+		fmt.Printf(" - Step 2: on release branch, change version to %v\n\n", *newVersion)
+		prURL1 := makePR(upstreamGithub, forkLocalGit, *newVersion, upstreamReleaseBranchName, true, prOptions(cfg, "version", ver), cfg.BumpChecks, userLogin, userLogin, emailAddress)
+		// prURL1 := "https://github.com/menghanl/grpc-go/pull/17"
+		st.Set("version_pr", prURL1)
+	})
 
 	/* Wait for the PR to be merged */
-	prMergeConfirmed := false
-	for !prMergeConfirmed {
-		prompt := &survey.Confirm{
-			Message: "Merged?",
+	runStep(st, "wait for version PR merged", func() {
+		if st.Get("version_pr") == "" {
+			fmt.Println("No version PR to merge")
+			return
 		}
-		survey.AskOne(prompt, &prMergeConfirmed, nil)
-	}
+		if draftPR(cfg, "version") {
+			fmt.Printf("Draft PR %v created, finish it before continuing...\n", st.Get("version_pr"))
+			confirm(st, "wait for version PR merged", "Ready for review?")
+			if err := markReady(upstreamGithub, st.Get("version_pr")); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if err := updatePR(upstreamGithub, st.Get("version_pr")); err != nil {
+			log.Warningf("failed to update the version PR with %v: %v", upstreamReleaseBranchName, err)
+		}
+		if method := versionPRMergeMethod(); method != "" {
+			mergeWhenReady(upstreamGithub, st, "wait for version PR merged", st.Get("version_pr"), method)
+			return
+		}
+		fmt.Printf("PR %v created, merge before continuing...\n", st.Get("version_pr"))
+		confirm(st, "wait for version PR merged", "Merged?")
+	})
 
-	fmt.Println()
 	/* Step 3: generate release note and create draft release */
-	fmt.Printf(" - Step 3: generate release note and create draft release\n\n")
-	// Get and print the markdown release notes.
-	markdownNote := releaseNote(upstreamGithub, ver)
-	// fmt.Println(markdownNote)
+	runStep(st, "step 3: create draft release", func() {
+		fmt.Println()
+		fmt.Printf(" - Step 3: generate release note and create draft release\n\n")
+		if *requireSigned {
+			checkSignedCommits(upstreamGithub, ver, upstreamReleaseBranchName)
+		}
+		// Get and print the markdown release notes.
+		releaseNotes, prs := releaseNote(upstreamGithub, ver)
+		addNotesRepos(cfg, releaseNotes, ver)
+		if *notesEdits != "" {
+			editNotes(st, "step 3: create draft release", releaseNotes, *notesEdits)
+		}
+		markdownNote, err := renderNotes(cfg, releaseNotes)
+		if err != nil {
+			log.Fatalf("failed to render release notes: %v", err)
+		}
+		if cfg.NotesReview != nil {
+			markdownNote = reviewNotes(cfg.NotesReview, st, "step 3: create draft release", upstreamGithub, ver, markdownNote)
+		}
+		// fmt.Println(markdownNote)
+		if err := notes.CheckCompleteness(prs, releaseNotes, markdownNote); err != nil {
+			log.Fatal(err)
+		}
+		if t, ok := embargoTime(); ok {
+			markdownNote = embargoNotes(markdownNote, t)
+			st.Set("embargo", t.Format(time.RFC3339))
+		}
 
-	releaseTitle := fmt.Sprintf("Release %v", *newVersion)
-	releaseURL, err := upstreamGithub.NewDraftRelease("v"+*newVersion, upstreamReleaseBranchName, releaseTitle, markdownNote)
-	if err != nil {
-		log.Fatal("failed to create release: ", err)
-	}
-	// releaseURL := "https://github.com/menghanl/grpc-go/release/untaged-blahblahblah"
-	fmt.Printf("Draft release %v created, publish before continuing\n", releaseURL)
+		if *waitChecks != 0 {
+			waitForChecks(upstreamGithub, upstreamReleaseBranchName)
+		}
+		if *checkGoMod {
+			checkReleaseGoMod(upstreamGithub, upstreamReleaseBranchName)
+		}
+		releaseTitle := fmt.Sprintf("Release %v", *newVersion)
+		if *tagKind != "" {
+			tagReleaseBranch(upstreamGithub, ver, upstreamReleaseBranchName, releaseTitle)
+		}
+		release, err := createOrUpdateDraft(upstreamGithub, "v"+*newVersion, upstreamReleaseBranchName, releaseTitle, markdownNote)
+		if err != nil {
+			log.Fatal("failed to create release: ", err)
+		}
+		// releaseURL := "https://github.com/menghanl/grpc-go/release/untaged-blahblahblah"
+		st.Set("draft_release", release.GetHTMLURL())
+		st.Set("draft_release_id", fmt.Sprint(release.GetID()))
+
+		if cfg.DeveloperNotes != nil {
+			attachDeveloperNotes(cfg, upstreamGithub, release.GetID(), releaseNotes)
+		}
+
+		if len(cfg.Packages) > 0 {
+			fmt.Printf(" - Build and attach linux packages\n\n")
+			attachPackages(cfg.Packages, cfg.Checksums, upstreamGithub, release.GetID(), ver, releaseNotes)
+		}
+	})
 
 	/* Wait for the release to be published */
-	releasePublishConfirmed := false
-	for !releasePublishConfirmed {
-		prompt := &survey.Confirm{
-			Message: "Published?",
+	runStep(st, "wait for release published", func() {
+		if st.Get("embargo") != "" {
+			disclose(upstreamGithub, st, "wait for release published")
+			return
+		}
+		if featureFlags.Enabled(features.AutoPublish) {
+			release, err := publishDraft(upstreamGithub, ver, "")
+			if err != nil {
+				log.Fatal(err)
+			}
+			fmt.Printf("Release %v published\n", release.GetHTMLURL())
+			return
 		}
-		survey.AskOne(prompt, &releasePublishConfirmed, nil)
+		fmt.Printf("Draft release %v created, publish before continuing\n", st.Get("draft_release"))
+		confirm(st, "wait for release published", "Published?")
+	})
+
+	if len(cfg.Images) > 0 {
+		runStep(st, "push release images", func() {
+			fmt.Println()
+			fmt.Printf(" - Push release images\n\n")
+			pushImages(cfg.Images, upstreamGithub, ver)
+		})
+	}
+
+	if len(cfg.Publishers) > 0 {
+		runStep(st, "update package manager manifests", func() {
+			fmt.Println()
+			fmt.Printf(" - Update package manager manifests\n\n")
+			publishManifests(cfg.Publishers, upstreamGithub, ver, userLogin, emailAddress, draftPR(cfg, "manifest"))
+		})
+	}
+
+	if cfg.RepoMetadata != nil {
+		runStep(st, "update repo metadata", func() {
+			fmt.Println()
+			fmt.Printf(" - Update repo metadata\n\n")
+			updateRepoMetadata(cfg.RepoMetadata, upstreamGithub, ver)
+		})
+	}
+
+	if cfg.Milestones != nil && cfg.Milestones.Close {
+		runStep(st, "close milestone", func() {
+			if err := closeMilestone(upstreamGithub, ver); err != nil {
+				log.Fatal(err)
+			}
+		})
+	}
+
+	if len(cfg.Webhooks) > 0 {
+		runStep(st, "notify webhooks", func() {
+			fmt.Println()
+			fmt.Printf(" - Notify webhooks\n\n")
+			if err := notifyWebhooks(cfg.Webhooks, upstreamGithub, ver); err != nil {
+				log.Fatal(err)
+			}
+		})
+	}
+
+	if cfg.Pages != nil {
+		runStep(st, "update release archive", func() {
+			fmt.Println()
+			fmt.Printf(" - Update release notes archive\n\n")
+			if err := updateArchive(cfg.Pages, upstreamGithub, ver.Tag()); err != nil {
+				log.Fatal(err)
+			}
+		})
+	}
+
+	if cfg.ReleasedComment != nil {
+		runStep(st, "comment released PRs", func() {
+			fmt.Println()
+			fmt.Printf(" - Comment on the PRs of %v\n\n", ver.Tag())
+			if err := commentReleasedPRs(cfg.ReleasedComment, st, upstreamGithub, ver); err != nil {
+				log.Fatal(err)
+			}
+		})
 	}
 
-	fmt.Println()
 	/* Step 4: on release branch, change version file to 1.release.1-dev */
-	nextMinorRelease := ver
-	nextMinorRelease.Patch++ // Increment the pateh version, not the minor version.
-	nextMinorReleaseStr := fmt.Sprintf("%v-dev", nextMinorRelease.String())
-	fmt.Printf(" - Step 4: on release branch, change version to %v\n\n", nextMinorReleaseStr)
-	// prURL2 := "https://github.com/menghanl/grpc-go/pull/18"
-	prURL2 := makePR(upstreamGithub, forkLocalGit, nextMinorReleaseStr, upstreamReleaseBranchName, userLogin, userLogin, emailAddress)
-	fmt.Println("PR to merge: ", prURL2)
+	runStep(st, "step 4: change version to patch dev on release branch", func() {
+		nextMinorRelease := ver.NextPatch() // Increment the pateh version, not the minor version.
+		nextMinorReleaseStr := fmt.Sprintf("%v-dev", nextMinorRelease.String())
+		fmt.Println()
+		fmt.Printf(" - Step 4: on release branch, change version to %v\n\n", nextMinorReleaseStr)
+		// prURL2 := "https://github.com/menghanl/grpc-go/pull/18"
+		prURL2 := makePR(upstreamGithub, forkLocalGit, nextMinorReleaseStr, upstreamReleaseBranchName, true, prOptions(cfg, "patch_dev", nextMinorRelease), cfg.BumpChecks, userLogin, userLogin, emailAddress)
+		st.Set("patch_dev_pr", prURL2)
+		if prURL2 != "" {
+			fmt.Println("PR to merge: ", prURL2)
+		}
+	})
 
-	fmt.Println()
-	/* Step 5: on master branch, change version file to 1.release+1.0-dev */
-	nextMajorRelease := ver
-	nextMajorRelease.Minor++ // Increment the minor version, not the major version.
-	nextMajorReleaseStr := fmt.Sprintf("%v-dev", nextMajorRelease.String())
-	fmt.Printf(" - Step 5: on master branch, change version to %v\n\n", nextMajorReleaseStr)
-	// prURL3 := "https://github.com/menghanl/grpc-go/pull/19"
-	prURL3 := makePR(upstreamGithub, forkLocalGit, nextMajorReleaseStr, "master", userLogin, userLogin, emailAddress)
-	fmt.Println("PR to merge: ", prURL3)
+	/* Step 5: on mainline branch, change version file to 1.release+1.0-dev */
+	runStep(st, "step 5: change version to minor dev on master", func() {
+		nextMajorRelease := ver.NextLine() // Increment the minor version, not the major version.
+		nextMajorReleaseStr := fmt.Sprintf("%v-dev", nextMajorRelease.String())
+		fmt.Println()
+		fmt.Printf(" - Step 5: on %v branch, change version to %v\n\n", mainline, nextMajorReleaseStr)
+		// prURL3 := "https://github.com/menghanl/grpc-go/pull/19"
+		prURL3 := makePR(upstreamGithub, forkLocalGit, nextMajorReleaseStr, mainline, false, prOptions(cfg, "minor_dev", nextMajorRelease), cfg.BumpChecks, userLogin, userLogin, emailAddress)
+		st.Set("minor_dev_pr", prURL3)
+		if prURL3 != "" {
+			fmt.Println("PR to merge: ", prURL3)
+		}
+	})
 
 	/* Step 6: finish steps as in g3doc */
 	fmt.Println()
 	fmt.Println("Not done yet. Send the emails and add compatibility test.")
 }
 
-// return value is pr URL.
-func makePR(upstream *ghclient.Client, local *gitwrapper.Repo, newVersionStr, upstreamBranchName string, login, name, email string) string {
+// return value is pr URL, empty if the version is already newVersionStr and
+// no pr is needed. The pr is opened and triaged with opt. CI is skipped for release branches. checks are run
+// on the change before it's pushed.
+func makePR(upstream *ghclient.Client, local *gitwrapper.Repo, newVersionStr, upstreamBranchName string, skipCI bool, opt *ghclient.PullRequestOptions, checks []string, login, name, email string) string {
 	/* Step 1: make version change locally and push to fork */
 	branchName := fmt.Sprintf("release_version_%v", newVersionStr)
 	if err := local.MakeVersionChange(&gitwrapper.VersionChangeConfig{
@@ -188,28 +641,73 @@ func makePR(upstream *ghclient.Client, local *gitwrapper.Repo, newVersionStr, up
 		BranchName:  branchName,
 		UserName:    name,
 		UserEmail:   email,
-		SkipCI:      upstreamBranchName != "master", // Not skip if upstreamBranchName is "master"
+		SkipCI:      skipCI,
 	}); err != nil {
 		log.Fatalf("failed to make change: %v", err)
 	}
 
-	if err := local.Publish(&gitwrapper.PublicConfig{
-		// This could push to upstream directly, but to be safe, we send pull
-		// request instead.
-		RemoteName: "",
-		Auth: &gitwrapper.AuthConfig{
-			Username: login,
-			Password: *token,
-		},
-	}); err != nil {
+	var prBody string
+	if len(checks) > 0 {
+		fmt.Printf(" - Checking the change to %v\n\n", newVersionStr)
+		out, err := runBumpChecks(local, checks)
+		if err != nil {
+			fmt.Println(redactor.String(out))
+			log.Fatalf("version change to %v failed the checks, pull request is not created: %v", newVersionStr, err)
+		}
+		prBody = bumpChecksBody(out)
+	}
+
+	// This could push to upstream directly, but to be safe, we send pull
+	// request instead.
+	forkOwner, forkRepo := forkOf(login)
+	if err := pushToFork(local, forkOwner, forkRepo, branchName); err != nil {
 		log.Fatalf("failed to public change: %v", err)
 	}
 
 	/* Step 2: send pull request to upstream/release_branch with the change */
 	prTitle := fmt.Sprintf("Change version to %v", newVersionStr)
-	prURL, err := upstream.NewPullRequest(login, branchName, upstreamBranchName, prTitle, "")
+	pr, err := upstream.CreatePullRequestWithOptionsContext(runCtx, &ghclient.Head{Owner: forkOwner, Repo: forkRepo, Branch: branchName}, upstreamBranchName, prTitle, prBody, opt)
 	if err != nil {
-		log.Fatalf("failed to create pull request: ", err)
+		if pr == nil {
+			log.Fatalf("failed to create pull request: %v", err)
+		}
+		// The pull request is created, a human can finish the triage.
+		log.Warning(err)
+	}
+	if pr.NoChanges {
+		fmt.Printf("Version is already %v on %v, no pull request is needed\n", newVersionStr, upstreamBranchName)
+		return ""
+	}
+	if pr.Conflicts() {
+		log.Warningf("pull request %v has conflicts with %v, resolve them before merging", pr.URL, upstreamBranchName)
+	}
+	return pr.URL
+}
+
+// mainlineBranch returns the mainline branch for the release line of ver, the
+// default branch of the repo if it's not configured.
+func mainlineBranch(m *config.Mainline, ver *version.Version) string {
+	if m == nil {
+		return defaultBranch(upstreamUser, *repo)
+	}
+	if b, ok := m.Lines[ver.Line()]; ok {
+		return b
+	}
+	if m.Branch != "" {
+		return m.Branch
+	}
+	return defaultBranch(upstreamUser, *repo)
+}
+
+func stateFilePath(ver *version.Version) string {
+	if *stateFile != "" {
+		return *stateFile
+	}
+	return fmt.Sprintf("%v_v%v.state.json", *repo, ver.String())
+}
+
+func flushTraces() {
+	if err := tracer.Flush(); err != nil {
+		log.Warning(err)
 	}
-	return prURL
 }
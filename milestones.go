@@ -0,0 +1,54 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/sniperkit/snk.fork.release-git-bot/ghclient"
+	"github.com/sniperkit/snk.fork.release-git-bot/version"
+)
+
+// closeMilestone closes the milestone of the published release of ver. Its
+// open issues and PRs are first moved to the milestone of the next release
+// line (e.g. "1.15 Release" for 1.14.0), opened if needed, with a comment
+// explaining why, so the milestone is closed with nothing left open.
+func closeMilestone(upstream *ghclient.Client, ver *version.Version) error {
+	m, err := upstream.FindMilestoneContext(runCtx, append([]string{ver.Milestone()}, milestoneAliases(ver)...)...)
+	if err != nil {
+		return fmt.Errorf("failed to find the milestone of %v: %v", ver.Tag(), err)
+	}
+	fmt.Println()
+	fmt.Printf(" - Close milestone %q\n\n", m.GetTitle())
+	stragglers, err := upstream.GetOpenIssuesForMilestoneContext(runCtx, m.GetNumber())
+	if err != nil {
+		return fmt.Errorf("failed to get the open issues of milestone %q: %v", m.GetTitle(), err)
+	}
+	if len(stragglers) > 0 {
+		title := ver.NextLine().Milestone()
+		next, err := upstream.EnsureMilestoneContext(runCtx, title)
+		if err != nil {
+			return fmt.Errorf("failed to open milestone %q: %v", title, err)
+		}
+		for _, i := range stragglers {
+			if err := upstream.MoveToMilestoneContext(runCtx, i.GetNumber(), next.GetNumber()); err != nil {
+				return fmt.Errorf("failed to move #%v to milestone %q: %v", i.GetNumber(), title, err)
+			}
+			kind := "issue"
+			if i.PullRequestLinks != nil {
+				kind = "PR"
+			}
+			body := fmt.Sprintf("%v is released, so its milestone %q is closed. This %v was still open, it's moved to %q.", ver.Tag(), m.GetTitle(), kind, title)
+			if _, err := upstream.CreateIssueCommentContext(runCtx, i.GetNumber(), body); err != nil {
+				return fmt.Errorf("failed to comment on #%v: %v", i.GetNumber(), err)
+			}
+			fmt.Printf("Moved #%v to %q\n", i.GetNumber(), title)
+		}
+	}
+	if err := upstream.CloseMilestoneContext(runCtx, m.GetNumber()); err != nil {
+		return fmt.Errorf("failed to close milestone %q: %v", m.GetTitle(), err)
+	}
+	fmt.Printf("Milestone %q closed, %v open issues and PRs moved\n", m.GetTitle(), len(stragglers))
+	return nil
+}
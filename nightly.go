@@ -0,0 +1,178 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/sniperkit/snk.fork.release-git-bot/cache"
+	"github.com/sniperkit/snk.fork.release-git-bot/config"
+	"github.com/sniperkit/snk.fork.release-git-bot/ghclient"
+	"github.com/sniperkit/snk.fork.release-git-bot/notes"
+	"github.com/sniperkit/snk.fork.release-git-bot/version"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// runNightly publishes a snapshot of the mainline as a pre-release: tagged
+// vX.Y.Z-dev.YYYYMMDD (the next line after the last stable release), or a
+// moving tag, with the notes of the PRs merged since the last stable release
+// and the given assets. Rerunning it replaces the notes and assets of the
+// snapshot, so it can run from a service schedule.
+func runNightly(cfg *config.Config, args []string) error {
+	fs := newFlagSet("nightly")
+	moving := fs.String("moving", "", `a tag to move to the snapshot (e.g. "nightly"), with a single release, instead of a dated tag per snapshot`)
+	branch := fs.String("branch", "", "the branch to snapshot, default to the mainline of the next release")
+	assets := fs.String("assets", "", "the files to attach to the snapshot, as globs, format: glob1,glob2")
+	checksums := fs.Bool("checksums", false, "attach a "+ghclient.ChecksumsAsset+" of the assets")
+	fs.Parse(args)
+
+	upstream := newClient(upstreamUser, *repo)
+	tags, err := upstream.ListTagsContext(runCtx)
+	if err != nil {
+		return fmt.Errorf("failed to list tags: %v", err)
+	}
+	stable := version.Latest(version.ParseTags(versionScheme, tags), func(v *version.Version) bool { return !v.IsPrerelease() })
+	if stable == nil {
+		return fmt.Errorf("no stable release tag to snapshot from")
+	}
+	snapshot := *stable.NextLine()
+	// The snapshot of the day in the release timezone.
+	snapshot.Pre = "dev." + botClock.Now().In(releaseZone).Format("20060102")
+	if *branch == "" {
+		*branch = mainlineBranch(cfg.Mainline, &snapshot)
+	}
+	tag := snapshot.Tag()
+	if *moving != "" {
+		tag = *moving
+	}
+
+	files, err := globAssets(*assets)
+	if err != nil {
+		return err
+	}
+	sha, err := upstream.GetCommitSHAContext(runCtx, *branch)
+	if err != nil {
+		return fmt.Errorf("failed to get the head of %v: %v", *branch, err)
+	}
+	fmt.Printf("Snapshot %v of %v at %v, since %v\n\n", tag, *branch, sha, stable.Tag())
+
+	body, err := nightlyNotes(cfg, upstream, stable, tag, sha)
+	if err != nil {
+		return err
+	}
+	title := fmt.Sprintf("Nightly %v", snapshot.String())
+	if err := upstream.SetTagContext(runCtx, tag, sha); err != nil {
+		return fmt.Errorf("failed to tag %v: %v", tag, err)
+	}
+	release, err := nightlyRelease(upstream, tag, sha, title, body)
+	if err != nil {
+		return err
+	}
+
+	uploaded, err := upstream.UploadReleaseAssetsContext(runCtx, release.GetID(), files...)
+	for _, a := range uploaded {
+		fmt.Println("Asset attached: ", a.URL)
+	}
+	if err != nil {
+		return err
+	}
+	if *checksums && len(uploaded) > 0 {
+		url, err := upstream.UploadChecksumsContext(runCtx, release.GetID(), uploaded)
+		if err != nil {
+			return fmt.Errorf("failed to upload %v: %v", ghclient.ChecksumsAsset, err)
+		}
+		fmt.Println("Checksums attached: ", url)
+	}
+	fmt.Printf("Nightly release %v published\n", release.GetHTMLURL())
+	return nil
+}
+
+// globAssets returns the files matching the comma separated globs.
+func globAssets(globs string) ([]string, error) {
+	if globs == "" {
+		return nil, nil
+	}
+	var files []string
+	for _, g := range strings.Split(globs, ",") {
+		matches, err := filepath.Glob(strings.TrimSpace(g))
+		if err != nil {
+			return nil, fmt.Errorf("invalid assets glob %q: %v", g, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no assets match %q", g)
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// nightlyNotes renders the notes of the PRs merged between the stable release
+// and sha.
+func nightlyNotes(cfg *config.Config, c *ghclient.Client, stable *version.Version, tag, sha string) (string, error) {
+	prs, err := c.GetMergedPRsBetweenTagsContext(runCtx, stable.Tag(), sha)
+	if err != nil {
+		return "", fmt.Errorf("failed to get merged PRs since %v: %v", stable.Tag(), err)
+	}
+	ns := notes.GenerateNotes(c.Owner(), c.Repo(), tag, prs, notes.Filters{
+		Ignored:    loadIgnoreList().Reasons(),
+		Embargoed:  embargoFilter(),
+		Collapse:   *collapse,
+		Paths:      prPaths(c),
+		Classifier: classifier,
+		Top:        *topChanges,
+	})
+	ns.Date = botClock.Now().In(releaseZone)
+	ns.CompareURL = fmt.Sprintf("https://%v/%v/%v/compare/%v...%v", githubHost(), c.Owner(), c.Repo(), stable.Tag(), sha)
+	if *authors {
+		userCache, err := cache.New("", stateKey)
+		if err != nil {
+			log.Warningf("failed to create cache, users won't be cached: %v", err)
+		}
+		resolveAuthors(c, userCache, ns)
+	}
+	body, err := renderNotes(cfg, ns)
+	if err != nil {
+		return "", fmt.Errorf("failed to render notes: %v", err)
+	}
+	header := fmt.Sprintf("Snapshot of %v at %v, for testing only. The changes since %v are not released yet.\n\n", tag, sha, stable.Tag())
+	return header + body, nil
+}
+
+// nightlyRelease creates the pre-release of the snapshot tag, or replaces the
+// notes and deletes the assets of the existing one.
+func nightlyRelease(c *ghclient.Client, tag, sha, title, body string) (*github.RepositoryRelease, error) {
+	releases, err := c.ListReleasesContext(runCtx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list releases: %v", err)
+	}
+	for _, r := range releases {
+		if r.GetTagName() != tag {
+			continue
+		}
+		for _, a := range r.Assets {
+			if err := c.DeleteReleaseAssetContext(runCtx, a.GetID()); err != nil {
+				return nil, fmt.Errorf("failed to delete asset %v: %v", a.GetName(), err)
+			}
+		}
+		release, err := c.EditReleaseContext(runCtx, r.GetID(), &github.RepositoryRelease{
+			Name:       github.String(title),
+			Body:       github.String(body),
+			Draft:      github.Bool(false),
+			Prerelease: github.Bool(true),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to update release %v: %v", tag, err)
+		}
+		return release, nil
+	}
+	release, err := c.CreatePrereleaseContext(runCtx, tag, sha, title, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create release %v: %v", tag, err)
+	}
+	return release, nil
+}
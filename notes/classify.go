@@ -0,0 +1,293 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package notes
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/sniperkit/snk.fork.release-git-bot/config"
+)
+
+// Classification is what a Classifier assigns to a PR.
+type Classification struct {
+	// Category is the label the PR is sorted by, e.g. "Feature". Its section
+	// is the section of the PR in the notes.
+	Category string
+	// Audience is who the change is for, e.g. "user" or "developer", empty if
+	// no rule says.
+	Audience string
+	// Importance scores the PR, higher is more important. It's the weight of
+	// the category if no rule says.
+	Importance int
+}
+
+// Category is a category of PRs.
+type Category struct {
+	Name string
+	// Section is the name of the section of the category in the notes. The
+	// PRs of a category without section are left out of the notes.
+	Section string
+	// Weight orders the sections, higher first.
+	Weight int
+}
+
+// Rule assigns a classification to the PRs it matches. All the conditions
+// set must match, a rule without condition matches all the PRs.
+type Rule struct {
+	// Labels are globs of label names, one of which must match, e.g.
+	// "Type: *".
+	Labels []string
+	// Title must match the PR title.
+	Title *regexp.Regexp
+	// Paths are globs of changed files, one of which must match, e.g.
+	// "docs/**" or "*.proto". "**" matches any number of directories. Rules
+	// with paths need the Paths filter.
+	Paths []string
+	// Authors are the logins of the authors, one of which must match.
+	Authors []string
+
+	Category   string
+	Audience   string
+	Importance int
+}
+
+// Classifier classifies the PRs with rules, tried in order: the first rule
+// matching a PR classifies it. The default rules sort the PRs by their most
+// weighted "Type: " label. With conventional commits, the PRs matched by no
+// rule are sorted by the type of their titles. The others are bug fixes.
+type Classifier struct {
+	rules      []*Rule
+	categories map[string]*Category
+	// conventional maps the conventional commit types to categories, nil if
+	// the titles aren't used, and breaking is the category of the breaking
+	// changes.
+	conventional map[string]string
+	breaking     string
+}
+
+// defaultCategories are the categories of the "Type: " labels.
+func defaultCategories() map[string]*Category {
+	ret := make(map[string]*Category)
+	for label, weight := range sortWeight {
+		ret[label] = &Category{Name: label, Section: labelToSectionName[label], Weight: weight}
+	}
+	return ret
+}
+
+// defaultRules are the rules of the "Type: " labels, the most weighted first.
+func defaultRules() []*Rule {
+	var labels []string
+	for label := range sortWeight {
+		labels = append(labels, label)
+	}
+	var ret []*Rule
+	for _, label := range sortLabelName(labels) {
+		ret = append(ret, &Rule{Labels: []string{labelPrefix + label, label}, Category: label})
+	}
+	return ret
+}
+
+// DefaultClassifier returns the Classifier of the "Type: " labels.
+func DefaultClassifier() *Classifier {
+	return &Classifier{rules: defaultRules(), categories: defaultCategories()}
+}
+
+// NewClassifier creates the Classifier of the config: its rules are tried
+// before the default ones, and its categories are added to (or replace) the
+// default ones. If c is nil, it's the DefaultClassifier.
+func NewClassifier(c *config.Classification) (*Classifier, error) {
+	cl := DefaultClassifier()
+	if c == nil {
+		return cl, nil
+	}
+	for _, cc := range c.Categories {
+		if cc.Name == "" {
+			return nil, fmt.Errorf("category without name")
+		}
+		cl.categories[cc.Name] = &Category{Name: cc.Name, Section: cc.Section, Weight: cc.Weight}
+	}
+	var rules []*Rule
+	for i, rc := range c.Rules {
+		if _, ok := cl.categories[rc.Category]; !ok {
+			return nil, fmt.Errorf("rule %v: unknown category %q", i+1, rc.Category)
+		}
+		r := &Rule{
+			Labels:     rc.Labels,
+			Paths:      rc.Paths,
+			Authors:    rc.Authors,
+			Category:   rc.Category,
+			Audience:   rc.Audience,
+			Importance: rc.Importance,
+		}
+		for _, g := range append(append([]string(nil), rc.Labels...), rc.Paths...) {
+			if _, err := path.Match(g, ""); err != nil {
+				return nil, fmt.Errorf("rule %v: invalid glob %q: %v", i+1, g, err)
+			}
+		}
+		if rc.Title != "" {
+			re, err := regexp.Compile(rc.Title)
+			if err != nil {
+				return nil, fmt.Errorf("rule %v: invalid title regexp: %v", i+1, err)
+			}
+			r.Title = re
+		}
+		rules = append(rules, r)
+	}
+	cl.rules = append(rules, cl.rules...)
+
+	if cc := c.ConventionalCommits; cc != nil {
+		cl.conventional = defaultConventionalTypes()
+		for t, category := range cc.Types {
+			cl.conventional[strings.ToLower(t)] = category
+		}
+		cl.breaking = "Behavior Change"
+		if cc.Breaking != "" {
+			cl.breaking = cc.Breaking
+		}
+		for t, category := range cl.conventional {
+			if _, ok := cl.categories[category]; !ok {
+				return nil, fmt.Errorf("conventional commits: type %q: unknown category %q", t, category)
+			}
+		}
+		if _, ok := cl.categories[cl.breaking]; !ok {
+			return nil, fmt.Errorf("conventional commits: unknown breaking category %q", cl.breaking)
+		}
+	}
+	return cl, nil
+}
+
+// NeedsPaths returns whether a rule matches the changed files, so the
+// classification needs the Paths filter.
+func (cl *Classifier) NeedsPaths() bool {
+	for _, r := range cl.rules {
+		if len(r.Paths) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Classify returns the classification of the PR, with paths its changed
+// files.
+func (cl *Classifier) Classify(pr *github.Issue, paths []string) *Classification {
+	var ret *Classification
+	for _, r := range cl.rules {
+		if r.matches(pr, paths) {
+			ret = &Classification{Category: r.Category, Audience: r.Audience, Importance: r.Importance}
+			break
+		}
+	}
+	if ret == nil {
+		ret = &Classification{Category: defaultLabel}
+		if category, ok := cl.conventionalCategory(pr.GetTitle(), pr.GetBody()); ok {
+			ret.Category = category
+		}
+	}
+	if ret.Importance == 0 {
+		ret.Importance = cl.weight(ret.Category)
+	}
+	return ret
+}
+
+// weight returns the weight of the category, 0 if it's unknown.
+func (cl *Classifier) weight(category string) int {
+	if c, ok := cl.categories[category]; ok {
+		return c.Weight
+	}
+	return 0
+}
+
+// sectionName returns the name of the section of the category, and whether
+// it has a section. Test-only changes have a section only if they are
+// collapsed.
+func (cl *Classifier) sectionName(category string, collapse bool) (string, bool) {
+	if c, ok := cl.categories[category]; ok && c.Section != "" {
+		return c.Section, true
+	}
+	if collapse && category == "Testing" {
+		return "Testing", true
+	}
+	return "", false
+}
+
+func (r *Rule) matches(pr *github.Issue, paths []string) bool {
+	if len(r.Labels) > 0 && !anyLabelMatches(r.Labels, pr.Labels) {
+		return false
+	}
+	if r.Title != nil && !r.Title.MatchString(pr.GetTitle()) {
+		return false
+	}
+	if len(r.Paths) > 0 {
+		found := false
+		for _, p := range paths {
+			for _, g := range r.Paths {
+				if matchPath(g, p) {
+					found = true
+				}
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(r.Authors) > 0 {
+		found := false
+		for _, a := range r.Authors {
+			if strings.EqualFold(a, pr.GetUser().GetLogin()) {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// anyLabelMatches returns whether any of the labels matches any of the globs.
+func anyLabelMatches(globs []string, labels []github.Label) bool {
+	for _, l := range labels {
+		for _, g := range globs {
+			if ok, _ := path.Match(g, l.GetName()); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchPath returns whether the slash separated path p matches the glob g, in
+// which "**" matches any number of directories.
+func matchPath(g, p string) bool {
+	if !strings.Contains(g, "**") {
+		if !strings.Contains(g, "/") {
+			// A glob without dir matches the base name in any dir.
+			ok, _ := path.Match(g, path.Base(p))
+			return ok
+		}
+		ok, _ := path.Match(g, p)
+		return ok
+	}
+	i := strings.Index(g, "**")
+	prefix, rest := g[:i], strings.TrimPrefix(g[i+2:], "/")
+	if !strings.HasPrefix(p, prefix) {
+		return false
+	}
+	p = p[len(prefix):]
+	if rest == "" {
+		return true
+	}
+	// "**" matches any number of leading directories of the rest.
+	parts := strings.Split(p, "/")
+	for j := range parts {
+		if matchPath(rest, strings.Join(parts[j:], "/")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package notes
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// collapsedNouns are the labels of the sections collapsed by Filters.Collapse,
+// and the noun of their summary line.
+var collapsedNouns = map[string]string{
+	"Documentation": "documentation improvement",
+	"Testing":       "test improvement",
+}
+
+// collapse collapses the documentation and testing sections into their
+// summary lines.
+func (ns *Notes) collapse() {
+	for _, s := range ns.Sections {
+		if _, ok := collapsedNouns[s.LabelName]; ok {
+			s.summarize()
+		}
+	}
+}
+
+// summarize sets the summary line of the collapsed section, e.g. "12
+// documentation improvements".
+func (s *Section) summarize() {
+	noun := collapsedNouns[s.LabelName]
+	if len(s.Entries) != 1 {
+		noun += "s"
+	}
+	s.Summary = fmt.Sprintf("%v %v", len(s.Entries), noun)
+}
+
+// labelForPaths returns "Documentation" if all the changed paths are docs,
+// "Testing" if they are all tests, and "" otherwise.
+func labelForPaths(paths []string) string {
+	if len(paths) == 0 {
+		return ""
+	}
+	docs, tests := true, true
+	for _, p := range paths {
+		docs = docs && isDocPath(p)
+		tests = tests && isTestPath(p)
+	}
+	switch {
+	case docs:
+		return "Documentation"
+	case tests:
+		return "Testing"
+	}
+	return ""
+}
+
+func isDocPath(p string) bool {
+	switch strings.ToLower(path.Ext(p)) {
+	case ".md", ".rst", ".adoc":
+		return true
+	}
+	return hasDir(p, "doc", "docs", "Documentation")
+}
+
+func isTestPath(p string) bool {
+	return strings.HasSuffix(p, "_test.go") || hasDir(p, "test", "tests", "testdata")
+}
+
+// hasDir returns whether any directory of the slash separated path p is one of
+// dirs.
+func hasDir(p string, dirs ...string) bool {
+	parts := strings.Split(path.Dir(p), "/")
+	for _, part := range parts {
+		for _, d := range dirs {
+			if part == d {
+				return true
+			}
+		}
+	}
+	return false
+}
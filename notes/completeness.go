@@ -0,0 +1,58 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package notes
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// CheckCompleteness checks that every PR in prs is either excluded
+// intentionally, or is in exactly one section of ns and is mentioned exactly
+// once in rendered (as "#<number>").
+//
+// It catches PRs dropped or duplicated by bugs in the notes generation or the
+// template.
+func CheckCompleteness(prs []*github.Issue, ns *Notes, rendered string) error {
+	excluded := make(map[int]bool)
+	for _, e := range ns.Excluded {
+		excluded[e.IssueNumber] = true
+	}
+	sections := make(map[int][]string)
+	for _, s := range ns.Sections {
+		for _, e := range s.Entries {
+			sections[e.IssueNumber] = append(sections[e.IssueNumber], s.Name)
+		}
+	}
+
+	var problems []string
+	for _, pr := range prs {
+		n := pr.GetNumber()
+		if excluded[n] {
+			continue
+		}
+		switch secs := sections[n]; len(secs) {
+		case 0:
+			problems = append(problems, fmt.Sprintf("#%v %q is in no section", n, pr.GetTitle()))
+			continue
+		case 1:
+		default:
+			problems = append(problems, fmt.Sprintf("#%v %q is in %v sections: %v", n, pr.GetTitle(), len(secs), secs))
+		}
+		// Not the references to other repos, e.g. grpc/grpc-java#12.
+		re := regexp.MustCompile(fmt.Sprintf(`(^|[^\w/])#%v\b`, n))
+		if count := len(re.FindAllStringIndex(rendered, -1)); count != 1 {
+			problems = append(problems, fmt.Sprintf("#%v %q is mentioned %v times in the rendered notes", n, pr.GetTitle(), count))
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	return fmt.Errorf("release notes are incomplete:\n  %v", strings.Join(problems, "\n  "))
+}
@@ -0,0 +1,79 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package notes
+
+import (
+	"regexp"
+	"strings"
+)
+
+// ConventionalCommit is a commit message following
+// https://www.conventionalcommits.org, e.g. the title of a squash-merged PR
+// "feat(api)!: remove the v1 endpoints".
+type ConventionalCommit struct {
+	// Type is the lower-cased type, e.g. "feat" or "fix".
+	Type  string
+	Scope string
+	// Breaking is set by a "!" after the type or scope, or by a BREAKING
+	// CHANGE footer.
+	Breaking    bool
+	Description string
+}
+
+var (
+	conventionalRE   = regexp.MustCompile(`^([a-zA-Z]+)(?:\(([^()]*)\))?(!)?: +(\S.*)$`)
+	breakingFooterRE = regexp.MustCompile(`(?m)^BREAKING[ -]CHANGE: `)
+)
+
+// ParseConventionalCommit parses the conventional commit prefix of the title,
+// and the footers of the body. It returns nil if the title has no prefix.
+func ParseConventionalCommit(title, body string) *ConventionalCommit {
+	m := conventionalRE.FindStringSubmatch(strings.TrimSpace(title))
+	if m == nil {
+		return nil
+	}
+	return &ConventionalCommit{
+		Type:        strings.ToLower(m[1]),
+		Scope:       strings.TrimSpace(m[2]),
+		Breaking:    m[3] == "!" || breakingFooterRE.MatchString(body),
+		Description: m[4],
+	}
+}
+
+// defaultConventionalTypes are the categories of the conventional commit
+// types.
+func defaultConventionalTypes() map[string]string {
+	return map[string]string{
+		"feat":     "Feature",
+		"fix":      "Bug",
+		"perf":     "Performance",
+		"docs":     "Documentation",
+		"test":     "Testing",
+		"build":    "Internal Cleanup",
+		"chore":    "Internal Cleanup",
+		"ci":       "Internal Cleanup",
+		"refactor": "Internal Cleanup",
+		"style":    "Internal Cleanup",
+	}
+}
+
+// conventionalCategory returns the category of the PR from the conventional
+// commit prefix of its title, and whether it has one of a known type.
+func (cl *Classifier) conventionalCategory(title, body string) (string, bool) {
+	if cl.conventional == nil {
+		return "", false
+	}
+	cc := ParseConventionalCommit(title, body)
+	if cc == nil {
+		return "", false
+	}
+	if cc.Breaking {
+		return cl.breaking, true
+	}
+	if cc.Scope == "deps" {
+		return "Dependencies", true
+	}
+	category, ok := cl.conventional[cc.Type]
+	return category, ok
+}
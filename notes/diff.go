@@ -0,0 +1,42 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package notes
+
+// LineDiff returns the lines removed from a ("- ") and added in b ("+ "), in
+// order, from the longest common subsequence. It returns nil if a and b are
+// the same.
+func LineDiff(a, b []string) []string {
+	// lcs[i][j] is the LCS length of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var ret []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			ret = append(ret, "- "+a[i])
+			i++
+		default:
+			ret = append(ret, "+ "+b[j])
+			j++
+		}
+	}
+	return ret
+}
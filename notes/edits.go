@@ -0,0 +1,150 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package notes
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Edits is the editable form of the notes entries, saved as yaml so a human
+// can tweak the wording and sections before the notes are rendered.
+//
+// Entries are keyed by PR number, so the edits are kept when the notes are
+// regenerated: apply the edits to the new notes, and export them again.
+type Edits struct {
+	Version string       `yaml:"version"`
+	Entries []*EditEntry `yaml:"entries"`
+}
+
+// EditEntry is an entry of Edits.
+type EditEntry struct {
+	PR int `yaml:"pr"`
+	// Section is the section name, e.g. "Bug Fixes". Moving an entry to a
+	// section that doesn't exist creates it.
+	Section string `yaml:"section"`
+	Title   string `yaml:"title"`
+	// Ignore is the reason to remove the PR from the notes. Ignored PRs are
+	// excluded, and should be added to the IgnoreList so they are not added
+	// back when the notes are regenerated.
+	Ignore string `yaml:"ignore,omitempty"`
+}
+
+// ExportEdits returns the entries of the notes as Edits.
+func (ns *Notes) ExportEdits() *Edits {
+	ret := &Edits{Version: ns.Version}
+	for _, s := range ns.Sections {
+		for _, e := range s.Entries {
+			ret.Entries = append(ret.Entries, &EditEntry{PR: e.IssueNumber, Section: s.Name, Title: e.Title})
+		}
+	}
+	return ret
+}
+
+// ApplyEdits changes the titles and sections of the entries to the edited
+// ones, and excludes the ignored ones. Entries not in the edits (e.g. PRs
+// merged since the export) are left alone, and edits of PRs not in the notes
+// are ignored.
+//
+// It returns the edits of the entries it excluded.
+func (ns *Notes) ApplyEdits(ed *Edits) (ignored []*EditEntry) {
+	edits := make(map[int]*EditEntry)
+	for _, e := range ed.Entries {
+		edits[e.PR] = e
+	}
+	var moved []*EditEntry
+	entries := make(map[int]*Entry)
+	for _, s := range ns.Sections {
+		var kept []*Entry
+		for _, e := range s.Entries {
+			edit, ok := edits[e.IssueNumber]
+			if !ok {
+				kept = append(kept, e)
+				continue
+			}
+			if edit.Ignore != "" {
+				ns.Excluded = append(ns.Excluded, &Excluded{IssueNumber: e.IssueNumber, Reason: "ignored: " + edit.Ignore})
+				ignored = append(ignored, edit)
+				continue
+			}
+			if edit.Title != "" {
+				e.Title = edit.Title
+			}
+			if edit.Section == "" || edit.Section == s.Name {
+				kept = append(kept, e)
+				continue
+			}
+			entries[e.IssueNumber] = e
+			moved = append(moved, edit)
+		}
+		s.Entries = kept
+	}
+	for _, edit := range moved {
+		s := ns.section(edit.Section)
+		s.Entries = append(s.Entries, entries[edit.PR])
+	}
+
+	var sections []*Section
+	for _, s := range ns.Sections {
+		if len(s.Entries) > 0 {
+			sortEntries(s.Entries)
+			if s.Summary != "" {
+				s.summarize()
+			}
+			sections = append(sections, s)
+		}
+	}
+	ns.Sections = sortSections(sections)
+	// The top changes are picked again, without the excluded entries.
+	ns.pickTop(len(ns.Top))
+	sort.Slice(ns.Excluded, func(i, j int) bool { return ns.Excluded[i].IssueNumber < ns.Excluded[j].IssueNumber })
+	return ignored
+}
+
+// section returns the section with the name, and adds it if it doesn't exist.
+func (ns *Notes) section(name string) *Section {
+	for _, s := range ns.Sections {
+		if s.Name == name {
+			return s
+		}
+	}
+	s := &Section{Name: name}
+	for label, n := range labelToSectionName {
+		if n == name {
+			s.LabelName, s.Weight = label, sortWeight[label]
+		}
+	}
+	ns.Sections = append(ns.Sections, s)
+	return s
+}
+
+// LoadEdits reads the edits from the yaml file. It returns nil if the file
+// doesn't exist.
+func LoadEdits(path string) (*Edits, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ed := new(Edits)
+	if err := yaml.UnmarshalStrict(b, ed); err != nil {
+		return nil, fmt.Errorf("failed to parse notes edits %q: %v", path, err)
+	}
+	return ed, nil
+}
+
+// Save writes the edits to the yaml file.
+func (ed *Edits) Save(path string) error {
+	b, err := yaml.Marshal(ed)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0644)
+}
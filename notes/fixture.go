@@ -0,0 +1,56 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package notes
+
+import (
+	"strconv"
+	"time"
+)
+
+// Fixture returns a sample release with entries in several sections, used to
+// preview templates without fetching a real release.
+func Fixture() *Notes {
+	milestone := &MileStone{ID: 1, Title: "1.14 Release"}
+	user := func(login string) *User {
+		return &User{
+			AvatarURL: "https://avatars.githubusercontent.com/" + login,
+			HTMLURL:   "https://github.com/" + login,
+			Login:     login,
+		}
+	}
+	entry := func(n int, title, login string, thanks bool) *Entry {
+		return &Entry{
+			IssueNumber:   n,
+			Title:         title,
+			HTMLURL:       "https://github.com/grpc/grpc-go/pull/" + strconv.Itoa(n),
+			User:          user(login),
+			MileStone:     milestone,
+			SpecialThanks: thanks,
+		}
+	}
+	return &Notes{
+		Org:     "grpc",
+		Repo:    "grpc-go",
+		Version: "v1.14.0",
+		Date:    time.Date(2018, 7, 31, 17, 0, 0, 0, time.UTC),
+		Sections: []*Section{
+			{Name: "API Changes", LabelName: "API Change", Entries: []*Entry{
+				entry(2101, "balancer: add Builder option to disable health check", "menghanl", false),
+			}},
+			{Name: "New Features", LabelName: "Feature", Entries: []*Entry{
+				entry(2110, "credentials: support ALTS handshaker", "contributor1", true),
+				entry(2115, "status: add FromContextError", "dfawley", false),
+			}},
+			{Name: "Bug Fixes", LabelName: "Bug", Entries: []*Entry{
+				entry(2120, "transport: fix race in stream close", "contributor2", true),
+			}},
+			{Name: "Documentation", LabelName: "Documentation", Entries: []*Entry{
+				entry(2130, "examples: update helloworld README", "menghanl", false),
+			}},
+		},
+		Excluded: []*Excluded{
+			{IssueNumber: 2140, Reason: `label "Testing" has no section`},
+		},
+	}
+}
@@ -4,6 +4,9 @@
 package notes
 
 import (
+	"fmt"
+	"sort"
+
 	"github.com/fatih/color"
 	"github.com/google/go-github/github"
 	log "github.com/sirupsen/logrus"
@@ -16,9 +19,32 @@ type Filters struct {
 	// if SpecialThanks returns true, a special thanks note will be included for
 	// the author.
 	SpecialThanks func(pr *github.Issue) bool
+	// Collapse collapses the documentation and test-only PRs into summary
+	// lines, e.g. "12 documentation improvements", to keep the notes focused on
+	// user-facing changes. Test-only PRs are excluded otherwise.
+	Collapse bool
+	// If Paths is not nil, it returns the files changed by the pr. With
+	// Collapse, PRs changing only docs or tests are collapsed whatever their
+	// labels.
+	Paths func(pr *github.Issue) []string
+	// Ignored are the PRs removed by maintainers (see IgnoreList), with the
+	// reasons. They are excluded from the notes.
+	Ignored map[int]string
+	// If Embargoed returns true, the pr is a security fix not disclosed yet,
+	// and it's excluded from the notes.
+	Embargoed func(pr *github.Issue) bool
+	// Classifier sorts the PRs into the sections. If nil, it's the
+	// DefaultClassifier.
+	Classifier *Classifier
+	// Top is the number of the most important entries (by the importance of
+	// their classification) picked for the TopChanges section, 0 for none.
+	Top int
 }
 
 // GenerateNotes generate the release notes from the given prs and maps.
+//
+// The output only depends on the set of prs, not their order: the entries are
+// sorted by importance and then number, and the excluded PRs by number.
 func GenerateNotes(org, repo, version string, prs []*github.Issue, filters Filters) *Notes {
 	notes := Notes{
 		Org:     org,
@@ -27,52 +53,103 @@ func GenerateNotes(org, repo, version string, prs []*github.Issue, filters Filte
 	}
 
 	sectionsMap := make(map[string]*Section)
+	cl := filters.Classifier
+	if cl == nil {
+		cl = DefaultClassifier()
+	}
 
 	for _, pr := range prs {
+		var paths []string
+		if filters.Paths != nil && (filters.Collapse || cl.NeedsPaths()) {
+			paths = filters.Paths(pr)
+		}
+		entry := newEntry(pr, filters, cl.Classify(pr, paths))
+		notes.Changes = append(notes.Changes, entry)
+
+		if reason, ok := filters.Ignored[pr.GetNumber()]; ok {
+			notes.exclude(pr, "ignored: "+reason)
+			continue
+		}
+		if filters.Embargoed != nil && filters.Embargoed(pr) {
+			notes.exclude(pr, "embargoed")
+			continue
+		}
 		if filters.Ignore != nil && filters.Ignore(pr) {
+			notes.exclude(pr, "ignored by filter")
 			continue
 		}
 
-		label := pickMostWeightedLabel(pr.Labels)
-		_, ok := labelToSectionName[label]
+		label := entry.Label
+		if filters.Collapse && filters.Paths != nil {
+			if l := labelForPaths(paths); l != "" {
+				label = l
+			}
+		}
+		name, ok := cl.sectionName(label, filters.Collapse)
 		if !ok {
-			continue // If ok==false, ignore this PR in the release note.
+			// If ok==false, ignore this PR in the release note.
+			notes.exclude(pr, fmt.Sprintf("label %q has no section", label))
+			continue
 		}
 		log.Infof(" [%v] - ", color.BlueString("%v", pr.GetNumber()))
 		log.Info(color.GreenString("%-18q", label))
-		log.Info(" from: %v\n", labelsToString(pr.Labels))
+		log.Infof(" from: %v\n", labelsToString(pr.Labels))
 
 		section, ok := sectionsMap[label]
 		if !ok {
-			section = &Section{Name: labelToSectionName[label], LabelName: label}
+			section = &Section{Name: name, LabelName: label, Weight: cl.weight(label)}
 			sectionsMap[label] = section
 
 			notes.Sections = append(notes.Sections, section)
 		}
 
-		user := pr.GetUser()
-		milestone := pr.GetMilestone()
-
-		entry := &Entry{
-			// head: fmt.Sprintf("%v (#%d)", pr.GetTitle(), pr.GetNumber()),
-			IssueNumber: pr.GetNumber(),
-			Title:       pr.GetTitle(),
-			HTMLURL:     pr.GetHTMLURL(),
-
-			User: &User{
-				AvatarURL: user.GetAvatarURL(),
-				HTMLURL:   user.GetHTMLURL(),
-				Login:     user.GetLogin(),
-			},
-
-			MileStone: &MileStone{
-				ID:    milestone.GetID(),
-				Title: milestone.GetTitle(),
-			},
-			SpecialThanks: filters.SpecialThanks != nil && filters.SpecialThanks(pr),
-		}
 		section.Entries = append(section.Entries, entry)
 	}
 	notes.Sections = sortSections(notes.Sections)
+	for _, s := range notes.Sections {
+		sortEntries(s.Entries)
+	}
+	sort.Slice(notes.Excluded, func(i, j int) bool { return notes.Excluded[i].IssueNumber < notes.Excluded[j].IssueNumber })
+	sort.Slice(notes.Changes, func(i, j int) bool { return notes.Changes[i].IssueNumber < notes.Changes[j].IssueNumber })
+	if filters.Collapse {
+		notes.collapse()
+	}
+	notes.pickTop(filters.Top)
 	return &notes
 }
+
+func newEntry(pr *github.Issue, filters Filters, c *Classification) *Entry {
+	user := pr.GetUser()
+	milestone := pr.GetMilestone()
+	var labels []string
+	for _, l := range pr.Labels {
+		labels = append(labels, l.GetName())
+	}
+	return &Entry{
+		// head: fmt.Sprintf("%v (#%d)", pr.GetTitle(), pr.GetNumber()),
+		IssueNumber: pr.GetNumber(),
+		Title:       pr.GetTitle(),
+		HTMLURL:     pr.GetHTMLURL(),
+		Ref:         fmt.Sprintf("#%v", pr.GetNumber()),
+		Label:       c.Category,
+		Labels:      labels,
+		Audience:    c.Audience,
+		Importance:  c.Importance,
+
+		User: &User{
+			AvatarURL: user.GetAvatarURL(),
+			HTMLURL:   user.GetHTMLURL(),
+			Login:     user.GetLogin(),
+		},
+
+		MileStone: &MileStone{
+			ID:    milestone.GetID(),
+			Title: milestone.GetTitle(),
+		},
+		SpecialThanks: filters.SpecialThanks != nil && filters.SpecialThanks(pr),
+	}
+}
+
+func (ns *Notes) exclude(pr *github.Issue, reason string) {
+	ns.Excluded = append(ns.Excluded, &Excluded{IssueNumber: pr.GetNumber(), Reason: reason})
+}
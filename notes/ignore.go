@@ -0,0 +1,87 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package notes
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// IgnoreList is the PRs maintainers removed from the notes, persisted so they
+// are not added back when the notes are regenerated.
+type IgnoreList struct {
+	PRs []*IgnoredPR `yaml:"prs"`
+}
+
+// IgnoredPR is a PR removed from the notes, and why.
+type IgnoredPR struct {
+	PR     int    `yaml:"pr"`
+	Reason string `yaml:"reason"`
+	// Release is the notes version the PR was removed from.
+	Release string    `yaml:"release"`
+	Time    time.Time `yaml:"time"`
+}
+
+// LoadIgnoreList reads the ignore list from the yaml file. It returns an empty
+// list if the file doesn't exist.
+func LoadIgnoreList(path string) (*IgnoreList, error) {
+	l := new(IgnoreList)
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.UnmarshalStrict(b, l); err != nil {
+		return nil, fmt.Errorf("failed to parse ignore list %q: %v", path, err)
+	}
+	return l, nil
+}
+
+// Save writes the list to the yaml file, sorted by PR number.
+func (l *IgnoreList) Save(path string) error {
+	sort.Slice(l.PRs, func(i, j int) bool { return l.PRs[i].PR < l.PRs[j].PR })
+	b, err := yaml.Marshal(l)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0644)
+}
+
+// Add adds the PR to the list, replacing the previous decision for it.
+func (l *IgnoreList) Add(p *IgnoredPR) {
+	for i, old := range l.PRs {
+		if old.PR == p.PR {
+			l.PRs[i] = p
+			return
+		}
+	}
+	l.PRs = append(l.PRs, p)
+}
+
+// ForRelease returns the PRs removed from the notes of the release.
+func (l *IgnoreList) ForRelease(release string) []*IgnoredPR {
+	var ret []*IgnoredPR
+	for _, p := range l.PRs {
+		if p.Release == release {
+			ret = append(ret, p)
+		}
+	}
+	return ret
+}
+
+// Reasons returns the reasons by PR number, for Filters.Ignored.
+func (l *IgnoreList) Reasons() map[int]string {
+	ret := make(map[int]string)
+	for _, p := range l.PRs {
+		ret[p.PR] = p.Reason
+	}
+	return ret
+}
@@ -3,13 +3,7 @@
 
 package notes
 
-import (
-	"sort"
-	"strings"
-
-	"github.com/google/go-github/github"
-	log "github.com/sirupsen/logrus"
-)
+import "sort"
 
 const (
 	labelPrefix  = "Type: "
@@ -28,29 +22,17 @@ var sortWeight = map[string]int{
 	"Internal Cleanup": 0,
 }
 
+// sortLabelName sorts the labels by weight, and by name for the same weight.
 func sortLabelName(labels []string) []string {
 	sort.Slice(labels, func(i, j int) bool {
-		return sortWeight[labels[i]] >= sortWeight[labels[j]]
+		if wi, wj := sortWeight[labels[i]], sortWeight[labels[j]]; wi != wj {
+			return wi > wj
+		}
+		return labels[i] < labels[j]
 	})
 	return labels
 }
 
-func pickMostWeightedLabel(labels []github.Label) string {
-	if len(labels) <= 0 {
-		log.Info("0 lable was assigned to issue")
-		return defaultLabel
-	}
-	var names []string
-	for _, l := range labels {
-		names = append(names, strings.TrimPrefix(l.GetName(), labelPrefix))
-	}
-	sortLabelName(names)
-	if _, ok := sortWeight[names[0]]; !ok {
-		return defaultLabel
-	}
-	return names[0]
-}
-
 var labelToSectionName = map[string]string{
 	"Dependencies":    "Dependencies",
 	"API Change":      "API Changes",
@@ -61,9 +43,20 @@ var labelToSectionName = map[string]string{
 	"Documentation":   "Documentation",
 }
 
+// sortSections sorts the sections by weight, and by name for the same weight.
 func sortSections(sections []*Section) []*Section {
 	sort.Slice(sections, func(i, j int) bool {
-		return sortWeight[sections[i].LabelName] >= sortWeight[sections[j].LabelName]
+		if wi, wj := sections[i].weight(), sections[j].weight(); wi != wj {
+			return wi > wj
+		}
+		return sections[i].Name < sections[j].Name
 	})
 	return sections
 }
+
+func (s *Section) weight() int {
+	if s.Weight == 0 {
+		return sortWeight[s.LabelName]
+	}
+	return s.Weight
+}
@@ -5,7 +5,10 @@
 // notes.
 package notes
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 // Notes contains all the note entries for a given release.
 type Notes struct {
@@ -13,30 +16,136 @@ type Notes struct {
 	Repo     string     `json:"repo"`
 	Version  string     `json:"version"`
 	Sections []*Section `json:"sections"`
+	// Top are the most important entries of the sections (see Filters.Top),
+	// rendered first as the TopChanges section. They are also in their
+	// sections.
+	Top []*Entry `json:"top,omitempty"`
+	// Date is the release date, zero if unknown. For reproducible notes, set
+	// it to the time of the release commit instead of now.
+	Date time.Time `json:"date"`
+	// Excluded are the input PRs intentionally left out of the notes.
+	Excluded []*Excluded `json:"excluded,omitempty"`
+	// Changes are all the input PRs sorted by number, including the excluded
+	// ones, for the developer changelog (see DeveloperTemplate). The entries
+	// in the sections are the same.
+	Changes []*Entry `json:"changes,omitempty"`
+	// Repos are the notes of the other repos released together, e.g. the
+	// plugins of a core repo, added with AddRepo. They are rendered in their
+	// own subsections.
+	Repos []*Notes `json:"repos,omitempty"`
+	// CompareURL is the "Full Changelog" link comparing the previous release
+	// with this one, empty if there's none.
+	CompareURL string `json:"compare_url,omitempty"`
+	// Stats are the diff statistics since the previous release, rendered as
+	// a summary line before the CompareURL. Nil if unknown.
+	Stats *Stats `json:"stats,omitempty"`
+}
+
+// Stats are the diff statistics of a release.
+type Stats struct {
+	Commits      int `json:"commits"`
+	FilesChanged int `json:"files_changed"`
+	Additions    int `json:"additions"`
+	Deletions    int `json:"deletions"`
+	// Truncated is whether the files are lower bounds, github only returns
+	// the first files of large diffs.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// String returns the summary line, e.g. "42 commits, 87 files changed, 1203
+// additions(+), 456 deletions(-)".
+func (s *Stats) String() string {
+	more := ""
+	if s.Truncated {
+		more = "+"
+	}
+	return fmt.Sprintf("%v commits, %v%v files changed, %v%v additions(+), %v%v deletions(-)", s.Commits, s.FilesChanged, more, s.Additions, more, s.Deletions, more)
+}
+
+// Excluded is a PR left out of the notes, and why.
+type Excluded struct {
+	IssueNumber int    `json:"issue_number"`
+	Reason      string `json:"reason"`
 }
 
 // ToMarkdown converts Notes into a markdown string that can be used in github
 // release description.
 func (ns *Notes) ToMarkdown() string {
 	var ret string
-	for _, section := range ns.Sections {
-		ret += fmt.Sprintf("# %v\n\n", section.Name)
+	if !ns.Date.IsZero() {
+		ret += fmt.Sprintf("Released on %v\n\n", FormatDate(ns.Date))
+	}
+	if len(ns.Top) > 0 {
+		ret += fmt.Sprintf("# %v\n\n", TopChanges)
+		for _, entry := range ns.Top {
+			ret += fmt.Sprintf(" * %v (%v)\n", entry.Title, entry.ref())
+		}
+		ret += "\n"
+	}
+	ret += sectionsMarkdown(ns.Sections, "#")
+	for _, r := range ns.Repos {
+		ret += fmt.Sprintf("# %v/%v %v\n\n", r.Org, r.Repo, r.Version)
+		ret += sectionsMarkdown(r.Sections, "##")
+	}
+	if ns.Stats != nil {
+		ret += fmt.Sprintf("%v\n\n", ns.Stats)
+	}
+	if ns.CompareURL != "" {
+		ret += fmt.Sprintf("**Full Changelog**: %v\n", ns.CompareURL)
+	}
+	return ret
+}
+
+// sectionsMarkdown renders the sections with the heading level, e.g. "##".
+func sectionsMarkdown(sections []*Section, heading string) string {
+	var ret string
+	for _, section := range sections {
+		if section.Summary != "" {
+			ret += fmt.Sprintf("<details><summary>%v</summary>\n\n", section.Summary)
+		} else {
+			ret += fmt.Sprintf("%v %v\n\n", heading, section.Name)
+		}
 		for _, entry := range section.Entries {
-			ret += fmt.Sprintf(" * %v (#%v)\n", entry.Title, entry.IssueNumber)
+			ret += fmt.Sprintf(" * %v (%v)\n", entry.Title, entry.ref())
 			if entry.SpecialThanks {
 				ret += fmt.Sprintf("   - Special Thanks: @%v\n", entry.User.Login)
 			}
 		}
+		if section.Summary != "" {
+			ret += "\n</details>\n"
+		}
 		ret += "\n"
 	}
 	return ret
 }
 
+// AddRepo adds the notes of another repo released together, e.g. a plugin of
+// the repo, for umbrella projects publishing one announcement. The references
+// of its entries are namespaced by repo, e.g. "grpc/grpc-go-plugins#12", so
+// they link to the right repo from the release of this one.
+func (ns *Notes) AddRepo(r *Notes) {
+	entries := r.Changes
+	for _, s := range r.Sections {
+		entries = append(entries, s.Entries...)
+	}
+	for _, e := range entries {
+		e.Ref = fmt.Sprintf("%v/%v#%v", r.Org, r.Repo, e.IssueNumber)
+	}
+	ns.Repos = append(ns.Repos, r)
+}
+
 // Section contains one release note section, for example "Feature".
 type Section struct {
-	Name      string   `json:"name"`
-	LabelName string   `json:"label_name"`
-	Entries   []*Entry `json:"entries"`
+	Name      string `json:"name"`
+	LabelName string `json:"label_name"`
+	// Weight orders the sections, higher first. If 0, it's the weight of the
+	// "Type: " label, for notes decoded from an older version.
+	Weight  int      `json:"weight,omitempty"`
+	Entries []*Entry `json:"entries"`
+	// Summary is set if the section is collapsed, e.g. "12 documentation
+	// improvements". Collapsed sections are rendered as the summary line, with
+	// the entries in an expandable details block.
+	Summary string `json:"summary,omitempty"`
 }
 
 // Entry contains the info for one entry in the release notes.
@@ -44,6 +153,17 @@ type Entry struct {
 	IssueNumber int    `json:"issue_number"`
 	Title       string `json:"title"`
 	HTMLURL     string `json:"html_url"`
+	// Ref is the github reference to the PR, "#123", or "org/repo#123" for
+	// the entries of the other repos in Notes.Repos.
+	Ref string `json:"ref,omitempty"`
+	// Label is the category the PR is sorted by (see Classifier), e.g. the
+	// label without the "Type: " prefix.
+	Label string `json:"label,omitempty"`
+	// Labels are the names of all the PR labels.
+	Labels []string `json:"labels,omitempty"`
+	// Audience and Importance are from the Classifier.
+	Audience   string `json:"audience,omitempty"`
+	Importance int    `json:"importance,omitempty"`
 
 	User      *User      `json:"user"`
 	MileStone *MileStone `json:"milestone"`
@@ -51,11 +171,24 @@ type Entry struct {
 	SpecialThanks bool `json:"special_thanks"`
 }
 
+// ref returns the Ref of the entry, which is empty in notes decoded from an
+// older version.
+func (e *Entry) ref() string {
+	if e.Ref == "" {
+		return fmt.Sprintf("#%v", e.IssueNumber)
+	}
+	return e.Ref
+}
+
 // User represents a github user.
 type User struct {
 	AvatarURL string `json:"avatar_url"`
 	HTMLURL   string `json:"html_url"`
 	Login     string `json:"login"`
+	// Name and Email are the display name and public email, if they are
+	// resolved. Changelog formats like debian's need them.
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email,omitempty"`
 }
 
 // MileStone represents a github milestone.
@@ -0,0 +1,43 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package notes
+
+import "sort"
+
+// TopChanges is the name of the section of the top changes, see Filters.Top.
+const TopChanges = "Top changes"
+
+// sortEntries sorts the entries by importance, most important first, and then
+// by PR number, so the order doesn't depend on the order of the input PRs.
+// With the default classifier, all the entries of a section are equally
+// important, and sorted by number.
+func sortEntries(entries []*Entry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Importance != entries[j].Importance {
+			return entries[i].Importance > entries[j].Importance
+		}
+		return entries[i].IssueNumber < entries[j].IssueNumber
+	})
+}
+
+// pickTop sets Top to the n most important entries of the sections, the
+// collapsed ones excluded. Top is empty if there are no more than n entries,
+// since it would repeat the whole notes.
+func (ns *Notes) pickTop(n int) {
+	ns.Top = nil
+	if n <= 0 {
+		return
+	}
+	var entries []*Entry
+	for _, s := range ns.Sections {
+		if s.Summary == "" {
+			entries = append(entries, s.Entries...)
+		}
+	}
+	if len(entries) <= n {
+		return
+	}
+	sortEntries(entries)
+	ns.Top = entries[:n]
+}
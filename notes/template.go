@@ -0,0 +1,311 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package notes
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+// DefaultTemplate renders the same markdown as ToMarkdown. The sections are
+// rendered with {{section .}}, see ParseTemplates.
+const DefaultTemplate = `{{if not .Date.IsZero}}Released on {{date .Date}}
+
+{{end}}{{if .Top}}# Top changes
+
+{{range .Top}} * {{.Title}} (#{{.IssueNumber}})
+{{end}}
+{{end}}{{range .Sections}}{{section .}}{{end}}{{range .Repos}}# {{.Org}}/{{.Repo}} {{.Version}}
+
+{{range .Sections}}{{if .Summary}}<details><summary>{{.Summary}}</summary>
+
+{{else}}## {{.Name}}
+
+{{end}}{{range .Entries}} * {{.Title}} ({{.Ref}})
+{{if .SpecialThanks}}   - Special Thanks: @{{.User.Login}}
+{{end}}{{end}}{{if .Summary}}
+</details>
+{{end}}
+{{end}}{{end}}{{if .Stats}}{{.Stats}}
+
+{{end}}{{if .CompareURL}}**Full Changelog**: {{.CompareURL}}
+{{end}}`
+
+// DefaultSectionTemplate renders a section of the notes like ToMarkdown, for
+// the sections without their own template. It's executed with a *Section.
+const DefaultSectionTemplate = `{{if .Summary}}<details><summary>{{.Summary}}</summary>
+
+{{else}}# {{.Name}}
+
+{{end}}{{range .Entries}} * {{.Title}} (#{{.IssueNumber}})
+{{if .SpecialThanks}}   - Special Thanks: @{{.User.Login}}
+{{end}}{{end}}{{if .Summary}}
+</details>
+{{end}}
+`
+
+// sectionPrefix prefixes the names of the section templates.
+const sectionPrefix = "section:"
+
+// DeveloperTemplate renders the developer changelog: every PR of the release,
+// including the ones left out of the notes, with their authors and labels.
+const DeveloperTemplate = `# Full changelog of {{.Version}}
+
+{{range .Changes}} * {{.Title}} (#{{.IssueNumber}}) @{{.User.Login}}{{if .Labels}} [{{range $i, $l := .Labels}}{{if $i}}, {{end}}{{$l}}{{end}}]{{end}}
+{{end}}`
+
+// ParseTemplate parses a notes template. The template is executed with a
+// *Notes.
+func ParseTemplate(name, text string) (*template.Template, error) {
+	return ParseTemplates(name, text, nil)
+}
+
+// FormatDate formats the dates of the notes, and of the templates with
+// {{date .Date}}. It's YYYY-MM-DD by default.
+var FormatDate = func(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+// ParseTemplates parses a notes template, with the templates of the sections
+// keyed by section name, e.g. a table for "Dependencies". In the notes
+// template, {{section .}} renders a *Section with its template, or
+// DefaultSectionTemplate if it has none, and {{date .Date}} formats a date
+// with FormatDate.
+func ParseTemplates(name, text string, sections map[string]string) (*template.Template, error) {
+	var t *template.Template
+	t = template.New(name).Option("missingkey=error").Funcs(template.FuncMap{
+		"date": func(d time.Time) string {
+			return FormatDate(d)
+		},
+		"section": func(s *Section) (string, error) {
+			st := t.Lookup(sectionPrefix + s.Name)
+			if st == nil {
+				st = t.Lookup(sectionPrefix)
+			}
+			var buf bytes.Buffer
+			err := st.Execute(&buf, s)
+			return buf.String(), err
+		},
+	})
+	if _, err := t.Parse(text); err != nil {
+		return nil, err
+	}
+	if _, err := t.New(sectionPrefix).Parse(DefaultSectionTemplate); err != nil {
+		return nil, err
+	}
+	for section, text := range sections {
+		if _, err := t.New(sectionPrefix + section).Parse(text); err != nil {
+			return nil, fmt.Errorf("invalid template of section %q: %v", section, err)
+		}
+	}
+	return t, nil
+}
+
+// ParseTemplateFile parses the notes template in the file.
+func ParseTemplateFile(path string) (*template.Template, error) {
+	return ParseTemplateFiles(path, nil)
+}
+
+// ParseTemplateFiles parses the notes template in the file, DefaultTemplate if
+// path is empty, with the templates of the sections in the files keyed by
+// section name, see ParseTemplates.
+func ParseTemplateFiles(path string, sections map[string]string) (*template.Template, error) {
+	name, text := "default", DefaultTemplate
+	if path != "" {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		name, text = path, string(b)
+	}
+	texts := make(map[string]string)
+	for section, file := range sections {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the template of section %q: %v", section, err)
+		}
+		texts[section] = string(b)
+	}
+	return ParseTemplates(name, text, texts)
+}
+
+// Render renders the notes with the template.
+func (ns *Notes) Render(t *template.Template) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, ns); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// CheckTemplate checks that all the fields referenced by the template exist in
+// the data model (Notes and the types it contains).
+//
+// Fields of values returned by functions, and of variables other than $ and
+// range variables, are not checked.
+func CheckTemplate(t *template.Template) error {
+	var problems []string
+	for _, tt := range t.Templates() {
+		if tt.Tree == nil {
+			continue
+		}
+		// The section templates are executed with a *Section.
+		dot := reflect.TypeOf(&Notes{})
+		if strings.HasPrefix(tt.Name(), sectionPrefix) {
+			dot = reflect.TypeOf(&Section{})
+		}
+		c := &templateChecker{
+			tree: tt.Tree,
+			vars: map[string]reflect.Type{"$": dot},
+		}
+		c.walk(tt.Tree.Root, dot)
+		problems = append(problems, c.problems...)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid template:\n  %v", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+type templateChecker struct {
+	tree     *parse.Tree
+	vars     map[string]reflect.Type
+	problems []string
+}
+
+// walk checks node with dot of type dot. A nil dot means unknown type.
+func (c *templateChecker) walk(node parse.Node, dot reflect.Type) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, nn := range n.Nodes {
+			c.walk(nn, dot)
+		}
+	case *parse.ActionNode:
+		c.pipe(n.Pipe, dot)
+	case *parse.IfNode:
+		c.pipe(n.Pipe, dot)
+		c.walk(n.List, dot)
+		c.walk(n.ElseList, dot)
+	case *parse.WithNode:
+		t := c.pipe(n.Pipe, dot)
+		c.walk(n.List, t)
+		c.walk(n.ElseList, dot)
+	case *parse.RangeNode:
+		t := c.pipe(n.Pipe, dot)
+		var key, elem reflect.Type
+		if t != nil {
+			switch t.Kind() {
+			case reflect.Slice, reflect.Array:
+				key, elem = reflect.TypeOf(0), t.Elem()
+			case reflect.Map:
+				key, elem = t.Key(), t.Elem()
+			default:
+				c.problem(n, fmt.Sprintf("range over %v, which is not a slice or map", t))
+			}
+		}
+		switch len(n.Pipe.Decl) {
+		case 1:
+			c.vars[n.Pipe.Decl[0].Ident[0]] = elem
+		case 2:
+			c.vars[n.Pipe.Decl[0].Ident[0]] = key
+			c.vars[n.Pipe.Decl[1].Ident[0]] = elem
+		}
+		c.walk(n.List, elem)
+		c.walk(n.ElseList, dot)
+	case *parse.TemplateNode:
+		if n.Pipe != nil {
+			c.pipe(n.Pipe, dot)
+		}
+	}
+}
+
+// pipe checks the pipeline and returns the type of its value, nil if unknown.
+func (c *templateChecker) pipe(p *parse.PipeNode, dot reflect.Type) reflect.Type {
+	if p == nil {
+		return nil
+	}
+	var ret reflect.Type
+	for i, cmd := range p.Cmds {
+		for _, arg := range cmd.Args {
+			t := c.arg(arg, dot)
+			// The value of a command with one argument is the argument, a
+			// function call is unknown.
+			if len(cmd.Args) == 1 && i == len(p.Cmds)-1 {
+				ret = t
+			}
+		}
+	}
+	for _, v := range p.Decl {
+		if len(p.Decl) == 1 {
+			c.vars[v.Ident[0]] = ret
+		}
+	}
+	return ret
+}
+
+func (c *templateChecker) arg(arg parse.Node, dot reflect.Type) reflect.Type {
+	switch a := arg.(type) {
+	case *parse.DotNode:
+		return dot
+	case *parse.FieldNode:
+		return c.fields(a, dot, a.Ident)
+	case *parse.VariableNode:
+		t, ok := c.vars[a.Ident[0]]
+		if !ok {
+			return nil
+		}
+		return c.fields(a, t, a.Ident[1:])
+	case *parse.PipeNode:
+		return c.pipe(a, dot)
+	}
+	return nil
+}
+
+// fields resolves the field chain on t.
+func (c *templateChecker) fields(n parse.Node, t reflect.Type, idents []string) reflect.Type {
+	for _, ident := range idents {
+		if t == nil {
+			return nil
+		}
+		if m, ok := t.MethodByName(ident); ok {
+			if m.Type.NumOut() == 0 {
+				return nil
+			}
+			t = m.Type.Out(0)
+			continue
+		}
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() == reflect.Map {
+			t = t.Elem()
+			continue
+		}
+		if t.Kind() != reflect.Struct {
+			c.problem(n, fmt.Sprintf("can't evaluate field %v in type %v", ident, t))
+			return nil
+		}
+		f, ok := t.FieldByName(ident)
+		if !ok || f.PkgPath != "" {
+			c.problem(n, fmt.Sprintf("%v has no field %v", t, ident))
+			return nil
+		}
+		t = f.Type
+	}
+	return t
+}
+
+func (c *templateChecker) problem(n parse.Node, msg string) {
+	location, _ := c.tree.ErrorContext(n)
+	c.problems = append(c.problems, fmt.Sprintf("%v: %v", location, msg))
+}
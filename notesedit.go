@@ -0,0 +1,77 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/sniperkit/snk.fork.release-git-bot/audit"
+	"github.com/sniperkit/snk.fork.release-git-bot/notes"
+	"github.com/sniperkit/snk.fork.release-git-bot/state"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// editNotes lets the human edit the notes entries in the yaml file at path.
+// The previous edits in the file are applied first, then the merged entries
+// (including the PRs new since the last run) are written back for editing,
+// and applied again once confirmed. The entries ignored in the edits are added
+// to the ignore list.
+func editNotes(st *state.State, step string, ns *notes.Notes, path string) {
+	ed, err := notes.LoadEdits(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if ed != nil {
+		ignoreNotes(ns, ns.ApplyEdits(ed))
+	}
+	if err := ns.ExportEdits().Save(path); err != nil {
+		log.Fatalf("failed to save notes edits: %v", err)
+	}
+	fmt.Printf("Notes entries are in %v, edit the titles and sections before continuing\n", path)
+	confirm(st, step, "Edited?")
+
+	if ed, err = notes.LoadEdits(path); err != nil {
+		log.Fatal(err)
+	}
+	if ed != nil {
+		ignoreNotes(ns, ns.ApplyEdits(ed))
+	}
+}
+
+// ignoreNotes adds the entries ignored in the edits to the ignore list, and
+// records the decisions in the audit log.
+func ignoreNotes(ns *notes.Notes, ignored []*notes.EditEntry) {
+	if len(ignored) == 0 {
+		return
+	}
+	l := loadIgnoreList()
+	for _, e := range ignored {
+		l.Add(&notes.IgnoredPR{PR: e.PR, Reason: e.Ignore, Release: ns.Version, Time: botClock.Now().UTC()})
+		if err := auditLog.Record(&audit.Entry{Method: "IGNORE", Endpoint: fmt.Sprintf("%v/%v#%v", ns.Org, ns.Repo, e.PR), Payload: e.Ignore}); err != nil {
+			log.Warning(err)
+		}
+	}
+	if err := l.Save(ignoreListPath()); err != nil {
+		log.Fatalf("failed to save the ignore list: %v", err)
+	}
+}
+
+func ignoreListPath() string {
+	if *ignoreList != "" {
+		return *ignoreList
+	}
+	return *repo + "_ignore.yaml"
+}
+
+// loadIgnoreList loads the ignore list, or returns an empty list if it can't
+// be read.
+func loadIgnoreList() *notes.IgnoreList {
+	l, err := notes.LoadIgnoreList(ignoreListPath())
+	if err != nil {
+		log.Warningf("failed to load the ignore list, no PR is ignored: %v", err)
+		return new(notes.IgnoreList)
+	}
+	return l
+}
@@ -0,0 +1,171 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+// Package notestest helps testing notes templates with golden files, so users
+// customizing the templates can check their changes in their own tests:
+//
+//	func TestNotes(t *testing.T) {
+//		prs, err := notestest.LoadPRs("testdata/prs.json")
+//		if err != nil {
+//			t.Fatal(err)
+//		}
+//		got, err := notestest.Render(&config.Config{NotesTemplate: "notes.tmpl"}, prs, notestest.Options{})
+//		if err != nil {
+//			t.Fatal(err)
+//		}
+//		notestest.CompareGolden(t, "testdata/notes.golden.md", got)
+//	}
+//
+// Run the tests with UPDATE_GOLDEN=1 to write the golden files.
+package notestest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/sniperkit/snk.fork.release-git-bot/config"
+	"github.com/sniperkit/snk.fork.release-git-bot/notes"
+)
+
+// UpdateEnv is the env var to set to write the golden files instead of
+// comparing with them.
+const UpdateEnv = "UPDATE_GOLDEN"
+
+// Fixture identifies the release the fixture PRs are rendered as. The date is
+// fixed, so the output doesn't change between runs.
+var (
+	FixtureOrg     = "grpc"
+	FixtureRepo    = "grpc-go"
+	FixtureVersion = "v1.14.0"
+	FixtureDate    = time.Date(2018, 7, 31, 17, 0, 0, 0, time.UTC)
+)
+
+// LoadPRs reads the fixture PRs, a json array of github issues as returned by
+// the github API (e.g. saved from "query -format json").
+func LoadPRs(path string) ([]*github.Issue, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var prs []*github.Issue
+	if err := json.Unmarshal(b, &prs); err != nil {
+		return nil, fmt.Errorf("failed to parse fixture PRs %q: %v", path, err)
+	}
+	return prs, nil
+}
+
+// Options are the notes generation options of the bot's flags.
+type Options struct {
+	// Thanks are the authors getting a special thanks note (-thanks).
+	Thanks []string
+	// Collapse collapses the documentation and test-only PRs (-collapse).
+	Collapse bool
+	// Top is the number of entries of the TopChanges section (-topchanges).
+	Top int
+	// Ignored is the ignore list of the maintainers (-ignorelist), nil for
+	// none.
+	Ignored *notes.IgnoreList
+	// Paths are the files changed by the PRs, by number, for Collapse and
+	// the classification rules on paths. Nil if the fixture has none.
+	Paths map[int][]string
+}
+
+// Generate generates the notes of the fixture release from the PRs, with the
+// classification of the config and the options, as the bot does.
+func Generate(cfg *config.Config, prs []*github.Issue, opts Options) (*notes.Notes, error) {
+	if cfg == nil {
+		cfg = &config.Config{}
+	}
+	cl, err := notes.NewClassifier(cfg.Classification)
+	if err != nil {
+		return nil, err
+	}
+	thanked := make(map[string]bool)
+	for _, u := range opts.Thanks {
+		thanked[u] = true
+	}
+	filters := notes.Filters{
+		SpecialThanks: func(pr *github.Issue) bool { return thanked[pr.GetUser().GetLogin()] },
+		Collapse:      opts.Collapse,
+		Classifier:    cl,
+		Top:           opts.Top,
+	}
+	if opts.Ignored != nil {
+		filters.Ignored = opts.Ignored.Reasons()
+	}
+	if opts.Paths != nil {
+		filters.Paths = func(pr *github.Issue) []string { return opts.Paths[pr.GetNumber()] }
+	}
+	ns := notes.GenerateNotes(FixtureOrg, FixtureRepo, FixtureVersion, prs, filters)
+	ns.Date = FixtureDate
+	return ns, nil
+}
+
+// Render generates the notes from the PRs (see Generate), and renders them
+// with the notes template of the config (the default template if it's not
+// set), as the bot does. The template is checked first.
+func Render(cfg *config.Config, prs []*github.Issue, opts Options) (string, error) {
+	ns, err := Generate(cfg, prs, opts)
+	if err != nil {
+		return "", err
+	}
+	return RenderNotes(cfg, ns)
+}
+
+// RenderNotes renders the notes with the notes template of the config, e.g.
+// notes.Fixture().
+func RenderNotes(cfg *config.Config, ns *notes.Notes) (string, error) {
+	if cfg == nil {
+		cfg = &config.Config{}
+	}
+	t, err := notes.ParseTemplateFiles(cfg.NotesTemplate, cfg.SectionTemplates)
+	if err != nil {
+		return "", err
+	}
+	if err := notes.CheckTemplate(t); err != nil {
+		return "", err
+	}
+	return ns.Render(t)
+}
+
+// TB is the part of testing.TB used here.
+type TB interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+	Fatalf(format string, args ...interface{})
+}
+
+// CompareGolden fails t if got is different from the content of the golden
+// file, with the differing lines. If $UPDATE_GOLDEN is set, the golden file is
+// written instead.
+func CompareGolden(t TB, path, got string) {
+	t.Helper()
+	if os.Getenv(UpdateEnv) != "" {
+		if err := ioutil.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatalf("failed to update golden file: %v", err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read golden file (run with %v=1 to create it): %v", UpdateEnv, err)
+	}
+	if d := Diff(string(want), got); d != "" {
+		t.Errorf("output differs from %v (- golden, + got), run with %v=1 to update:\n%v", path, UpdateEnv, d)
+	}
+}
+
+// Diff returns the lines removed from want ("- ") and added in got ("+ "),
+// or "" if they are the same.
+func Diff(want, got string) string {
+	d := notes.LineDiff(strings.Split(want, "\n"), strings.Split(got, "\n"))
+	if len(d) == 0 {
+		return ""
+	}
+	return strings.Join(d, "\n") + "\n"
+}
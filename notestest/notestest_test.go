@@ -0,0 +1,62 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package notestest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/sniperkit/snk.fork.release-git-bot/notes"
+)
+
+func TestRenderFixture(t *testing.T) {
+	got, err := RenderNotes(nil, notes.Fixture())
+	if err != nil {
+		t.Fatal(err)
+	}
+	CompareGolden(t, "testdata/fixture.golden.md", got)
+}
+
+func TestGenerate(t *testing.T) {
+	pr := func(n int, title, label string) *github.Issue {
+		return &github.Issue{
+			Number: github.Int(n),
+			Title:  github.String(title),
+			User:   &github.User{Login: github.String("dfawley")},
+			Labels: []github.Label{{Name: github.String(label)}},
+		}
+	}
+	prs := []*github.Issue{
+		pr(1, "transport: fix a deadlock", "Bug"),
+		pr(2, "grpc: add WithBlock", "Feature"),
+		pr(3, "docs: fix a typo", "Documentation"),
+	}
+	ignored := new(notes.IgnoreList)
+	ignored.Add(&notes.IgnoredPR{PR: 1, Reason: "reverted", Release: FixtureVersion})
+	ns, err := Generate(nil, prs, Options{Ignored: ignored})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ns.Excluded) != 1 || ns.Excluded[0].IssueNumber != 1 {
+		t.Errorf("Generate() excluded %+v, want #1", ns.Excluded)
+	}
+	for _, s := range ns.Sections {
+		for _, e := range s.Entries {
+			if e.IssueNumber == 1 {
+				t.Errorf("Generate() has ignored #1 in section %q", s.Name)
+			}
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	if d := Diff("a\nb\n", "a\nb\n"); d != "" {
+		t.Errorf("Diff() of the same strings = %q, want \"\"", d)
+	}
+	d := Diff("a\nb\nc", "a\nB\nc")
+	if !strings.Contains(d, "- b\n") || !strings.Contains(d, "+ B\n") {
+		t.Errorf("Diff() = %q, want - b and + B", d)
+	}
+}
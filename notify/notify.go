@@ -0,0 +1,208 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+// Package notify posts the release events of the bot to webhooks of internal
+// systems (e.g. deploy tooling and dashboards), so they can react to releases
+// without polling github.
+//
+// The payloads are JSON, described by Schema, and signed like github webhooks:
+// the X-Release-Bot-Signature-256 header is "sha256=<hex hmac>" of the body
+// with the secret of the webhook.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/sniperkit/snk.fork.release-git-bot/clock"
+)
+
+// The headers of the deliveries.
+const (
+	EventHeader     = "X-Release-Bot-Event"
+	DeliveryHeader  = "X-Release-Bot-Delivery"
+	SignatureHeader = "X-Release-Bot-Signature-256"
+)
+
+// The events.
+const (
+	// ReleasePublished is the event of a published release.
+	ReleasePublished = "release.published"
+	// ReleasePromoted is the event of a release promoted to a channel, e.g.
+	// from beta to stable.
+	ReleasePromoted = "release.promoted"
+)
+
+// SchemaVersion is the version of the payload schema. It changes only when
+// fields are removed or change meaning, new fields may be added anytime.
+const SchemaVersion = "v1"
+
+// Payload is the body of a delivery, see Schema.
+type Payload struct {
+	// Schema is SchemaVersion.
+	Schema string `json:"schema"`
+	// Event is e.g. ReleasePublished.
+	Event string `json:"event"`
+	// Repo is the repo released, in the format of owner/repo.
+	Repo string `json:"repo"`
+	// Version is the released version, e.g. "1.14.0", and Tag its git tag.
+	Version string `json:"version"`
+	Tag     string `json:"tag"`
+	// Commit is the SHA of the tagged commit.
+	Commit string `json:"commit"`
+	// URL is the github release page.
+	URL         string    `json:"url"`
+	Prerelease  bool      `json:"prerelease"`
+	PublishedAt time.Time `json:"published_at"`
+	// Notes are the release notes, in markdown.
+	Notes  string   `json:"notes"`
+	Assets []*Asset `json:"assets"`
+	// Channel is the channel the release is promoted to, for
+	// ReleasePromoted.
+	Channel string `json:"channel,omitempty"`
+}
+
+// Asset is a file attached to the release.
+type Asset struct {
+	Name        string `json:"name"`
+	URL         string `json:"url"`
+	Size        int    `json:"size"`
+	ContentType string `json:"content_type,omitempty"`
+}
+
+// Schema is the JSON Schema (draft 2020-12, also an OpenAPI 3.1 schema
+// object) of Payload.
+const Schema = `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "$id": "https://github.com/sniperkit/snk.fork.release-git-bot/notify/v1.json",
+  "title": "Release bot event",
+  "type": "object",
+  "required": ["schema", "event", "repo", "version", "tag", "commit", "url", "prerelease", "published_at", "notes", "assets"],
+  "properties": {
+    "schema": {"const": "v1"},
+    "event": {"type": "string", "enum": ["release.published", "release.promoted"]},
+    "repo": {"type": "string", "description": "owner/repo", "pattern": "^[^/]+/[^/]+$"},
+    "version": {"type": "string", "examples": ["1.14.0"]},
+    "tag": {"type": "string", "examples": ["v1.14.0"]},
+    "commit": {"type": "string", "description": "the SHA of the tagged commit", "pattern": "^[0-9a-f]{40}$"},
+    "url": {"type": "string", "format": "uri", "description": "the github release page"},
+    "prerelease": {"type": "boolean"},
+    "published_at": {"type": "string", "format": "date-time"},
+    "notes": {"type": "string", "description": "the release notes, in markdown"},
+    "assets": {
+      "type": ["array", "null"],
+      "items": {
+        "type": "object",
+        "required": ["name", "url", "size"],
+        "properties": {
+          "name": {"type": "string"},
+          "url": {"type": "string", "format": "uri", "description": "the download url"},
+          "size": {"type": "integer", "minimum": 0},
+          "content_type": {"type": "string"}
+        }
+      }
+    },
+    "channel": {"type": "string", "description": "the channel the release is promoted to, for release.promoted", "examples": ["stable"]}
+  }
+}
+`
+
+// Webhook is where the payloads are posted.
+type Webhook struct {
+	URL string
+	// Secret signs the payloads. If empty, they are not signed.
+	Secret string
+}
+
+// maxAttempts is the number of attempts of a delivery failing with a 5xx
+// response or a network error.
+const maxAttempts = 3
+
+// Sender posts the payloads.
+type Sender struct {
+	// Client is the http client of the deliveries. If nil, it's
+	// http.DefaultClient.
+	Client *http.Client
+	// Clock is the time of the retries. If nil, it's clock.Real.
+	Clock clock.Clock
+}
+
+// Send posts p to the webhook. The delivery id is derived from the repo, tag
+// and event, so redeliveries (e.g. when a release is resumed) can be
+// deduplicated by the receivers. Deliveries failing with a 5xx response or a
+// network error are retried.
+func (s *Sender) Send(ctx context.Context, w *Webhook, p *Payload) error {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	hc := s.Client
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	for attempt := 1; ; attempt++ {
+		retry, err := s.post(ctx, hc, w, p, body)
+		if err == nil || !retry || attempt == maxAttempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-clock.Or(s.Clock).After(time.Duration(attempt) * time.Second):
+		}
+	}
+}
+
+// post makes one attempt of the delivery. It returns whether a failure is
+// worth retrying.
+func (s *Sender) post(ctx context.Context, hc *http.Client, w *Webhook, p *Payload, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "release-git-bot")
+	req.Header.Set(EventHeader, p.Event)
+	req.Header.Set(DeliveryHeader, DeliveryID(p))
+	if w.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(body, w.Secret))
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, fmt.Errorf("failed to post to %v: %v", req.URL.Host, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return resp.StatusCode >= 500, fmt.Errorf("%v answered %v: %s", req.URL.Host, resp.Status, bytes.TrimSpace(msg))
+	}
+	return false, nil
+}
+
+// DeliveryID returns the id of the delivery of p, the same for all its
+// attempts and redeliveries.
+func DeliveryID(p *Payload) string {
+	key := p.Event + "\x00" + p.Repo + "\x00" + p.Tag
+	if p.Channel != "" {
+		key += "\x00" + p.Channel
+	}
+	h := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(h[:16])
+}
+
+// Sign returns the signature header of the body, "sha256=<hex hmac>".
+func Sign(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,43 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// PostSlack posts the message to a Slack incoming webhook. The text is in
+// Slack's mrkdwn, e.g. "<url|link text>". If hc is nil, it's
+// http.DefaultClient.
+func PostSlack(ctx context.Context, hc *http.Client, url, text string) error {
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post to slack: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("slack answered %v: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
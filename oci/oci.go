@@ -0,0 +1,113 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+// Package oci tags release container images with OCI annotations derived from
+// the release.
+//
+// Images are pushed and inspected with "docker buildx imagetools", so the
+// docker CLI with buildx must be installed and logged in to the registries.
+package oci
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// The annotation keys defined by the OCI image spec.
+const (
+	AnnotationVersion  = "org.opencontainers.image.version"
+	AnnotationRevision = "org.opencontainers.image.revision"
+	AnnotationSource   = "org.opencontainers.image.source"
+	AnnotationURL      = "org.opencontainers.image.url"
+	AnnotationCreated  = "org.opencontainers.image.created"
+)
+
+// Release contains the info of the release the image is built for.
+type Release struct {
+	// Version is the release tag, e.g. v1.14.0.
+	Version string
+	// Revision is the commit SHA the release tag points to.
+	Revision string
+	// SourceURL is the url of the github repo.
+	SourceURL string
+	// HTMLURL is the url of the release page.
+	HTMLURL string
+	// Created is the time the release was published.
+	Created time.Time
+}
+
+// Annotations returns the OCI annotations for the release, merged with extra.
+// Annotations in extra don't override the generated ones.
+func Annotations(r *Release, extra map[string]string) map[string]string {
+	ret := make(map[string]string)
+	for k, v := range extra {
+		ret[k] = v
+	}
+	ret[AnnotationVersion] = r.Version
+	ret[AnnotationRevision] = r.Revision
+	ret[AnnotationSource] = r.SourceURL
+	ret[AnnotationURL] = r.HTMLURL
+	ret[AnnotationCreated] = r.Created.UTC().Format(time.RFC3339)
+	return ret
+}
+
+// Push creates the tags for source in repository with the annotations, and
+// pushes them.
+//
+// The annotations are set on the image index, so they apply to all platforms.
+func Push(source, repository string, tags []string, annotations map[string]string) error {
+	args := []string{"buildx", "imagetools", "create"}
+	for _, k := range sortedKeys(annotations) {
+		args = append(args, "--annotation", fmt.Sprintf("index:%v=%v", k, annotations[k]))
+	}
+	for _, t := range tags {
+		args = append(args, "--tag", repository+":"+t)
+	}
+	args = append(args, source)
+	log.Infof("executing %q", "docker "+strings.Join(args, " "))
+	if out, err := exec.Command("docker", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to push %v: %v\n%s", repository, err, out)
+	}
+	return nil
+}
+
+// Verify fetches the manifest of the pushed image ref, and checks that it has
+// all the annotations.
+func Verify(ref string, annotations map[string]string) error {
+	log.Infof("executing %q", "docker buildx imagetools inspect --raw "+ref)
+	out, err := exec.Command("docker", "buildx", "imagetools", "inspect", "--raw", ref).Output()
+	if err != nil {
+		return fmt.Errorf("failed to inspect %v: %v", ref, err)
+	}
+	var manifest struct {
+		Annotations map[string]string `json:"annotations"`
+	}
+	if err := json.Unmarshal(out, &manifest); err != nil {
+		return fmt.Errorf("failed to parse manifest of %v: %v", ref, err)
+	}
+	var mismatch []string
+	for _, k := range sortedKeys(annotations) {
+		if got := manifest.Annotations[k]; got != annotations[k] {
+			mismatch = append(mismatch, fmt.Sprintf("%v: got %q, want %q", k, got, annotations[k]))
+		}
+	}
+	if len(mismatch) > 0 {
+		return fmt.Errorf("annotations mismatch on %v:\n%v", ref, strings.Join(mismatch, "\n"))
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,111 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/sniperkit/snk.fork.release-git-bot/config"
+)
+
+// repoOverview is the release status of one repo in the org report.
+type repoOverview struct {
+	Repo          string     `json:"repo"`
+	LatestRelease string     `json:"latest_release,omitempty"`
+	PublishedAt   *time.Time `json:"published_at,omitempty"`
+	// DaysSinceRelease is -1 if the repo has no release.
+	DaysSinceRelease int                  `json:"days_since_release"`
+	Milestones       []*milestoneProgress `json:"open_milestones"`
+}
+
+type milestoneProgress struct {
+	Title  string     `json:"title"`
+	Open   int        `json:"open"`
+	Closed int        `json:"closed"`
+	DueOn  *time.Time `json:"due_on,omitempty"`
+}
+
+func (m *milestoneProgress) String() string {
+	total := m.Open + m.Closed
+	if total == 0 {
+		return fmt.Sprintf("%v (empty)", m.Title)
+	}
+	return fmt.Sprintf("%v %v/%v (%v%%)", m.Title, m.Closed, total, m.Closed*100/total)
+}
+
+func runOrg(cfg *config.Config, args []string) error {
+	fs := newFlagSet("org")
+	org := fs.String("org", upstreamUser, "the github org")
+	team := fs.String("team", "", "only include the repos of this team (slug)")
+	topic := fs.String("topic", "", "only include the repos with this topic")
+	format := fs.String("format", "table", "output format, table, markdown or json")
+	fs.Parse(args)
+
+	repos, err := newClient(*org, "").ListOrgReposContext(runCtx, *team, *topic)
+	if err != nil {
+		return fmt.Errorf("failed to list repos: %v", err)
+	}
+
+	now := botClock.Now()
+	var overviews []*repoOverview
+	for _, r := range repos {
+		c := newClient(*org, r.GetName())
+		o := &repoOverview{Repo: r.GetFullName(), DaysSinceRelease: -1}
+		// A 404 means there's no release.
+		if release, err := c.GetLatestReleaseContext(runCtx); err == nil {
+			t := release.GetPublishedAt().Time
+			o.LatestRelease = release.GetTagName()
+			o.PublishedAt = &t
+			o.DaysSinceRelease = int(now.Sub(t).Hours() / 24)
+		}
+		milestones, err := c.GetOpenMilestonesContext(runCtx)
+		if err != nil {
+			return fmt.Errorf("failed to get milestones of %v: %v", r.GetFullName(), err)
+		}
+		for _, m := range milestones {
+			o.Milestones = append(o.Milestones, &milestoneProgress{
+				Title:  m.GetTitle(),
+				Open:   m.GetOpenIssues(),
+				Closed: m.GetClosedIssues(),
+				DueOn:  m.DueOn,
+			})
+		}
+		overviews = append(overviews, o)
+	}
+	// Repos that haven't released for the longest time first.
+	sort.SliceStable(overviews, func(i, j int) bool {
+		return overviews[i].DaysSinceRelease > overviews[j].DaysSinceRelease
+	})
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(overviews)
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	if *format == "markdown" {
+		table.SetBorders(tablewriter.Border{Left: true, Top: false, Right: true, Bottom: false})
+		table.SetCenterSeparator("|")
+	}
+	table.SetHeader([]string{"repo", "latest release", "days since release", "open milestones"})
+	for _, o := range overviews {
+		days := "-"
+		if o.DaysSinceRelease >= 0 {
+			days = fmt.Sprint(o.DaysSinceRelease)
+		}
+		var ms []string
+		for _, m := range o.Milestones {
+			ms = append(ms, m.String())
+		}
+		table.Append([]string{o.Repo, o.LatestRelease, days, strings.Join(ms, "; ")})
+	}
+	table.Render()
+	return nil
+}
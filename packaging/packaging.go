@@ -0,0 +1,172 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+// Package packaging builds .deb and .rpm packages from built binaries with
+// nfpm.
+//
+// nfpm (https://nfpm.goreleaser.com) must be installed and in PATH.
+package packaging
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/sniperkit/snk.fork.release-git-bot/config"
+	"github.com/sniperkit/snk.fork.release-git-bot/notes"
+	yaml "gopkg.in/yaml.v2"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// nfpmConfig is the subset of the nfpm config file used by the bot.
+type nfpmConfig struct {
+	Name        string                   `yaml:"name"`
+	Arch        string                   `yaml:"arch"`
+	Platform    string                   `yaml:"platform"`
+	Version     string                   `yaml:"version"`
+	Release     string                   `yaml:"release"`
+	Maintainer  string                   `yaml:"maintainer,omitempty"`
+	Description string                   `yaml:"description,omitempty"`
+	Vendor      string                   `yaml:"vendor,omitempty"`
+	Homepage    string                   `yaml:"homepage,omitempty"`
+	License     string                   `yaml:"license,omitempty"`
+	Changelog   string                   `yaml:"changelog,omitempty"`
+	Depends     []string                 `yaml:"depends,omitempty"`
+	Contents    []*config.PackageContent `yaml:"contents"`
+}
+
+// changelogEntry is one version in the chglog format used by nfpm.
+type changelogEntry struct {
+	Semver   string           `yaml:"semver"`
+	Date     time.Time        `yaml:"date"`
+	Packager string           `yaml:"packager"`
+	Changes  []*changelogNote `yaml:"changes"`
+}
+
+type changelogNote struct {
+	Note string `yaml:"note"`
+}
+
+// rpmArch maps GOARCH to the rpm arch names, used in the rpm file name.
+var rpmArch = map[string]string{
+	"amd64": "x86_64",
+	"arm64": "aarch64",
+	"386":   "i386",
+}
+
+// Build builds the packages in all the configured formats into outDir, and
+// returns the paths of the built files.
+//
+// version is the version without the "v" prefix. The changelog embedded in the
+// packages is generated from ns.
+func Build(c *config.Package, version string, ns *notes.Notes, outDir string) ([]string, error) {
+	if _, err := exec.LookPath("nfpm"); err != nil {
+		return nil, fmt.Errorf("nfpm not found in PATH: %v", err)
+	}
+	tmpDir, err := ioutil.TempDir("", "release-git-bot-packaging")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	changelogPath := filepath.Join(tmpDir, "changelog.yml")
+	if err := writeYAML(changelogPath, changelog(c, version, ns)); err != nil {
+		return nil, fmt.Errorf("failed to write changelog: %v", err)
+	}
+	configPath := filepath.Join(tmpDir, "nfpm.yml")
+	if err := writeYAML(configPath, &nfpmConfig{
+		Name:        c.Name,
+		Arch:        c.Arch,
+		Platform:    "linux",
+		Version:     version,
+		Release:     "1",
+		Maintainer:  c.Maintainer,
+		Description: c.Description,
+		Vendor:      c.Vendor,
+		Homepage:    c.Homepage,
+		License:     c.License,
+		Changelog:   changelogPath,
+		Depends:     c.Depends,
+		Contents:    c.Contents,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to write nfpm config: %v", err)
+	}
+
+	var ret []string
+	for _, format := range c.Formats {
+		var name string
+		switch format {
+		case "deb":
+			name = fmt.Sprintf("%v_%v_%v.deb", c.Name, version, c.Arch)
+		case "rpm":
+			arch, ok := rpmArch[c.Arch]
+			if !ok {
+				arch = c.Arch
+			}
+			name = fmt.Sprintf("%v-%v-1.%v.rpm", c.Name, version, arch)
+		default:
+			return nil, fmt.Errorf("unknown package format %q", format)
+		}
+		target := filepath.Join(outDir, name)
+		log.Infof("executing %q", "nfpm pkg --packager "+format+" --target "+target)
+		cmd := exec.Command("nfpm", "pkg", "--config", configPath, "--packager", format, "--target", target)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("failed to build %v: %v\n%s", name, err, out)
+		}
+		ret = append(ret, target)
+	}
+	return ret, nil
+}
+
+// changelog converts the release notes into a one version changelog.
+func changelog(c *config.Package, version string, ns *notes.Notes) []*changelogEntry {
+	e := &changelogEntry{
+		Semver:   version,
+		Date:     ns.Date,
+		Packager: c.Maintainer,
+	}
+	if e.Date.IsZero() {
+		e.Date = time.Now().UTC()
+	}
+	for _, section := range ns.Sections {
+		for _, entry := range section.Entries {
+			note := fmt.Sprintf("%v: %v (#%v)", section.Name, entry.Title, entry.IssueNumber)
+			if author := authorString(entry.User); author != "" {
+				note += " - " + author
+			}
+			e.Changes = append(e.Changes, &changelogNote{Note: note})
+		}
+	}
+	if len(e.Changes) == 0 {
+		e.Changes = append(e.Changes, &changelogNote{Note: "Release " + version})
+	}
+	return []*changelogEntry{e}
+}
+
+func writeYAML(path string, v interface{}) error {
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0644)
+}
+
+// authorString returns "Name <email>" of the user, as much of it as is known.
+func authorString(u *notes.User) string {
+	if u == nil {
+		return ""
+	}
+	switch {
+	case u.Name != "" && u.Email != "":
+		return fmt.Sprintf("%v <%v>", u.Name, u.Email)
+	case u.Name != "":
+		return u.Name
+	case u.Email != "":
+		return "<" + u.Email + ">"
+	}
+	return ""
+}
@@ -0,0 +1,112 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/google/go-github/github"
+	"github.com/sniperkit/snk.fork.release-git-bot/config"
+	"github.com/sniperkit/snk.fork.release-git-bot/ghclient"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Defaults of the release notes archive.
+const (
+	defaultPagesBranch = "gh-pages"
+	defaultPagesDir    = "releases"
+)
+
+func runPages(cfg *config.Config, args []string) error {
+	fs := newFlagSet("pages")
+	fs.Parse(args)
+	if cfg.Pages == nil {
+		return fmt.Errorf("no pages in the config, there's no archive to rebuild")
+	}
+	upstream := newClient(upstreamUser, *repo)
+	return updateArchive(cfg.Pages, upstream, "")
+}
+
+// updateArchive commits the index of the release notes archive, and the page
+// of the release tag, or of all the releases if tag is empty, in one commit.
+func updateArchive(p *config.Pages, upstream *ghclient.Client, tag string) error {
+	branch, dir := p.Branch, p.Dir
+	if branch == "" {
+		branch = defaultPagesBranch
+	}
+	if dir == "" {
+		dir = defaultPagesDir
+	}
+	all, err := upstream.ListReleasesContext(runCtx)
+	if err != nil {
+		return fmt.Errorf("failed to list releases: %v", err)
+	}
+	var releases []*github.RepositoryRelease
+	for _, r := range all {
+		if !r.GetDraft() && (p.Prereleases || !r.GetPrerelease()) {
+			releases = append(releases, r)
+		}
+	}
+	sort.SliceStable(releases, func(i, j int) bool {
+		return releases[i].GetPublishedAt().After(releases[j].GetPublishedAt().Time)
+	})
+
+	files := map[string][]byte{
+		path.Join(dir, "index.md"): archiveIndex(upstream, releases),
+	}
+	for _, r := range releases {
+		if tag == "" || r.GetTagName() == tag {
+			files[path.Join(dir, r.GetTagName()+".md")] = archivePage(r)
+		}
+	}
+	if tag != "" && len(files) == 1 {
+		log.Warningf("release %v is not published, or is a pre-release, only the archive index is updated", tag)
+	}
+	msg := "Update the release notes archive"
+	if tag != "" {
+		msg = fmt.Sprintf("Add the notes of %v to the release archive", tag)
+	}
+	cmt, err := upstream.CommitFilesContext(runCtx, branch, msg, files)
+	if err != nil {
+		return fmt.Errorf("failed to update the release archive: %v", err)
+	}
+	fmt.Printf("Release archive updated in %v/%v, commit %v: %v pages\n", branch, dir, cmt.GetSHA(), len(files)-1)
+	return nil
+}
+
+// archiveIndex returns the index page of the archive, listing the releases
+// newest first.
+func archiveIndex(c *ghclient.Client, releases []*github.RepositoryRelease) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "---\ntitle: %v/%v releases\n---\n\n", c.Owner(), c.Repo())
+	fmt.Fprintf(&b, "# %v/%v releases\n\n", c.Owner(), c.Repo())
+	fmt.Fprintf(&b, "| Release | Date |\n|---|---|\n")
+	for _, r := range releases {
+		name := r.GetTagName()
+		if r.GetPrerelease() {
+			name += " (pre-release)"
+		}
+		fmt.Fprintf(&b, "| [%v](%v.md) | %v |\n", name, r.GetTagName(), formatDate(r.GetPublishedAt().Time))
+	}
+	return b.Bytes()
+}
+
+// archivePage returns the page of the release, with its notes.
+func archivePage(r *github.RepositoryRelease) []byte {
+	var b bytes.Buffer
+	title := r.GetName()
+	if title == "" {
+		title = r.GetTagName()
+	}
+	fmt.Fprintf(&b, "---\ntitle: %q\n---\n\n", title)
+	fmt.Fprintf(&b, "# %v\n\n", title)
+	fmt.Fprintf(&b, "Released %v, [on GitHub](%v). [All releases](index.md)\n\n", formatDate(r.GetPublishedAt().Time), r.GetHTMLURL())
+	b.WriteString(r.GetBody())
+	b.WriteString("\n")
+	return b.Bytes()
+}
@@ -0,0 +1,155 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/sniperkit/snk.fork.release-git-bot/config"
+	"github.com/sniperkit/snk.fork.release-git-bot/features"
+	"github.com/sniperkit/snk.fork.release-git-bot/state"
+)
+
+// pipelineStep is a step of the release flow. Gates are the steps waiting for
+// a human (e.g. merging a PR).
+type pipelineStep struct {
+	name string
+	gate bool
+}
+
+// releasePipeline returns the steps of the release flow for the config, in
+// order. The names are the step names in main, as checkpointed in the state.
+func releasePipeline(cfg *config.Config) []pipelineStep {
+	steps := []pipelineStep{{name: "step 1: create release branch"}}
+	if cfg.BranchCut != nil && cfg.BranchCut.RetargetLabel != "" {
+		steps = append(steps, pipelineStep{name: "retarget PRs to release branch"})
+	}
+	if cfg.BranchCut != nil {
+		steps = append(steps, pipelineStep{name: "announce branch cut"})
+	}
+	if cfg.Milestones != nil && cfg.Milestones.OpenNext {
+		steps = append(steps, pipelineStep{name: "open next milestone"})
+	}
+	steps = append(steps,
+		pipelineStep{name: "step 2: change version on release branch"},
+		pipelineStep{name: "wait for version PR merged", gate: versionPRMergeMethod() == ""},
+		pipelineStep{name: "step 3: create draft release"},
+		pipelineStep{name: "wait for release published", gate: !featureFlags.Enabled(features.AutoPublish)},
+	)
+	if len(cfg.Images) > 0 {
+		steps = append(steps, pipelineStep{name: "push release images"})
+	}
+	if len(cfg.Publishers) > 0 {
+		steps = append(steps, pipelineStep{name: "update package manager manifests"})
+	}
+	if cfg.RepoMetadata != nil {
+		steps = append(steps, pipelineStep{name: "update repo metadata"})
+	}
+	if cfg.Milestones != nil && cfg.Milestones.Close {
+		steps = append(steps, pipelineStep{name: "close milestone"})
+	}
+	if len(cfg.Webhooks) > 0 {
+		steps = append(steps, pipelineStep{name: "notify webhooks"})
+	}
+	if cfg.Pages != nil {
+		steps = append(steps, pipelineStep{name: "update release archive"})
+	}
+	if cfg.ReleasedComment != nil {
+		steps = append(steps, pipelineStep{name: "comment released PRs"})
+	}
+	return append(steps,
+		pipelineStep{name: "step 4: change version to patch dev on release branch"},
+		pipelineStep{name: "step 5: change version to minor dev on master"},
+	)
+}
+
+// Step statuses in the diagram.
+const (
+	stepDone    = "done"
+	stepCurrent = "current"
+	stepPending = "pending"
+)
+
+// stepStatuses returns the status of each step: done if it's checkpointed in
+// st, current for the first step not done, and pending for the rest.
+func stepStatuses(steps []pipelineStep, st *state.State) []string {
+	ret := make([]string, len(steps))
+	current := false
+	for i, s := range steps {
+		switch {
+		case st.IsDone(s.name):
+			ret[i] = stepDone
+		case !current:
+			ret[i], current = stepCurrent, true
+		default:
+			ret[i] = stepPending
+		}
+	}
+	return ret
+}
+
+// pipelineDiagram renders the steps and their status in st as a "mermaid"
+// flowchart (rendered by github in issue comments) or a graphviz "dot" graph.
+func pipelineDiagram(steps []pipelineStep, st *state.State, format string) (string, error) {
+	statuses := stepStatuses(steps, st)
+	var b bytes.Buffer
+	switch format {
+	case "mermaid":
+		b.WriteString("flowchart TD\n")
+		for i, s := range steps {
+			label := strings.Replace(s.name, `"`, "#quot;", -1)
+			if s.gate {
+				fmt.Fprintf(&b, "  s%v{{\"%v\"}}:::%v\n", i, label, statuses[i])
+			} else {
+				fmt.Fprintf(&b, "  s%v[\"%v\"]:::%v\n", i, label, statuses[i])
+			}
+			if i > 0 {
+				fmt.Fprintf(&b, "  s%v --> s%v\n", i-1, i)
+			}
+		}
+		b.WriteString("  classDef done fill:#d4f7d4,stroke:#2da44e\n")
+		b.WriteString("  classDef current fill:#fff3c4,stroke:#bf8700\n")
+		b.WriteString("  classDef pending fill:#f6f8fa,stroke:#8c959f\n")
+	case "dot":
+		colors := map[string]string{stepDone: "#d4f7d4", stepCurrent: "#fff3c4", stepPending: "#f6f8fa"}
+		b.WriteString("digraph release {\n  node [style=filled];\n")
+		for i, s := range steps {
+			shape := "box"
+			if s.gate {
+				shape = "hexagon"
+			}
+			fmt.Fprintf(&b, "  s%v [label=%q, shape=%v, fillcolor=%q];\n", i, s.name, shape, colors[statuses[i]])
+			if i > 0 {
+				fmt.Fprintf(&b, "  s%v -> s%v;\n", i-1, i)
+			}
+		}
+		b.WriteString("}\n")
+	default:
+		return "", fmt.Errorf("unknown diagram format %q, must be mermaid or dot", format)
+	}
+	return b.String(), nil
+}
+
+func runPipeline(cfg *config.Config, args []string) error {
+	fs := newFlagSet("pipeline")
+	format := fs.String("format", "mermaid", "the diagram format, mermaid or dot")
+	fs.Parse(args)
+
+	ver, err := versionScheme.Parse(*newVersion)
+	if err != nil {
+		return fmt.Errorf("invalid version string %q: %v", *newVersion, err)
+	}
+	st, err := state.Load(stateFilePath(ver), upstreamUser+"/"+*repo, ver.String(), stateKey)
+	if err != nil {
+		return err
+	}
+	d, err := pipelineDiagram(releasePipeline(cfg), st, *format)
+	if err != nil {
+		return err
+	}
+	fmt.Print(d)
+	return nil
+}
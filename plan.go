@@ -0,0 +1,120 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sniperkit/snk.fork.release-git-bot/config"
+	"github.com/sniperkit/snk.fork.release-git-bot/ghclient"
+	"github.com/sniperkit/snk.fork.release-git-bot/policy"
+	"github.com/sniperkit/snk.fork.release-git-bot/version"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// releasePlan returns the changes the release is going to make, in order.
+func releasePlan(cfg *config.Config, ver *version.Version, mainline, login string) *policy.Plan {
+	upstream := upstreamUser + "/" + *repo
+	forkOwner, forkRepo := forkOf(login)
+	fork := forkOwner + "/" + forkRepo
+	p := &policy.Plan{
+		Repo:          upstream,
+		Version:       ver.String(),
+		Tag:           ver.Tag(),
+		ReleaseBranch: ver.Branch(),
+		Mainline:      mainline,
+	}
+	add := func(kind, repo, target string) {
+		p.Operations = append(p.Operations, &policy.Operation{Kind: kind, Repo: repo, Target: target})
+	}
+	versionPR := func(v, base string) {
+		add(policy.Push, fork, fmt.Sprintf("release_version_%v", v))
+		add(policy.CreatePR, upstream, base)
+	}
+
+	add(policy.CreateBranch, upstream, ver.Branch())
+	for _, m := range cfg.MirrorBranches {
+		add(policy.CreateBranch, upstream, versionReplacer(ver).Replace(m))
+	}
+	if cfg.BranchCut != nil && cfg.BranchCut.RetargetLabel != "" {
+		add(policy.RetargetPR, upstream, ver.Branch())
+	}
+	if cfg.BranchCut != nil {
+		add(policy.Comment, upstream, ver.Milestone())
+	}
+	if cfg.Milestones != nil && cfg.Milestones.OpenNext {
+		add(policy.EditMilestone, upstream, ver.NextLine().Milestone())
+	}
+	versionPR(ver.String(), ver.Branch())
+	if cfg.NotesReview != nil {
+		if cfg.NotesReview.GoogleDocs == nil {
+			add(policy.Gist, "", "")
+		}
+		if n := notesReviewIssue(cfg.NotesReview); n != 0 {
+			add(policy.Comment, upstream, fmt.Sprintf("#%v", n))
+		}
+	}
+	if *tagKind != "" {
+		add(policy.CreateTag, upstream, ver.Tag())
+	}
+	add(policy.CreateRelease, upstream, ver.Tag())
+	if len(cfg.Packages) > 0 {
+		add(policy.UploadAsset, upstream, ver.Tag())
+	}
+	add(policy.PublishRelease, upstream, ver.Tag())
+	for _, pc := range cfg.Publishers {
+		i := strings.LastIndex(pc.Repo, "/")
+		name := pc.Repo[i+1:]
+		add(policy.Push, login+"/"+name, fmt.Sprintf("%v_%v_%v", pc.Kind, pc.Name, ver.String()))
+		if i > 0 {
+			add(policy.CreatePR, pc.Repo, defaultBranch(pc.Repo[:i], name))
+		}
+	}
+	if cfg.RepoMetadata != nil {
+		add(policy.EditRepo, upstream, "")
+	}
+	if cfg.Milestones != nil && cfg.Milestones.Close {
+		add(policy.EditMilestone, upstream, ver.Milestone())
+		// The open issues and PRs are moved to the next milestone.
+		add(policy.Comment, upstream, ver.Milestone())
+	}
+	if cfg.ReleasedComment != nil {
+		add(policy.Comment, upstream, ver.Milestone())
+	}
+	versionPR(fmt.Sprintf("%v-dev", ver.NextPatch()), ver.Branch())
+	versionPR(fmt.Sprintf("%v-dev", ver.NextLine()), mainline)
+	if *trackingIssue != 0 {
+		add(policy.Comment, upstream, fmt.Sprintf("#%v", *trackingIssue))
+	}
+	return p
+}
+
+// checkPlan exits if the OPA policies in the config deny the plan.
+func checkPlan(c *config.OPA, upstream *ghclient.Client, plan *policy.Plan) {
+	o, err := policy.NewOPA(c)
+	if err != nil {
+		log.Fatalf("invalid opa config: %v", err)
+	}
+	if o == nil {
+		return
+	}
+	r, err := upstream.GetRepoContext(runCtx)
+	if err != nil {
+		log.Fatalf("failed to get repo metadata for the policies: %v", err)
+	}
+	deny, err := o.Deny(&policy.Input{Plan: plan, Repo: r})
+	if err != nil {
+		log.Fatalf("failed to evaluate the release plan: %v", err)
+	}
+	if len(deny) > 0 {
+		fmt.Println("The release plan is denied by the policies:")
+		for _, d := range deny {
+			fmt.Println("  -", d)
+		}
+		log.Fatal("release plan denied")
+	}
+	fmt.Printf("The release plan (%v operations) is allowed by the policies\n\n", len(plan.Operations))
+}
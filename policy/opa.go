@@ -0,0 +1,178 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strings"
+
+	"github.com/sniperkit/snk.fork.release-git-bot/config"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultQuery is the rule returning the deny messages.
+const DefaultQuery = "data.release.deny"
+
+// Plan is what a release run is going to do, evaluated by the OPA policies
+// before anything is changed.
+type Plan struct {
+	Repo          string `json:"repo"`
+	Version       string `json:"version"`
+	Tag           string `json:"tag"`
+	ReleaseBranch string `json:"release_branch"`
+	Mainline      string `json:"mainline"`
+	// Operations are the changes in the order they will be made.
+	Operations []*Operation `json:"operations"`
+}
+
+// Input is the input document of the OPA policies.
+type Input struct {
+	Plan *Plan `json:"plan"`
+	// Repo is the repo metadata returned by the github API.
+	Repo interface{} `json:"repo"`
+}
+
+// OPA evaluates plans against OPA/Rego policies, with an OPA server or the opa
+// CLI. A nil OPA denies nothing.
+type OPA struct {
+	c  *config.OPA
+	hc *http.Client
+}
+
+// NewOPA creates an OPA for the config. It returns nil if c is nil.
+func NewOPA(c *config.OPA) (*OPA, error) {
+	if c == nil {
+		return nil, nil
+	}
+	if c.URL == "" && len(c.Policies) == 0 {
+		return nil, fmt.Errorf("opa config has neither url nor policies")
+	}
+	if c.URL == "" {
+		if _, err := exec.LookPath("opa"); err != nil {
+			return nil, fmt.Errorf("opa not found in PATH: %v", err)
+		}
+	}
+	return &OPA{c: c, hc: http.DefaultClient}, nil
+}
+
+func (o *OPA) query() string {
+	if o.c.Query != "" {
+		return o.c.Query
+	}
+	return DefaultQuery
+}
+
+// Deny evaluates the input, and returns the deny messages. The plan is allowed
+// if there's none.
+func (o *OPA) Deny(input *Input) ([]string, error) {
+	if o == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+	var result interface{}
+	if o.c.URL != "" {
+		result, err = o.evalServer(b)
+	} else {
+		result, err = o.evalCLI(b)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return denyMessages(result), nil
+}
+
+// evalServer evaluates the query with the OPA REST API.
+func (o *OPA) evalServer(input []byte) (interface{}, error) {
+	// data.release.deny is at /v1/data/release/deny.
+	path := strings.Replace(strings.TrimPrefix(o.query(), "data."), ".", "/", -1)
+	url := strings.TrimSuffix(o.c.URL, "/") + "/v1/data/" + path
+	body := append(append([]byte(`{"input":`), input...), '}')
+	log.Infof("evaluating %v with %v", o.query(), url)
+	resp, err := o.hc.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query opa: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to query opa: %v", resp.Status)
+	}
+	var ret struct {
+		// Result is missing if the rule is undefined.
+		Result interface{} `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&ret); err != nil {
+		return nil, fmt.Errorf("failed to parse opa response: %v", err)
+	}
+	return ret.Result, nil
+}
+
+// evalCLI evaluates the query with "opa eval".
+func (o *OPA) evalCLI(input []byte) (interface{}, error) {
+	args := []string{"eval", "--format", "json", "--stdin-input"}
+	for _, p := range o.c.Policies {
+		args = append(args, "--data", p)
+	}
+	args = append(args, o.query())
+	log.Infof("executing %q", "opa "+strings.Join(args, " "))
+	cmd := exec.Command("opa", args...)
+	cmd.Stdin = bytes.NewReader(input)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run opa eval: %v\n%s", err, stderr.Bytes())
+	}
+	var ret struct {
+		Result []struct {
+			Expressions []struct {
+				Value interface{} `json:"value"`
+			} `json:"expressions"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(out, &ret); err != nil {
+		return nil, fmt.Errorf("failed to parse opa eval output: %v", err)
+	}
+	if len(ret.Result) == 0 || len(ret.Result[0].Expressions) == 0 {
+		// Undefined.
+		return nil, nil
+	}
+	return ret.Result[0].Expressions[0].Value, nil
+}
+
+// denyMessages converts the result of the deny rule to messages. The rule is
+// usually a set of strings, but a boolean true or other values also deny.
+func denyMessages(result interface{}) []string {
+	switch r := result.(type) {
+	case nil:
+		return nil
+	case bool:
+		if r {
+			return []string{"denied by policy"}
+		}
+		return nil
+	case string:
+		return []string{r}
+	case []interface{}:
+		var ret []string
+		for _, m := range r {
+			if s, ok := m.(string); ok {
+				ret = append(ret, s)
+			} else {
+				b, _ := json.Marshal(m)
+				ret = append(ret, string(b))
+			}
+		}
+		return ret
+	}
+	b, _ := json.Marshal(result)
+	return []string{string(b)}
+}
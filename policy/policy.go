@@ -0,0 +1,146 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+// Package policy enforces the operations the bot is allowed to make. The
+// policy is checked before every mutation, regardless of the command line
+// flags.
+package policy
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/sniperkit/snk.fork.release-git-bot/config"
+)
+
+// The kinds of operations.
+const (
+	CreateBranch   = "create_branch"
+	CreateTag      = "create_tag"
+	UpdateRef      = "update_ref"
+	DeleteRef      = "delete_ref"
+	CreatePR       = "create_pr"
+	RetargetPR     = "retarget_pr"
+	CreateRelease  = "create_release"
+	PublishRelease = "publish_release"
+	UploadAsset    = "upload_asset"
+	Comment        = "comment"
+	EditRepo       = "edit_repo"
+	EditMilestone  = "edit_milestone"
+	Gist           = "gist"
+	Push           = "push"
+	// Other is any other mutation.
+	Other = "other"
+)
+
+var kinds = map[string]bool{
+	CreateBranch: true, CreateTag: true, UpdateRef: true, DeleteRef: true,
+	CreatePR: true, RetargetPR: true, CreateRelease: true, PublishRelease: true, UploadAsset: true,
+	Comment: true, EditRepo: true, EditMilestone: true, Gist: true, Push: true,
+	Other: true,
+}
+
+// Operation is a mutation the bot is about to make.
+type Operation struct {
+	// Kind is one of the kinds above.
+	Kind string `json:"kind"`
+	// Repo is the repo changed, in the format of owner/repo, empty for Gist.
+	Repo string `json:"repo"`
+	// Target is what's changed in the repo, e.g. the branch name for
+	// CreateBranch and Push, the ref for UpdateRef and DeleteRef, the base
+	// branch for CreatePR and RetargetPR, the tag for releases and the title (or number) for
+	// EditMilestone.
+	Target string `json:"target,omitempty"`
+
+	// Method and Path are the API request, empty for git operations.
+	Method string `json:"method,omitempty"`
+	Path   string `json:"path,omitempty"`
+}
+
+func (op *Operation) String() string {
+	if op.Repo == "" {
+		return strings.TrimSpace(op.Kind + " " + op.Target)
+	}
+	if op.Target == "" {
+		return fmt.Sprintf("%v on %v", op.Kind, op.Repo)
+	}
+	return fmt.Sprintf("%v %v on %v", op.Kind, op.Target, op.Repo)
+}
+
+// Violation is the error for an operation not allowed by the policy.
+type Violation struct {
+	Op     *Operation
+	Reason string
+}
+
+func (v *Violation) Error() string {
+	return fmt.Sprintf("policy doesn't allow %v: %v", v.Op, v.Reason)
+}
+
+// Engine checks the operations against the policy config. A nil Engine allows
+// everything.
+type Engine struct {
+	// Approve asks for the approval of an operation in RequireApproval. If
+	// nil, those operations are denied.
+	Approve func(op *Operation) bool
+
+	c *config.Policy
+}
+
+// New creates an Engine for the config. It returns nil if c is nil.
+func New(c *config.Policy) (*Engine, error) {
+	if c == nil {
+		return nil, nil
+	}
+	for _, list := range [][]string{c.Deny, c.RequireApproval} {
+		for _, k := range list {
+			if !kinds[k] {
+				return nil, fmt.Errorf("unknown operation %q in policy", k)
+			}
+		}
+	}
+	for _, b := range c.Branches {
+		if _, err := path.Match(b, ""); err != nil {
+			return nil, fmt.Errorf("invalid branch pattern %q in policy: %v", b, err)
+		}
+	}
+	return &Engine{c: c}, nil
+}
+
+// Check returns a *Violation if op is not allowed.
+func (e *Engine) Check(op *Operation) error {
+	if e == nil {
+		return nil
+	}
+	if contains(e.c.Deny, op.Kind) {
+		return &Violation{Op: op, Reason: op.Kind + " is denied"}
+	}
+	if op.Kind == CreateBranch && len(e.c.Branches) > 0 && !matchAny(e.c.Branches, op.Target) {
+		return &Violation{Op: op, Reason: fmt.Sprintf("branch doesn't match %q", e.c.Branches)}
+	}
+	if contains(e.c.RequireApproval, op.Kind) {
+		if e.Approve == nil || !e.Approve(op) {
+			return &Violation{Op: op, Reason: op.Kind + " requires approval"}
+		}
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAny(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, s); ok {
+			return true
+		}
+	}
+	return false
+}
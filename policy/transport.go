@@ -0,0 +1,143 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package policy
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/sniperkit/snk.fork.release-git-bot/ghclient"
+	"github.com/sniperkit/snk.fork.release-git-bot/refs"
+)
+
+// Client returns a copy of hc with a transport that checks every mutating
+// request (but not the GraphQL queries) against the policy, and fails the
+// request with a *Violation without sending it if it's not allowed. If hc is
+// nil, a new client with the default transport is returned.
+func (e *Engine) Client(hc *http.Client) *http.Client {
+	if e == nil {
+		return hc
+	}
+	var ret http.Client
+	if hc != nil {
+		ret = *hc
+	}
+	base := ret.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	ret.Transport = &transport{e: e, base: base}
+	return &ret
+}
+
+type transport struct {
+	e    *Engine
+	base http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch req.Method {
+	case http.MethodPost, http.MethodPatch, http.MethodPut, http.MethodDelete:
+	default:
+		return t.base.RoundTrip(req)
+	}
+	if ghclient.IsGraphQLQuery(req) {
+		// A POST, but only a read.
+		return t.base.RoundTrip(req)
+	}
+	if err := t.e.Check(Classify(req)); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
+
+// Classify returns the operation of a github API request.
+func Classify(req *http.Request) *Operation {
+	op := &Operation{Kind: Other, Method: req.Method, Path: req.URL.Path}
+	// The path is /repos/{owner}/{repo}/..., with an /api/v3 prefix on github
+	// enterprise.
+	parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	for i, p := range parts {
+		if p == "gists" && (i == 0 || parts[i-1] == "v3") {
+			op.Kind = Gist
+			op.Target = strings.Join(parts[i+1:], "/")
+			return op
+		}
+	}
+	for len(parts) > 0 && parts[0] != "repos" {
+		parts = parts[1:]
+	}
+	if len(parts) < 3 {
+		return op
+	}
+	op.Repo = parts[1] + "/" + parts[2]
+	rest := parts[3:]
+
+	var body struct {
+		Ref     string `json:"ref"`
+		Base    string `json:"base"`
+		TagName string `json:"tag_name"`
+		Title   string `json:"title"`
+		Draft   *bool  `json:"draft"`
+	}
+	if req.GetBody != nil {
+		if r, err := req.GetBody(); err == nil {
+			b, _ := ioutil.ReadAll(r)
+			r.Close()
+			json.Unmarshal(b, &body)
+		}
+	}
+
+	switch {
+	case len(rest) == 0 || (len(rest) == 1 && rest[0] == "topics"):
+		op.Kind = EditRepo
+	case len(rest) >= 2 && rest[0] == "git" && rest[1] == "refs":
+		ref := strings.Join(rest[2:], "/")
+		switch req.Method {
+		case http.MethodPost:
+			r, err := refs.Parse(body.Ref)
+			if err != nil {
+				op.Target = body.Ref
+				break
+			}
+			op.Target = r.Name()
+			if _, ok := r.(refs.TagRef); ok {
+				op.Kind = CreateTag
+			} else {
+				op.Kind = CreateBranch
+			}
+		case http.MethodDelete:
+			op.Kind, op.Target = DeleteRef, ref
+		default:
+			op.Kind, op.Target = UpdateRef, ref
+		}
+	case rest[0] == "pulls" && len(rest) == 1:
+		op.Kind, op.Target = CreatePR, body.Base
+	case rest[0] == "pulls" && len(rest) == 2 && body.Base != "":
+		op.Kind, op.Target = RetargetPR, body.Base
+	case rest[0] == "releases" && len(rest) >= 3 && rest[2] == "assets":
+		op.Kind = UploadAsset
+	case rest[0] == "releases":
+		op.Target = body.TagName
+		switch {
+		case body.Draft != nil && !*body.Draft:
+			op.Kind = PublishRelease
+		case req.Method == http.MethodPost:
+			op.Kind = CreateRelease
+		}
+	case rest[0] == "milestones":
+		op.Kind, op.Target = EditMilestone, body.Title
+		if op.Target == "" && len(rest) > 1 {
+			op.Target = rest[1]
+		}
+	case rest[0] == "issues" && len(rest) == 3 && rest[2] == "comments":
+		op.Kind, op.Target = Comment, "#"+rest[1]
+	}
+	return op
+}
@@ -0,0 +1,43 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package policy
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/sniperkit/snk.fork.release-git-bot/config"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestClientAllowsGraphQLQueries(t *testing.T) {
+	e, err := New(&config.Policy{Deny: []string{Other}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hc := e.Client(&http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Status: "200 OK", Body: http.NoBody}, nil
+	})})
+
+	for _, tc := range []struct {
+		body    string
+		allowed bool
+	}{
+		{`{"query": "query { viewer { login } }"}`, true},
+		{`{"query": "{ viewer { login } }"}`, true},
+		{`{"query": "mutation { addComment(input: {}) { clientMutationId } }"}`, false},
+	} {
+		resp, err := hc.Post("https://api.github.com/graphql", "application/json", strings.NewReader(tc.body))
+		if err == nil {
+			resp.Body.Close()
+		}
+		if allowed := err == nil; allowed != tc.allowed {
+			t.Errorf("Post(%v) allowed = %v (%v), want %v", tc.body, allowed, err, tc.allowed)
+		}
+	}
+}
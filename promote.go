@@ -0,0 +1,197 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/sniperkit/snk.fork.release-git-bot/config"
+	"github.com/sniperkit/snk.fork.release-git-bot/ghclient"
+	"github.com/sniperkit/snk.fork.release-git-bot/notify"
+	"github.com/sniperkit/snk.fork.release-git-bot/oci"
+	"github.com/sniperkit/snk.fork.release-git-bot/version"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// runPromote promotes the published release of -version to a channel of the
+// config, the one after its current channel by default. Nothing is rebuilt:
+// the tag of the channel is moved to the release, its images are tagged for the
+// channel, its pre-release mark follows the channel, and the announcement
+// targets of the channel are notified, with the asset location of the channel.
+// Rerunning it is safe.
+func runPromote(cfg *config.Config, args []string) error {
+	fs := newFlagSet("promote")
+	to := fs.String("to", "", "the channel to promote to, default to the channel after the current one of the release")
+	fs.Parse(args)
+	if len(cfg.Channels) == 0 {
+		return fmt.Errorf("no channels in the config")
+	}
+	ver, err := versionScheme.Parse(*newVersion)
+	if err != nil {
+		return fmt.Errorf("invalid -version %q: %v", *newVersion, err)
+	}
+
+	upstream := newClient(upstreamUser, *repo)
+	tag := ver.Tag()
+	release, err := upstream.GetReleaseByTagContext(runCtx, tag)
+	if err != nil {
+		return fmt.Errorf("failed to get release %v: %v", tag, err)
+	}
+	if release.GetDraft() {
+		return fmt.Errorf("release %v is a draft, publish it before promoting it", tag)
+	}
+	sha, err := upstream.GetCommitSHAContext(runCtx, tag)
+	if err != nil {
+		return fmt.Errorf("failed to get commit for tag %v: %v", tag, err)
+	}
+
+	cur := currentChannel(upstream, cfg.Channels, sha)
+	target := cur + 1
+	if *to != "" {
+		if target = channelIndex(cfg.Channels, *to); target < 0 {
+			return fmt.Errorf("unknown channel %q, the channels are %v", *to, strings.Join(channelNames(cfg.Channels), ", "))
+		}
+	}
+	switch {
+	case target >= len(cfg.Channels):
+		return fmt.Errorf("%v is already in the last channel, %v", tag, cfg.Channels[cur].Name)
+	case target < cur:
+		return fmt.Errorf("%v is already in %v, after %v", tag, cfg.Channels[cur].Name, cfg.Channels[target].Name)
+	case target > cur+1:
+		log.Warningf("%v skips the channels %v", tag, strings.Join(channelNames(cfg.Channels[cur+1:target]), ", "))
+	}
+	ch := cfg.Channels[target]
+	fmt.Printf("Promoting %v to %v\n", tag, ch.Name)
+	return promote(cfg.Images, upstream, ver, release, sha, ch)
+}
+
+// promote moves the release of ver at commit sha to the channel.
+func promote(images []*config.Image, upstream *ghclient.Client, ver *version.Version, release *github.RepositoryRelease, sha string, ch *config.Channel) error {
+	if err := upstream.SetTagContext(runCtx, channelTag(ch), sha); err != nil {
+		return fmt.Errorf("failed to move tag %v: %v", channelTag(ch), err)
+	}
+	fmt.Printf("Tag %v moved to %v\n", channelTag(ch), sha)
+
+	if release.GetPrerelease() != ch.Prerelease {
+		edited, err := upstream.EditReleaseContext(runCtx, release.GetID(), &github.RepositoryRelease{Prerelease: github.Bool(ch.Prerelease)})
+		if err != nil {
+			return fmt.Errorf("failed to edit release %v: %v", ver.Tag(), err)
+		}
+		release = edited
+		fmt.Printf("Release %v pre-release: %v\n", ver.Tag(), ch.Prerelease)
+	}
+
+	if len(ch.ImageTags) > 0 {
+		if *readOnly {
+			return fmt.Errorf("not tagging the images: %v", ghclient.ErrReadOnly)
+		}
+		r := versionReplacer(ver)
+		var tags []string
+		for _, t := range ch.ImageTags {
+			tags = append(tags, r.Replace(t))
+		}
+		for _, img := range images {
+			// The annotations are the same as on the release tag, the
+			// manifest is only tagged again.
+			annotations := oci.Annotations(ociRelease(upstream, release, sha), img.Annotations)
+			if err := oci.Push(img.Repository+":"+ver.Tag(), img.Repository, tags, annotations); err != nil {
+				return fmt.Errorf("failed to tag image: %v", err)
+			}
+			for _, t := range tags {
+				if err := oci.Verify(img.Repository+":"+t, annotations); err != nil {
+					return fmt.Errorf("failed to verify image: %v", err)
+				}
+			}
+			fmt.Printf("Image %v tagged %v\n", img.Repository, tags)
+		}
+	}
+
+	if len(ch.Webhooks) > 0 {
+		p, err := releasePayload(upstream, ver)
+		if err != nil {
+			return err
+		}
+		p.Event, p.Channel = notify.ReleasePromoted, ch.Name
+		if ch.AssetsURL != "" {
+			base := channelAssetsURL(ch, ver)
+			for _, a := range p.Assets {
+				a.URL = base + a.Name
+			}
+		}
+		if err := deliver(ch.Webhooks, p); err != nil {
+			return err
+		}
+	}
+	if ch.SlackWebhookEnv != "" {
+		if *readOnly {
+			return fmt.Errorf("not announcing the promotion on Slack: %v", ghclient.ErrReadOnly)
+		}
+		hook := os.Getenv(ch.SlackWebhookEnv)
+		if hook == "" {
+			log.Warningf("$%v is empty, the promotion is not announced on Slack", ch.SlackWebhookEnv)
+			return nil
+		}
+		text := fmt.Sprintf("<%v|%v/%v %v> is promoted to *%v*", release.GetHTMLURL(), upstream.Owner(), upstream.Repo(), ver.Tag(), ch.Name)
+		if ch.AssetsURL != "" {
+			text += fmt.Sprintf(", <%v|download>", channelAssetsURL(ch, ver))
+		}
+		if err := notify.PostSlack(runCtx, &http.Client{Timeout: webhookTimeout}, hook, text); err != nil {
+			return fmt.Errorf("failed to announce the promotion on Slack: %v", err)
+		}
+		fmt.Println("Promotion announced on Slack")
+	}
+	return nil
+}
+
+// currentChannel returns the index of the most stable channel whose tag is at
+// the commit sha, -1 if none is.
+func currentChannel(upstream *ghclient.Client, channels []*config.Channel, sha string) int {
+	for i := len(channels) - 1; i >= 0; i-- {
+		// A channel without releases has no tag yet.
+		if cur, err := upstream.GetCommitSHAContext(runCtx, channelTag(channels[i])); err == nil && cur == sha {
+			return i
+		}
+	}
+	return -1
+}
+
+func channelIndex(channels []*config.Channel, name string) int {
+	for i, ch := range channels {
+		if ch.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func channelNames(channels []*config.Channel) []string {
+	var ret []string
+	for _, ch := range channels {
+		ret = append(ret, ch.Name)
+	}
+	return ret
+}
+
+// channelAssetsURL returns the asset location of the channel for ver, ending
+// with a slash.
+func channelAssetsURL(ch *config.Channel, ver *version.Version) string {
+	u := versionReplacer(ver).Replace(ch.AssetsURL)
+	if !strings.HasSuffix(u, "/") {
+		u += "/"
+	}
+	return u
+}
+
+// channelTag returns the moving tag of the channel.
+func channelTag(ch *config.Channel) string {
+	if ch.Tag != "" {
+		return ch.Tag
+	}
+	return ch.Name
+}
@@ -0,0 +1,192 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package main
+
+import (
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/sniperkit/snk.fork.release-git-bot/config"
+	"github.com/sniperkit/snk.fork.release-git-bot/ghclient"
+	"github.com/sniperkit/snk.fork.release-git-bot/version"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultNightlyTags is the glob of the nightly release tags if it's not
+// configured.
+const defaultNightlyTags = "*-dev.*"
+
+// pruneAction is a deletion of the prune command.
+type pruneAction struct {
+	what string
+	do   func() error
+}
+
+func runPrune(cfg *config.Config, args []string) error {
+	fs := newFlagSet("prune")
+	dryRun := fs.Bool("dryrun", false, "only print what would be deleted")
+	fs.Parse(args)
+	if cfg.Retention == nil {
+		return fmt.Errorf("no retention in the config, nothing to prune")
+	}
+	upstream := newClient(upstreamUser, *repo)
+	releases, err := upstream.ListReleasesContext(runCtx)
+	if err != nil {
+		return fmt.Errorf("failed to list releases: %v", err)
+	}
+	actions, err := pruneActions(cfg.Retention, upstream, releases, botClock.Now())
+	if err != nil {
+		return err
+	}
+	if len(cfg.Retention.Branches) > 0 {
+		branchActions, err := pruneReleaseBranches(cfg.Retention.Branches, upstream)
+		if err != nil {
+			return err
+		}
+		actions = append(actions, branchActions...)
+	}
+	if len(actions) == 0 {
+		fmt.Println("Nothing to prune")
+		return nil
+	}
+	var failed int
+	for _, a := range actions {
+		if *dryRun {
+			fmt.Println("Would delete", a.what)
+			continue
+		}
+		if err := a.do(); err != nil {
+			log.Errorf("failed to delete %v: %v", a.what, err)
+			failed++
+			continue
+		}
+		fmt.Println("Deleted", a.what)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%v of %v deletions failed", failed, len(actions))
+	}
+	return nil
+}
+
+// pruneActions returns the deletions of the releases due by the retention at
+// now.
+func pruneActions(r *config.Retention, upstream *ghclient.Client, releases []*github.RepositoryRelease, now time.Time) ([]*pruneAction, error) {
+	maxAge := func(name, s string) (time.Duration, error) {
+		if s == "" {
+			return 0, nil
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, fmt.Errorf("invalid retention %v %q: %v", name, s, err)
+		}
+		return d, nil
+	}
+	draftAge, err := maxAge("drafts", r.Drafts)
+	if err != nil {
+		return nil, err
+	}
+	nightlyAge, err := maxAge("nightly", r.Nightly)
+	if err != nil {
+		return nil, err
+	}
+	nightlyTags := r.NightlyTags
+	if nightlyTags == "" {
+		nightlyTags = defaultNightlyTags
+	}
+	if _, err := path.Match(nightlyTags, ""); err != nil {
+		return nil, fmt.Errorf("invalid retention nightly_tags %q: %v", nightlyTags, err)
+	}
+
+	// The published final releases, which supersede their pre-releases.
+	final := make(map[string]bool)
+	for _, rel := range releases {
+		if v, err := version.ParseTag(versionScheme, rel.GetTagName()); err == nil && !rel.GetDraft() && !v.IsPrerelease() {
+			final[fmt.Sprint(v.Parts)] = true
+		}
+	}
+
+	var actions []*pruneAction
+	for _, rel := range releases {
+		rel := rel
+		tag := rel.GetTagName()
+		age := now.Sub(rel.GetCreatedAt().Time)
+		v, verr := version.ParseTag(versionScheme, tag)
+		nightly, _ := path.Match(nightlyTags, tag)
+		switch {
+		case nightly && nightlyAge > 0 && age > nightlyAge:
+			actions = append(actions, &pruneAction{
+				what: fmt.Sprintf("nightly release %v and its tag (%v old)", tag, age.Round(time.Hour)),
+				do: func() error {
+					if err := upstream.DeleteReleaseContext(runCtx, rel.GetID()); err != nil {
+						return err
+					}
+					if rel.GetDraft() {
+						// Drafts have no tag yet.
+						return nil
+					}
+					return upstream.DeleteTagContext(runCtx, tag)
+				},
+			})
+		case rel.GetDraft() && (rel.GetPrerelease() || (verr == nil && v.IsPrerelease())) && draftAge > 0 && age > draftAge:
+			actions = append(actions, &pruneAction{
+				what: fmt.Sprintf("draft pre-release %v (%v old)", tag, age.Round(time.Hour)),
+				do:   func() error { return upstream.DeleteReleaseContext(runCtx, rel.GetID()) },
+			})
+		case r.RCAssets && !rel.GetDraft() && verr == nil && v.IsPrerelease() && final[fmt.Sprint(v.Parts)]:
+			for _, a := range rel.Assets {
+				id := a.GetID()
+				actions = append(actions, &pruneAction{
+					what: fmt.Sprintf("asset %v of superseded pre-release %v", a.GetName(), tag),
+					do:   func() error { return upstream.DeleteReleaseAssetContext(runCtx, id) },
+				})
+			}
+		}
+	}
+	return actions, nil
+}
+
+// pruneReleaseBranches returns the deletions of the stale branches matching
+// the globs, in the repo and in the fork of the token user, e.g. the version
+// bump branches of past releases once their PRs are merged.
+func pruneReleaseBranches(globs []string, upstream *ghclient.Client) ([]*pruneAction, error) {
+	heads := []*ghclient.Client{upstream}
+	login, err := upstream.GetLoginContext(runCtx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the login of the token: %v", err)
+	}
+	if login != upstreamUser {
+		fork := newClient(login, *repo)
+		if _, err := fork.GetRepoContext(runCtx); err != nil {
+			log.Infof("no fork %v/%v to prune: %v", login, *repo, err)
+		} else {
+			heads = append(heads, fork)
+		}
+	}
+
+	var actions []*pruneAction
+	for _, head := range heads {
+		head := head
+		for _, g := range globs {
+			stale, err := upstream.StaleBranchesContext(runCtx, head, g)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list the stale branches of %v/%v: %v", head.Owner(), head.Repo(), err)
+			}
+			for _, b := range stale {
+				name := b.Name
+				status := "closed"
+				if b.Merged {
+					status = "merged"
+				}
+				actions = append(actions, &pruneAction{
+					what: fmt.Sprintf("branch %v/%v:%v (PR #%v %v)", head.Owner(), head.Repo(), name, b.PRs[0], status),
+					do:   func() error { return head.DeleteBranchContext(runCtx, name) },
+				})
+			}
+		}
+	}
+	return actions, nil
+}
@@ -0,0 +1,242 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/sniperkit/snk.fork.release-git-bot/config"
+	"github.com/sniperkit/snk.fork.release-git-bot/ghclient"
+	"github.com/sniperkit/snk.fork.release-git-bot/gitwrapper"
+	"github.com/sniperkit/snk.fork.release-git-bot/notes"
+	"github.com/sniperkit/snk.fork.release-git-bot/oci"
+	"github.com/sniperkit/snk.fork.release-git-bot/packaging"
+	"github.com/sniperkit/snk.fork.release-git-bot/publish"
+	"github.com/sniperkit/snk.fork.release-git-bot/version"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// publishManifests sends a pull request to each manifest repo, updating the
+// manifest to the published release.
+//
+// Failures are logged, so one broken publisher doesn't block the others.
+func publishManifests(publishers []*config.Publisher, upstream *ghclient.Client, ver *version.Version, login, email string, draft bool) {
+	tag := ver.Tag()
+	release, err := upstream.GetReleaseByTagContext(runCtx, tag)
+	if err != nil {
+		log.Errorf("failed to get release %v: %v", tag, err)
+		return
+	}
+
+	r := &publish.Release{
+		Version: ver.String(),
+		Tag:     tag,
+		HTMLURL: release.GetHTMLURL(),
+	}
+	for _, ra := range release.Assets {
+		a := publish.NewAsset(ra.GetName(), ra.GetBrowserDownloadURL(), "")
+		if a.OS == "" {
+			continue // Not a binary archive, e.g. checksum file.
+		}
+		if a.SHA256, err = publish.Checksum(nil, a.URL); err != nil {
+			log.Errorf("failed to get checksum for asset %v: %v", a.Name, err)
+			return
+		}
+		r.Assets = append(r.Assets, a)
+	}
+
+	for _, pc := range publishers {
+		prURL, err := makeManifestPR(pc, r, login, email, draft)
+		if err != nil {
+			log.Errorf("failed to update %v manifest in %v: %v", pc.Kind, pc.Repo, err)
+			continue
+		}
+		fmt.Println("PR to merge: ", prURL)
+	}
+}
+
+// return value is pr URL. The pr is a draft if draft is set.
+func makeManifestPR(pc *config.Publisher, r *publish.Release, login, email string, draft bool) (string, error) {
+	p, err := publish.New(pc)
+	if err != nil {
+		return "", err
+	}
+	files, err := p.Files(r)
+	if err != nil {
+		return "", err
+	}
+
+	ownerAndRepo := strings.SplitN(pc.Repo, "/", 2)
+	if len(ownerAndRepo) != 2 {
+		return "", fmt.Errorf("invalid manifest repo %q, must be in the format of owner/repo", pc.Repo)
+	}
+	owner, repo := ownerAndRepo[0], ownerAndRepo[1]
+	base := defaultBranch(owner, repo)
+
+	/* Step 1: write the manifests in the fork */
+	fmt.Printf(" - Cloning %v/%v (%v) into memory\n\n", login, repo, base)
+	local, err := gitwrapper.GithubClone(&gitwrapper.GithubCloneConfig{
+		Host:   githubHost(),
+		Owner:  login,
+		Repo:   repo,
+		Branch: base,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to github clone: %v", err)
+	}
+	changes := make(map[string][]byte)
+	for _, f := range files {
+		changes[f.Path] = f.Content
+	}
+	branchName := fmt.Sprintf("%v_%v_%v", pc.Kind, pc.Name, r.Version)
+	title := fmt.Sprintf("%v %v", pc.Name, r.Version)
+	if err := local.MakeFileChange(&gitwrapper.FileChangeConfig{
+		Files:         changes,
+		BranchName:    branchName,
+		CommitMessage: title,
+		UserName:      login,
+		UserEmail:     email,
+	}); err != nil {
+		return "", fmt.Errorf("failed to make change: %v", err)
+	}
+	if err := pushToFork(local, login, repo, branchName); err != nil {
+		return "", fmt.Errorf("failed to public change: %v", err)
+	}
+
+	/* Step 2: send pull request to the manifest repo */
+	body := fmt.Sprintf("Update %v to %v.\n\nRelease: %v", pc.Name, r.Version, r.HTMLURL)
+	pr, err := newClient(owner, repo).CreatePullRequestContext(runCtx, &ghclient.Head{Owner: login, Repo: repo, Branch: branchName}, base, title, body, draft)
+	if err != nil {
+		return "", err
+	}
+	if pr.NoChanges {
+		return "", fmt.Errorf("%v manifest is already up to date", pc.Name)
+	}
+	return pr.URL, nil
+}
+
+// attachPackages builds the linux packages and uploads them to the draft
+// release, with their checksums if checksums is true.
+func attachPackages(packages []*config.Package, checksums bool, upstream *ghclient.Client, releaseID int64, ver *version.Version, ns *notes.Notes) {
+	outDir, err := ioutil.TempDir("", "release-git-bot-packages")
+	if err != nil {
+		log.Fatalf("failed to create packages dir: %v", err)
+	}
+	defer os.RemoveAll(outDir)
+
+	var paths []string
+	for _, pc := range packages {
+		built, err := packaging.Build(pc, ver.String(), ns, outDir)
+		if err != nil {
+			log.Fatalf("failed to build package %v: %v", pc.Name, err)
+		}
+		paths = append(paths, built...)
+	}
+	assets, err := upstream.UploadReleaseAssetsContext(runCtx, releaseID, paths...)
+	for _, a := range assets {
+		fmt.Println("Package attached: ", a.URL)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if checksums {
+		url, err := upstream.UploadChecksumsContext(runCtx, releaseID, assets)
+		if err != nil {
+			log.Fatalf("failed to upload %v: %v", ghclient.ChecksumsAsset, err)
+		}
+		fmt.Println("Checksums attached: ", url)
+	}
+}
+
+// attachDeveloperNotes renders the developer changelog and uploads it to the
+// draft release.
+func attachDeveloperNotes(cfg *config.Config, upstream *ghclient.Client, releaseID int64, ns *notes.Notes) {
+	text, err := renderDeveloperNotes(cfg, ns)
+	if err != nil {
+		log.Fatalf("failed to render developer notes: %v", err)
+	}
+	dir, err := ioutil.TempDir("", "release-git-bot-changelog")
+	if err != nil {
+		log.Fatalf("failed to create changelog dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := cfg.DeveloperNotes.Asset
+	if name == "" {
+		name = "CHANGELOG.md"
+	}
+	p := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(p, []byte(text), 0644); err != nil {
+		log.Fatalf("failed to write developer notes: %v", err)
+	}
+	url, err := upstream.UploadReleaseAssetContext(runCtx, releaseID, p)
+	if err != nil {
+		log.Fatalf("failed to upload %v: %v", name, err)
+	}
+	fmt.Println("Developer changelog attached: ", url)
+}
+
+// pushImages pushes the release tags with OCI annotations for the images, and
+// verifies the annotations on the pushed manifests.
+func pushImages(images []*config.Image, upstream *ghclient.Client, ver *version.Version) {
+	tag := ver.Tag()
+	release, err := upstream.GetReleaseByTagContext(runCtx, tag)
+	if err != nil {
+		log.Fatalf("failed to get release %v: %v", tag, err)
+	}
+	sha, err := upstream.GetCommitSHAContext(runCtx, tag)
+	if err != nil {
+		log.Fatalf("failed to get commit for tag %v: %v", tag, err)
+	}
+	r := ociRelease(upstream, release, sha)
+
+	for _, img := range images {
+		annotations := oci.Annotations(r, img.Annotations)
+		tags := append([]string{tag}, img.ExtraTags...)
+		if err := oci.Push(img.Source, img.Repository, tags, annotations); err != nil {
+			log.Fatalf("failed to push image: %v", err)
+		}
+		for _, t := range tags {
+			if err := oci.Verify(img.Repository+":"+t, annotations); err != nil {
+				log.Fatalf("failed to verify image: %v", err)
+			}
+		}
+		fmt.Printf("Image %v pushed with tags %v\n", img.Repository, tags)
+	}
+}
+
+// ociRelease returns the release for the OCI annotations of its images.
+func ociRelease(upstream *ghclient.Client, release *github.RepositoryRelease, sha string) *oci.Release {
+	return &oci.Release{
+		Version:   release.GetTagName(),
+		Revision:  sha,
+		SourceURL: fmt.Sprintf("https://%v/%v/%v", githubHost(), upstream.Owner(), upstream.Repo()),
+		HTMLURL:   release.GetHTMLURL(),
+		Created:   release.GetPublishedAt().Time,
+	}
+}
+
+// updateRepoMetadata updates the repo description, homepage and topics.
+func updateRepoMetadata(m *config.RepoMetadata, upstream *ghclient.Client, ver *version.Version) {
+	r := versionReplacer(ver)
+	description, homepage := r.Replace(m.Description), r.Replace(m.Homepage)
+	if description != "" || homepage != "" {
+		if err := upstream.EditRepoContext(runCtx, description, homepage); err != nil {
+			log.Fatalf("failed to update repo description and homepage: %v", err)
+		}
+		fmt.Printf("Repo description: %q, homepage: %q\n", description, homepage)
+	}
+	if len(m.Topics) > 0 {
+		if err := upstream.ReplaceTopicsContext(runCtx, m.Topics); err != nil {
+			log.Fatalf("failed to update repo topics: %v", err)
+		}
+		fmt.Printf("Repo topics: %v\n", m.Topics)
+	}
+}
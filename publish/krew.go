@@ -0,0 +1,87 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package publish
+
+import (
+	"fmt"
+
+	"github.com/sniperkit/snk.fork.release-git-bot/config"
+	yaml "gopkg.in/yaml.v2"
+)
+
+type krewManifest struct {
+	APIVersion string       `yaml:"apiVersion"`
+	Kind       string       `yaml:"kind"`
+	Metadata   krewMetadata `yaml:"metadata"`
+	Spec       krewSpec     `yaml:"spec"`
+}
+
+type krewMetadata struct {
+	Name string `yaml:"name"`
+}
+
+type krewSpec struct {
+	Version          string          `yaml:"version"`
+	Homepage         string          `yaml:"homepage,omitempty"`
+	ShortDescription string          `yaml:"shortDescription,omitempty"`
+	Platforms        []*krewPlatform `yaml:"platforms"`
+}
+
+type krewPlatform struct {
+	Selector krewSelector `yaml:"selector"`
+	URI      string       `yaml:"uri"`
+	SHA256   string       `yaml:"sha256"`
+	Bin      string       `yaml:"bin"`
+}
+
+type krewSelector struct {
+	MatchLabels map[string]string `yaml:"matchLabels"`
+}
+
+// krew generates the plugin manifest for krew-index.
+type krew struct {
+	c *config.Publisher
+}
+
+func (k *krew) Files(r *Release) ([]*File, error) {
+	m := &krewManifest{
+		APIVersion: "krew.googlecontainertools.github.com/v1alpha2",
+		Kind:       "Plugin",
+		Metadata:   krewMetadata{Name: k.c.Name},
+		Spec: krewSpec{
+			Version:          r.Tag,
+			Homepage:         k.c.Homepage,
+			ShortDescription: k.c.Description,
+		},
+	}
+	for _, os := range knownOS {
+		for _, a := range assetsFor(r, os) {
+			bin := k.c.Bin
+			if bin == "" {
+				bin = k.c.Name
+			}
+			if os == "windows" {
+				bin += ".exe"
+			}
+			m.Spec.Platforms = append(m.Spec.Platforms, &krewPlatform{
+				Selector: krewSelector{MatchLabels: map[string]string{"os": a.OS, "arch": a.Arch}},
+				URI:      a.URL,
+				SHA256:   a.SHA256,
+				Bin:      bin,
+			})
+		}
+	}
+	if len(m.Spec.Platforms) == 0 {
+		return nil, fmt.Errorf("krew: no platform specific asset found in release %v", r.Tag)
+	}
+	b, err := yaml.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	path := k.c.Path
+	if path == "" {
+		path = fmt.Sprintf("plugins/%v.yaml", k.c.Name)
+	}
+	return []*File{{Path: path, Content: b}}, nil
+}
@@ -0,0 +1,134 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+// Package publish generates package manager manifests (krew, scoop, winget)
+// for a published release.
+package publish
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/sniperkit/snk.fork.release-git-bot/config"
+)
+
+// Release contains the info of a published release needed by the manifests.
+type Release struct {
+	// Version is the version without the "v" prefix, e.g. 1.14.0.
+	Version string
+	// Tag is the git tag of the release, e.g. v1.14.0.
+	Tag string
+	// HTMLURL is the url of the release page.
+	HTMLURL string
+	// Assets are the files uploaded to the release.
+	Assets []*Asset
+}
+
+// Asset is one file uploaded to the release.
+type Asset struct {
+	Name   string
+	URL    string
+	SHA256 string
+
+	// OS and Arch are parsed from the asset name, in the format of GOOS and
+	// GOARCH. They are "" if the name doesn't contain a known platform.
+	OS   string
+	Arch string
+}
+
+// File is a manifest file to be written to the manifest repo.
+type File struct {
+	Path    string
+	Content []byte
+}
+
+// Publisher generates the manifests for one package manager.
+type Publisher interface {
+	// Files returns the manifest files for the release.
+	Files(r *Release) ([]*File, error)
+}
+
+// New creates a Publisher for the config.
+func New(c *config.Publisher) (Publisher, error) {
+	if c.Name == "" {
+		return nil, fmt.Errorf("publisher name is empty")
+	}
+	switch c.Kind {
+	case "krew":
+		return &krew{c: c}, nil
+	case "scoop":
+		return &scoop{c: c}, nil
+	case "winget":
+		if c.Identifier == "" {
+			return nil, fmt.Errorf("winget publisher %q has no identifier", c.Name)
+		}
+		return &winget{c: c}, nil
+	}
+	return nil, fmt.Errorf("unknown publisher kind %q", c.Kind)
+}
+
+var (
+	knownOS   = []string{"linux", "darwin", "windows"}
+	knownArch = map[string]string{
+		"amd64":  "amd64",
+		"x86_64": "amd64",
+		"arm64":  "arm64",
+		"386":    "386",
+		"i386":   "386",
+	}
+)
+
+// NewAsset creates an Asset with the platform parsed from the name.
+func NewAsset(name, url, sha string) *Asset {
+	a := &Asset{Name: name, URL: url, SHA256: sha}
+	fields := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return r == '_' || r == '-' || r == '.'
+	})
+	for _, f := range fields {
+		for _, os := range knownOS {
+			if f == os {
+				a.OS = os
+			}
+		}
+		if arch, ok := knownArch[f]; ok {
+			a.Arch = arch
+		}
+	}
+	return a
+}
+
+// Checksum downloads the file at url and returns its hex encoded SHA-256
+// checksum.
+func Checksum(hc *http.Client, url string) (string, error) {
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Get(url)
+	if err != nil {
+		return "", fmt.Errorf("failed to download %v: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to download %v: %v", url, resp.Status)
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, resp.Body); err != nil {
+		return "", fmt.Errorf("failed to read %v: %v", url, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// assetsFor returns the assets for the given OS, skipping checksum files.
+func assetsFor(r *Release, os string) []*Asset {
+	var ret []*Asset
+	for _, a := range r.Assets {
+		if a.OS == os && a.Arch != "" {
+			ret = append(ret, a)
+		}
+	}
+	return ret
+}
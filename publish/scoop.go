@@ -0,0 +1,70 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package publish
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/sniperkit/snk.fork.release-git-bot/config"
+)
+
+type scoopManifest struct {
+	Version      string                        `json:"version"`
+	Description  string                        `json:"description,omitempty"`
+	Homepage     string                        `json:"homepage,omitempty"`
+	License      string                        `json:"license,omitempty"`
+	Architecture map[string]*scoopArchitecture `json:"architecture"`
+	Bin          string                        `json:"bin"`
+}
+
+type scoopArchitecture struct {
+	URL  string `json:"url"`
+	Hash string `json:"hash"`
+}
+
+var scoopArchNames = map[string]string{
+	"amd64": "64bit",
+	"386":   "32bit",
+	"arm64": "arm64",
+}
+
+// scoop generates the app manifest for a scoop bucket.
+type scoop struct {
+	c *config.Publisher
+}
+
+func (s *scoop) Files(r *Release) ([]*File, error) {
+	bin := s.c.Bin
+	if bin == "" {
+		bin = s.c.Name
+	}
+	m := &scoopManifest{
+		Version:      r.Version,
+		Description:  s.c.Description,
+		Homepage:     s.c.Homepage,
+		License:      s.c.License,
+		Architecture: make(map[string]*scoopArchitecture),
+		Bin:          bin + ".exe",
+	}
+	for _, a := range assetsFor(r, "windows") {
+		name, ok := scoopArchNames[a.Arch]
+		if !ok {
+			continue
+		}
+		m.Architecture[name] = &scoopArchitecture{URL: a.URL, Hash: a.SHA256}
+	}
+	if len(m.Architecture) == 0 {
+		return nil, fmt.Errorf("scoop: no windows asset found in release %v", r.Tag)
+	}
+	b, err := json.MarshalIndent(m, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+	path := s.c.Path
+	if path == "" {
+		path = fmt.Sprintf("bucket/%v.json", s.c.Name)
+	}
+	return []*File{{Path: path, Content: append(b, '\n')}}, nil
+}
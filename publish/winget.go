@@ -0,0 +1,135 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package publish
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/sniperkit/snk.fork.release-git-bot/config"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const wingetManifestVersion = "1.0.0"
+
+type wingetVersion struct {
+	PackageIdentifier string `yaml:"PackageIdentifier"`
+	PackageVersion    string `yaml:"PackageVersion"`
+	DefaultLocale     string `yaml:"DefaultLocale"`
+	ManifestType      string `yaml:"ManifestType"`
+	ManifestVersion   string `yaml:"ManifestVersion"`
+}
+
+type wingetLocale struct {
+	PackageIdentifier string `yaml:"PackageIdentifier"`
+	PackageVersion    string `yaml:"PackageVersion"`
+	PackageLocale     string `yaml:"PackageLocale"`
+	Publisher         string `yaml:"Publisher"`
+	PackageName       string `yaml:"PackageName"`
+	PackageURL        string `yaml:"PackageUrl,omitempty"`
+	License           string `yaml:"License"`
+	ShortDescription  string `yaml:"ShortDescription"`
+	ReleaseNotesURL   string `yaml:"ReleaseNotesUrl,omitempty"`
+	ManifestType      string `yaml:"ManifestType"`
+	ManifestVersion   string `yaml:"ManifestVersion"`
+}
+
+type wingetInstaller struct {
+	PackageIdentifier string                 `yaml:"PackageIdentifier"`
+	PackageVersion    string                 `yaml:"PackageVersion"`
+	InstallerType     string                 `yaml:"InstallerType"`
+	Installers        []*wingetInstallerItem `yaml:"Installers"`
+	ManifestType      string                 `yaml:"ManifestType"`
+	ManifestVersion   string                 `yaml:"ManifestVersion"`
+}
+
+type wingetInstallerItem struct {
+	Architecture    string `yaml:"Architecture"`
+	InstallerURL    string `yaml:"InstallerUrl"`
+	InstallerSha256 string `yaml:"InstallerSha256"`
+}
+
+var wingetArchNames = map[string]string{
+	"amd64": "x64",
+	"386":   "x86",
+	"arm64": "arm64",
+}
+
+// winget generates the multi-file manifest for winget-pkgs.
+type winget struct {
+	c *config.Publisher
+}
+
+func (w *winget) Files(r *Release) ([]*File, error) {
+	id := w.c.Identifier
+	installer := &wingetInstaller{
+		PackageIdentifier: id,
+		PackageVersion:    r.Version,
+		InstallerType:     "zip",
+		ManifestType:      "installer",
+		ManifestVersion:   wingetManifestVersion,
+	}
+	for _, a := range assetsFor(r, "windows") {
+		arch, ok := wingetArchNames[a.Arch]
+		if !ok {
+			continue
+		}
+		installer.Installers = append(installer.Installers, &wingetInstallerItem{
+			Architecture:    arch,
+			InstallerURL:    a.URL,
+			InstallerSha256: strings.ToUpper(a.SHA256),
+		})
+	}
+	if len(installer.Installers) == 0 {
+		return nil, fmt.Errorf("winget: no windows asset found in release %v", r.Tag)
+	}
+	version := &wingetVersion{
+		PackageIdentifier: id,
+		PackageVersion:    r.Version,
+		DefaultLocale:     "en-US",
+		ManifestType:      "version",
+		ManifestVersion:   wingetManifestVersion,
+	}
+	locale := &wingetLocale{
+		PackageIdentifier: id,
+		PackageVersion:    r.Version,
+		PackageLocale:     "en-US",
+		Publisher:         w.c.Publisher,
+		PackageName:       w.c.Name,
+		PackageURL:        w.c.Homepage,
+		License:           w.c.License,
+		ShortDescription:  w.c.Description,
+		ReleaseNotesURL:   r.HTMLURL,
+		ManifestType:      "defaultLocale",
+		ManifestVersion:   wingetManifestVersion,
+	}
+
+	// The default directory is manifests/<first letter>/<id as path>/<version>.
+	dir := w.c.Path
+	if dir == "" {
+		dir = path.Join("manifests", strings.ToLower(id[:1]), strings.Replace(id, ".", "/", -1))
+	}
+	dir = path.Join(dir, r.Version)
+
+	var files []*File
+	for _, m := range []struct {
+		suffix string
+		v      interface{}
+	}{
+		{"", version},
+		{".installer", installer},
+		{".locale.en-US", locale},
+	} {
+		b, err := yaml.Marshal(m.v)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, &File{
+			Path:    path.Join(dir, id+m.suffix+".yaml"),
+			Content: b,
+		})
+	}
+	return files, nil
+}
@@ -0,0 +1,190 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/olekukonko/tablewriter"
+	"github.com/sniperkit/snk.fork.release-git-bot/cache"
+	"github.com/sniperkit/snk.fork.release-git-bot/config"
+	"github.com/sniperkit/snk.fork.release-git-bot/ghclient"
+	"github.com/sniperkit/snk.fork.release-git-bot/notes"
+	"github.com/sniperkit/snk.fork.release-git-bot/version"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// releaseContent is what went into a release.
+type releaseContent struct {
+	From         string          `json:"from"`
+	To           string          `json:"to"`
+	Commits      int             `json:"commits"`
+	PRs          []*github.Issue `json:"prs"`
+	Contributors []string        `json:"contributors"`
+	Notes        *notes.Notes    `json:"notes"`
+}
+
+func runQuery(cfg *config.Config, args []string) error {
+	fs := newFlagSet("query")
+	tag := fs.String("tag", "", "the release tag, default to v<version>")
+	from := fs.String("from", "", "the previous release tag, default to the latest release tag lower than -tag")
+	format := fs.String("format", "markdown", "output format, markdown or json")
+	cacheDir := fs.String("cachedir", "", "the cache dir for fetched PRs, default to the user cache dir")
+	fs.Parse(args)
+
+	if *tag == "" {
+		ver, err := versionScheme.Parse(*newVersion)
+		if err != nil {
+			return fmt.Errorf("-tag is not set, and invalid version string %q: %v", *newVersion, err)
+		}
+		*tag = ver.Tag()
+	}
+	upstream := newClient(upstreamUser, *repo)
+	if *from == "" {
+		ver, err := version.ParseTag(versionScheme, *tag)
+		if err != nil {
+			return fmt.Errorf("failed to find the previous release of %v, use -from: %v", *tag, err)
+		}
+		if *from = previousTag(upstream, ver); *from == "" {
+			return fmt.Errorf("no release before %v, use -from", *tag)
+		}
+	}
+	c, err := cache.New(*cacheDir, stateKey)
+	if err != nil {
+		log.Warningf("failed to create cache, PRs won't be cached: %v", err)
+	}
+
+	content, err := queryRelease(upstream, c, *from, *tag)
+	if err != nil {
+		return err
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(content)
+	}
+	fmt.Printf("# %v/%v %v (since %v)\n\n", upstream.Owner(), upstream.Repo(), content.To, content.From)
+	fmt.Printf("%v commits, %v PRs, %v contributors\n\n", content.Commits, len(content.PRs), len(content.Contributors))
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"PR", "title", "author", "labels"})
+	for _, pr := range content.PRs {
+		var labels []string
+		for _, l := range pr.Labels {
+			labels = append(labels, l.GetName())
+		}
+		table.Append([]string{strconv.Itoa(pr.GetNumber()), pr.GetTitle(), pr.GetUser().GetLogin(), strings.Join(labels, ", ")})
+	}
+	table.Render()
+	fmt.Printf("\nContributors: %v\n\n", strings.Join(content.Contributors, ", "))
+	fmt.Println(content.Notes.ToMarkdown())
+	return nil
+}
+
+// queryRelease reconstructs the content of the release from the commits
+// between the two tags, without using milestones.
+func queryRelease(upstream *ghclient.Client, c *cache.Cache, from, to string) (*releaseContent, error) {
+	commits, err := upstream.GetCommitsBetweenContext(runCtx, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commits between %v and %v: %v", from, to, err)
+	}
+	ret := &releaseContent{From: from, To: to, Commits: len(commits)}
+	var contributors map[string]bool
+	if ret.PRs, contributors, err = prsForCommits(upstream, c, commits); err != nil {
+		return nil, err
+	}
+	for login := range contributors {
+		ret.Contributors = append(ret.Contributors, login)
+	}
+	sort.Strings(ret.Contributors)
+
+	var thanksFilter func(pr *github.Issue) bool
+	if *thanks {
+		thanksFilter = newThanksFilter(upstream)
+	}
+	ret.Notes = notes.GenerateNotes(upstream.Owner(), upstream.Repo(), to, ret.PRs, notes.Filters{
+		SpecialThanks: thanksFilter,
+		Paths:         prPaths(upstream),
+		Classifier:    classifier,
+	})
+	ret.Notes.Date = releaseDate(upstream, to)
+	resolveAuthors(upstream, c, ret.Notes)
+	return ret, nil
+}
+
+// prsForCommits returns the PRs the commits were merged in (see
+// ghclient.PRNumbersForCommitsContext), sorted by number, and the set of the
+// commit and PR authors.
+func prsForCommits(upstream *ghclient.Client, c *cache.Cache, commits []github.RepositoryCommit) ([]*github.Issue, map[string]bool, error) {
+	contributors := make(map[string]bool)
+	for _, cmt := range commits {
+		if login := cmt.GetAuthor().GetLogin(); login != "" {
+			contributors[login] = true
+		}
+	}
+	nums, err := upstream.PRNumbersForCommitsContext(runCtx, commits)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	issues, err := getIssuesCached(upstream, c, nums)
+	if err != nil {
+		return nil, nil, err
+	}
+	var prs []*github.Issue
+	for _, pr := range issues {
+		if pr.PullRequestLinks == nil {
+			continue // The number is an issue, not a PR.
+		}
+		contributors[pr.GetUser().GetLogin()] = true
+		prs = append(prs, pr)
+	}
+	sort.Slice(prs, func(i, j int) bool { return prs[i].GetNumber() < prs[j].GetNumber() })
+	return prs, contributors, nil
+}
+
+// getIssuesCached returns the issues or PRs with the given numbers, in the
+// same order. The ones missing in the cache are fetched in one batch, and
+// cached once closed.
+func getIssuesCached(upstream *ghclient.Client, c *cache.Cache, nums []int) ([]*github.Issue, error) {
+	issues := make([]*github.Issue, len(nums))
+	var missing []int
+	for i, n := range nums {
+		issue := new(github.Issue)
+		if c.Get(issueCacheKey(upstream, n), issue) {
+			issues[i] = issue
+		} else {
+			missing = append(missing, n)
+		}
+	}
+	fetched, err := upstream.GetIssuesByNumbersContext(runCtx, missing)
+	if err != nil {
+		return nil, err
+	}
+	for i := range issues {
+		if issues[i] != nil {
+			continue
+		}
+		issue := fetched[0]
+		fetched = fetched[1:]
+		if issue.GetState() == "closed" {
+			if err := c.Put(issueCacheKey(upstream, issue.GetNumber()), issue); err != nil {
+				log.Warningf("failed to cache PR %v: %v", issue.GetNumber(), err)
+			}
+		}
+		issues[i] = issue
+	}
+	return issues, nil
+}
+
+func issueCacheKey(upstream *ghclient.Client, n int) string {
+	return fmt.Sprintf("%v/%v/issue/%v", upstream.Owner(), upstream.Repo(), n)
+}
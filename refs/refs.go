@@ -0,0 +1,72 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+// Package refs formats and parses git refs, so branch and tag refs are not
+// built by string concatenation everywhere.
+//
+// The github refs API takes the short form ("heads/master", "tags/v1.0.0") in
+// the url, and the full form ("refs/heads/master") in the body; git uses the
+// full form.
+package refs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Ref is a branch or tag ref.
+type Ref interface {
+	// Name is the branch or tag name, e.g. "master" or "v1.0.0".
+	Name() string
+	// Short is the ref without the "refs/" prefix, e.g. "heads/master".
+	Short() string
+	// Full is the full ref, e.g. "refs/heads/master".
+	Full() string
+}
+
+// BranchRef is the ref of the branch with this name.
+type BranchRef string
+
+// Name returns the branch name.
+func (b BranchRef) Name() string { return string(b) }
+
+// Short returns "heads/<name>".
+func (b BranchRef) Short() string { return "heads/" + string(b) }
+
+// Full returns "refs/heads/<name>".
+func (b BranchRef) Full() string { return "refs/heads/" + string(b) }
+
+func (b BranchRef) String() string { return b.Full() }
+
+// TagRef is the ref of the tag with this name.
+type TagRef string
+
+// Name returns the tag name.
+func (t TagRef) Name() string { return string(t) }
+
+// Short returns "tags/<name>".
+func (t TagRef) Short() string { return "tags/" + string(t) }
+
+// Full returns "refs/tags/<name>".
+func (t TagRef) Full() string { return "refs/tags/" + string(t) }
+
+func (t TagRef) String() string { return t.Full() }
+
+// Parse parses a branch or tag ref in the full ("refs/heads/x") or the short
+// ("heads/x") form.
+func Parse(s string) (Ref, error) {
+	short := strings.TrimPrefix(s, "refs/")
+	var ret Ref
+	switch {
+	case strings.HasPrefix(short, "heads/"):
+		ret = BranchRef(strings.TrimPrefix(short, "heads/"))
+	case strings.HasPrefix(short, "tags/"):
+		ret = TagRef(strings.TrimPrefix(short, "tags/"))
+	default:
+		return nil, fmt.Errorf("%q is neither a branch nor a tag ref", s)
+	}
+	if ret.Name() == "" {
+		return nil, fmt.Errorf("%q has no name", s)
+	}
+	return ret, nil
+}
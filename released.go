@@ -0,0 +1,72 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sniperkit/snk.fork.release-git-bot/clock"
+	"github.com/sniperkit/snk.fork.release-git-bot/config"
+	"github.com/sniperkit/snk.fork.release-git-bot/ghclient"
+	"github.com/sniperkit/snk.fork.release-git-bot/state"
+	"github.com/sniperkit/snk.fork.release-git-bot/version"
+)
+
+// defaultReleasedComment is the comment on the PRs of a published release.
+const defaultReleasedComment = "This PR is included in [{tag}]({url})."
+
+// commentReleasedPRs comments on the merged PRs of the published release of
+// ver that they are included in it. Like the branch cut announcement, the PRs
+// are commented in batches, and the commented PRs are kept in the state, so
+// they are not commented again on resume.
+func commentReleasedPRs(rc *config.ReleasedComment, st *state.State, upstream *ghclient.Client, ver *version.Version) error {
+	batch := rc.BatchSize
+	if batch <= 0 {
+		batch = defaultNoticeBatch
+	}
+	interval := defaultNoticeInterval
+	if rc.BatchInterval != "" {
+		d, err := time.ParseDuration(rc.BatchInterval)
+		if err != nil {
+			return fmt.Errorf("invalid released_comment batch_interval %q: %v", rc.BatchInterval, err)
+		}
+		interval = d
+	}
+
+	release, err := upstream.GetReleaseByTagContext(runCtx, ver.Tag())
+	if err != nil {
+		return fmt.Errorf("failed to get release %v: %v", ver.Tag(), err)
+	}
+	prs, err := mergedPRs(upstream, ver)
+	if err != nil {
+		return fmt.Errorf("failed to get the PRs of %v: %v", ver.Tag(), err)
+	}
+	body := rc.Body
+	if body == "" {
+		body = defaultReleasedComment
+	}
+	body = strings.NewReplacer("{tag}", ver.Tag(), "{url}", release.GetHTMLURL()).Replace(versionReplacer(ver).Replace(body))
+
+	var commented int
+	for _, pr := range prs {
+		key := fmt.Sprintf("released_comment_%v", pr.GetNumber())
+		if st.Get(key) != "" {
+			continue
+		}
+		if commented > 0 && commented%batch == 0 {
+			fmt.Printf("Commented on %v PRs, pausing %v\n", commented, interval)
+			clock.Sleep(botClock, interval)
+		}
+		url, err := upstream.CreateIssueCommentContext(runCtx, pr.GetNumber(), body)
+		if err != nil {
+			return fmt.Errorf("failed to comment on #%v: %v", pr.GetNumber(), err)
+		}
+		st.Set(key, url)
+		commented++
+	}
+	fmt.Printf("Commented on %v PRs of %v\n", commented, ver.Tag())
+	return nil
+}
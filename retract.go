@@ -0,0 +1,193 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/sniperkit/snk.fork.release-git-bot/config"
+	"github.com/sniperkit/snk.fork.release-git-bot/ghclient"
+	"github.com/sniperkit/snk.fork.release-git-bot/gitwrapper"
+	"github.com/sniperkit/snk.fork.release-git-bot/verify"
+	"github.com/sniperkit/snk.fork.release-git-bot/version"
+)
+
+// retractedMarker marks the retraction notice in the notes of a release, so
+// it's added once.
+const retractedMarker = "<!-- retracted -->"
+
+// runRetract retracts the botched release -version: it opens a PR adding the
+// retract directive with the reason to the go.mod of the mainline, adds a
+// retraction notice to the notes of the release, and with -yank, marks it as a
+// pre-release so it's no longer the latest release. The release is edited
+// before the PR is opened, and an open PR of a previous run is reused, so
+// rerunning it is safe.
+func runRetract(cfg *config.Config, args []string) error {
+	fs := newFlagSet("retract")
+	reason := fs.String("reason", "", "why the version is retracted, e.g. \"breaks the server on startup\". It's the comment of the retract directive, shown by go list -m -retracted")
+	instead := fs.String("instead", "", "the version to use instead, e.g. 1.14.2, for the notice")
+	yank := fs.Bool("yank", false, "also mark the github release as a pre-release, so it's no longer the latest release")
+	fs.Parse(args)
+	if *reason == "" {
+		return fmt.Errorf("-reason is required")
+	}
+	ver, err := versionScheme.Parse(*newVersion)
+	if err != nil {
+		return fmt.Errorf("invalid -version %q: %v", *newVersion, err)
+	}
+	upstream := newClient(upstreamUser, *repo)
+	release, err := upstream.GetReleaseByTagContext(runCtx, ver.Tag())
+	if err != nil {
+		return fmt.Errorf("failed to get release %v: %v", ver.Tag(), err)
+	}
+
+	if err := markRetracted(upstream, release, ver, *reason, *instead, *yank); err != nil {
+		return err
+	}
+
+	mainline := mainlineBranch(cfg.Mainline, ver)
+	prURL, err := retractPR(upstream, ver, mainline, *reason)
+	if err != nil {
+		return err
+	}
+	if prURL != "" {
+		fmt.Println("PR to merge: ", prURL)
+	}
+	return nil
+}
+
+// markRetracted adds the retraction notice to the notes of the release, and
+// with yank, marks it as a pre-release. It does nothing if it's already done.
+func markRetracted(upstream *ghclient.Client, release *github.RepositoryRelease, ver *version.Version, reason, instead string, yank bool) error {
+	edit := &github.RepositoryRelease{}
+	body := release.GetBody()
+	if !strings.Contains(body, retractedMarker) {
+		edit.Body = github.String(retractionNotice(ver, reason, instead) + body)
+	}
+	if yank && !release.GetPrerelease() {
+		edit.Prerelease = github.Bool(true)
+	}
+	if edit.Body == nil && edit.Prerelease == nil {
+		fmt.Printf("Release %v is already marked as retracted\n", ver.Tag())
+		return nil
+	}
+	if _, err := upstream.EditReleaseContext(runCtx, release.GetID(), edit); err != nil {
+		return fmt.Errorf("failed to edit release %v: %v", ver.Tag(), err)
+	}
+	fmt.Printf("Release %v marked as retracted: %v\n", ver.Tag(), release.GetHTMLURL())
+	return nil
+}
+
+// retractionNotice returns the notice added at the top of the notes of the
+// retracted release.
+func retractionNotice(ver *version.Version, reason, instead string) string {
+	notice := fmt.Sprintf("%v\n> **%v is retracted:** %v", retractedMarker, ver.Tag(), reason)
+	if instead != "" {
+		notice += fmt.Sprintf("\n> Use v%v instead.", strings.TrimPrefix(instead, "v"))
+	}
+	return notice + "\n\n"
+}
+
+// retractPR opens a PR adding the retract directive of ver to the go.mod of
+// the mainline, and returns its url. If a previous run already opened it, it's
+// returned instead. It's empty if the version is already retracted there.
+func retractPR(upstream *ghclient.Client, ver *version.Version, mainline, reason string) (string, error) {
+	gomod, err := upstream.GetFileContentContext(runCtx, "go.mod", mainline)
+	if err != nil {
+		return "", fmt.Errorf("failed to get go.mod on %v: %v", mainline, err)
+	}
+	if verify.Retracted(gomod, ver.Tag()) {
+		fmt.Printf("%v is already retracted in go.mod on %v\n", ver.Tag(), mainline)
+		return "", nil
+	}
+	branchName := fmt.Sprintf("retract_%v", ver.Tag())
+	open, err := upstream.ListOpenPullRequestsContext(runCtx, mainline)
+	if err != nil {
+		return "", fmt.Errorf("failed to list the open PRs to %v: %v", mainline, err)
+	}
+	for _, pr := range open {
+		if pr.GetHead().GetRef() == branchName {
+			fmt.Printf("%v is already retracted by an open PR\n", ver.Tag())
+			return pr.GetHTMLURL(), nil
+		}
+	}
+
+	login, err := upstream.GetLoginContext(runCtx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get login from github: %v", err)
+	}
+	emailAddress := *email
+	if emailAddress == "" {
+		if emailAddress, err = upstream.GetPrimaryEmailContext(runCtx); err != nil {
+			return "", fmt.Errorf("failed to get primary email address from github: %v", err)
+		}
+	}
+	auditLog.SetActor(login)
+
+	fmt.Printf(" - Cloning %v/%v (%v) into memory\n\n", upstreamUser, *repo, mainline)
+	local, err := gitwrapper.GithubClone(&gitwrapper.GithubCloneConfig{
+		Host:   githubHost(),
+		Owner:  upstreamUser,
+		Repo:   *repo,
+		Branch: mainline,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to github clone: %v", err)
+	}
+	title := fmt.Sprintf("Retract %v", ver.Tag())
+	if err := local.MakeFileChange(&gitwrapper.FileChangeConfig{
+		Files:         map[string][]byte{"go.mod": addRetract(gomod, ver.Tag(), reason)},
+		BranchName:    branchName,
+		CommitMessage: title,
+		UserName:      login,
+		UserEmail:     emailAddress,
+	}); err != nil {
+		return "", fmt.Errorf("failed to make change: %v", err)
+	}
+	forkOwner, forkRepo := forkOf(login)
+	if err := pushToFork(local, forkOwner, forkRepo, branchName); err != nil {
+		return "", fmt.Errorf("failed to public change: %v", err)
+	}
+
+	body := fmt.Sprintf("%v is retracted: %v\n\nThe retraction takes effect with the next release of the module, tag it once this is merged.", ver.Tag(), reason)
+	pr, err := upstream.CreatePullRequestContext(runCtx, &ghclient.Head{Owner: forkOwner, Repo: forkRepo, Branch: branchName}, mainline, title, body, false)
+	if err != nil {
+		return "", fmt.Errorf("failed to create pull request: %v", err)
+	}
+	return pr.URL, nil
+}
+
+// retractGoVersion is the first go version supporting the retract directive.
+const retractGoVersion = "1.16"
+
+// goDirective matches the go directive of a go.mod file.
+var goDirective = regexp.MustCompile(`(?m)^go[ \t]+(\d+)\.(\d+)\S*[ \t]*$`)
+
+// addRetract appends the retract directive of the version to the go.mod
+// content, with the reason as its comment. The go directive is bumped to
+// retractGoVersion if it's lower, or added if there's none.
+func addRetract(gomod []byte, version, reason string) []byte {
+	if m := goDirective.FindSubmatch(gomod); m == nil {
+		gomod = append(bytes.TrimRight(gomod, "\n"), []byte("\n\ngo "+retractGoVersion+"\n")...)
+	} else {
+		major, _ := strconv.Atoi(string(m[1]))
+		minor, _ := strconv.Atoi(string(m[2]))
+		if major == 1 && minor < 16 {
+			gomod = goDirective.ReplaceAll(gomod, []byte("go "+retractGoVersion))
+		}
+	}
+	var b bytes.Buffer
+	b.Write(bytes.TrimRight(gomod, "\n"))
+	b.WriteString("\n\n")
+	for _, line := range strings.Split(strings.TrimSpace(reason), "\n") {
+		fmt.Fprintf(&b, "// %v\n", strings.TrimSpace(line))
+	}
+	fmt.Fprintf(&b, "retract %v\n", version)
+	return b.Bytes()
+}
@@ -0,0 +1,146 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/sniperkit/snk.fork.release-git-bot/config"
+	"github.com/sniperkit/snk.fork.release-git-bot/gdocs"
+	"github.com/sniperkit/snk.fork.release-git-bot/ghclient"
+	"github.com/sniperkit/snk.fork.release-git-bot/notify"
+	"github.com/sniperkit/snk.fork.release-git-bot/state"
+	"github.com/sniperkit/snk.fork.release-git-bot/version"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// reviewNotesFile is the name of the notes in the review gist.
+const reviewNotesFile = "NOTES.md"
+
+// reviewNotes shares the markdown notes in a secret gist (or a Google Doc),
+// sends the link to the reviewers, and returns the notes in it once the human
+// confirms the review is done. The gist or doc is kept in the state: when the
+// release is resumed, it's not overwritten, so the edits made in it are kept.
+func reviewNotes(r *config.NotesReview, st *state.State, step string, upstream *ghclient.Client, ver *version.Version, markdown string) string {
+	id := st.Get("notes_review")
+	if id == "" {
+		title := fmt.Sprintf("Release notes of %v/%v %v, for review", upstream.Owner(), upstream.Repo(), ver.Tag())
+		var url string
+		var err error
+		if r.GoogleDocs != nil {
+			id, url, err = exportNotesDoc(r.GoogleDocs, title, markdown)
+		} else {
+			id, url, err = shareNotesGist(upstream, title, markdown)
+		}
+		if err != nil {
+			log.Fatalf("failed to share the notes for review: %v", err)
+		}
+		st.Set("notes_review", id)
+		st.Set("notes_review_url", url)
+		announceReview(r, upstream, ver, url)
+	}
+	fmt.Printf("Notes are shared for review in %v, edit them there before continuing\n", st.Get("notes_review_url"))
+	confirm(st, step, "Reviewed?")
+
+	var reviewed string
+	var err error
+	if r.GoogleDocs != nil {
+		reviewed, err = docsClient(r.GoogleDocs).Text(runCtx, id)
+	} else {
+		reviewed, err = upstream.GetGistFileContext(runCtx, id, reviewNotesFile)
+	}
+	if err != nil {
+		log.Fatalf("failed to get the reviewed notes: %v", err)
+	}
+	if reviewed != markdown {
+		fmt.Println("Using the reviewed notes")
+	}
+	return reviewed
+}
+
+// shareNotesGist shares the notes in a secret gist, and returns its id and
+// url.
+func shareNotesGist(upstream *ghclient.Client, title, markdown string) (string, string, error) {
+	g, err := upstream.SaveGistContext(runCtx, "", title, map[string]string{reviewNotesFile: markdown})
+	if err != nil {
+		return "", "", err
+	}
+	return g.GetID(), g.GetHTMLURL(), nil
+}
+
+// exportNotesDoc exports the notes to a Google Doc shared with the editors,
+// and returns its id and url.
+func exportNotesDoc(gd *config.GoogleDocs, title, markdown string) (string, string, error) {
+	c := docsClient(gd)
+	d, err := c.Create(runCtx, title, markdown, gd.Folder)
+	if err != nil {
+		return "", "", err
+	}
+	for _, e := range gd.Editors {
+		if err := c.Share(runCtx, d.ID, e, "writer"); err != nil {
+			log.Warning(err)
+		}
+	}
+	return d.ID, d.URL(), nil
+}
+
+// docsClient returns the Google Docs client with the token in the
+// environment.
+func docsClient(gd *config.GoogleDocs) *gdocs.Client {
+	token := os.Getenv(gd.TokenEnv)
+	if token == "" {
+		log.Fatalf("$%v is empty, there's no token for Google Docs", gd.TokenEnv)
+	}
+	return &gdocs.Client{HTTP: &http.Client{Timeout: webhookTimeout}, Token: token}
+}
+
+// announceReview sends the link to the review gist to the reviewers, on the
+// review issue and on Slack. Failures are logged, the link is printed anyway.
+func announceReview(r *config.NotesReview, upstream *ghclient.Client, ver *version.Version, url string) {
+	var mentions []string
+	for _, login := range r.Reviewers {
+		mentions = append(mentions, "@"+strings.TrimPrefix(login, "@"))
+	}
+	msg := fmt.Sprintf("The release notes of %v are ready for review: %v", ver.Tag(), url)
+	where := "gist"
+	if r.GoogleDocs != nil {
+		where = "doc"
+	}
+	if len(mentions) > 0 {
+		msg = strings.Join(mentions, " ") + " " + msg
+	}
+	if n := notesReviewIssue(r); n != 0 {
+		if c, err := upstream.CreateIssueCommentContext(runCtx, n, msg+"\n\nPlease comment on the "+where+"."); err != nil {
+			log.Warningf("failed to comment the review link on #%v: %v", n, err)
+		} else {
+			fmt.Println("Review requested: ", c)
+		}
+	}
+	if r.SlackWebhookEnv != "" {
+		hook := os.Getenv(r.SlackWebhookEnv)
+		if hook == "" {
+			log.Warningf("$%v is empty, the review link is not posted to Slack", r.SlackWebhookEnv)
+			return
+		}
+		text := fmt.Sprintf("The release notes of %v/%v %v are ready for review: <%v|%v>", upstream.Owner(), upstream.Repo(), ver.Tag(), url, where)
+		if err := notify.PostSlack(runCtx, &http.Client{Timeout: webhookTimeout}, hook, text); err != nil {
+			log.Warningf("failed to post the review link to Slack: %v", err)
+		} else {
+			fmt.Println("Review requested on Slack")
+		}
+	}
+}
+
+// notesReviewIssue returns the issue the review link is commented on, 0 for
+// none.
+func notesReviewIssue(r *config.NotesReview) int {
+	if r.Issue != 0 {
+		return r.Issue
+	}
+	return *trackingIssue
+}
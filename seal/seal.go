@@ -0,0 +1,123 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+// Package seal encrypts the files the bot keeps on disk (state and cache), with
+// AES-256-GCM.
+//
+// A nil *Key is valid and doesn't encrypt.
+package seal
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const (
+	// KeyEnv is the env var of the base64 encoded 32 bytes key, e.g. generated
+	// with "openssl rand -base64 32".
+	KeyEnv = "RELEASE_BOT_STATE_KEY"
+	// KeyCommandEnv is the env var of a shell command printing the base64
+	// encoded key, e.g. to decrypt it with a KMS:
+	//   gcloud kms decrypt --key=... --ciphertext-file=key.enc --plaintext-file=- | base64
+	// It's used if KeyEnv is not set.
+	KeyCommandEnv = "RELEASE_BOT_STATE_KEY_COMMAND"
+)
+
+// magic is the prefix of the encrypted files, followed by the nonce and the
+// ciphertext. Files without it are plaintext, written before the key was set.
+var magic = []byte("release-git-bot sealed v1\n")
+
+// Key encrypts and decrypts the files.
+type Key struct {
+	aead cipher.AEAD
+}
+
+// New creates a Key from the 32 bytes raw key.
+func New(raw []byte) (*Key, error) {
+	if len(raw) != 32 {
+		return nil, fmt.Errorf("key must be 32 bytes, got %v", len(raw))
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{aead: aead}, nil
+}
+
+// FromEnv creates a Key from $RELEASE_BOT_STATE_KEY, or from the output of
+// $RELEASE_BOT_STATE_KEY_COMMAND. It returns nil if neither is set.
+func FromEnv() (*Key, error) {
+	encoded := os.Getenv(KeyEnv)
+	if encoded == "" {
+		command := os.Getenv(KeyCommandEnv)
+		if command == "" {
+			return nil, nil
+		}
+		cmd := exec.Command("sh", "-c", command)
+		cmd.Stderr = os.Stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("failed to run $%v: %v", KeyCommandEnv, err)
+		}
+		encoded = string(out)
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode state key: %v", err)
+	}
+	return New(raw)
+}
+
+// Seal encrypts b. If k is nil, b is returned unchanged.
+func (k *Key) Seal(b []byte) ([]byte, error) {
+	if k == nil {
+		return b, nil
+	}
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	ret := append(append([]byte{}, magic...), nonce...)
+	// The magic is authenticated too.
+	return k.aead.Seal(ret, nonce, b, magic), nil
+}
+
+// Open decrypts b. Plaintext b (not sealed) is returned unchanged, so the
+// existing files are still readable after the key is set; they are encrypted
+// when they are written next.
+//
+// It's an error if b is sealed but k is nil, or b was sealed with another key.
+func (k *Key) Open(b []byte) ([]byte, error) {
+	if !IsSealed(b) {
+		return b, nil
+	}
+	if k == nil {
+		return nil, fmt.Errorf("file is encrypted, set $%v or $%v", KeyEnv, KeyCommandEnv)
+	}
+	b = b[len(magic):]
+	if len(b) < k.aead.NonceSize() {
+		return nil, fmt.Errorf("encrypted file is truncated")
+	}
+	ret, err := k.aead.Open(nil, b[:k.aead.NonceSize()], b[k.aead.NonceSize():], magic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt, wrong key?: %v", err)
+	}
+	return ret, nil
+}
+
+// IsSealed returns whether b was encrypted by Seal.
+func IsSealed(b []byte) bool {
+	return bytes.HasPrefix(b, magic)
+}
@@ -0,0 +1,220 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/blang/semver"
+	"github.com/sniperkit/snk.fork.release-git-bot/buildinfo"
+	"github.com/sniperkit/snk.fork.release-git-bot/config"
+	"github.com/sniperkit/snk.fork.release-git-bot/publish"
+	"github.com/sniperkit/snk.fork.release-git-bot/verify"
+	"golang.org/x/crypto/openpgp"
+)
+
+// selfRepo is the repo of the bot's own releases.
+const selfRepo = "sniperkit/snk.fork.release-git-bot"
+
+// runSelfUpdate replaces the running binary with the one of the latest release
+// of the bot for this platform. The downloaded binary must match the published
+// checksum file, and with -keyring, its signature.
+func runSelfUpdate(cfg *config.Config, args []string) error {
+	fs := newFlagSet("self-update")
+	from := fs.String("from", selfRepo, "the repo of the bot releases, format: owner/repo")
+	keyring := fs.String("keyring", "", "armored public keyring to verify the binary signature with. If empty, only the checksum is verified")
+	check := fs.Bool("check", false, "only print whether a newer version is available")
+	force := fs.Bool("force", false, "update even if the binary is a dev build, or is not older than the latest release")
+	fs.Parse(args)
+
+	parts := strings.Split(*from, "/")
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid -from %q, format: owner/repo", *from)
+	}
+	release, err := newClient(parts[0], parts[1]).GetLatestReleaseContext(runCtx)
+	if err != nil {
+		return fmt.Errorf("failed to get the latest release of %v: %v", *from, err)
+	}
+	latest := strings.TrimPrefix(release.GetTagName(), "v")
+	newer, err := isNewerVersion(latest, buildinfo.Version)
+	if err != nil {
+		return err
+	}
+	if !newer {
+		fmt.Printf("release-git-bot %v is up to date, the latest release is %v\n", buildinfo.Version, latest)
+		if !*force {
+			return nil
+		}
+	} else {
+		fmt.Printf("release-git-bot %v is available (this is %v): %v\n", latest, buildinfo.Version, release.GetHTMLURL())
+	}
+	if *check {
+		return nil
+	}
+	if buildinfo.IsDev() && !*force {
+		return fmt.Errorf("not replacing a dev build, use -force")
+	}
+
+	var assets []*verify.Asset
+	for _, a := range release.Assets {
+		assets = append(assets, &verify.Asset{Name: a.GetName(), URL: a.GetBrowserDownloadURL()})
+	}
+	name, err := selfAsset(assets)
+	if err != nil {
+		return fmt.Errorf("%v: %v", release.GetTagName(), err)
+	}
+	var keys openpgp.EntityList
+	if *keyring != "" {
+		if keys, err = readKeyring(*keyring); err != nil {
+			return err
+		}
+	}
+	v := &verify.Verifier{HTTPClient: transportClient, Keyring: keys}
+	b, checks, err := v.Asset(name, assets)
+	if err != nil {
+		return fmt.Errorf("failed to download %v: %v", name, err)
+	}
+	for _, c := range checks {
+		if c.Skipped && keys == nil && strings.HasPrefix(c.Name, "signature ") {
+			continue
+		}
+		if !c.Passed {
+			return fmt.Errorf("not updating, %v failed: %v", c.Name, c.Detail)
+		}
+		fmt.Printf("[PASS] %v %v\n", c.Name, c.Detail)
+	}
+
+	if isTarball(name) {
+		if b, err = binaryFromTarball(b); err != nil {
+			return fmt.Errorf("failed to extract %v: %v", name, err)
+		}
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find the running binary: %v", err)
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return fmt.Errorf("failed to find the running binary: %v", err)
+	}
+	if err := replaceBinary(exe, b); err != nil {
+		return err
+	}
+	fmt.Printf("%v updated to %v\n", exe, latest)
+	return nil
+}
+
+// isNewerVersion returns whether the release version latest is newer than the
+// version of the binary. A dev build is older than any release.
+func isNewerVersion(latest, current string) (bool, error) {
+	l, err := semver.Parse(latest)
+	if err != nil {
+		return false, fmt.Errorf("invalid latest release version %q: %v", latest, err)
+	}
+	if current == "dev" {
+		return true, nil
+	}
+	c, err := semver.Parse(strings.TrimPrefix(current, "v"))
+	if err != nil {
+		return false, fmt.Errorf("invalid binary version %q: %v", current, err)
+	}
+	return l.GT(c), nil
+}
+
+// selfAsset returns the name of the release asset of the binary for this
+// platform, a bare binary or a .tar.gz archive of it. The other assets of the
+// platform, e.g. packages, zip archives, signatures or SBOMs, are skipped.
+func selfAsset(assets []*verify.Asset) (string, error) {
+	for _, a := range assets {
+		name := a.Name
+		if !isTarball(name) && !isBareBinary(name) {
+			continue
+		}
+		if pa := publish.NewAsset(name, "", ""); pa.OS == runtime.GOOS && pa.Arch == runtime.GOARCH {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("no binary for %v/%v", runtime.GOOS, runtime.GOARCH)
+}
+
+// isBareBinary returns whether the asset is a binary, without extension (or
+// .exe). The dots of a version in the name, e.g. in
+// release-git-bot_1.2.3_linux_amd64, are not extensions.
+func isBareBinary(name string) bool {
+	ext := path.Ext(name)
+	if ext == "" || ext == ".exe" || strings.ContainsAny(ext, "_-") {
+		return true
+	}
+	return strings.Trim(ext[1:], "0123456789") == ""
+}
+
+// isTarball returns whether the asset is a .tar.gz archive.
+func isTarball(name string) bool {
+	return strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz")
+}
+
+// binaryFromTarball returns the release-git-bot binary in the .tar.gz archive.
+func binaryFromTarball(b []byte) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("no release-git-bot binary in the archive")
+		}
+		if err != nil {
+			return nil, err
+		}
+		base := path.Base(h.Name)
+		if h.Typeflag == tar.TypeReg && (base == "release-git-bot" || base == "release-git-bot.exe") {
+			return ioutil.ReadAll(tr)
+		}
+	}
+}
+
+// replaceBinary replaces the binary at exe with b. The new binary is written
+// next to it and renamed over it, so exe is never left half written.
+func replaceBinary(exe string, b []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(exe), filepath.Base(exe)+".new")
+	if err != nil {
+		return fmt.Errorf("failed to write the new binary: %v", err)
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write the new binary: %v", err)
+	}
+	tmp.Close()
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write the new binary: %v", err)
+	}
+	if runtime.GOOS == "windows" {
+		// A running binary can't be replaced on windows, but it can be
+		// renamed.
+		prev := exe + ".old"
+		os.Remove(prev)
+		if err := os.Rename(exe, prev); err != nil {
+			os.Remove(tmp.Name())
+			return fmt.Errorf("failed to replace %v: %v", exe, err)
+		}
+	}
+	if err := os.Rename(tmp.Name(), exe); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to replace %v: %v", exe, err)
+	}
+	return nil
+}
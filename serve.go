@@ -0,0 +1,208 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sniperkit/snk.fork.release-git-bot/config"
+	"github.com/sniperkit/snk.fork.release-git-bot/seal"
+	"github.com/sniperkit/snk.fork.release-git-bot/service"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// configPollInterval is how often the service config file is checked for
+// changes.
+const configPollInterval = 10 * time.Second
+
+func runServe(cfg *config.Config, args []string) error {
+	fs := newFlagSet("serve")
+	serviceConfig := fs.String("service", "", "the service config file with the tenants, see config.Service. It's reloaded on SIGHUP or when changed")
+	fs.Parse(args)
+
+	if *serviceConfig == "" {
+		return fmt.Errorf("-service is not set")
+	}
+	sc, err := loadServiceConfig(*serviceConfig)
+	if err != nil {
+		return err
+	}
+	runner := &tenantRunner{}
+	runner.setConfig(sc)
+	elector, err := service.NewElector(sc.LeaderElection, botClock)
+	if err != nil {
+		return err
+	}
+	s, err := service.New(sc, runner.run, botClock, elector)
+	if err != nil {
+		return err
+	}
+	stop, electorDone := make(chan struct{}), make(chan struct{})
+	go func() {
+		elector.Run(stop)
+		close(electorDone)
+	}()
+	go watchServiceConfig(*serviceConfig, func(sc *config.Service) error {
+		if err := s.Reload(sc); err != nil {
+			return err
+		}
+		runner.setConfig(sc)
+		return nil
+	})
+
+	mux := http.NewServeMux()
+	mux.Handle("/webhook", s)
+	mux.HandleFunc("/healthz", s.Healthz)
+	mux.HandleFunc("/readyz", s.Readyz)
+	srv := &http.Server{Addr: sc.Listen, Handler: mux}
+
+	// Release the leader lock on shutdown, so another replica takes over
+	// without waiting for it to expire.
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, os.Interrupt)
+	go func() {
+		<-sigs
+		close(stop)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}()
+
+	fmt.Printf("Serving %v tenants on %v\n", len(sc.Tenants), sc.Listen)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	<-electorDone
+	return nil
+}
+
+// loadServiceConfig loads the service config, and prepares the tenant dirs.
+// Commands run in the tenant state dirs, so the config paths are made
+// absolute.
+func loadServiceConfig(path string) (*config.Service, error) {
+	sc, err := config.LoadService(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range sc.Tenants {
+		if t.Config != "" {
+			if t.Config, err = filepath.Abs(t.Config); err != nil {
+				return nil, err
+			}
+		}
+		if err := os.MkdirAll(t.StateDir, 0700); err != nil {
+			return nil, fmt.Errorf("failed to create state dir of tenant %v: %v", t.Name, err)
+		}
+	}
+	return sc, nil
+}
+
+// watchServiceConfig reloads the service config on SIGHUP, or when the file is
+// modified. Invalid configs are logged and ignored.
+func watchServiceConfig(path string, reload func(sc *config.Service) error) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	tk := time.NewTicker(configPollInterval)
+	defer tk.Stop()
+
+	var lastMod time.Time
+	if fi, err := os.Stat(path); err == nil {
+		lastMod = fi.ModTime()
+	}
+	for {
+		select {
+		case <-hup:
+		case <-tk.C:
+			fi, err := os.Stat(path)
+			if err != nil || !fi.ModTime().After(lastMod) {
+				continue
+			}
+			lastMod = fi.ModTime()
+		}
+		sc, err := loadServiceConfig(path)
+		if err == nil {
+			err = reload(sc)
+		}
+		if err != nil {
+			log.Warningf("failed to reload service config, keeping the old one: %v", err)
+			continue
+		}
+		log.Infof("service config reloaded, %v tenants", len(sc.Tenants))
+	}
+}
+
+// tenantRunner runs each command as a child process of this binary, in the
+// tenant's state dir, with only the tenant's token.
+type tenantRunner struct {
+	mu sync.Mutex
+	// secrets are the env vars of all the credentials, removed from the child
+	// env.
+	secrets map[string]bool
+}
+
+func (r *tenantRunner) setConfig(sc *config.Service) {
+	secrets := map[string]bool{"GITHUB_TOKEN": true}
+	for _, t := range sc.Tenants {
+		secrets[t.TokenEnv] = true
+		secrets[t.SecretEnv] = true
+		if t.StateKeyEnv != "" {
+			secrets[t.StateKeyEnv] = true
+		}
+	}
+	r.mu.Lock()
+	r.secrets = secrets
+	r.mu.Unlock()
+}
+
+func (r *tenantRunner) run(t *config.Tenant, e *service.Event, command string) error {
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	ownerAndRepo := strings.SplitN(e.Repo, "/", 2)
+	args := []string{"-owner", ownerAndRepo[0], "-repo", ownerAndRepo[1]}
+	if t.Config != "" {
+		args = append(args, "-config", t.Config)
+	}
+	if e.Tag != "" {
+		args = append(args, "-version", strings.TrimPrefix(e.Tag, "v"))
+	}
+	args = append(args, strings.Fields(command)...)
+
+	r.mu.Lock()
+	var env []string
+	for _, kv := range os.Environ() {
+		if !r.secrets[strings.SplitN(kv, "=", 2)[0]] {
+			env = append(env, kv)
+		}
+	}
+	r.mu.Unlock()
+	env = append(env,
+		"GITHUB_TOKEN="+os.Getenv(t.TokenEnv),
+		"XDG_CACHE_HOME="+filepath.Join(t.StateDir, "cache"),
+	)
+	if t.StateKeyEnv != "" {
+		// Overrides the service wide key, if any.
+		env = append(env, seal.KeyEnv+"="+os.Getenv(t.StateKeyEnv))
+	}
+
+	log.Infof("tenant %v: executing %q", t.Name, "release-git-bot "+strings.Join(args, " "))
+	cmd := exec.Command(self, args...)
+	cmd.Dir = t.StateDir
+	cmd.Env = env
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
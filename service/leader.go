@@ -0,0 +1,366 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package service
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sniperkit/snk.fork.release-git-bot/clock"
+	"github.com/sniperkit/snk.fork.release-git-bot/config"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultLeaseDuration is the lease duration if it's not configured.
+const DefaultLeaseDuration = 15 * time.Second
+
+// Elector elects one leader among the replicas. A nil Elector is always the
+// leader, for single replica deployments.
+type Elector struct {
+	// clock is the time of the lease renewals and expiry.
+	clock    clock.Clock
+	id       string
+	duration time.Duration
+	lock     lock
+
+	mu      sync.Mutex
+	leader  bool
+	lastErr error
+	tried   bool
+}
+
+// lock is a lease held by one replica at a time.
+type lock interface {
+	// tryAcquire takes the lock for id at now if it's free or expired, or
+	// renews it if id already holds it. It returns whether id holds the lock.
+	tryAcquire(id string, d time.Duration, now time.Time) (bool, error)
+	// release frees the lock if id holds it.
+	release(id string) error
+}
+
+// NewElector creates an Elector for the config, renewing the lease on clk. If
+// clk is nil, it's clock.Real. It returns nil if c is nil.
+func NewElector(c *config.LeaderElection, clk clock.Clock) (*Elector, error) {
+	if c == nil {
+		return nil, nil
+	}
+	d := DefaultLeaseDuration
+	if c.Duration != "" {
+		var err error
+		if d, err = time.ParseDuration(c.Duration); err != nil {
+			return nil, fmt.Errorf("invalid leader election duration: %v", err)
+		}
+	}
+	id, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	if c.Name == "" {
+		return nil, fmt.Errorf("leader election has no name")
+	}
+	var l lock
+	switch c.Kind {
+	case "lease":
+		if l, err = newLeaseLock(c.Namespace, c.Name); err != nil {
+			return nil, err
+		}
+	case "file":
+		l = &fileLock{path: c.Name}
+	default:
+		return nil, fmt.Errorf("unknown leader election kind %q", c.Kind)
+	}
+	return &Elector{clock: clock.Or(clk), id: id, duration: d, lock: l}, nil
+}
+
+// Run acquires and renews the lock until stop is closed, then releases it.
+func (e *Elector) Run(stop <-chan struct{}) {
+	if e == nil {
+		return
+	}
+	t := e.clock.NewTicker(e.duration / 3)
+	defer t.Stop()
+	for {
+		ok, err := e.lock.tryAcquire(e.id, e.duration, e.clock.Now())
+		if err != nil {
+			log.Warningf("leader election: %v", err)
+		}
+		e.mu.Lock()
+		if ok != e.leader {
+			log.Infof("leader election: %v is leader: %v", e.id, ok)
+		}
+		e.leader, e.lastErr, e.tried = ok, err, true
+		e.mu.Unlock()
+
+		select {
+		case <-stop:
+			e.mu.Lock()
+			e.leader = false
+			e.mu.Unlock()
+			if err := e.lock.release(e.id); err != nil {
+				log.Warningf("leader election: failed to release: %v", err)
+			}
+			return
+		case <-t.C():
+		}
+	}
+}
+
+// IsLeader returns whether this replica is the leader.
+func (e *Elector) IsLeader() bool {
+	if e == nil {
+		return true
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leader
+}
+
+// healthy returns whether the last lock operation succeeded.
+func (e *Elector) healthy() bool {
+	if e == nil {
+		return true
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.tried && e.lastErr == nil
+}
+
+// record is the content of the lock file.
+type record struct {
+	Holder string    `json:"holder"`
+	Renew  time.Time `json:"renew"`
+}
+
+// fileLock is a lock file on a volume shared by the replicas. The lock file is
+// read and written while holding a guard file, created exclusively, so two
+// replicas never both take an expired lock.
+type fileLock struct {
+	path string
+}
+
+// guard creates the guard file of the lock. It returns false if another
+// replica holds it. A guard left by a crashed replica is removed once it's
+// older than d.
+func (f *fileLock) guard(d time.Duration) (bool, error) {
+	guard := f.path + ".guard"
+	g, err := os.OpenFile(guard, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err == nil {
+		return true, g.Close()
+	}
+	if !os.IsExist(err) {
+		return false, err
+	}
+	if fi, err := os.Stat(guard); err == nil && time.Since(fi.ModTime()) > d {
+		os.Remove(guard)
+	}
+	return false, nil
+}
+
+func (f *fileLock) read() (*record, error) {
+	b, err := ioutil.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	r := &record{}
+	if err := json.Unmarshal(b, r); err != nil {
+		return nil, fmt.Errorf("invalid lock file %v: %v", f.path, err)
+	}
+	return r, nil
+}
+
+func (f *fileLock) tryAcquire(id string, d time.Duration, now time.Time) (bool, error) {
+	ok, err := f.guard(d)
+	if !ok || err != nil {
+		return false, err
+	}
+	defer os.Remove(f.path + ".guard")
+	r, err := f.read()
+	if err != nil {
+		return false, err
+	}
+	if r != nil && r.Holder != id && now.Sub(r.Renew) < d {
+		return false, nil
+	}
+	b, err := json.Marshal(&record{Holder: id, Renew: now.UTC()})
+	if err != nil {
+		return false, err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(f.path), filepath.Base(f.path)+".tmp")
+	if err != nil {
+		return false, err
+	}
+	_, err = tmp.Write(b)
+	tmp.Close()
+	if err == nil {
+		err = os.Rename(tmp.Name(), f.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return false, err
+	}
+	return true, nil
+}
+
+func (f *fileLock) release(id string) error {
+	r, err := f.read()
+	if err != nil || r == nil || r.Holder != id {
+		return err
+	}
+	return os.Remove(f.path)
+}
+
+// The in cluster service account files.
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// leaseLock is a kubernetes coordination.k8s.io/v1 Lease, used from inside the
+// cluster with the pod service account.
+type leaseLock struct {
+	url   string
+	token string
+	hc    *http.Client
+}
+
+func newLeaseLock(namespace, name string) (*leaseLock, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("lease leader election only works in a kubernetes cluster")
+	}
+	token, err := ioutil.ReadFile(filepath.Join(serviceAccountDir, "token"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account token: %v", err)
+	}
+	if namespace == "" {
+		ns, err := ioutil.ReadFile(filepath.Join(serviceAccountDir, "namespace"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read namespace: %v", err)
+		}
+		namespace = strings.TrimSpace(string(ns))
+	}
+	ca, err := ioutil.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cluster CA: %v", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca)
+	return &leaseLock{
+		url:   fmt.Sprintf("https://%v:%v/apis/coordination.k8s.io/v1/namespaces/%v/leases/%v", host, port, namespace, name),
+		token: strings.TrimSpace(string(token)),
+		hc: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		},
+	}, nil
+}
+
+// lease is the part of the Lease object used here.
+type lease struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name            string `json:"name"`
+		ResourceVersion string `json:"resourceVersion,omitempty"`
+	} `json:"metadata"`
+	Spec struct {
+		HolderIdentity       string `json:"holderIdentity"`
+		LeaseDurationSeconds int    `json:"leaseDurationSeconds"`
+		RenewTime            string `json:"renewTime,omitempty"`
+	} `json:"spec"`
+}
+
+// microTime is the format of kubernetes MicroTime.
+const microTime = "2006-01-02T15:04:05.000000Z07:00"
+
+func (l *leaseLock) do(method, url string, in, out interface{}) (int, error) {
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			return 0, err
+		}
+	}
+	req, err := http.NewRequest(method, url, &body)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", "Bearer "+l.token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := l.hc.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 || out == nil {
+		return resp.StatusCode, nil
+	}
+	return resp.StatusCode, json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (l *leaseLock) tryAcquire(id string, d time.Duration, now time.Time) (bool, error) {
+	cur := &lease{}
+	status, err := l.do(http.MethodGet, l.url, nil, cur)
+	if err != nil {
+		return false, err
+	}
+	now = now.UTC()
+	switch status {
+	case http.StatusOK:
+		renew, _ := time.Parse(microTime, cur.Spec.RenewTime)
+		expiry := renew.Add(time.Duration(cur.Spec.LeaseDurationSeconds) * time.Second)
+		if cur.Spec.HolderIdentity != "" && cur.Spec.HolderIdentity != id && now.Before(expiry) {
+			return false, nil
+		}
+	case http.StatusNotFound:
+		cur = nil
+	default:
+		return false, fmt.Errorf("failed to get lease: status %v", status)
+	}
+
+	next := &lease{APIVersion: "coordination.k8s.io/v1", Kind: "Lease"}
+	next.Metadata.Name = l.url[strings.LastIndex(l.url, "/")+1:]
+	next.Spec.HolderIdentity = id
+	next.Spec.LeaseDurationSeconds = int(d / time.Second)
+	next.Spec.RenewTime = now.Format(microTime)
+	if cur == nil {
+		status, err = l.do(http.MethodPost, l.url[:strings.LastIndex(l.url, "/")], next, nil)
+	} else {
+		// The update fails with a conflict if another replica changed the
+		// lease since it was read.
+		next.Metadata.ResourceVersion = cur.Metadata.ResourceVersion
+		status, err = l.do(http.MethodPut, l.url, next, nil)
+	}
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case status == http.StatusConflict:
+		return false, nil
+	case status >= 300:
+		return false, fmt.Errorf("failed to update lease: status %v", status)
+	}
+	return true, nil
+}
+
+func (l *leaseLock) release(id string) error {
+	cur := &lease{}
+	status, err := l.do(http.MethodGet, l.url, nil, cur)
+	if err != nil || status != http.StatusOK || cur.Spec.HolderIdentity != id {
+		return err
+	}
+	cur.Spec.HolderIdentity = ""
+	_, err = l.do(http.MethodPut, l.url, cur, nil)
+	return err
+}
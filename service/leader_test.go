@@ -0,0 +1,113 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sniperkit/snk.fork.release-git-bot/clock"
+)
+
+// eventually fails t if cond doesn't become true soon, for the goroutines
+// woken by the fake clock.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for i := 0; i < 200; i++ {
+		if cond() {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %v", what)
+}
+
+func tempLock(t *testing.T) (*fileLock, func()) {
+	dir, err := ioutil.TempDir("", "leader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &fileLock{path: filepath.Join(dir, "lock")}, func() { os.RemoveAll(dir) }
+}
+
+func TestFileLockExpiry(t *testing.T) {
+	l, cleanup := tempLock(t)
+	defer cleanup()
+	clk := clock.NewFake(time.Date(2018, 7, 31, 17, 0, 0, 0, time.UTC))
+	d := 15 * time.Second
+
+	if ok, err := l.tryAcquire("a", d, clk.Now()); !ok || err != nil {
+		t.Fatalf("a: tryAcquire() = %v, %v, want true", ok, err)
+	}
+	clk.Advance(d - time.Second)
+	if ok, err := l.tryAcquire("b", d, clk.Now()); ok || err != nil {
+		t.Fatalf("b: tryAcquire() before expiry = %v, %v, want false", ok, err)
+	}
+	if ok, err := l.tryAcquire("a", d, clk.Now()); !ok || err != nil {
+		t.Fatalf("a: renew = %v, %v, want true", ok, err)
+	}
+	clk.Advance(d)
+	if ok, err := l.tryAcquire("b", d, clk.Now()); !ok || err != nil {
+		t.Fatalf("b: tryAcquire() after expiry = %v, %v, want true", ok, err)
+	}
+	if ok, err := l.tryAcquire("a", d, clk.Now()); ok || err != nil {
+		t.Fatalf("a: tryAcquire() held by b = %v, %v, want false", ok, err)
+	}
+}
+
+func TestElectorRun(t *testing.T) {
+	l, cleanup := tempLock(t)
+	defer cleanup()
+	clk := clock.NewFake(time.Date(2018, 7, 31, 17, 0, 0, 0, time.UTC))
+	e := &Elector{clock: clk, id: "a", duration: 15 * time.Second, lock: l}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		e.Run(stop)
+		close(done)
+	}()
+	eventually(t, "the first election", e.healthy)
+	if !e.IsLeader() {
+		t.Fatalf("IsLeader() = false, want true")
+	}
+
+	// The lease is renewed every duration/3.
+	clk.Advance(5 * time.Second)
+	want := clk.Now()
+	eventually(t, "the renewal", func() bool {
+		r, err := l.read()
+		return err == nil && r != nil && r.Renew.Equal(want)
+	})
+
+	close(stop)
+	<-done
+	if e.IsLeader() {
+		t.Errorf("IsLeader() after stop = true, want false")
+	}
+	if r, err := l.read(); r != nil || err != nil {
+		t.Errorf("lock after stop = %+v, %v, want released", r, err)
+	}
+}
+
+func TestDailyNext(t *testing.T) {
+	d := &daily{hour: 9, minute: 30, loc: time.UTC}
+	clk := clock.NewFake(time.Date(2018, 7, 31, 8, 0, 0, 0, time.UTC))
+	for _, tc := range []struct {
+		advance time.Duration
+		want    time.Time
+	}{
+		{0, time.Date(2018, 7, 31, 9, 30, 0, 0, time.UTC)},
+		{90 * time.Minute, time.Date(2018, 8, 1, 9, 30, 0, 0, time.UTC)},
+		{time.Minute, time.Date(2018, 8, 1, 9, 30, 0, 0, time.UTC)},
+	} {
+		clk.Advance(tc.advance)
+		if got := d.next(clk.Now()); !got.Equal(tc.want) {
+			t.Errorf("next(%v) = %v, want %v", clk.Now(), got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,341 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+// Package service serves github webhooks for many tenants, and runs the
+// configured bot commands for their events.
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sniperkit/snk.fork.release-git-bot/clock"
+	"github.com/sniperkit/snk.fork.release-git-bot/config"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// maxPayload is the max webhook payload size, as documented by github.
+const maxPayload = 25 << 20
+
+// Event is a webhook event.
+type Event struct {
+	// Name is "<X-GitHub-Event>.<action>", e.g. "release.published".
+	Name string
+	// Delivery is the X-GitHub-Delivery id.
+	Delivery string
+	// Repo is the repo of the event, in the format of owner/repo.
+	Repo string
+	// Tag is the release tag for release events.
+	Tag string
+	// Payload is the raw payload.
+	Payload []byte
+}
+
+// Runner runs a bot command for the tenant's event. Runs of one tenant are
+// never concurrent.
+type Runner func(t *config.Tenant, e *Event, command string) error
+
+// Server is the webhook handler. It also runs the scheduled commands if it's
+// the leader.
+type Server struct {
+	// elector elects the replica running the scheduled commands. If nil, the
+	// schedules always run.
+	elector *Elector
+	run     Runner
+	clock   clock.Clock
+
+	mu      sync.Mutex
+	tenants map[string]*tenant // By repo.
+	// locks serialize the runs of each tenant (by name), across reloads.
+	locks map[string]*sync.Mutex
+	// stopSchedules stops the schedules of the current config.
+	stopSchedules chan struct{}
+}
+
+type tenant struct {
+	c  *config.Tenant
+	mu *sync.Mutex
+}
+
+// New creates a Server for the config, and starts the schedules on clk, run
+// while e is the leader. If clk is nil, it's clock.Real.
+func New(c *config.Service, run Runner, clk clock.Clock, e *Elector) (*Server, error) {
+	s := &Server{elector: e, run: run, clock: clock.Or(clk), locks: make(map[string]*sync.Mutex)}
+	if err := s.Reload(c); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload replaces the config, and restarts the schedules. If c is invalid, the
+// old config is kept. Running commands are not interrupted.
+func (s *Server) Reload(c *config.Service) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tenants, err := s.newTenants(c)
+	if err != nil {
+		return err
+	}
+	if s.stopSchedules != nil {
+		close(s.stopSchedules)
+	}
+	s.tenants = tenants
+	s.stopSchedules = make(chan struct{})
+	for _, tc := range c.Tenants {
+		for _, sc := range tc.Schedule {
+			t := tenants[strings.ToLower(tc.Repos[0])]
+			if sc.At != "" {
+				at, _ := parseDaily(sc)
+				go s.scheduleDaily(t, at, sc.Commands, s.stopSchedules)
+				continue
+			}
+			d, _ := time.ParseDuration(sc.Every)
+			go s.schedule(t, d, sc.Commands, s.stopSchedules)
+		}
+	}
+	return nil
+}
+
+func (s *Server) newTenants(c *config.Service) (map[string]*tenant, error) {
+	ret := make(map[string]*tenant)
+	for _, tc := range c.Tenants {
+		if tc.Name == "" {
+			return nil, fmt.Errorf("tenant has no name")
+		}
+		if tc.SecretEnv == "" || os.Getenv(tc.SecretEnv) == "" {
+			return nil, fmt.Errorf("tenant %v has no webhook secret, set secret_env and the env var", tc.Name)
+		}
+		if tc.StateDir == "" {
+			return nil, fmt.Errorf("tenant %v has no state_dir", tc.Name)
+		}
+		for _, sc := range tc.Schedule {
+			switch {
+			case sc.At != "" && sc.Every != "":
+				return nil, fmt.Errorf("tenant %v has a schedule with both every and at", tc.Name)
+			case sc.At != "":
+				if _, err := parseDaily(sc); err != nil {
+					return nil, fmt.Errorf("tenant %v has invalid schedule: %v", tc.Name, err)
+				}
+			default:
+				if d, err := time.ParseDuration(sc.Every); err != nil || d <= 0 {
+					return nil, fmt.Errorf("tenant %v has invalid schedule %q", tc.Name, sc.Every)
+				}
+			}
+			if len(tc.Repos) == 0 {
+				return nil, fmt.Errorf("tenant %v has schedules but no repos", tc.Name)
+			}
+		}
+		mu, ok := s.locks[tc.Name]
+		if !ok {
+			mu = &sync.Mutex{}
+			s.locks[tc.Name] = mu
+		}
+		t := &tenant{c: tc, mu: mu}
+		for _, r := range tc.Repos {
+			r = strings.ToLower(r)
+			if other, ok := ret[r]; ok {
+				return nil, fmt.Errorf("repo %v is in both tenant %v and %v", r, other.c.Name, tc.Name)
+			}
+			ret[r] = t
+		}
+	}
+	return ret, nil
+}
+
+// ServeHTTP handles a webhook delivery. The commands are run in the
+// background, after the delivery is acknowledged.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxPayload))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	e, err := parseEvent(r.Header, body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	t, ok := s.tenants[strings.ToLower(e.Repo)]
+	s.mu.Unlock()
+	if !ok {
+		http.Error(w, "unknown repo", http.StatusNotFound)
+		return
+	}
+	// Verify before anything is done for the tenant.
+	if !validSignature(r.Header.Get("X-Hub-Signature-256"), body, os.Getenv(t.c.SecretEnv)) {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+	commands := t.c.On[e.Name]
+	if len(commands) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	log.Infof("delivery %v: %v for tenant %v, running %q", e.Delivery, e.Name, t.c.Name, commands)
+	go s.handle(t, e, commands)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// schedule runs the commands for each repo of the tenant every d, while this
+// replica is the leader.
+func (s *Server) schedule(t *tenant, d time.Duration, commands []string, stop <-chan struct{}) {
+	tk := s.clock.NewTicker(d)
+	defer tk.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-tk.C():
+		}
+		s.runSchedule(t, commands)
+	}
+}
+
+// daily is the time of day of a daily schedule.
+type daily struct {
+	hour, minute int
+	loc          *time.Location
+}
+
+// parseDaily parses the at and timezone of the schedule.
+func parseDaily(sc *config.Schedule) (*daily, error) {
+	t, err := time.Parse("15:04", sc.At)
+	if err != nil {
+		return nil, fmt.Errorf("invalid at %q, want HH:MM", sc.At)
+	}
+	loc := time.UTC
+	if sc.Timezone != "" {
+		if loc, err = time.LoadLocation(sc.Timezone); err != nil {
+			return nil, fmt.Errorf("invalid timezone %q: %v", sc.Timezone, err)
+		}
+	}
+	return &daily{hour: t.Hour(), minute: t.Minute(), loc: loc}, nil
+}
+
+// next returns the first time of day after now.
+func (d *daily) next(now time.Time) time.Time {
+	n := now.In(d.loc)
+	next := time.Date(n.Year(), n.Month(), n.Day(), d.hour, d.minute, 0, 0, d.loc)
+	if !next.After(n) {
+		next = time.Date(n.Year(), n.Month(), n.Day()+1, d.hour, d.minute, 0, 0, d.loc)
+	}
+	return next
+}
+
+// scheduleDaily runs the commands for each repo of the tenant every day at
+// the time of day, while this replica is the leader.
+func (s *Server) scheduleDaily(t *tenant, at *daily, commands []string, stop <-chan struct{}) {
+	for {
+		now := s.clock.Now()
+		select {
+		case <-stop:
+			return
+		case <-s.clock.After(at.next(now).Sub(now)):
+		}
+		s.runSchedule(t, commands)
+	}
+}
+
+// runSchedule runs the scheduled commands for each repo of the tenant, if this
+// replica is the leader.
+func (s *Server) runSchedule(t *tenant, commands []string) {
+	if !s.elector.IsLeader() {
+		return
+	}
+	for _, r := range t.c.Repos {
+		s.handle(t, &Event{Name: "schedule", Delivery: "schedule", Repo: r}, commands)
+	}
+}
+
+// Healthz always returns 200, the process is alive as long as it serves.
+func (s *Server) Healthz(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+// Readyz returns 200 if the config is loaded, and the leader election (if
+// any) is working.
+func (s *Server) Readyz(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	loaded := s.tenants != nil
+	s.mu.Unlock()
+	switch {
+	case !loaded:
+		http.Error(w, "config not loaded", http.StatusServiceUnavailable)
+	case !s.elector.healthy():
+		http.Error(w, "leader election not working", http.StatusServiceUnavailable)
+	default:
+		fmt.Fprintln(w, "ok")
+	}
+}
+
+func (s *Server) handle(t *tenant, e *Event, commands []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, c := range commands {
+		if err := s.run(t.c, e, c); err != nil {
+			log.Warningf("delivery %v: tenant %v: %q failed: %v", e.Delivery, t.c.Name, c, err)
+			return
+		}
+	}
+}
+
+func parseEvent(h http.Header, body []byte) (*Event, error) {
+	name := h.Get("X-GitHub-Event")
+	if name == "" {
+		return nil, fmt.Errorf("missing X-GitHub-Event")
+	}
+	var p struct {
+		Action     string `json:"action"`
+		Repository struct {
+			FullName string `json:"full_name"`
+		} `json:"repository"`
+		Release struct {
+			TagName string `json:"tag_name"`
+		} `json:"release"`
+	}
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse payload: %v", err)
+	}
+	if p.Repository.FullName == "" {
+		return nil, fmt.Errorf("payload has no repository")
+	}
+	if p.Action != "" {
+		name += "." + p.Action
+	}
+	return &Event{
+		Name:     name,
+		Delivery: h.Get("X-GitHub-Delivery"),
+		Repo:     p.Repository.FullName,
+		Tag:      p.Release.TagName,
+		Payload:  body,
+	}, nil
+}
+
+// validSignature checks the X-Hub-Signature-256 header, "sha256=<hex hmac>".
+func validSignature(header string, body []byte, secret string) bool {
+	if secret == "" || !strings.HasPrefix(header, "sha256=") {
+		return false
+	}
+	sig, err := hex.DecodeString(strings.TrimPrefix(header, "sha256="))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(sig, mac.Sum(nil))
+}
@@ -0,0 +1,235 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sniperkit/snk.fork.release-git-bot/config"
+	"github.com/sniperkit/snk.fork.release-git-bot/ghclient"
+	"github.com/sniperkit/snk.fork.release-git-bot/notes"
+	"github.com/sniperkit/snk.fork.release-git-bot/policy"
+	"github.com/sniperkit/snk.fork.release-git-bot/version"
+)
+
+// shadowReport compares what the bot would have done for a release with what
+// the release manager did manually.
+type shadowReport struct {
+	Tag string `json:"tag"`
+	// Checks are the version inference and plan checks, with the bot's
+	// expectation and what was found.
+	Checks []*shadowCheck `json:"checks"`
+	// MissingPRs are in the bot's notes but not the manual ones, and ExtraPRs
+	// the other way around.
+	MissingPRs []int `json:"missing_prs"`
+	ExtraPRs   []int `json:"extra_prs"`
+	// NotesDiff is the line diff from the manual notes to the bot's notes,
+	// empty if they are the same.
+	NotesDiff []string `json:"notes_diff"`
+}
+
+type shadowCheck struct {
+	Name   string `json:"name"`
+	Want   string `json:"want"`
+	Got    string `json:"got"`
+	Differ bool   `json:"differ"`
+}
+
+// differences returns the number of differences in the report.
+func (r *shadowReport) differences() int {
+	n := len(r.MissingPRs) + len(r.ExtraPRs)
+	for _, c := range r.Checks {
+		if c.Differ {
+			n++
+		}
+	}
+	if len(r.NotesDiff) > 0 {
+		n++
+	}
+	return n
+}
+
+func runShadow(cfg *config.Config, args []string) error {
+	fs := newFlagSet("shadow")
+	format := fs.String("format", "text", "output format, text or json")
+	fs.Parse(args)
+
+	ver, err := versionScheme.Parse(*newVersion)
+	if err != nil {
+		return fmt.Errorf("invalid version string %q: %v", *newVersion, err)
+	}
+	upstream := newClient(upstreamUser, *repo)
+	r, err := shadowRelease(cfg, upstream, ver)
+	if err != nil {
+		return err
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	} else {
+		printShadowReport(r)
+	}
+	if n := r.differences(); n > 0 {
+		return fmt.Errorf("%v differences from the manual release", n)
+	}
+	return nil
+}
+
+// shadowRelease computes everything the bot would do for the release, without
+// changing anything, and compares it with the manual release.
+func shadowRelease(cfg *config.Config, upstream *ghclient.Client, ver *version.Version) (*shadowReport, error) {
+	release, err := upstream.GetReleaseByTagContext(runCtx, ver.Tag())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the manual release %v: %v", ver.Tag(), err)
+	}
+	r := &shadowReport{Tag: ver.Tag()}
+	check := func(name, want, got string) {
+		r.Checks = append(r.Checks, &shadowCheck{Name: name, Want: want, Got: got, Differ: want != got})
+	}
+
+	// Version inference.
+	prev := previousTag(upstream, ver)
+	check("previous release", prev, previousRelease(upstream, ver))
+	tagSHA, err := upstream.GetCommitSHAContext(runCtx, ver.Tag())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %v commit: %v", ver.Tag(), err)
+	}
+	onBranch := "not found"
+	if ok, err := upstream.IsAncestorContext(runCtx, tagSHA, ver.Branch()); err == nil {
+		onBranch = fmt.Sprint(ok)
+	}
+	check(fmt.Sprintf("tag on release branch %v", ver.Branch()), "true", onBranch)
+
+	// The plan, for the changes that can be observed afterwards.
+	plan := releasePlan(cfg, ver, mainlineBranch(cfg.Mainline, ver), upstreamUser)
+	for _, op := range plan.Operations {
+		if op.Repo != plan.Repo {
+			continue
+		}
+		switch op.Kind {
+		case policy.CreateBranch:
+			got := "exists"
+			if _, err := upstream.GetCommitSHAContext(runCtx, op.Target); err != nil {
+				got = "missing"
+			}
+			check("branch "+op.Target, "exists", got)
+		case policy.PublishRelease:
+			got := "published"
+			if release.GetDraft() {
+				got = "draft"
+			}
+			check("release "+op.Target, "published", got)
+		}
+	}
+
+	// Notes.
+	ns, _ := releaseNote(upstream, ver)
+	addNotesRepos(cfg, ns, ver)
+	botNotes, err := renderNotes(cfg, ns)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render release notes: %v", err)
+	}
+	manualNotes := release.GetBody()
+	r.MissingPRs, r.ExtraPRs = diffPRNumbers(prNumbersIn(botNotes), prNumbersIn(manualNotes))
+	r.NotesDiff = notes.LineDiff(normalizeNotes(manualNotes), normalizeNotes(botNotes))
+	return r, nil
+}
+
+// previousRelease returns the tag of the latest published release before ver,
+// i.e. the previous release as the release manager sees it, or "" if there's
+// none.
+func previousRelease(upstream *ghclient.Client, ver *version.Version) string {
+	tags, err := upstream.ListTagsContext(runCtx)
+	if err != nil {
+		return ""
+	}
+	vs := version.ParseTags(ver.Scheme(), tags)
+	for i := len(vs) - 1; i >= 0; i-- {
+		v := vs[i]
+		if v.IsPrerelease() || v.Compare(ver) >= 0 {
+			continue
+		}
+		if rel, err := upstream.GetReleaseByTagContext(runCtx, v.Tag()); err == nil && !rel.GetDraft() && !rel.GetPrerelease() {
+			return v.Tag()
+		}
+	}
+	return ""
+}
+
+var prRefRE = regexp.MustCompile(`(?:#|/pull/)(\d+)`)
+
+// prNumbersIn returns the PR numbers referenced in the notes.
+func prNumbersIn(s string) map[int]bool {
+	ret := make(map[int]bool)
+	for _, m := range prRefRE.FindAllStringSubmatch(s, -1) {
+		n, _ := strconv.Atoi(m[1])
+		ret[n] = true
+	}
+	return ret
+}
+
+// diffPRNumbers returns the sorted numbers only in bot, and only in manual.
+func diffPRNumbers(bot, manual map[int]bool) (missing, extra []int) {
+	for n := range bot {
+		if !manual[n] {
+			missing = append(missing, n)
+		}
+	}
+	for n := range manual {
+		if !bot[n] {
+			extra = append(extra, n)
+		}
+	}
+	sort.Ints(missing)
+	sort.Ints(extra)
+	return missing, extra
+}
+
+// normalizeNotes splits the notes into lines, ignoring line endings, trailing
+// spaces and blank lines.
+func normalizeNotes(s string) []string {
+	var ret []string
+	for _, l := range strings.Split(strings.Replace(s, "\r\n", "\n", -1), "\n") {
+		if l = strings.TrimRight(l, " \t"); l != "" {
+			ret = append(ret, l)
+		}
+	}
+	return ret
+}
+
+func printShadowReport(r *shadowReport) {
+	fmt.Printf("# Shadow run of %v\n\n", r.Tag)
+	for _, c := range r.Checks {
+		mark := "ok  "
+		if c.Differ {
+			mark = "DIFF"
+		}
+		fmt.Printf(" %v %v: bot %q, manual %q\n", mark, c.Name, c.Want, c.Got)
+	}
+	fmt.Println()
+	if len(r.MissingPRs) > 0 {
+		fmt.Printf("PRs in the bot's notes but not the manual ones: %v\n", r.MissingPRs)
+	}
+	if len(r.ExtraPRs) > 0 {
+		fmt.Printf("PRs in the manual notes but not the bot's: %v\n", r.ExtraPRs)
+	}
+	if len(r.NotesDiff) == 0 {
+		fmt.Println("Notes are the same.")
+		return
+	}
+	fmt.Println("Notes diff (- manual, + bot):")
+	for _, l := range r.NotesDiff {
+		fmt.Println(l)
+	}
+}
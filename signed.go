@@ -0,0 +1,53 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/sniperkit/snk.fork.release-git-bot/ghclient"
+	"github.com/sniperkit/snk.fork.release-git-bot/version"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// checkSignedCommits exits if any commit on the release branch since the
+// previous release is not signed, or its signature is not verified by github
+// (both GPG and SSH signatures are verified by github).
+func checkSignedCommits(upstream *ghclient.Client, ver *version.Version, releaseBranch string) {
+	prevTag := previousTag(upstream, ver)
+	if prevTag == "" {
+		log.Fatalf("no release before %v to check the commits since", ver.Tag())
+	}
+	commits, err := upstream.GetCommitsBetweenContext(runCtx, prevTag, releaseBranch)
+	if err != nil {
+		log.Fatalf("failed to get commits between %v and %v: %v", prevTag, releaseBranch, err)
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"commit", "author", "reason", "message"})
+	var unsigned int
+	for _, cmt := range commits {
+		v := cmt.GetCommit().GetVerification()
+		if v.GetVerified() {
+			continue
+		}
+		unsigned++
+		reason := v.GetReason()
+		if reason == "" {
+			reason = "unsigned"
+		}
+		msg := strings.SplitN(cmt.GetCommit().GetMessage(), "\n", 2)[0]
+		table.Append([]string{cmt.GetSHA()[:7], cmt.GetCommit().GetAuthor().GetEmail(), reason, msg})
+	}
+	if unsigned > 0 {
+		fmt.Printf("%v of %v commits between %v and %v are not verified:\n", unsigned, len(commits), prevTag, releaseBranch)
+		table.Render()
+		log.Fatal("all commits in the release must be signed")
+	}
+	fmt.Printf("All %v commits between %v and %v are verified\n", len(commits), prevTag, releaseBranch)
+}
@@ -0,0 +1,154 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+// Package state persists the progress of a release, so an interrupted
+// release can be resumed without redoing the finished steps.
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sniperkit/snk.fork.release-git-bot/clock"
+	"github.com/sniperkit/snk.fork.release-git-bot/seal"
+)
+
+// State is the checkpoint of one release.
+type State struct {
+	Repo    string `json:"repo"`
+	Version string `json:"version"`
+
+	// Done contains the names of the finished steps.
+	Done map[string]time.Time `json:"done"`
+	// Values are the outputs of the steps, e.g. the created pull request urls.
+	Values map[string]string `json:"values"`
+
+	// Redact, if not nil, scrubs the secrets from the file content before
+	// it's saved.
+	Redact func([]byte) []byte `json:"-"`
+	// Clock is the time the steps are marked done at. If nil, it's
+	// clock.Real.
+	Clock clock.Clock `json:"-"`
+
+	mu   sync.Mutex
+	path string
+	key  *seal.Key
+}
+
+// Load reads the state from the file at path. If the file doesn't exist, a
+// new state for repo and version is returned.
+//
+// If key is not nil, the file is encrypted with it when it's saved. A plaintext
+// file is still loaded, and encrypted on the next save.
+//
+// It's an error if the file is for a different repo or version.
+func Load(path, repo, version string, key *seal.Key) (*State, error) {
+	s := &State{
+		Repo:    repo,
+		Version: version,
+		Done:    make(map[string]time.Time),
+		Values:  make(map[string]string),
+		path:    path,
+		key:     key,
+	}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %v", err)
+	}
+	if b, err = key.Open(b); err != nil {
+		return nil, fmt.Errorf("failed to read state file %q: %v", path, err)
+	}
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %q: %v", path, err)
+	}
+	if s.Repo != repo || s.Version != version {
+		return nil, fmt.Errorf("state file %q is for %v %v, not %v %v", path, s.Repo, s.Version, repo, version)
+	}
+	return s, nil
+}
+
+// Path returns the file path of the state.
+func (s *State) Path() string {
+	return s.path
+}
+
+// IsDone returns whether the step is finished.
+func (s *State) IsDone(step string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.Done[step]
+	return ok
+}
+
+// MarkDone marks the step as finished, and saves the state.
+func (s *State) MarkDone(step string) error {
+	s.mu.Lock()
+	s.Done[step] = clock.Or(s.Clock).Now().UTC()
+	s.mu.Unlock()
+	return s.Save()
+}
+
+// Set sets a value, and saves the state.
+func (s *State) Set(key, value string) error {
+	s.mu.Lock()
+	s.Values[key] = value
+	s.mu.Unlock()
+	return s.Save()
+}
+
+// Get returns a value, or "" if it's not set.
+func (s *State) Get(key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Values[key]
+}
+
+// Snapshot returns the content of the state file: the redacted JSON content
+// of the state, encrypted with the key of the state if it has one. It's e.g.
+// for a crash report, which doesn't leak an encrypted state.
+func (s *State) Snapshot() ([]byte, error) {
+	s.mu.Lock()
+	b, err := json.MarshalIndent(s, "", "  ")
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if s.Redact != nil {
+		b = s.Redact(b)
+	}
+	if b, err = s.key.Seal(b); err != nil {
+		return nil, fmt.Errorf("failed to encrypt state: %v", err)
+	}
+	return b, nil
+}
+
+// Save writes the state to its file. The file is replaced atomically, so it's
+// never left half written.
+func (s *State) Save() error {
+	b, err := s.Snapshot()
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to save state: %v", err)
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to save state: %v", err)
+	}
+	tmp.Close()
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to save state: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"text/template"
+
+	"github.com/sniperkit/snk.fork.release-git-bot/config"
+	"github.com/sniperkit/snk.fork.release-git-bot/notes"
+	"github.com/sniperkit/snk.fork.release-git-bot/notestest"
+)
+
+// notesTemplate returns the notes template in the config, or the default
+// template, with the section templates in the config.
+func notesTemplate(cfg *config.Config) (*template.Template, error) {
+	return notes.ParseTemplateFiles(cfg.NotesTemplate, cfg.SectionTemplates)
+}
+
+// renderNotes renders the notes with the template in the config.
+func renderNotes(cfg *config.Config, ns *notes.Notes) (string, error) {
+	t, err := notesTemplate(cfg)
+	if err != nil {
+		return "", err
+	}
+	return ns.Render(t)
+}
+
+// renderDeveloperNotes renders the developer changelog of the notes with the
+// template in the config.
+func renderDeveloperNotes(cfg *config.Config, ns *notes.Notes) (string, error) {
+	var (
+		t   *template.Template
+		err error
+	)
+	if cfg.DeveloperNotes.Template == "" {
+		t, err = notes.ParseTemplate("developer", notes.DeveloperTemplate)
+	} else {
+		t, err = notes.ParseTemplateFile(cfg.DeveloperNotes.Template)
+	}
+	if err != nil {
+		return "", err
+	}
+	return ns.Render(t)
+}
+
+func runTemplate(cfg *config.Config, args []string) error {
+	if len(args) == 0 || args[0] != "check" {
+		return fmt.Errorf("usage: template check [-file template] [-fixture notes.json] [-golden notes.md]")
+	}
+	fs := newFlagSet("template check")
+	file := fs.String("file", cfg.NotesTemplate, "the template file to check, default to notes_template in the config")
+	fixture := fs.String("fixture", "", "a json encoded notes.Notes to render the template with, default to the bundled fixture")
+	golden := fs.String("golden", "", "a golden file to compare the rendered notes with, see package notestest. Set $UPDATE_GOLDEN to write it")
+	fs.Parse(args[1:])
+
+	t, err := notes.ParseTemplateFiles(*file, cfg.SectionTemplates)
+	if err != nil {
+		return err
+	}
+	if err := notes.CheckTemplate(t); err != nil {
+		return err
+	}
+
+	ns := notes.Fixture()
+	if *fixture != "" {
+		b, err := ioutil.ReadFile(*fixture)
+		if err != nil {
+			return err
+		}
+		ns = new(notes.Notes)
+		if err := json.Unmarshal(b, ns); err != nil {
+			return fmt.Errorf("failed to parse fixture %v: %v", *fixture, err)
+		}
+	}
+	out, err := ns.Render(t)
+	if err != nil {
+		return err
+	}
+	if *golden == "" {
+		fmt.Println(out)
+		return nil
+	}
+	if os.Getenv(notestest.UpdateEnv) != "" {
+		return ioutil.WriteFile(*golden, []byte(out), 0644)
+	}
+	want, err := ioutil.ReadFile(*golden)
+	if err != nil {
+		return err
+	}
+	if d := notestest.Diff(string(want), out); d != "" {
+		return fmt.Errorf("rendered notes differ from %v (- golden, + rendered):\n%v", *golden, d)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sniperkit/snk.fork.release-git-bot/config"
+	"github.com/sniperkit/snk.fork.release-git-bot/notes"
+)
+
+// defaultDateFormat is the layout of the dates if the config has no
+// date_format.
+const defaultDateFormat = "2006-01-02"
+
+var (
+	// releaseZone is the timezone of the dates and times of the release,
+	// from the config, default to UTC.
+	releaseZone = time.UTC
+	// dateFormat is the layout of the dates shown to humans.
+	dateFormat = defaultDateFormat
+)
+
+// loadTimeConfig sets releaseZone and dateFormat from the config.
+func loadTimeConfig(c *config.Time) error {
+	if c == nil {
+		return nil
+	}
+	if c.Zone != "" {
+		loc, err := time.LoadLocation(c.Zone)
+		if err != nil {
+			return fmt.Errorf("invalid time zone %q: %v", c.Zone, err)
+		}
+		releaseZone = loc
+	}
+	if c.DateFormat != "" {
+		dateFormat = c.DateFormat
+	}
+	notes.FormatDate = formatDate
+	return nil
+}
+
+// formatDate formats the date of t in the release timezone.
+func formatDate(t time.Time) string {
+	return t.In(releaseZone).Format(dateFormat)
+}
+
+// localLayouts are the layouts of the times without offset, parsed in the
+// release timezone.
+var localLayouts = []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02"}
+
+// parseTime parses a time in RFC 3339 (e.g. 2018-08-01T16:00:00Z), or without
+// offset in the release timezone (e.g. 2018-08-01 09:00, or 2018-08-01 for
+// midnight).
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range localLayouts {
+		if t, err := time.ParseInLocation(layout, s, releaseZone); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("want RFC 3339, or YYYY-MM-DD[ HH:MM] in %v", releaseZone)
+}
@@ -0,0 +1,136 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Span kinds and status codes defined by OTLP.
+const (
+	spanKindInternal = 1
+	spanKindClient   = 3
+
+	statusCodeOK    = 1
+	statusCodeError = 2
+)
+
+type otlpRequest struct {
+	ResourceSpans []*otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource      `json:"resource"`
+	ScopeSpans []*otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []*otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope   `json:"scope"`
+	Spans []*otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []*otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+func otlpValue(v interface{}) map[string]interface{} {
+	switch v := v.(type) {
+	case bool:
+		return map[string]interface{}{"boolValue": v}
+	case int:
+		// int64 values are strings in the json encoding.
+		return map[string]interface{}{"intValue": strconv.Itoa(v)}
+	case float64:
+		return map[string]interface{}{"doubleValue": v}
+	}
+	return map[string]interface{}{"stringValue": fmt.Sprint(v)}
+}
+
+// Flush exports all the ended spans, and removes them from the tracer.
+func (t *Tracer) Flush() error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	ended := t.ended
+	t.ended = nil
+	t.mu.Unlock()
+	if len(ended) == 0 {
+		return nil
+	}
+
+	scope := &otlpScopeSpans{Scope: otlpScope{Name: "release-git-bot"}}
+	for _, s := range ended {
+		span := &otlpSpan{
+			TraceID:           t.traceID,
+			SpanID:            s.id,
+			ParentSpanID:      s.parentID,
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Status:            otlpStatus{Code: statusCodeOK},
+		}
+		for k, v := range s.attrs {
+			span.Attributes = append(span.Attributes, &otlpKeyValue{Key: k, Value: otlpValue(v)})
+		}
+		if s.err != nil {
+			span.Status = otlpStatus{Code: statusCodeError, Message: s.err.Error()}
+		}
+		scope.Spans = append(scope.Spans, span)
+	}
+	req := &otlpRequest{ResourceSpans: []*otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []*otlpKeyValue{
+			{Key: "service.name", Value: otlpValue(t.service)},
+		}},
+		ScopeSpans: []*otlpScopeSpans{scope},
+	}}}
+
+	b, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	url := strings.TrimSuffix(t.endpoint, "/") + "/v1/traces"
+	// Use the default client, the exporter must not be traced itself.
+	resp, err := http.Post(url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("failed to export spans: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to export spans to %v: %v", url, resp.Status)
+	}
+	return nil
+}
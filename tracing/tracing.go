@@ -0,0 +1,137 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+// Package tracing records spans for the workflow steps and github API calls,
+// and exports them with the OTLP/HTTP json protocol, so they can be viewed
+// with any OpenTelemetry compatible backend.
+//
+// A nil *Tracer is valid and does nothing, so tracing can be optional.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Tracer creates spans and exports them.
+type Tracer struct {
+	endpoint string
+	service  string
+	traceID  string
+
+	mu      sync.Mutex
+	current *Span
+	ended   []*Span
+}
+
+// New creates a tracer exporting to the OTLP/HTTP endpoint, e.g.
+// http://localhost:4318.
+func New(endpoint, service string) *Tracer {
+	return &Tracer{
+		endpoint: endpoint,
+		service:  service,
+		traceID:  randomID(16),
+	}
+}
+
+// Span is one traced operation.
+type Span struct {
+	t        *Tracer
+	id       string
+	parentID string
+	parent   *Span
+	name     string
+	kind     int
+	start    time.Time
+	end      time.Time
+	attrs    map[string]interface{}
+	err      error
+}
+
+type spanKey struct{}
+
+// ContextWithSpan returns a context carrying the span, which will be the
+// parent of spans started for requests made with the context.
+func ContextWithSpan(ctx context.Context, s *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, s)
+}
+
+func spanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// Start starts a span, as a child of the current span. The new span becomes
+// the current span until it ends.
+func (t *Tracer) Start(name string) *Span {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.newSpan(name, spanKindInternal, t.current)
+	t.current = s
+	return s
+}
+
+func (t *Tracer) newSpan(name string, kind int, parent *Span) *Span {
+	s := &Span{
+		t:      t,
+		id:     randomID(8),
+		parent: parent,
+		name:   name,
+		kind:   kind,
+		start:  time.Now(),
+		attrs:  make(map[string]interface{}),
+	}
+	if parent != nil {
+		s.parentID = parent.id
+	}
+	return s
+}
+
+// SetAttribute sets an attribute on the span. v should be a string, bool, int
+// or float64.
+func (s *Span) SetAttribute(k string, v interface{}) {
+	if s == nil {
+		return
+	}
+	s.t.mu.Lock()
+	s.attrs[k] = v
+	s.t.mu.Unlock()
+}
+
+// SetError marks the span as failed.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.t.mu.Lock()
+	s.err = err
+	s.t.mu.Unlock()
+}
+
+// End ends the span. If the span is the current span, its parent becomes the
+// current span.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	t := s.t
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s.end = time.Now()
+	t.ended = append(t.ended, s)
+	if t.current == s {
+		t.current = s.parent
+	}
+}
+
+func randomID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
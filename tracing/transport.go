@@ -0,0 +1,68 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package tracing
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// Client returns a copy of hc with a transport that traces every request. If
+// hc is nil, a new client with the default transport is returned.
+func (t *Tracer) Client(hc *http.Client) *http.Client {
+	if t == nil {
+		return hc
+	}
+	var ret http.Client
+	if hc != nil {
+		ret = *hc
+	}
+	base := ret.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	ret.Transport = &transport{t: t, base: base}
+	return &ret
+}
+
+type transport struct {
+	t    *Tracer
+	base http.RoundTripper
+}
+
+func (tr *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t := tr.t
+	parent := spanFromContext(req.Context())
+	t.mu.Lock()
+	if parent == nil {
+		parent = t.current
+	}
+	s := t.newSpan(fmt.Sprintf("%v %v", req.Method, req.URL.Path), spanKindClient, parent)
+	t.mu.Unlock()
+	s.SetAttribute("http.method", req.Method)
+	s.SetAttribute("http.url", req.URL.String())
+
+	resp, err := tr.base.RoundTrip(req)
+	if err != nil {
+		s.SetError(err)
+		s.End()
+		return nil, err
+	}
+	s.SetAttribute("http.status_code", resp.StatusCode)
+	for attr, header := range map[string]string{
+		"github.ratelimit.limit":     "X-RateLimit-Limit",
+		"github.ratelimit.remaining": "X-RateLimit-Remaining",
+		"github.ratelimit.reset":     "X-RateLimit-Reset",
+	} {
+		if v, err := strconv.Atoi(resp.Header.Get(header)); err == nil {
+			s.SetAttribute(attr, v)
+		}
+	}
+	if resp.StatusCode >= 400 {
+		s.SetError(fmt.Errorf("%v", resp.Status))
+	}
+	s.End()
+	return resp, nil
+}
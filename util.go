@@ -4,14 +4,28 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"net/url"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/blang/semver"
 	"github.com/google/go-github/github"
+	"github.com/sniperkit/snk.fork.release-git-bot/audit"
+	"github.com/sniperkit/snk.fork.release-git-bot/cache"
+	"github.com/sniperkit/snk.fork.release-git-bot/config"
+	"github.com/sniperkit/snk.fork.release-git-bot/features"
 	"github.com/sniperkit/snk.fork.release-git-bot/ghclient"
+	"github.com/sniperkit/snk.fork.release-git-bot/gitwrapper"
 	"github.com/sniperkit/snk.fork.release-git-bot/notes"
+	"github.com/sniperkit/snk.fork.release-git-bot/policy"
+	"github.com/sniperkit/snk.fork.release-git-bot/state"
+	"github.com/sniperkit/snk.fork.release-git-bot/verify"
+	"github.com/sniperkit/snk.fork.release-git-bot/version"
+	survey "gopkg.in/AlecAivazis/survey.v1"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -25,9 +39,215 @@ func commaStringToSet(s string) map[string]struct{} {
 	return ret
 }
 
-func releaseNote(c *ghclient.Client, ver semver.Version) string {
-	milestone := fmt.Sprintf("%v.%v Release", ver.Major, ver.Minor)
+// newThanksFilter returns the filter for special thanks: grpc org members and
+// users in urwelcome are excluded, unless they are in verymuch.
+func newThanksFilter(c *ghclient.Client) func(pr *github.Issue) bool {
+	urwelcomeMap := commaStringToSet(*urwelcome)
+	verymuchMap := commaStringToSet(*verymuch)
+	grpcMembers, err := c.GetOrgMembersContext(runCtx, "grpc")
+	if err != nil {
+		log.Fatalf("failed to get org members for special thanks: %v", err)
+	}
+	return func(pr *github.Issue) bool {
+		user := pr.GetUser().GetLogin()
+		_, isGRPCMember := grpcMembers[user]
+		_, isWelcome := urwelcomeMap[user]
+		_, isVerymuch := verymuchMap[user]
+		return *thanks && (isVerymuch || (!isGRPCMember && !isWelcome))
+	}
+}
 
+// versionReplacer replaces "{version}", "{line}", "{major}" and "{minor}"
+// with the version numbers. "{major}" and "{minor}" are the first two parts of
+// the version.
+func versionReplacer(ver *version.Version) *strings.Replacer {
+	r := []string{
+		"{version}", ver.String(),
+		"{line}", ver.Line(),
+		"{major}", fmt.Sprint(ver.Parts[0]),
+	}
+	if len(ver.Parts) > 1 {
+		r = append(r, "{minor}", fmt.Sprint(ver.Parts[1]))
+	}
+	return strings.NewReplacer(r...)
+}
+
+// milestoneAliases returns the -milestone candidates, with "{major}" and
+// "{minor}" replaced by the version numbers.
+func milestoneAliases(ver *version.Version) []string {
+	if *milestoneFlag == "" {
+		return nil
+	}
+	r := versionReplacer(ver)
+	var ret []string
+	for _, m := range strings.Split(*milestoneFlag, ",") {
+		ret = append(ret, r.Replace(strings.TrimSpace(m)))
+	}
+	return ret
+}
+
+// mergedPRs returns the merged PRs of the release, from its milestone, or with
+// -prsfrom tags, from the commits since the previous release tag.
+func mergedPRs(c *ghclient.Client, ver *version.Version) ([]*github.Issue, error) {
+	switch *prsFrom {
+	case "milestone":
+		return c.GetMergedPRsForMilestoneContext(runCtx, ver.Milestone(), milestoneAliases(ver)...)
+	case "tags":
+		prev := previousTag(c, ver)
+		if prev == "" {
+			return nil, fmt.Errorf("no release before %v to list the PRs since, use -prsfrom milestone", ver.Tag())
+		}
+		return c.GetMergedPRsBetweenTagsContext(runCtx, prev, ver.Branch())
+	case "search":
+		q, err := prSearchQuery(c, ver)
+		if err != nil {
+			return nil, err
+		}
+		return c.SearchMergedPRsContext(runCtx, q)
+	}
+	return nil, fmt.Errorf("invalid -prsfrom %q, want milestone, tags or search", *prsFrom)
+}
+
+// prSearchQuery returns the search of the merged PRs of ver with -prsfrom
+// search: the PRs merged into the mainline between the previous release and
+// the branch cut, or for a patch release, into the release branch since the
+// previous patch, filtered by the pr_search of the config.
+func prSearchQuery(c *ghclient.Client, ver *version.Version) (ghclient.PRSearch, error) {
+	var q ghclient.PRSearch
+	ps := prSearch
+	if ps == nil {
+		ps = &config.PRSearch{}
+	}
+	prev := previousTag(c, ver)
+	patch := false
+	if p, err := version.ParseTag(versionScheme, prev); prev != "" && err == nil {
+		patch = p.Line() == ver.Line()
+	}
+	mainline := mainlineBranch(mainlineConfig, ver)
+	q.Base = ps.Base
+	if q.Base == "" {
+		q.Base = mainline
+		if patch {
+			q.Base = ver.Branch()
+		}
+	}
+	if ps.Since != "" {
+		since, err := parseTime(ps.Since)
+		if err != nil {
+			return q, fmt.Errorf("invalid pr_search since %q: %v", ps.Since, err)
+		}
+		q.MergedAfter = since
+	} else if prev != "" {
+		since, err := c.GetCommitTimeContext(runCtx, prev)
+		if err != nil {
+			return q, fmt.Errorf("failed to get the time of %v: %v", prev, err)
+		}
+		// The PRs merged with the previous release commit are in it.
+		q.MergedAfter = since.Add(time.Second)
+	}
+	if ps.Until != "" {
+		until, err := parseTime(ps.Until)
+		if err != nil {
+			return q, fmt.Errorf("invalid pr_search until %q: %v", ps.Until, err)
+		}
+		q.MergedBefore = until.Add(time.Second)
+	} else {
+		until, err := releaseWindowEnd(c, ver, mainline, patch)
+		if err != nil {
+			return q, err
+		}
+		if !until.IsZero() {
+			// The PRs merged with the last commit are in the release.
+			q.MergedBefore = until.Add(time.Second)
+		}
+	}
+	q.Labels, q.ExcludeLabels = ps.Labels, ps.ExcludeLabels
+	q.Authors, q.ExcludeAuthors = ps.Authors, ps.ExcludeAuthors
+	q.Query = ps.Query
+	return q, nil
+}
+
+// releaseWindowEnd returns the time of the last commit of the release: the
+// head of the release branch for a patch release, or the branch cut, i.e. the
+// merge base of the mainline and the release branch. It's zero if the release
+// branch isn't cut yet.
+func releaseWindowEnd(c *ghclient.Client, ver *version.Version, mainline string, patch bool) (time.Time, error) {
+	ref := ver.Branch()
+	if !patch {
+		cmp, err := c.CompareCommitsContext(runCtx, mainline, ver.Branch())
+		if err != nil {
+			log.Warningf("failed to find the branch cut of %v, not bounding the PR search: %v", ver.Branch(), err)
+			return time.Time{}, nil
+		}
+		ref = cmp.MergeBase
+	}
+	t, err := c.GetCommitTimeContext(runCtx, ref)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get the time of %v: %v", ref, err)
+	}
+	return t, nil
+}
+
+// previousTag returns the tag of the release before ver, i.e. the latest
+// release tag (pre-releases excluded) lower than ver. Tags are sorted by the
+// version scheme. If the tags can't be listed, or none is lower, it falls back
+// to ver.Previous(). It returns "" if there's no release before ver, e.g. for
+// the first release.
+func previousTag(c *ghclient.Client, ver *version.Version) string {
+	guess := func() string {
+		if p := ver.Previous(); p != nil {
+			return p.Tag()
+		}
+		return ""
+	}
+	tags, err := c.ListTagsContext(runCtx)
+	if err != nil {
+		log.Warningf("failed to list tags, guessing the previous release: %v", err)
+		return guess()
+	}
+	prev := version.Latest(version.ParseTags(ver.Scheme(), tags), func(v *version.Version) bool {
+		return !v.IsPrerelease() && v.Compare(ver) < 0
+	})
+	if prev == nil {
+		log.Warningf("no release tag before %v, guessing the previous release", ver.Tag())
+		return guess()
+	}
+	return prev.Tag()
+}
+
+// compareURL returns the "Full Changelog" link from the previous release to
+// ver with the diff statistics, or "" and nil if the previous release tag is
+// not an ancestor of the release branch, so the link would not resolve. The
+// tag of ver only exists once the release is published, so the branch is
+// compared instead.
+func compareURL(c *ghclient.Client, ver *version.Version) (string, *notes.Stats) {
+	prev := previousTag(c, ver)
+	if prev == "" {
+		return "", nil
+	}
+	cmp, err := c.CompareCommitsContext(runCtx, prev, ver.Branch())
+	if err != nil {
+		log.Warningf("no full changelog link, failed to compare %v with %v: %v", prev, ver.Branch(), err)
+		return "", nil
+	}
+	// "ahead" means the branch has commits after the tag, and none before it.
+	if cmp.Status != "ahead" && cmp.Status != "identical" {
+		log.Warningf("no full changelog link, %v is not an ancestor of %v", prev, ver.Branch())
+		return "", nil
+	}
+	stats := &notes.Stats{
+		Commits:      cmp.Commits,
+		FilesChanged: cmp.FilesChanged,
+		Additions:    cmp.Additions,
+		Deletions:    cmp.Deletions,
+		Truncated:    cmp.Truncated,
+	}
+	return fmt.Sprintf("https://%v/%v/%v/compare/%v...%v", githubHost(), c.Owner(), c.Repo(), prev, ver.Tag()), stats
+}
+
+// releaseNote returns the notes for the release, and the merged PRs they are
+// generated from.
+func releaseNote(c *ghclient.Client, ver *version.Version) (*notes.Notes, []*github.Issue) {
 	var (
 		prs          []*github.Issue
 		thanksFilter func(pr *github.Issue) bool
@@ -37,31 +257,557 @@ func releaseNote(c *ghclient.Client, ver semver.Version) string {
 
 	wg.Add(1)
 	go func() {
-		prs = c.GetMergedPRsForMilestone(milestone)
-		wg.Done()
+		defer wg.Done()
+		var err error
+		prs, err = mergedPRs(c, ver)
+		if err != nil {
+			log.Fatalf("failed to get merged PRs: %v", err)
+		}
 	}()
 	if *thanks {
 		wg.Add(1)
 		go func() {
-			urwelcomeMap := commaStringToSet(*urwelcome)
-			verymuchMap := commaStringToSet(*verymuch)
-			grpcMembers := c.GetOrgMembers("grpc")
-			thanksFilter = func(pr *github.Issue) bool {
-				user := pr.GetUser().GetLogin()
-				_, isGRPCMember := grpcMembers[user]
-				_, isWelcome := urwelcomeMap[user]
-				_, isVerymuch := verymuchMap[user]
-				return *thanks && (isVerymuch || (!isGRPCMember && !isWelcome))
-			}
+			thanksFilter = newThanksFilter(c)
 			wg.Done()
 		}()
 	}
 	wg.Wait()
 
-	ns := notes.GenerateNotes(c.Owner(), c.Repo(), "v"+ver.String(), prs, notes.Filters{
+	ns := notes.GenerateNotes(c.Owner(), c.Repo(), ver.Tag(), prs, notes.Filters{
 		SpecialThanks: thanksFilter,
+		Ignored:       loadIgnoreList().Reasons(),
+		Embargoed:     embargoFilter(),
+		Collapse:      *collapse,
+		Paths:         prPaths(c),
+		Classifier:    classifier,
+		Top:           *topChanges,
+	})
+	// The tag doesn't exist until the release is published.
+	ns.Date = releaseDate(c, ver.Tag(), ver.Branch())
+	ns.CompareURL, ns.Stats = compareURL(c, ver)
+	if *authors {
+		userCache, err := cache.New("", stateKey)
+		if err != nil {
+			log.Warningf("failed to create cache, users won't be cached: %v", err)
+		}
+		resolveAuthors(c, userCache, ns)
+	}
+
+	log.Infof("generated notes for %v/%v/%v", c.Owner(), c.Repo(), ver.Tag())
+	return ns, prs
+}
+
+// addNotesRepos adds the notes of the notes_repos in the config to ns, from
+// their merged PRs for the release (see mergedPRs).
+func addNotesRepos(cfg *config.Config, ns *notes.Notes, ver *version.Version) {
+	for _, r := range cfg.NotesRepos {
+		parts := strings.Split(r, "/")
+		if len(parts) != 2 {
+			log.Fatalf("invalid notes repo %q, want owner/repo", r)
+		}
+		c := newClient(parts[0], parts[1])
+		prs, err := mergedPRs(c, ver)
+		if err != nil {
+			log.Fatalf("failed to get merged PRs of %v: %v", r, err)
+		}
+		var thanksFilter func(pr *github.Issue) bool
+		if *thanks {
+			thanksFilter = newThanksFilter(c)
+		}
+		rns := notes.GenerateNotes(c.Owner(), c.Repo(), ver.Tag(), prs, notes.Filters{
+			SpecialThanks: thanksFilter,
+			Embargoed:     embargoFilter(),
+			Collapse:      *collapse,
+			Paths:         prPaths(c),
+			Classifier:    classifier,
+		})
+		if *authors {
+			userCache, err := cache.New("", stateKey)
+			if err != nil {
+				log.Warningf("failed to create cache, users won't be cached: %v", err)
+			}
+			resolveAuthors(c, userCache, rns)
+		}
+		ns.AddRepo(rns)
+		log.Infof("added notes of %v/%v/%v", c.Owner(), c.Repo(), ver.Tag())
+	}
+}
+
+// prPaths returns the Paths filter listing the files changed by the PRs, nil
+// if the notes are not collapsed and no classification rule needs them.
+func prPaths(c *ghclient.Client) func(pr *github.Issue) []string {
+	if !*collapse && !classifier.NeedsPaths() {
+		return nil
+	}
+	return func(pr *github.Issue) []string {
+		paths, err := c.ListPRFilesContext(runCtx, pr.GetNumber())
+		if err != nil {
+			log.Warningf("failed to list the files of PR #%v, it's classified by label only: %v", pr.GetNumber(), err)
+		}
+		return paths
+	}
+}
+
+// releaseDate returns the date of the notes, in the release timezone: now, or
+// with -deterministic the time of the commit of the first ref that exists.
+func releaseDate(c *ghclient.Client, refs ...string) time.Time {
+	if !*deterministic {
+		return botClock.Now().In(releaseZone)
+	}
+	for _, ref := range refs {
+		if t, err := c.GetCommitTimeContext(runCtx, ref); err == nil {
+			return t.In(releaseZone)
+		}
+	}
+	log.Warningf("none of %v exists, the notes are not dated", refs)
+	return time.Time{}
+}
+
+// draftPR returns whether the pull requests of the kind are opened as drafts.
+func draftPR(cfg *config.Config, kind string) bool {
+	for _, k := range cfg.DraftPRs {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// prOptions returns the options of the pull request of the kind, changing the
+// version to v.
+func prOptions(cfg *config.Config, kind string, v *version.Version) *ghclient.PullRequestOptions {
+	opt := &ghclient.PullRequestOptions{Draft: draftPR(cfg, kind)}
+	p := cfg.PullRequests
+	if p == nil {
+		return opt
+	}
+	r := versionReplacer(v)
+	opt.Reviewers = p.Reviewers
+	opt.TeamReviewers = p.TeamReviewers
+	opt.Assignees = p.Assignees
+	for _, l := range p.Labels {
+		opt.Labels = append(opt.Labels, r.Replace(l))
+	}
+	if p.Milestone {
+		opt.Milestones = append([]string{v.Milestone()}, milestoneAliases(v)...)
+	}
+	return opt
+}
+
+// prNumber returns the number of the pull request, given as a number or url.
+func prNumber(pr string) (int, error) {
+	n, err := strconv.Atoi(pr[strings.LastIndex(pr, "/")+1:])
+	if err != nil {
+		return 0, fmt.Errorf("invalid PR %q, want a number or url", pr)
+	}
+	return n, nil
+}
+
+// markReady marks the draft pull request at the url (or number) as ready for
+// review.
+func markReady(upstream *ghclient.Client, pr string) error {
+	n, err := prNumber(pr)
+	if err != nil {
+		return err
+	}
+	if err := upstream.MarkReadyForReviewContext(runCtx, n); err != nil {
+		return fmt.Errorf("failed to mark PR %v ready for review: %v", pr, err)
+	}
+	return nil
+}
+
+// updatePR updates the branch of the pull request at the url (or number) with
+// its base branch, if the base has moved.
+func updatePR(upstream *ghclient.Client, pr string) error {
+	n, err := prNumber(pr)
+	if err != nil {
+		return err
+	}
+	updated, err := upstream.UpdatePullRequestBranchContext(runCtx, n)
+	if err != nil {
+		return err
+	}
+	if updated {
+		fmt.Println("Updated with its base branch: ", pr)
+	}
+	return nil
+}
+
+// mergePollInterval is how often mergeWhenReady checks the checks and the
+// reviews.
+const mergePollInterval = time.Minute
+
+// versionPRMergeMethod returns the method the version pull requests are merged
+// with by the bot, -merge or "merge" with the auto_merge feature, or "" if a
+// human merges them.
+func versionPRMergeMethod() string {
+	if *mergeMethod == "" && featureFlags.Enabled(features.AutoMerge) {
+		return "merge"
+	}
+	return *mergeMethod
+}
+
+// mergeWhenReady waits until the checks of the pull request at the url (or
+// number) are green and it meets the requirements of its base branch, and
+// merges it. With -automerge, github's auto-merge is enabled first, so the
+// pull request is merged even if the bot stops. If the bot is interrupted
+// while waiting, it exits with the instructions to resume at step.
+func mergeWhenReady(upstream *ghclient.Client, st *state.State, step, pr, method string) {
+	n, err := prNumber(pr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *autoMerge {
+		if err := upstream.EnableAutoMergeContext(runCtx, n, method); err != nil {
+			log.Warningf("%v, the bot merges it instead", err)
+		} else {
+			fmt.Println("Auto-merge enabled: ", pr)
+		}
+	}
+	ctx, cancel := context.WithCancel(runCtx)
+	defer cancel()
+	go func() {
+		select {
+		case <-interruptCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	err = upstream.WaitAndMergeContext(ctx, n, method, &ghclient.MergeWait{
+		Interval: mergePollInterval,
+		Clock:    botClock,
+		Waiting: func(missing []string) {
+			fmt.Printf("Waiting for %v: %v\n", pr, strings.Join(missing, ", "))
+		},
+	})
+	if atomic.LoadInt32(&interrupted) != 0 {
+		exitForResume(st, step)
+	}
+	if err != nil {
+		log.Fatalf("failed to merge %v: %v", pr, err)
+	}
+	fmt.Println("Merged: ", pr)
+}
+
+// waitForChecks waits for the checks on the commit at ref to pass, up to
+// -waitchecks.
+func waitForChecks(upstream *ghclient.Client, ref string) {
+	fmt.Printf("Waiting for the checks on %v...\n", ref)
+	s, err := upstream.WaitForChecksContext(runCtx, ref, *waitChecks)
+	if err != nil {
+		log.Fatalf("not releasing %v: %v", ref, err)
+	}
+	fmt.Printf("%v checks passed on %v\n", s.Checks, ref)
+}
+
+// checkReleaseGoMod checks the go.mod at ref with verify.GoMod, and stops the
+// release if a check fails. Repos without go.mod are not checked.
+func checkReleaseGoMod(upstream *ghclient.Client, ref string) {
+	gomod, err := upstream.GetFileContentContext(runCtx, "go.mod", ref)
+	if err != nil {
+		log.Infof("not checking go.mod at %v: %v", ref, err)
+		return
+	}
+	var failed []string
+	for _, c := range verify.GoMod(nil, "", gomod) {
+		switch {
+		case c.Skipped:
+			log.Warningf("%v: skipped, %v", c.Name, c.Detail)
+		case !c.Passed:
+			failed = append(failed, fmt.Sprintf("%v: %v", c.Name, c.Detail))
+		}
+	}
+	if len(failed) > 0 {
+		log.Fatalf("not releasing %v, its go.mod would break the consumers of the tag (-checkgomod=false to skip):\n  %v", ref, strings.Join(failed, "\n  "))
+	}
+	fmt.Printf("go.mod at %v checked\n", ref)
+}
+
+// tagReleaseBranch tags the head of the release branch with the release tag,
+// per -tagkind, with the message for annotated tags.
+func tagReleaseBranch(upstream *ghclient.Client, ver *version.Version, branch, message string) {
+	if *tagKind != "lightweight" && *tagKind != "annotated" {
+		log.Fatalf("invalid -tagkind %q, want lightweight or annotated", *tagKind)
+	}
+	if _, ok := embargoTime(); ok {
+		log.Fatal("an embargoed release can't be tagged before the disclosure, tags are public")
+	}
+	sha, err := upstream.GetCommitSHAContext(runCtx, branch)
+	if err != nil {
+		log.Fatalf("failed to get the head of %v: %v", branch, err)
+	}
+	if err := upstream.CreateTagContext(runCtx, ver.Tag(), sha, message, *tagKind == "annotated"); err != nil {
+		log.Fatalf("failed to tag %v: %v", ver.Tag(), err)
+	}
+	fmt.Printf("Tagged %v at %v\n", ver.Tag(), sha)
+}
+
+// defaultBranches caches defaultBranch, by owner/repo.
+var defaultBranches sync.Map
+
+// defaultBranch returns the default branch of owner/repo, e.g. "main". It
+// falls back to master if it can't be detected.
+func defaultBranch(owner, repo string) string {
+	if b, ok := defaultBranches.Load(owner + "/" + repo); ok {
+		return b.(string)
+	}
+	b, err := newClient(owner, repo).DefaultBranchContext(runCtx)
+	if err != nil {
+		log.Warningf("failed to get the default branch of %v/%v, assuming master (see -defaultbranch): %v", owner, repo, err)
+		return "master"
+	}
+	defaultBranches.Store(owner+"/"+repo, b)
+	return b
+}
+
+// forkOf returns the owner and name of the fork of the user to push the
+// version changes to, -fork if it's set.
+func forkOf(login string) (owner, name string) {
+	if *fork == "" {
+		return login, *repo
+	}
+	parts := strings.SplitN(*fork, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		log.Fatalf("invalid -fork %q, want owner/repo", *fork)
+	}
+	return parts[0], parts[1]
+}
+
+// pushToFork pushes the local change to the fork login/repo if the policy
+// allows it, and records it in the audit log.
+func pushToFork(local *gitwrapper.Repo, login, repo, branch string) error {
+	err := policyEngine.Check(&policy.Operation{Kind: policy.Push, Repo: login + "/" + repo, Target: branch})
+	var auth *gitwrapper.AuthConfig
+	if err == nil {
+		auth, err = gitAuth(login)
+	}
+	if err == nil {
+		err = local.Publish(&gitwrapper.PublicConfig{
+			RemoteName: "",
+			Auth:       auth,
+		})
+	}
+	e := &audit.Entry{
+		Method:   "GIT",
+		Endpoint: fmt.Sprintf("push https://%v/%v/%v %v", githubHost(), login, repo, branch),
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	if aerr := auditLog.Record(e); aerr != nil {
+		log.Warning(aerr)
+	}
+	return err
+}
+
+// gitAuth returns the credentials to push as login: the installation token if
+// the bot is a GitHub App, or -token. It fails with -readonly.
+func gitAuth(login string) (*gitwrapper.AuthConfig, error) {
+	if *readOnly {
+		return nil, fmt.Errorf("no git credentials: %v", ghclient.ErrReadOnly)
+	}
+	if appTransport == nil {
+		return &gitwrapper.AuthConfig{Username: login, Password: *token}, nil
+	}
+	t, err := appTransport.Token()
+	if err != nil {
+		return nil, err
+	}
+	return &gitwrapper.AuthConfig{Username: "x-access-token", Password: t}, nil
+}
+
+// approveOperation asks the user to approve the operation required by the
+// policy.
+func approveOperation(op *policy.Operation) bool {
+	approved := false
+	survey.AskOne(&survey.Confirm{Message: fmt.Sprintf("Policy requires approval to %v. Approve?", op)}, &approved, nil)
+	return approved
+}
+
+var commentAuditOnce sync.Once
+
+// commentAuditSummary comments the summary of the audit log and the pipeline
+// diagram on the tracking issue, once.
+func commentAuditSummary(upstream *ghclient.Client, cfg *config.Config, st *state.State) {
+	commentAuditOnce.Do(func() {
+		if auditLog == nil {
+			log.Warning("-audit is empty, not commenting on the tracking issue")
+			return
+		}
+		body := auditLog.Summary()
+		if d, err := pipelineDiagram(releasePipeline(cfg), st, "mermaid"); err == nil {
+			body += "\nRelease progress:\n\n```mermaid\n" + d + "```\n"
+		}
+		if ver, err := versionScheme.Parse(st.Version); err == nil {
+			if ignored := loadIgnoreList().ForRelease(ver.Tag()); len(ignored) > 0 {
+				body += "\nPRs removed from the notes:\n\n"
+				for _, p := range ignored {
+					body += fmt.Sprintf(" * #%v: %v\n", p.PR, p.Reason)
+				}
+			}
+		}
+		url, err := upstream.CreateIssueCommentContext(runCtx, *trackingIssue, body)
+		if err != nil {
+			log.Warningf("failed to comment on the tracking issue: %v", err)
+			return
+		}
+		fmt.Println("Changes summarized on the tracking issue: ", url)
 	})
+}
 
-	log.Infof("generated notes for %v/%v/%v", c.Owner(), c.Repo(), "v"+ver.String())
-	return ns.ToMarkdown()
+// apiHeaders returns the github API headers for the config. The API version is
+// pinned to ghclient.DefaultAPIVersion if it's not configured.
+func apiHeaders(c *config.API) *ghclient.Headers {
+	h := &ghclient.Headers{Version: ghclient.DefaultAPIVersion}
+	if c != nil {
+		if c.Version != "" {
+			h.Version = c.Version
+		}
+		h.Previews = c.Previews
+	}
+	return h
+}
+
+// apiBreaker returns the circuit breaker of the api config, nil if it's
+// disabled.
+func apiBreaker(c *config.API) (*ghclient.Breaker, error) {
+	b := &ghclient.Breaker{
+		Clock: botClock,
+		OnOpen: func(d time.Duration, err error) {
+			log.Warningf("github is failing (%v), pausing the API requests for %v", err, d.Round(time.Second))
+		},
+		OnClose: func() { log.Warning("github is back, resuming the API requests") },
+	}
+	if c == nil || c.Breaker == nil {
+		return b, nil
+	}
+	if c.Breaker.Disabled {
+		return nil, nil
+	}
+	b.Threshold = c.Breaker.Threshold
+	var err error
+	if c.Breaker.Cooldown != "" {
+		if b.Cooldown, err = time.ParseDuration(c.Breaker.Cooldown); err != nil {
+			return nil, fmt.Errorf("invalid breaker cooldown: %v", err)
+		}
+	}
+	if c.Breaker.MaxCooldown != "" {
+		if b.MaxCooldown, err = time.ParseDuration(c.Breaker.MaxCooldown); err != nil {
+			return nil, fmt.Errorf("invalid breaker max_cooldown: %v", err)
+		}
+	}
+	return b, nil
+}
+
+// newETagCache returns the cache of the API responses, in the user cache dir.
+// The responses are private, so they are scoped to the credentials.
+func newETagCache() *ghclient.ETagCache {
+	c, err := cache.New("", stateKey)
+	if err != nil {
+		log.Warningf("failed to create cache, the API responses are cached in memory: %v", err)
+	}
+	e := &ghclient.ETagCache{Scope: fmt.Sprintf("%v/%v/%v", *token, *appID, *installation)}
+	if c != nil {
+		e.Store = c
+	}
+	return e
+}
+
+// apiRetry returns the retries of the api config, nil if they're disabled.
+func apiRetry(c *config.API) (*ghclient.Retry, error) {
+	r := &ghclient.Retry{
+		Clock: botClock,
+		OnRetry: func(attempt int, d time.Duration, err error) {
+			log.Warningf("github request failed (%v), retry %v in %v", err, attempt, d.Round(time.Millisecond))
+		},
+	}
+	if c == nil || c.Retry == nil {
+		return r, nil
+	}
+	if c.Retry.Disabled {
+		return nil, nil
+	}
+	r.Attempts = c.Retry.Attempts
+	var err error
+	if c.Retry.Base != "" {
+		if r.Base, err = time.ParseDuration(c.Retry.Base); err != nil {
+			return nil, fmt.Errorf("invalid retry base: %v", err)
+		}
+	}
+	if c.Retry.Max != "" {
+		if r.Max, err = time.ParseDuration(c.Retry.Max); err != nil {
+			return nil, fmt.Errorf("invalid retry max: %v", err)
+		}
+	}
+	return r, nil
+}
+
+// apiRateLimiter returns the rate limiter of the api config, logging its
+// waits.
+func apiRateLimiter(c *config.API) (*ghclient.RateLimiter, error) {
+	var maxWait time.Duration
+	l := &ghclient.RateLimiter{Clock: botClock}
+	if c != nil && c.RateLimit != nil {
+		l.Reserve = c.RateLimit.Reserve
+		if c.RateLimit.MaxWait != "" {
+			var err error
+			if maxWait, err = time.ParseDuration(c.RateLimit.MaxWait); err != nil {
+				return nil, fmt.Errorf("invalid rate_limit max_wait: %v", err)
+			}
+		}
+	}
+	l.OnWait = func(w *ghclient.RateLimitWait) error {
+		d := w.Until.Sub(botClock.Now()).Round(time.Second)
+		if maxWait > 0 && d > maxWait {
+			return fmt.Errorf("github rate limit exceeded, it resets in %v", d)
+		}
+		if w.Secondary {
+			log.Warningf("github secondary rate limit hit, waiting %v", d)
+		} else {
+			log.Warningf("%v of %v github %v requests left, waiting %v for the reset", w.Rate.Remaining, w.Rate.Limit, w.Rate.Resource, d)
+		}
+		return nil
+	}
+	return l, nil
+}
+
+// newClient returns the github client of the repo, on the GitHub Enterprise
+// Server in the api config if there's one.
+func newClient(owner, repo string) *ghclient.Client {
+	c := ghclient.New(transportClient, owner, repo)
+	if apiConfig != nil && apiConfig.BaseURL != "" {
+		var err error
+		c, err = ghclient.NewEnterprise(transportClient, apiConfig.BaseURL, apiConfig.UploadURL, owner, repo)
+		if err != nil {
+			log.Fatalf("invalid api config: %v", err)
+		}
+	}
+	c.SetRetry(apiRetryPolicy)
+	c.SetClock(botClock)
+	if *defaultBranchFlag != "" && isUpstream(c) {
+		c.SetDefaultBranch(*defaultBranchFlag)
+	}
+	if apiConfig != nil {
+		c.UseGraphQL(apiConfig.GraphQL)
+		c.SetConcurrency(apiConfig.Concurrency)
+	}
+	return c
+}
+
+// isUpstream returns whether c is the client of -repo.
+func isUpstream(c *ghclient.Client) bool {
+	return c.Owner() == upstreamUser && c.Repo() == *repo
+}
+
+// githubHost returns the host to clone and push the repos, the host of the
+// GitHub Enterprise Server if there's one.
+func githubHost() string {
+	if apiConfig == nil || apiConfig.BaseURL == "" {
+		return "github.com"
+	}
+	u, err := url.Parse(apiConfig.BaseURL)
+	if err != nil {
+		log.Fatalf("invalid api config: %v", err)
+	}
+	return u.Host
 }
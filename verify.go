@@ -0,0 +1,173 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/sniperkit/snk.fork.release-git-bot/config"
+	"github.com/sniperkit/snk.fork.release-git-bot/ghclient"
+	"github.com/sniperkit/snk.fork.release-git-bot/verify"
+	"golang.org/x/crypto/openpgp"
+)
+
+// passphraseEnv is the env var of the signing key passphrase.
+const passphraseEnv = "RELEASE_BOT_KEY_PASSPHRASE"
+
+func runVerify(cfg *config.Config, args []string) error {
+	fs := newFlagSet("verify")
+	commit := fs.String("commit", "", "the commit the tag is expected to point to. If not specified, the tag must be on the release branch")
+	module := fs.String("module", "", "the go module path. If not specified, it's read from go.mod at the tag. Use \"-\" to skip the module check")
+	proxy := fs.String("proxy", verify.DefaultProxy, "the go module proxy")
+	keyring := fs.String("keyring", "", "armored public keyring to verify asset signatures")
+	signingKey := fs.String("signingkey", "", "armored private key to sign the report with. Its passphrase is read from $RELEASE_BOT_KEY_PASSPHRASE")
+	out := fs.String("out", "", "the report file, default to verify_<tag>.json")
+	fs.Parse(args)
+
+	ver, err := versionScheme.Parse(*newVersion)
+	if err != nil {
+		return fmt.Errorf("invalid version string %q: %v", *newVersion, err)
+	}
+	tag := ver.Tag()
+	upstream := newClient(upstreamUser, *repo)
+	release, err := upstream.GetReleaseByTagContext(runCtx, tag)
+	if err != nil {
+		return fmt.Errorf("failed to get release %v: %v", tag, err)
+	}
+
+	report := &verify.Report{
+		Repo: upstream.Owner() + "/" + upstream.Repo(),
+		Tag:  tag,
+		Time: botClock.Now().UTC(),
+	}
+
+	/* Tag */
+	report.Commit, err = upstream.GetCommitSHAContext(runCtx, tag)
+	if err != nil {
+		return fmt.Errorf("failed to get commit for tag %v: %v", tag, err)
+	}
+	report.Add(tagCheck(upstream, report.Commit, *commit, release.GetTargetCommitish()))
+
+	/* Assets */
+	var keys openpgp.EntityList
+	if *keyring != "" {
+		if keys, err = readKeyring(*keyring); err != nil {
+			return err
+		}
+	}
+	var assets []*verify.Asset
+	for _, a := range release.Assets {
+		assets = append(assets, &verify.Asset{Name: a.GetName(), URL: a.GetBrowserDownloadURL()})
+	}
+	v := &verify.Verifier{HTTPClient: transportClient, Keyring: keys}
+	report.Add(v.Assets(assets)...)
+
+	/* Module */
+	if *module != "-" {
+		modulePath := *module
+		if modulePath == "" {
+			gomod, err := upstream.GetFileContentContext(runCtx, "go.mod", tag)
+			if err != nil {
+				return fmt.Errorf("failed to get go.mod at %v, use -module to specify the module: %v", tag, err)
+			}
+			modulePath = verify.ModulePath(gomod)
+			report.Add(verify.GoMod(nil, *proxy, gomod)...)
+		}
+		report.Add(verify.Module(nil, *proxy, modulePath, tag))
+	}
+
+	/* Report */
+	b, err := report.JSON()
+	if err != nil {
+		return err
+	}
+	reportFile := *out
+	if reportFile == "" {
+		reportFile = fmt.Sprintf("verify_%v.json", tag)
+	}
+	if err := ioutil.WriteFile(reportFile, b, 0644); err != nil {
+		return fmt.Errorf("failed to write report: %v", err)
+	}
+	if *signingKey != "" {
+		signer, err := readSigningKey(*signingKey)
+		if err != nil {
+			return err
+		}
+		sig, err := verify.Sign(b, signer)
+		if err != nil {
+			return fmt.Errorf("failed to sign report: %v", err)
+		}
+		if err := ioutil.WriteFile(reportFile+".asc", sig, 0644); err != nil {
+			return fmt.Errorf("failed to write report signature: %v", err)
+		}
+	}
+
+	for _, c := range report.Checks {
+		status := "PASS"
+		if c.Skipped {
+			status = "SKIP"
+		} else if !c.Passed {
+			status = "FAIL"
+		}
+		fmt.Printf("[%v] %v %v\n", status, c.Name, c.Detail)
+	}
+	fmt.Printf("Report written to %v\n", reportFile)
+	if !report.Success {
+		return fmt.Errorf("release %v failed verification", tag)
+	}
+	return nil
+}
+
+func tagCheck(upstream *ghclient.Client, tagCommit, wantCommit, branch string) *verify.Check {
+	c := &verify.Check{Name: "tag commit"}
+	if wantCommit != "" {
+		c.Passed = tagCommit == wantCommit
+		if !c.Passed {
+			c.Detail = fmt.Sprintf("tag points to %v, want %v", tagCommit, wantCommit)
+		}
+		return c
+	}
+	ok, err := upstream.IsAncestorContext(runCtx, tagCommit, branch)
+	if err != nil {
+		c.Detail = err.Error()
+		return c
+	}
+	c.Passed = ok
+	if !ok {
+		c.Detail = fmt.Sprintf("tag commit %v is not on branch %v", tagCommit, branch)
+	}
+	return c
+}
+
+func readKeyring(path string) (openpgp.EntityList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open keyring: %v", err)
+	}
+	defer f.Close()
+	keys, err := openpgp.ReadArmoredKeyRing(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keyring %v: %v", path, err)
+	}
+	return keys, nil
+}
+
+func readSigningKey(path string) (*openpgp.Entity, error) {
+	keys, err := readKeyring(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 || keys[0].PrivateKey == nil {
+		return nil, fmt.Errorf("no private key found in %v", path)
+	}
+	signer := keys[0]
+	if signer.PrivateKey.Encrypted {
+		if err := signer.PrivateKey.Decrypt([]byte(os.Getenv(passphraseEnv))); err != nil {
+			return nil, fmt.Errorf("failed to decrypt signing key: %v", err)
+		}
+	}
+	return signer, nil
+}
@@ -0,0 +1,299 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package verify
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/blang/semver"
+)
+
+// GoMod checks the content of a go.mod file before its module is tagged. The
+// tag is fetched by the module's consumers as is, so it must not have:
+//
+//   - replace directives to local paths, which only resolve in the repo;
+//   - requires of modules of the same repo at pseudo-versions, which tie the
+//     release to untagged commits;
+//   - requires of versions retracted by their module, looked up on the module
+//     proxy.
+//
+// If hc is nil, it's http.DefaultClient; if proxy is empty, it's
+// DefaultProxy.
+func GoMod(hc *http.Client, proxy string, gomod []byte) []*Check {
+	f := parseGoMod(gomod)
+	replaces := &Check{Name: "go.mod has no local replace", Passed: true}
+	var local []string
+	for _, r := range f.replaces {
+		if isLocalPath(r.New.Path) {
+			local = append(local, fmt.Sprintf("%v => %v", r.Old.Path, r.New.Path))
+		}
+	}
+	if len(local) > 0 {
+		replaces.Passed = false
+		replaces.Detail = strings.Join(local, ", ")
+	}
+
+	self := &Check{Name: "go.mod requires no pseudo-version of the repo", Passed: true}
+	var pseudo []string
+	root := stripMajor(f.module)
+	for _, r := range f.requires {
+		sameRepo := r.Path == root || strings.HasPrefix(r.Path, root+"/") || strings.HasPrefix(root, r.Path+"/")
+		if sameRepo && isPseudoVersion(r.Version) {
+			pseudo = append(pseudo, r.String())
+		}
+	}
+	if len(pseudo) > 0 {
+		self.Passed = false
+		self.Detail = strings.Join(pseudo, ", ")
+	}
+
+	return []*Check{replaces, self, retracted(hc, proxy, f.requires)}
+}
+
+// retracted checks that none of the required versions is retracted by the
+// latest version of its module.
+func retracted(hc *http.Client, proxy string, requires []modVersion) *Check {
+	c := &Check{Name: "go.mod requires no retracted version", Passed: true}
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	if proxy == "" {
+		proxy = DefaultProxy
+	}
+	proxy = strings.TrimSuffix(proxy, "/")
+	var found, failed []string
+	for _, r := range requires {
+		intervals, err := retractions(hc, proxy, r.Path)
+		if err != nil {
+			failed = append(failed, r.Path)
+			continue
+		}
+		for _, in := range intervals {
+			if in.contains(r.Version) {
+				found = append(found, r.String())
+				break
+			}
+		}
+	}
+	switch {
+	case len(found) > 0:
+		c.Passed = false
+		c.Detail = strings.Join(found, ", ")
+	case len(failed) > 0:
+		// Private modules are not on the proxy.
+		c.Passed, c.Skipped = false, true
+		c.Detail = "can't look up " + strings.Join(failed, ", ")
+	}
+	return c
+}
+
+// retractions returns the retract directives of the latest version of the
+// module.
+func retractions(hc *http.Client, proxy, module string) ([]*interval, error) {
+	var latest struct {
+		Version string
+	}
+	if err := proxyGet(hc, fmt.Sprintf("%v/%v/@latest", proxy, escapePath(module)), func(b []byte) error {
+		return json.Unmarshal(b, &latest)
+	}); err != nil {
+		return nil, err
+	}
+	var ret []*interval
+	err := proxyGet(hc, fmt.Sprintf("%v/%v/@v/%v.mod", proxy, escapePath(module), escapePath(latest.Version)), func(b []byte) error {
+		ret = parseGoMod(b).retracts
+		return nil
+	})
+	return ret, err
+}
+
+func proxyGet(hc *http.Client, url string, decode func([]byte) error) error {
+	resp, err := hc.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%v: %v", url, resp.Status)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return decode(b)
+}
+
+// modVersion is a module at a version, e.g. in a require directive.
+type modVersion struct {
+	Path, Version string
+}
+
+func (m modVersion) String() string {
+	if m.Version == "" {
+		return m.Path
+	}
+	return m.Path + "@" + m.Version
+}
+
+type replace struct {
+	Old, New modVersion
+}
+
+// interval is a retracted version, or range of versions.
+type interval struct {
+	Low, High string
+}
+
+func (in *interval) contains(v string) bool {
+	sv, err := parseSemver(v)
+	if err != nil {
+		return false
+	}
+	low, err := parseSemver(in.Low)
+	if err != nil {
+		return false
+	}
+	high, err := parseSemver(in.High)
+	if err != nil {
+		return false
+	}
+	return sv.GTE(low) && sv.LTE(high)
+}
+
+// parseSemver parses a module version, e.g. "v1.2.3" or
+// "v2.0.0+incompatible".
+func parseSemver(v string) (semver.Version, error) {
+	return semver.Parse(strings.TrimPrefix(v, "v"))
+}
+
+// goModFile is the directives of a go.mod file the checks need.
+type goModFile struct {
+	module   string
+	requires []modVersion
+	replaces []*replace
+	retracts []*interval
+}
+
+// parseGoMod parses the directives of the go.mod content, single line or in
+// blocks. Unknown directives and malformed lines are ignored.
+func parseGoMod(gomod []byte) *goModFile {
+	f := &goModFile{}
+	var block string
+	for _, line := range strings.Split(string(gomod), "\n") {
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		verb := block
+		switch {
+		case block != "" && fields[0] == ")":
+			block = ""
+			continue
+		case block == "" && len(fields) == 2 && fields[1] == "(":
+			block = fields[0]
+			continue
+		case block == "":
+			verb, fields = fields[0], fields[1:]
+		}
+		for i := range fields {
+			fields[i] = strings.Trim(fields[i], `"`)
+		}
+		switch verb {
+		case "module":
+			if len(fields) == 1 {
+				f.module = fields[0]
+			}
+		case "require":
+			if len(fields) == 2 {
+				f.requires = append(f.requires, modVersion{fields[0], fields[1]})
+			}
+		case "replace":
+			f.addReplace(fields)
+		case "retract":
+			f.addRetract(fields)
+		}
+	}
+	return f
+}
+
+// addReplace adds the replace directive "old [v] => new [v]".
+func (f *goModFile) addReplace(fields []string) {
+	for i, s := range fields {
+		if s != "=>" {
+			continue
+		}
+		from, to := fields[:i], fields[i+1:]
+		if len(from) < 1 || len(from) > 2 || len(to) < 1 || len(to) > 2 {
+			return
+		}
+		r := &replace{Old: modVersion{Path: from[0]}, New: modVersion{Path: to[0]}}
+		if len(from) == 2 {
+			r.Old.Version = from[1]
+		}
+		if len(to) == 2 {
+			r.New.Version = to[1]
+		}
+		f.replaces = append(f.replaces, r)
+		return
+	}
+}
+
+// addRetract adds the retract directive of a version, "v1.0.0", or a range,
+// "[v1.0.0, v1.1.0]".
+func (f *goModFile) addRetract(fields []string) {
+	s := strings.Join(fields, " ")
+	if !strings.HasPrefix(s, "[") {
+		if len(fields) == 1 {
+			f.retracts = append(f.retracts, &interval{Low: s, High: s})
+		}
+		return
+	}
+	bounds := strings.Split(strings.Trim(s, "[]"), ",")
+	if len(bounds) != 2 {
+		return
+	}
+	f.retracts = append(f.retracts, &interval{Low: strings.TrimSpace(bounds[0]), High: strings.TrimSpace(bounds[1])})
+}
+
+// isLocalPath returns whether the replacement is a local path, as opposed to
+// a module path.
+func isLocalPath(p string) bool {
+	return strings.HasPrefix(p, "./") || strings.HasPrefix(p, "../") || path.IsAbs(p) ||
+		p == "." || p == ".." || (len(p) > 2 && p[1] == ':' && (p[2] == '\\' || p[2] == '/'))
+}
+
+// pseudoVersionRE matches the pseudo-versions of untagged commits, e.g.
+// v0.0.0-20180724155351-3d292e4d0cdc.
+var pseudoVersionRE = regexp.MustCompile(`^v[0-9]+\.(0\.0-|\d+\.\d+-([^+]*\.)?0\.)\d{14}-[A-Za-z0-9]+(\+[0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*)?$`)
+
+func isPseudoVersion(v string) bool {
+	return pseudoVersionRE.MatchString(v)
+}
+
+// majorSuffixRE matches the major version suffix of a module path, e.g. /v2.
+var majorSuffixRE = regexp.MustCompile(`/v[0-9]+$`)
+
+// stripMajor returns the module path without its major version suffix.
+func stripMajor(module string) string {
+	return majorSuffixRE.ReplaceAllString(module, "")
+}
+
+// Retracted returns whether the go.mod content retracts the version, e.g.
+// "v1.14.1".
+func Retracted(gomod []byte, version string) bool {
+	for _, in := range parseGoMod(gomod).retracts {
+		if in.Low == version || in.High == version || in.contains(version) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package verify
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+)
+
+// DefaultProxy is the module proxy used if none is given.
+const DefaultProxy = "https://proxy.golang.org"
+
+// Module checks that version of module can be fetched from the module proxy.
+func Module(hc *http.Client, proxy, module, version string) *Check {
+	c := &Check{Name: fmt.Sprintf("module %v@%v", module, version)}
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	if proxy == "" {
+		proxy = DefaultProxy
+	}
+	url := fmt.Sprintf("%v/%v/@v/%v.info", strings.TrimSuffix(proxy, "/"), escapePath(module), escapePath(version))
+	resp, err := hc.Get(url)
+	if err != nil {
+		c.Detail = err.Error()
+		return c
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		c.Detail = fmt.Sprintf("%v: %v", url, resp.Status)
+		return c
+	}
+	c.Passed = true
+	return c
+}
+
+// ModulePath returns the module path declared in the content of a go.mod
+// file, or "" if there's none.
+func ModulePath(gomod []byte) string {
+	for _, line := range strings.Split(string(gomod), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], `"`)
+		}
+	}
+	return ""
+}
+
+// escapePath escapes upper case letters as required by the module proxy
+// protocol, e.g. "Azure" becomes "!azure".
+func escapePath(p string) string {
+	var b strings.Builder
+	for _, r := range p {
+		if unicode.IsUpper(r) {
+			b.WriteByte('!')
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
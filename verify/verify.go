@@ -0,0 +1,244 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+// Package verify checks the artifacts of a published release, and produces a
+// verification report.
+package verify
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+// Check is the result of one verification.
+type Check struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	// Skipped is true if the check couldn't be done, e.g. no checksum file was
+	// published. A skipped check is not a failure.
+	Skipped bool   `json:"skipped,omitempty"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+// Report is the verification report of a release.
+type Report struct {
+	Repo    string    `json:"repo"`
+	Tag     string    `json:"tag"`
+	Commit  string    `json:"commit"`
+	Time    time.Time `json:"time"`
+	Checks  []*Check  `json:"checks"`
+	Success bool      `json:"success"`
+}
+
+// Add adds checks to the report, and updates Success.
+func (r *Report) Add(checks ...*Check) {
+	for _, c := range checks {
+		r.Checks = append(r.Checks, c)
+	}
+	r.Success = true
+	for _, c := range r.Checks {
+		if !c.Passed && !c.Skipped {
+			r.Success = false
+		}
+	}
+}
+
+// JSON returns the indented json encoding of the report.
+func (r *Report) JSON() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+// Sign returns the armored detached signature of the json report.
+func Sign(report []byte, signer *openpgp.Entity) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&buf, signer, bytes.NewReader(report), nil); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Asset is a release asset to be verified.
+type Asset struct {
+	Name string
+	URL  string
+}
+
+// Verifier downloads and verifies the release assets.
+type Verifier struct {
+	// HTTPClient is used to download the assets. If nil, http.DefaultClient is
+	// used.
+	HTTPClient *http.Client
+	// Keyring contains the public keys to verify the asset signatures. If nil,
+	// the signature checks are skipped.
+	Keyring openpgp.EntityList
+}
+
+// checksumFiles are the names (case insensitive) of the published checksum
+// files.
+var checksumFiles = []string{"sha256sums.txt", "sha256sums", "checksums.txt"}
+
+// Assets downloads all the assets, and checks them against the published
+// checksum file and signatures.
+//
+// An asset "x" is signed if there's a "x.sig" (binary) or "x.asc" (armored)
+// asset.
+func (v *Verifier) Assets(assets []*Asset) []*Check {
+	contents := make(map[string][]byte)
+	var checks []*Check
+	for _, a := range assets {
+		b, err := v.download(a.URL)
+		if err != nil {
+			checks = append(checks, &Check{Name: "download " + a.Name, Detail: err.Error()})
+			continue
+		}
+		contents[a.Name] = b
+	}
+
+	var sums map[string]string
+	for name, b := range contents {
+		for _, cf := range checksumFiles {
+			if strings.EqualFold(name, cf) {
+				sums = parseChecksums(b)
+			}
+		}
+	}
+
+	for _, a := range assets {
+		b, ok := contents[a.Name]
+		if !ok || isChecksumOrSignature(a.Name) {
+			continue
+		}
+		checks = append(checks, checksumCheck(a.Name, b, sums))
+		checks = append(checks, v.signatureCheck(a.Name, b, contents))
+	}
+	return checks
+}
+
+// Asset downloads the asset name of the assets, and checks it against the
+// published checksum file and its signature like Assets. It returns the
+// content of the asset with the checks.
+func (v *Verifier) Asset(name string, assets []*Asset) ([]byte, []*Check, error) {
+	contents := make(map[string][]byte)
+	var sums map[string]string
+	for _, a := range assets {
+		checksums := false
+		for _, cf := range checksumFiles {
+			checksums = checksums || strings.EqualFold(a.Name, cf)
+		}
+		if !checksums && a.Name != name && a.Name != name+".sig" && a.Name != name+".asc" {
+			continue
+		}
+		b, err := v.download(a.URL)
+		if err != nil {
+			return nil, nil, err
+		}
+		contents[a.Name] = b
+		if checksums {
+			sums = parseChecksums(b)
+		}
+	}
+	b, ok := contents[name]
+	if !ok {
+		return nil, nil, fmt.Errorf("no asset %v", name)
+	}
+	return b, []*Check{checksumCheck(name, b, sums), v.signatureCheck(name, b, contents)}, nil
+}
+
+func (v *Verifier) download(url string) ([]byte, error) {
+	hc := v.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %v: %v", url, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+func isChecksumOrSignature(name string) bool {
+	for _, cf := range checksumFiles {
+		if strings.EqualFold(name, cf) {
+			return true
+		}
+	}
+	return strings.HasSuffix(name, ".sig") || strings.HasSuffix(name, ".asc")
+}
+
+// parseChecksums parses the output of sha256sum, "<hex>  <name>" per line.
+func parseChecksums(b []byte) map[string]string {
+	ret := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		// sha256sum prefixes the name with "*" in binary mode.
+		ret[strings.TrimPrefix(fields[1], "*")] = strings.ToLower(fields[0])
+	}
+	return ret
+}
+
+func checksumCheck(name string, b []byte, sums map[string]string) *Check {
+	c := &Check{Name: "checksum " + name}
+	if sums == nil {
+		c.Skipped = true
+		c.Detail = "no checksum file published"
+		return c
+	}
+	want, ok := sums[name]
+	if !ok {
+		c.Detail = "asset not in checksum file"
+		return c
+	}
+	sum := sha256.Sum256(b)
+	if got := hex.EncodeToString(sum[:]); got != want {
+		c.Detail = fmt.Sprintf("got %v, want %v", got, want)
+		return c
+	}
+	c.Passed = true
+	return c
+}
+
+func (v *Verifier) signatureCheck(name string, b []byte, contents map[string][]byte) *Check {
+	c := &Check{Name: "signature " + name}
+	if v.Keyring == nil {
+		c.Skipped = true
+		c.Detail = "no keyring given"
+		return c
+	}
+	var (
+		signer *openpgp.Entity
+		err    error
+	)
+	if sig, ok := contents[name+".asc"]; ok {
+		signer, err = openpgp.CheckArmoredDetachedSignature(v.Keyring, bytes.NewReader(b), bytes.NewReader(sig))
+	} else if sig, ok := contents[name+".sig"]; ok {
+		signer, err = openpgp.CheckDetachedSignature(v.Keyring, bytes.NewReader(b), bytes.NewReader(sig))
+	} else {
+		c.Detail = "no signature published"
+		return c
+	}
+	if err != nil {
+		c.Detail = err.Error()
+		return c
+	}
+	c.Passed = true
+	c.Detail = fmt.Sprintf("signed by key %X", signer.PrimaryKey.Fingerprint)
+	return c
+}
@@ -0,0 +1,232 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package version
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/blang/semver"
+)
+
+// numeric is a scheme of dot separated numbers with an optional pre-release.
+// All the builtin schemes are numeric, they only differ in the parts.
+type numeric struct {
+	name string
+	// re matches the versions. Unnamed groups are the parts, group "pre" is
+	// the pre-release.
+	re *regexp.Regexp
+	// check is an optional stricter validation before re.
+	check func(s string) error
+	// parts is the number of parts, line is the number of leading parts in
+	// the release line.
+	parts, line int
+	// pad is the zero padded width of each part, nil for no padding.
+	pad []int
+	// month is the index of the month part (1 to 12) that rolls over to the
+	// part before it, -1 if there's none.
+	month int
+	// format is the custom format, see config.VersionScheme.Format.
+	format string
+
+	branch, milestone string
+}
+
+func newSemver() *numeric {
+	return &numeric{
+		name: "semver",
+		re:   regexp.MustCompile(`^(\d+)\.(\d+)\.(\d+)(?:-(?P<pre>[^+]+))?(?:\+.*)?$`),
+		check: func(s string) error {
+			_, err := semver.Make(s)
+			return err
+		},
+		parts:     3,
+		line:      2,
+		month:     -1,
+		branch:    "v{line}.x",
+		milestone: "{line} Release",
+	}
+}
+
+func newCalver() *numeric {
+	return &numeric{
+		name:      "calver",
+		re:        regexp.MustCompile(`^(\d{4})\.(0[1-9]|1[0-2])\.(\d+)(?:-(?P<pre>.+))?$`),
+		parts:     3,
+		line:      2,
+		pad:       []int{4, 2, 0},
+		month:     1,
+		branch:    "v{line}.x",
+		milestone: "{line} Release",
+	}
+}
+
+func newFourPart() *numeric {
+	return &numeric{
+		name:      "fourpart",
+		re:        regexp.MustCompile(`^(\d+)\.(\d+)\.(\d+)\.(\d+)(?:-(?P<pre>.+))?$`),
+		parts:     4,
+		line:      3,
+		month:     -1,
+		branch:    "v{line}.x",
+		milestone: "{line} Release",
+	}
+}
+
+func newRegex(pattern, format string) (*numeric, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("version scheme regex has no pattern")
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile version pattern: %v", err)
+	}
+	var parts int
+	for _, name := range re.SubexpNames()[1:] {
+		if name == "" {
+			parts++
+		}
+	}
+	if parts == 0 {
+		return nil, fmt.Errorf("version pattern %q has no group for the version parts", pattern)
+	}
+	line := parts - 1
+	if line == 0 {
+		line = 1
+	}
+	return &numeric{
+		name:      "regex",
+		re:        re,
+		parts:     parts,
+		line:      line,
+		month:     -1,
+		format:    format,
+		branch:    "v{line}.x",
+		milestone: "{line} Release",
+	}, nil
+}
+
+func (n *numeric) Name() string { return n.name }
+
+func (n *numeric) Parse(s string) (*Version, error) {
+	if n.check != nil {
+		if err := n.check(s); err != nil {
+			return nil, fmt.Errorf("invalid %v version %q: %v", n.name, s, err)
+		}
+	}
+	m := n.re.FindStringSubmatch(s)
+	if m == nil {
+		return nil, fmt.Errorf("invalid %v version %q: doesn't match %v", n.name, s, n.re)
+	}
+	v := &Version{scheme: n}
+	for i, name := range n.re.SubexpNames()[1:] {
+		if name == "pre" {
+			v.Pre = m[i+1]
+			continue
+		}
+		if name != "" {
+			continue
+		}
+		p, err := strconv.Atoi(m[i+1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid %v version %q: part %q is not a number", n.name, s, m[i+1])
+		}
+		v.Parts = append(v.Parts, p)
+	}
+	return v, nil
+}
+
+func (n *numeric) part(v *Version, i int) string {
+	if i < len(n.pad) && n.pad[i] > 0 {
+		return fmt.Sprintf("%0*d", n.pad[i], v.Parts[i])
+	}
+	return strconv.Itoa(v.Parts[i])
+}
+
+func (n *numeric) join(v *Version, parts int) string {
+	var ss []string
+	for i := 0; i < parts; i++ {
+		ss = append(ss, n.part(v, i))
+	}
+	return strings.Join(ss, ".")
+}
+
+func (n *numeric) Format(v *Version) string {
+	var pre string
+	if v.Pre != "" {
+		pre = "-" + v.Pre
+	}
+	if n.format == "" {
+		return n.join(v, n.parts) + pre
+	}
+	r := []string{"{pre}", pre}
+	for i := range v.Parts {
+		r = append(r, fmt.Sprintf("{%v}", i), n.part(v, i))
+	}
+	return strings.NewReplacer(r...).Replace(n.format)
+}
+
+func (n *numeric) Line(v *Version) string { return n.join(v, n.line) }
+
+func (n *numeric) Branch(v *Version) string {
+	return strings.Replace(n.branch, "{line}", n.Line(v), -1)
+}
+
+func (n *numeric) Milestone(v *Version) string {
+	return strings.Replace(n.milestone, "{line}", n.Line(v), -1)
+}
+
+// bump returns a release version (no pre-release) with part i incremented by
+// delta, and the parts after i reset.
+func (n *numeric) bump(v *Version, i, delta int) *Version {
+	ret := &Version{Parts: append([]int(nil), v.Parts...), scheme: n}
+	ret.Parts[i] += delta
+	if i == n.month && i > 0 {
+		switch {
+		case ret.Parts[i] > 12:
+			ret.Parts[i] = 1
+			ret.Parts[i-1]++
+		case ret.Parts[i] < 1:
+			ret.Parts[i] = 12
+			ret.Parts[i-1]--
+		}
+	}
+	for j := i + 1; j < len(ret.Parts); j++ {
+		ret.Parts[j] = 0
+	}
+	return ret
+}
+
+func (n *numeric) NextPatch(v *Version) *Version {
+	return n.bump(v, n.parts-1, 1)
+}
+
+func (n *numeric) NextLine(v *Version) *Version {
+	return n.bump(v, n.line-1, 1)
+}
+
+func (n *numeric) Previous(v *Version) *Version {
+	if last := n.parts - 1; last >= n.line && v.Parts[last] > 0 {
+		return n.bump(v, last, -1)
+	}
+	i := n.line - 1
+	if v.Parts[i] > 0 {
+		return n.bump(v, i, -1)
+	}
+	return nil
+}
+
+func (n *numeric) Compare(a, b *Version) int {
+	for i := 0; i < len(a.Parts) && i < len(b.Parts); i++ {
+		if c := compareInt(a.Parts[i], b.Parts[i]); c != 0 {
+			return c
+		}
+	}
+	if c := compareInt(len(a.Parts), len(b.Parts)); c != 0 {
+		return c
+	}
+	return comparePre(a.Pre, b.Pre)
+}
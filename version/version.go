@@ -0,0 +1,242 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+// Package version parses, bumps, names and sorts release versions for
+// different versioning schemes (semver, calver, 4-part versions, and custom
+// regexps).
+package version
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sniperkit/snk.fork.release-git-bot/config"
+)
+
+// Scheme is a versioning scheme.
+type Scheme interface {
+	// Name is the kind of the scheme, e.g. "semver".
+	Name() string
+	// Parse parses s, without the "v" prefix.
+	Parse(s string) (*Version, error)
+
+	// Format returns the string of v, without the "v" prefix.
+	Format(v *Version) string
+	// Line returns the release line of v, e.g. "1.14" for 1.14.2 with
+	// semver. Versions on the same line are released from the same branch.
+	Line(v *Version) string
+	// Branch returns the release branch name of v, e.g. v1.14.x.
+	Branch(v *Version) string
+	// Milestone returns the milestone title of v, e.g. "1.14 Release".
+	Milestone(v *Version) string
+
+	// NextPatch returns the next release on the line of v, e.g. 1.14.1 for
+	// 1.14.0.
+	NextPatch(v *Version) *Version
+	// NextLine returns the first release of the next line, e.g. 1.15.0 for
+	// 1.14.2.
+	NextLine(v *Version) *Version
+	// Previous guesses the release before v without looking at the tags: the
+	// previous patch release for patch releases, and the first release of the
+	// previous line otherwise. It returns nil if there's no lower version to
+	// guess, e.g. for 2.0.0.
+	Previous(v *Version) *Version
+
+	// Compare returns -1, 0 or 1 if a is lower than, equal to or higher than
+	// b.
+	Compare(a, b *Version) int
+}
+
+// Version is a version parsed by a Scheme.
+type Version struct {
+	// Parts are the numeric parts, e.g. [1 14 0] for 1.14.0.
+	Parts []int
+	// Pre is the pre-release without the "-", e.g. "rc.1".
+	Pre string
+
+	scheme Scheme
+}
+
+// Scheme returns the scheme v is parsed by.
+func (v *Version) Scheme() Scheme { return v.scheme }
+
+func (v *Version) String() string      { return v.scheme.Format(v) }
+func (v *Version) Line() string        { return v.scheme.Line(v) }
+func (v *Version) Branch() string      { return v.scheme.Branch(v) }
+func (v *Version) Milestone() string   { return v.scheme.Milestone(v) }
+func (v *Version) NextPatch() *Version { return v.scheme.NextPatch(v) }
+func (v *Version) NextLine() *Version  { return v.scheme.NextLine(v) }
+func (v *Version) Previous() *Version  { return v.scheme.Previous(v) }
+
+// Tag returns the git tag of v, e.g. v1.14.0.
+func (v *Version) Tag() string { return "v" + v.String() }
+
+// Compare returns -1, 0 or 1 if v is lower than, equal to or higher than o.
+func (v *Version) Compare(o *Version) int { return v.scheme.Compare(v, o) }
+
+// IsPrerelease returns whether v has a pre-release, e.g. 1.14.0-rc.1.
+func (v *Version) IsPrerelease() bool { return v.Pre != "" }
+
+// ParseTag parses a git tag, with or without the "v" prefix.
+func ParseTag(s Scheme, tag string) (*Version, error) {
+	return s.Parse(strings.TrimPrefix(tag, "v"))
+}
+
+// Sort sorts the versions from low to high. All versions must be parsed by
+// the same scheme.
+func Sort(vs []*Version) {
+	sort.SliceStable(vs, func(i, j int) bool {
+		return vs[i].scheme.Compare(vs[i], vs[j]) < 0
+	})
+}
+
+// ParseTags parses the git tags by the scheme, and returns the versions sorted
+// from low to high. Tags that are not versions of the scheme are skipped.
+func ParseTags(s Scheme, tags []string) []*Version {
+	var ret []*Version
+	for _, t := range tags {
+		v, err := ParseTag(s, t)
+		if err != nil {
+			continue
+		}
+		ret = append(ret, v)
+	}
+	Sort(ret)
+	return ret
+}
+
+// Latest returns the highest version in vs that keep returns true for, or nil
+// if there's none. A nil keep keeps all versions.
+func Latest(vs []*Version, keep func(v *Version) bool) *Version {
+	var ret *Version
+	for _, v := range vs {
+		if keep != nil && !keep(v) {
+			continue
+		}
+		if ret == nil || v.Compare(ret) > 0 {
+			ret = v
+		}
+	}
+	return ret
+}
+
+// New creates the Scheme for the config. It returns semver if c is nil.
+func New(c *config.VersionScheme) (Scheme, error) {
+	if c == nil {
+		c = &config.VersionScheme{}
+	}
+	var (
+		n   *numeric
+		err error
+	)
+	switch c.Kind {
+	case "", "semver":
+		n = newSemver()
+	case "calver":
+		n = newCalver()
+	case "fourpart":
+		n = newFourPart()
+	case "regex":
+		n, err = newRegex(c.Pattern, c.Format)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown version scheme %q", c.Kind)
+	}
+	if c.LineParts != 0 {
+		if c.LineParts < 1 || c.LineParts > n.parts {
+			return nil, fmt.Errorf("line_parts %v is out of range, version scheme %q has %v parts", c.LineParts, n.name, n.parts)
+		}
+		n.line = c.LineParts
+	}
+	if c.Branch != "" {
+		n.branch = c.Branch
+	}
+	if c.Milestone != "" {
+		n.milestone = c.Milestone
+	}
+	return n, nil
+}
+
+// comparePre compares pre-releases as in semver: a version without
+// pre-release is higher, dot separated identifiers are compared one by one,
+// numerically if both are numbers. Unlike semver, numbers in identifiers are
+// also compared numerically, so rc2 < rc10.
+func comparePre(a, b string) int {
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		return 1
+	case b == "":
+		return -1
+	}
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if c := compareIdent(as[i], bs[i]); c != 0 {
+			return c
+		}
+	}
+	return compareInt(len(as), len(bs))
+}
+
+func compareIdent(a, b string) int {
+	an, aErr := strconv.Atoi(a)
+	bn, bErr := strconv.Atoi(b)
+	switch {
+	case aErr == nil && bErr == nil:
+		return compareInt(an, bn)
+	case aErr == nil:
+		// Numeric identifiers are lower than alphanumeric ones.
+		return -1
+	case bErr == nil:
+		return 1
+	}
+	return compareNatural(a, b)
+}
+
+// compareNatural compares a and b by runs of digits and non-digits, digit runs
+// numerically.
+func compareNatural(a, b string) int {
+	for a != "" && b != "" {
+		ar, br := leadingRun(a), leadingRun(b)
+		a, b = a[len(ar):], b[len(br):]
+		an, aErr := strconv.Atoi(ar)
+		bn, bErr := strconv.Atoi(br)
+		var c int
+		if aErr == nil && bErr == nil {
+			c = compareInt(an, bn)
+		} else {
+			c = strings.Compare(ar, br)
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return compareInt(len(a), len(b))
+}
+
+// leadingRun returns the leading digits of s, or the leading non-digits if s
+// doesn't start with a digit.
+func leadingRun(s string) string {
+	isDigit := func(c byte) bool { return '0' <= c && c <= '9' }
+	d := isDigit(s[0])
+	i := 1
+	for i < len(s) && isDigit(s[i]) == d {
+		i++
+	}
+	return s[:i]
+}
+
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,126 @@
+// Sniperkit - 2018
+// Status: Analyzed
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/sniperkit/snk.fork.release-git-bot/audit"
+	"github.com/sniperkit/snk.fork.release-git-bot/config"
+	"github.com/sniperkit/snk.fork.release-git-bot/ghclient"
+	"github.com/sniperkit/snk.fork.release-git-bot/notify"
+	"github.com/sniperkit/snk.fork.release-git-bot/version"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// webhookTimeout is the timeout of each delivery attempt.
+const webhookTimeout = 30 * time.Second
+
+func runWebhooks(cfg *config.Config, args []string) error {
+	if len(args) == 0 || (args[0] != "schema" && args[0] != "send") {
+		return fmt.Errorf("usage: webhooks schema | webhooks send -version version")
+	}
+	if args[0] == "schema" {
+		fmt.Print(notify.Schema)
+		return nil
+	}
+	fs := newFlagSet("webhooks send")
+	fs.Parse(args[1:])
+	if len(cfg.Webhooks) == 0 {
+		return fmt.Errorf("no webhooks in the config")
+	}
+	ver, err := versionScheme.Parse(*newVersion)
+	if err != nil {
+		return fmt.Errorf("invalid -version %q: %v", *newVersion, err)
+	}
+	return notifyWebhooks(cfg.Webhooks, newClient(upstreamUser, *repo), ver)
+}
+
+// notifyWebhooks posts the published release to the webhooks. All are tried,
+// the error reports the failed ones.
+func notifyWebhooks(hooks []*config.Webhook, upstream *ghclient.Client, ver *version.Version) error {
+	p, err := releasePayload(upstream, ver)
+	if err != nil {
+		return err
+	}
+	return deliver(hooks, p)
+}
+
+// deliver posts the payload to the webhooks, and records the deliveries in the
+// audit log. All are tried, the error reports the failed ones.
+func deliver(hooks []*config.Webhook, p *notify.Payload) error {
+	if *readOnly {
+		return fmt.Errorf("not notifying the webhooks: %v", ghclient.ErrReadOnly)
+	}
+	p.Notes = string(redactor.Bytes([]byte(p.Notes)))
+	s := &notify.Sender{Client: &http.Client{Timeout: webhookTimeout}, Clock: botClock}
+	var failed int
+	for _, h := range hooks {
+		w := &notify.Webhook{URL: h.URL}
+		if h.SecretEnv != "" {
+			if w.Secret = os.Getenv(h.SecretEnv); w.Secret == "" {
+				log.Warningf("$%v is empty, the payload to %v is not signed", h.SecretEnv, h.URL)
+			}
+		}
+		err := s.Send(runCtx, w, p)
+		e := &audit.Entry{
+			Method:   http.MethodPost,
+			Endpoint: h.URL,
+			Payload:  fmt.Sprintf("%v %v delivery %v", p.Event, p.Tag, notify.DeliveryID(p)),
+		}
+		if err != nil {
+			e.Error = err.Error()
+			log.Errorf("failed to notify %v: %v", h.URL, err)
+			failed++
+		} else {
+			fmt.Println("Notified: ", h.URL)
+		}
+		if aerr := auditLog.Record(e); aerr != nil {
+			log.Warning(aerr)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%v of %v webhooks failed", failed, len(hooks))
+	}
+	return nil
+}
+
+// releasePayload returns the payload of the published release of ver.
+func releasePayload(upstream *ghclient.Client, ver *version.Version) (*notify.Payload, error) {
+	tag := ver.Tag()
+	release, err := upstream.GetReleaseByTagContext(runCtx, tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get release %v: %v", tag, err)
+	}
+	sha, err := upstream.GetCommitSHAContext(runCtx, tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit for tag %v: %v", tag, err)
+	}
+	p := &notify.Payload{
+		Schema:      notify.SchemaVersion,
+		Event:       notify.ReleasePublished,
+		Repo:        upstream.Owner() + "/" + upstream.Repo(),
+		Version:     ver.String(),
+		Tag:         tag,
+		Commit:      sha,
+		URL:         release.GetHTMLURL(),
+		Prerelease:  release.GetPrerelease(),
+		PublishedAt: release.GetPublishedAt().Time,
+		Notes:       release.GetBody(),
+		Assets:      []*notify.Asset{},
+	}
+	for _, a := range release.Assets {
+		p.Assets = append(p.Assets, &notify.Asset{
+			Name:        a.GetName(),
+			URL:         a.GetBrowserDownloadURL(),
+			Size:        a.GetSize(),
+			ContentType: a.GetContentType(),
+		})
+	}
+	return p, nil
+}